@@ -2,7 +2,6 @@ package config
 
 import (
 	_ "embed"
-	"fmt"
 	"os"
 	"strings"
 )
@@ -44,7 +43,3 @@ func GetLogLevel() LogLevel {
 func IsDebug() bool {
 	return os.Getenv("XUI_DEBUG") == "true"
 }
-
-func GetDBPath() string {
-	return fmt.Sprintf("/etc/%s/%s.db", GetName(), GetName())
-}
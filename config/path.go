@@ -0,0 +1,176 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// 路径配置项
+const (
+	PathDB         = "db"
+	PathBinDir     = "binDir"
+	PathXrayConfig = "xrayConfig"
+	PathLogDir     = "logDir"
+)
+
+// 路径的来源，优先级 flag > env > db > default
+const (
+	SourceFlag    = "flag"
+	SourceEnv     = "env"
+	SourceDB      = "db"
+	SourceDefault = "default"
+)
+
+type pathOption struct {
+	env string
+	// 数据库中的设置 key，为空表示不能在数据库中设置
+	settingKey string
+	def        func() string
+
+	flag    string
+	dbValue string
+}
+
+var pathOptions = map[string]*pathOption{
+	PathDB: {
+		env: "XUI_DB_PATH",
+		def: func() string {
+			return fmt.Sprintf("/etc/%s/%s.db", GetName(), GetName())
+		},
+	},
+	PathBinDir: {
+		env:        "XUI_BIN_DIR",
+		settingKey: "binDir",
+		def: func() string {
+			return "bin"
+		},
+	},
+	PathXrayConfig: {
+		env:        "XUI_XRAY_CONFIG",
+		settingKey: "xrayConfigPath",
+	},
+	PathLogDir: {
+		env:        "XUI_LOG_DIR",
+		settingKey: "logDir",
+		// 默认只输出到标准错误
+		def: func() string {
+			return ""
+		},
+	},
+}
+
+func init() {
+	// 默认值依赖 bin 目录的生效值，不能在 pathOptions 初始化时引用
+	pathOptions[PathXrayConfig].def = func() string {
+		return filepath.Join(GetBinDir(), "config.json")
+	}
+}
+
+// GetPathNames 返回所有路径配置项
+func GetPathNames() []string {
+	names := make([]string, 0, len(pathOptions))
+	for name := range pathOptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetPathEnv 返回路径对应的环境变量
+func GetPathEnv(name string) string {
+	return pathOptions[name].env
+}
+
+// GetPathSettingKeys 返回可以在数据库中设置的路径及其设置 key
+func GetPathSettingKeys() map[string]string {
+	keys := map[string]string{}
+	for name, option := range pathOptions {
+		if option.settingKey != "" {
+			keys[name] = option.settingKey
+		}
+	}
+	return keys
+}
+
+// SetPathFlag 设置命令行参数指定的路径，空值表示未指定
+func SetPathFlag(name string, value string) {
+	pathOptions[name].flag = value
+}
+
+// SetPathDBValue 设置数据库中保存的路径，空值表示未设置
+func SetPathDBValue(name string, value string) {
+	pathOptions[name].dbValue = value
+}
+
+// GetPath 返回路径的生效值及其来源
+func GetPath(name string) (string, string) {
+	option := pathOptions[name]
+	if option.flag != "" {
+		return option.flag, SourceFlag
+	}
+	if value := os.Getenv(option.env); value != "" {
+		return value, SourceEnv
+	}
+	if option.dbValue != "" {
+		return option.dbValue, SourceDB
+	}
+	return option.def(), SourceDefault
+}
+
+// relativeBase 解析非命令行参数指定的相对路径时使用的目录，为空时相对于当前工作目录
+var relativeBase string
+
+// SetRelativeBase 设置相对路径的基准目录。服务在程序所在目录运行，
+// 在其他目录执行的命令需要按程序所在目录解析默认的 bin 等相对路径
+func SetRelativeBase(dir string) {
+	relativeBase = dir
+}
+
+func getPath(name string) string {
+	value, source := GetPath(name)
+	if relativeBase != "" && source != SourceFlag && value != "" && !filepath.IsAbs(value) {
+		return filepath.Join(relativeBase, value)
+	}
+	return value
+}
+
+func GetDBPath() string {
+	return getPath(PathDB)
+}
+
+// GetKeyPath 敏感数据加密主密钥文件，与数据库分开保存，备份数据库不会泄露密钥
+func GetKeyPath() string {
+	return filepath.Join(filepath.Dir(GetDBPath()), GetName()+".key")
+}
+
+// GetControlSocketPath 面板控制 socket，命令行通过它通知运行中的面板
+func GetControlSocketPath() string {
+	return filepath.Join(filepath.Dir(GetDBPath()), GetName()+".sock")
+}
+
+// GetBinDir xray 程序和 geo 文件所在目录
+func GetBinDir() string {
+	return getPath(PathBinDir)
+}
+
+// GetXrayConfigPath 生成的 xray 配置文件
+func GetXrayConfigPath() string {
+	return getPath(PathXrayConfig)
+}
+
+// GetLogDir 面板日志目录，为空时只输出到标准错误
+func GetLogDir() string {
+	return getPath(PathLogDir)
+}
+
+// GetAcmeCacheDir ACME 账号密钥和签发的证书
+func GetAcmeCacheDir() string {
+	return filepath.Join(filepath.Dir(GetDBPath()), "acme")
+}
+
+// GetCertDir 证书库中的证书以文件方式提供给 xray 时写入的目录
+func GetCertDir() string {
+	return filepath.Join(filepath.Dir(GetDBPath()), "certs")
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"x-ui/config"
+	"x-ui/web/control"
+)
+
+const controlUsage = `Usage: x-ui control <command>
+
+Commands:
+    reload-xray        restart xray with the current config
+    reload-settings    reload settings and restart the web server
+    dump-status        show the status of the running panel
+    rotate-logs        rotate the panel log and the xray access and error logs
+`
+
+// notifyPanel 通过控制 socket 通知正在运行的面板，使命令行的修改立即生效
+func notifyPanel(command string) {
+	_, err := control.Call(config.GetControlSocketPath(), command)
+	if err == control.ErrNotRunning {
+		fmt.Println("panel is not running, changes will take effect when the panel starts")
+	} else if err != nil {
+		fmt.Printf("notify panel failed: %v, please restart panel manually\n", err)
+	} else {
+		fmt.Println("running panel notified:", command)
+	}
+}
+
+func runControlCmd(args []string) {
+	if len(args) < 1 {
+		fmt.Print(controlUsage)
+		return
+	}
+	command := args[0]
+	switch command {
+	case control.CmdReloadXray, control.CmdReloadSettings, control.CmdDumpStatus, control.CmdRotateLogs:
+	default:
+		fmt.Print(controlUsage)
+		return
+	}
+	msg, err := control.Call(config.GetControlSocketPath(), command)
+	if err != nil {
+		fmt.Println(command, "failed:", err)
+		os.Exit(1)
+	}
+	if msg.Obj != nil {
+		data, _ := json.MarshalIndent(msg.Obj, "", "  ")
+		fmt.Println(string(data))
+	}
+	fmt.Println(command, "success")
+}
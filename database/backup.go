@@ -0,0 +1,174 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+	"x-ui/util/seal"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// SchemaVersion 数据库结构版本，保存在 PRAGMA user_version 中，表结构有不兼容的变化时递增。
+// 恢复备份时拒绝比当前程序更新的版本
+const SchemaVersion = 1
+
+// 备份中必须存在的表
+var requiredTables = []string{"users", "inbounds", "settings"}
+
+func setSchemaVersion() error {
+	return db.Exec(fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion)).Error
+}
+
+func getSchemaVersion(conn *gorm.DB) (int, error) {
+	var version int
+	err := conn.Raw("PRAGMA user_version").Scan(&version).Error
+	return version, err
+}
+
+// Backup 使用 VACUUM INTO 在面板运行时生成一致的数据库副本，dest 不能已存在
+func Backup(dest string) error {
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	_, err := os.Stat(dest)
+	if err == nil {
+		return fmt.Errorf("backup file %v already exists", dest)
+	}
+	err = os.MkdirAll(filepath.Dir(dest), 0700)
+	if err != nil {
+		return err
+	}
+	err = db.Exec("VACUUM INTO ?", dest).Error
+	if err != nil {
+		os.Remove(dest)
+		return err
+	}
+	return os.Chmod(dest, 0600)
+}
+
+// BackupBytes 生成备份并返回其内容
+func BackupBytes() ([]byte, error) {
+	dir, err := os.MkdirTemp("", "x-ui-backup")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "x-ui.db")
+	err = Backup(dest)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(dest)
+}
+
+// ValidateBackup 检查备份文件完整、包含必要的表、结构版本不高于当前程序，且加密数据可以用当前密钥解密
+func ValidateBackup(path string) (version int, err error) {
+	_, err = os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	conn, err := gorm.Open(sqlite.Open("file:"+path+"?mode=ro"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		return 0, err
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return 0, err
+	}
+	defer sqlDB.Close()
+
+	var result string
+	err = conn.Raw("PRAGMA integrity_check").Scan(&result).Error
+	if err != nil {
+		return 0, fmt.Errorf("not a valid database: %v", err)
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("database integrity check failed: %v", result)
+	}
+	for _, table := range requiredTables {
+		if !hasColumn(conn, table, "id") {
+			return 0, fmt.Errorf("table %v not found, not a x-ui database", table)
+		}
+	}
+	version, err = getSchemaVersion(conn)
+	if err != nil {
+		return 0, err
+	}
+	if version > SchemaVersion {
+		return version, fmt.Errorf("backup schema version %v is newer than supported version %v, please upgrade x-ui first", version, SchemaVersion)
+	}
+	err = transformSecrets(conn, func(value string) (string, error) {
+		_, err := seal.Decrypt(value)
+		return value, err
+	})
+	if err != nil {
+		return version, fmt.Errorf("encrypted data can not be decrypted with current key: %v", err)
+	}
+	return version, nil
+}
+
+// Restore 校验备份后替换数据库文件，原数据库改名保留，返回保留的路径。
+// 面板需要重启后才会使用恢复的数据库
+func Restore(src string, dbPath string) (string, error) {
+	_, err := ValidateBackup(src)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Dir(dbPath)
+	tmp, err := os.CreateTemp(dir, ".restore-*.db")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	in, err := os.Open(src)
+	if err != nil {
+		tmp.Close()
+		return "", err
+	}
+	_, err = io.Copy(tmp, in)
+	in.Close()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err != nil {
+		return "", err
+	}
+	if closeErr != nil {
+		return "", closeErr
+	}
+	err = os.Chmod(tmp.Name(), 0600)
+	if err != nil {
+		return "", err
+	}
+
+	old := ""
+	_, err = os.Stat(dbPath)
+	if err == nil {
+		old = fmt.Sprintf("%s.%s.bak", dbPath, time.Now().Format("20060102-150405"))
+		for i := 1; ; i++ {
+			_, err = os.Stat(old)
+			if os.IsNotExist(err) {
+				break
+			}
+			old = fmt.Sprintf("%s.%s-%d.bak", dbPath, time.Now().Format("20060102-150405"), i)
+		}
+		err = os.Rename(dbPath, old)
+		if err != nil {
+			return "", err
+		}
+	}
+	err = os.Rename(tmp.Name(), dbPath)
+	if err != nil {
+		if old != "" {
+			os.Rename(old, dbPath)
+		}
+		return "", err
+	}
+	return old, nil
+}
@@ -9,6 +9,7 @@ import (
 	"path"
 	"x-ui/config"
 	"x-ui/database/model"
+	"x-ui/util/seal"
 )
 
 var db *gorm.DB
@@ -34,29 +35,71 @@ func initUser() error {
 }
 
 func initInbound() error {
-	// 首先自动迁移
-	err := db.AutoMigrate(&model.Inbound{})
-	if err != nil {
-		return err
-	}
-	
-	// 添加二次转发字段（如果不存在）
-	// 使用 IF NOT EXISTS 避免重复添加
-	err = db.Exec(`
-		ALTER TABLE inbounds 
-		ADD COLUMN IF NOT EXISTS secondary_forward_enable BOOLEAN DEFAULT FALSE,
-		ADD COLUMN IF NOT EXISTS secondary_forward_protocol VARCHAR(20) DEFAULT 'none',
-		ADD COLUMN IF NOT EXISTS secondary_forward_address VARCHAR(255) DEFAULT '',
-		ADD COLUMN IF NOT EXISTS secondary_forward_port INTEGER DEFAULT 0,
-		ADD COLUMN IF NOT EXISTS secondary_forward_username VARCHAR(255) DEFAULT '',
-		ADD COLUMN IF NOT EXISTS secondary_forward_password VARCHAR(255) DEFAULT '';
-	`).Error
-	
-	return err
+	// 二次转发字段由 AutoMigrate 自动补齐，sqlite 不支持 ADD COLUMN IF NOT EXISTS
+	return db.AutoMigrate(&model.Inbound{})
 }
 
 func initSetting() error {
-	return db.AutoMigrate(&model.Setting{})
+	return db.AutoMigrate(&model.Setting{}, &model.SettingVersion{}, &model.SettingChange{})
+}
+
+func initRoutingRule() error {
+	return db.AutoMigrate(&model.RoutingRule{})
+}
+
+func initStatusSample() error {
+	return db.AutoMigrate(&model.StatusSample{})
+}
+
+// initAlertRule 首次创建时添加默认告警规则
+func initAlertRule() error {
+	err := db.AutoMigrate(&model.AlertRule{}, &model.AlertEvent{})
+	if err != nil {
+		return err
+	}
+	var count int64
+	err = db.Model(&model.AlertRule{}).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	rules := []*model.AlertRule{
+		{Name: "CPU 使用率过高", Enable: true, Metric: model.AlertMetricCpu, Operator: ">", Threshold: 90, Hysteresis: 10, Duration: 300},
+		{Name: "磁盘空间不足", Enable: true, Metric: model.AlertMetricDisk, Operator: ">", Threshold: 85, Hysteresis: 5},
+		{Name: "xray 运行错误", Enable: true, Metric: model.AlertMetricXrayError, Operator: ">=", Threshold: 1, Duration: 60},
+		{Name: "入站流量即将用尽", Enable: true, Metric: model.AlertMetricInboundUsage, Operator: ">=", Threshold: 80, Hysteresis: 5},
+		{Name: "入站即将到期", Enable: true, Metric: model.AlertMetricInboundDays, Operator: "<=", Threshold: 3},
+	}
+	return db.Create(&rules).Error
+}
+
+func initNotifyChannel() error {
+	return db.AutoMigrate(&model.NotifyChannel{})
+}
+
+func initTgBinding() error {
+	return db.AutoMigrate(&model.TgBinding{})
+}
+
+func initTlsCert() error {
+	return db.AutoMigrate(&model.TlsCert{})
+}
+
+func initForwardPool() error {
+	return db.AutoMigrate(&model.ForwardPool{}, &model.ForwardPoolMember{})
+}
+
+// initSecret 加载主密钥，并加密升级前以明文保存的敏感数据
+func initSecret() error {
+	err := seal.LoadKeyFile(config.GetKeyPath())
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		return transformSecrets(tx, seal.Encrypt)
+	})
 }
 
 func InitDB(dbPath string) error {
@@ -94,10 +137,53 @@ func InitDB(dbPath string) error {
 	if err != nil {
 		return err
 	}
+	err = initRoutingRule()
+	if err != nil {
+		return err
+	}
+	err = initForwardPool()
+	if err != nil {
+		return err
+	}
+	err = initTlsCert()
+	if err != nil {
+		return err
+	}
+	err = initNotifyChannel()
+	if err != nil {
+		return err
+	}
+	err = initTgBinding()
+	if err != nil {
+		return err
+	}
+	err = initAlertRule()
+	if err != nil {
+		return err
+	}
+	err = initStatusSample()
+	if err != nil {
+		return err
+	}
+	err = initSecret()
+	if err != nil {
+		return err
+	}
+	err = setSchemaVersion()
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// OpenReadOnly 以只读方式打开数据库，不创建表、不迁移数据也不修改结构版本，用于诊断
+func OpenReadOnly(dbPath string) error {
+	var err error
+	db, err = gorm.Open(sqlite.Open("file:"+dbPath+"?mode=ro"), &gorm.Config{Logger: logger.Discard})
+	return err
+}
+
 func GetDB() *gorm.DB {
 	return db
 }
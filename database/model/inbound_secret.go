@@ -0,0 +1,141 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// inboundSecretField 入站 settings 中的凭据字段，list 为空时是 settings 的顶层字段，
+// 否则是 settings 中 list 数组各元素的字段
+type inboundSecretField struct {
+	list string
+	key  string
+}
+
+// inboundSecretFields 各协议 settings 中需要掩码的凭据
+var inboundSecretFields = map[Protocol][]inboundSecretField{
+	VMess:       {{"clients", "id"}},
+	VLESS:       {{"clients", "id"}},
+	Trojan:      {{"clients", "password"}},
+	Shadowsocks: {{"", "password"}, {"clients", "password"}},
+	Socks:       {{"accounts", "pass"}},
+	Http:        {{"accounts", "pass"}},
+	MTProto:     {{"users", "secret"}},
+}
+
+func parseInboundSettings(settings string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(settings)))
+	decoder.UseNumber()
+	err := decoder.Decode(&values)
+	return values, err
+}
+
+func marshalInboundSettings(values map[string]interface{}) (string, error) {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(values)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimRight(buf.Bytes(), "\n")), nil
+}
+
+// visitInboundSecrets 对 settings 中每个字符串类型的凭据调用 fn，path 为字段路径
+func visitInboundSecrets(protocol Protocol, values map[string]interface{}, fn func(obj map[string]interface{}, key string, path string)) {
+	for _, field := range inboundSecretFields[protocol] {
+		if field.list == "" {
+			if _, ok := values[field.key].(string); ok {
+				fn(values, field.key, "settings."+field.key)
+			}
+			continue
+		}
+		items, _ := values[field.list].([]interface{})
+		for i, item := range items {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if _, ok := obj[field.key].(string); ok {
+				// 有 email 时按 email 定位客户端，避免删除或调整顺序后恢复成其他客户端的凭据
+				if email, _ := obj["email"].(string); email != "" {
+					fn(obj, field.key, fmt.Sprintf("settings.%v[email=%v].%v", field.list, email, field.key))
+				} else {
+					fn(obj, field.key, fmt.Sprintf("settings.%v[%d].%v", field.list, i, field.key))
+				}
+			}
+		}
+	}
+}
+
+// MaskInboundSettings 将 settings 中的客户端 id、密码等凭据替换为掩码，无法解析时整体替换为掩码
+func MaskInboundSettings(protocol Protocol, settings string) string {
+	if _, ok := inboundSecretFields[protocol]; !ok || settings == "" {
+		return settings
+	}
+	values, err := parseInboundSettings(settings)
+	if err != nil {
+		return SecretMask
+	}
+	masked := false
+	visitInboundSecrets(protocol, values, func(obj map[string]interface{}, key string, path string) {
+		if obj[key] != "" {
+			obj[key] = SecretMask
+			masked = true
+		}
+	})
+	if !masked {
+		return settings
+	}
+	result, err := marshalInboundSettings(values)
+	if err != nil {
+		return SecretMask
+	}
+	return result
+}
+
+// RestoreInboundSettings 将提交的 settings 中的掩码恢复为 oldSettings 中相同位置的原值，
+// 没有原值可以恢复时返回错误。新增入站时 oldSettings 为空
+func RestoreInboundSettings(protocol Protocol, settings string, oldSettings string) (string, error) {
+	if _, ok := inboundSecretFields[protocol]; !ok || settings == "" {
+		return settings, nil
+	}
+	values, err := parseInboundSettings(settings)
+	if err != nil {
+		// 格式错误由入站校验报告
+		return settings, nil
+	}
+	oldValues := map[string]string{}
+	if oldSettings != "" {
+		old, err := parseInboundSettings(oldSettings)
+		if err == nil {
+			visitInboundSecrets(protocol, old, func(obj map[string]interface{}, key string, path string) {
+				oldValues[path] = obj[key].(string)
+			})
+		}
+	}
+	restored := false
+	var restoreErr error
+	visitInboundSecrets(protocol, values, func(obj map[string]interface{}, key string, path string) {
+		if obj[key] != SecretMask || restoreErr != nil {
+			return
+		}
+		oldValue, ok := oldValues[path]
+		if !ok || oldValue == "" {
+			restoreErr = fmt.Errorf("%v 是掩码，没有可以恢复的原值，请重新填写", path)
+			return
+		}
+		obj[key] = oldValue
+		restored = true
+	})
+	if restoreErr != nil {
+		return "", restoreErr
+	}
+	if !restored {
+		return settings, nil
+	}
+	return marshalInboundSettings(values)
+}
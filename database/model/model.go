@@ -2,6 +2,8 @@ package model
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"x-ui/util/json_util"
 	// 移除 xray 导入
 )
@@ -11,10 +13,12 @@ type Protocol string
 const (
 	VMess       Protocol = "vmess"
 	VLESS       Protocol = "vless"
-	Dokodemo    Protocol = "Dokodemo-door"
+	Dokodemo    Protocol = "dokodemo-door"
 	Http        Protocol = "http"
 	Trojan      Protocol = "trojan"
 	Shadowsocks Protocol = "shadowsocks"
+	Socks       Protocol = "socks"
+	MTProto     Protocol = "mtproto"
 )
 
 // 二次转发协议类型常量
@@ -23,6 +27,19 @@ const (
 	SecondaryForwardSOCKS = "socks"
 	SecondaryForwardHTTP  = "http"
 	SecondaryForwardHTTPS = "https"
+
+	SecondaryForwardVMess       = "vmess"
+	SecondaryForwardVLESS       = "vless"
+	SecondaryForwardTrojan      = "trojan"
+	SecondaryForwardShadowsocks = "shadowsocks"
+	// 引用上游池，由 xray 负载均衡器在多个上游之间选择
+	SecondaryForwardPool = "pool"
+)
+
+// 上游池负载均衡策略
+const (
+	BalancerRandom    = "random"
+	BalancerLeastPing = "leastPing"
 )
 
 type User struct {
@@ -57,6 +74,12 @@ type Inbound struct {
 	SecondaryForwardPort     int    `json:"secondaryForwardPort" form:"secondaryForwardPort" gorm:"default:0"`
 	SecondaryForwardUsername string `json:"secondaryForwardUsername" form:"secondaryForwardUsername" gorm:"default:''"`
 	SecondaryForwardPassword string `json:"secondaryForwardPassword" form:"secondaryForwardPassword" gorm:"default:''"`
+	// vmess/vless/trojan/shadowsocks 等协议的扩展参数（JSON）
+	SecondaryForwardSettings string `json:"secondaryForwardSettings" form:"secondaryForwardSettings" gorm:"default:''"`
+	// 协议为 pool 时引用的上游池
+	SecondaryForwardPoolId int `json:"secondaryForwardPoolId" form:"secondaryForwardPoolId" gorm:"default:0"`
+	// 上游分享链接，仅用于提交时解析，不保存
+	SecondaryForwardLink string `json:"secondaryForwardLink,omitempty" form:"secondaryForwardLink" gorm:"-"`
 }
 
 // InboundConfig 定义配置结构，避免直接导入 xray
@@ -76,6 +99,8 @@ type InboundConfig struct {
 	SecondaryForwardPort     int    `json:"secondaryForwardPort"`
 	SecondaryForwardUsername string `json:"secondaryForwardUsername"`
 	SecondaryForwardPassword string `json:"secondaryForwardPassword"`
+	SecondaryForwardSettings string `json:"secondaryForwardSettings"`
+	SecondaryForwardPoolId   int    `json:"secondaryForwardPoolId"`
 }
 
 func (i *Inbound) GenXrayInboundConfig() *InboundConfig {
@@ -100,13 +125,252 @@ func (i *Inbound) GenXrayInboundConfig() *InboundConfig {
 		SecondaryForwardPort:     i.SecondaryForwardPort,
 		SecondaryForwardUsername: i.SecondaryForwardUsername,
 		SecondaryForwardPassword: i.SecondaryForwardPassword,
+		SecondaryForwardSettings: i.SecondaryForwardSettings,
+		SecondaryForwardPoolId:   i.SecondaryForwardPoolId,
 	}
 	
 	return config
 }
 
+// ForwardPool 二次转发上游池，渲染为 xray 的 balancer 和 observatory
+type ForwardPool struct {
+	Id            int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name          string `json:"name" form:"name"`
+	Strategy      string `json:"strategy" form:"strategy"`
+	ProbeURL      string `json:"probeUrl" form:"probeUrl"`
+	ProbeInterval string `json:"probeInterval" form:"probeInterval"`
+
+	Members []ForwardPoolMember `json:"members" form:"members" gorm:"-"`
+}
+
+// ForwardPoolMember 上游池中的一个上游，字段含义与 Inbound 的二次转发字段一致
+type ForwardPoolMember struct {
+	Id       int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	PoolId   int    `json:"poolId" form:"poolId" gorm:"index"`
+	Remark   string `json:"remark" form:"remark"`
+	Protocol string `json:"protocol" form:"protocol"`
+	Address  string `json:"address" form:"address"`
+	Port     int    `json:"port" form:"port"`
+	Username string `json:"username" form:"username"`
+	Password string `json:"password" form:"password"`
+	Settings string `json:"settings" form:"settings"`
+	// 上游分享链接，仅用于提交时解析，不保存
+	Link string `json:"link,omitempty" form:"link" gorm:"-"`
+}
+
+// 证书来源
+const (
+	TlsCertSourceUpload     = "upload"
+	TlsCertSourceSelfSigned = "selfSigned"
+	TlsCertSourceAcme       = "acme"
+)
+
+// TlsCert 面板管理的 TLS 证书，入站的 tlsSettings 中通过 certId 引用，
+// 生成 xray 配置时渲染为证书文件路径或证书内容。Cert 和 Key 为 PEM 格式，
+// Domains 以逗号分隔，NotAfter 为 unix 秒
+type TlsCert struct {
+	Id        int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name      string `json:"name" form:"name"`
+	Source    string `json:"source" form:"source"`
+	Domains   string `json:"domains" form:"domains"`
+	Cert      string `json:"cert" form:"cert"`
+	Key       string `json:"key" form:"key"`
+	NotBefore int64  `json:"notBefore"`
+	NotAfter  int64  `json:"notAfter"`
+	// 最近一次续期失败的原因，续期成功后清空
+	LastError string `json:"lastError"`
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
 type Setting struct {
 	Id    int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
 	Key   string `json:"key" form:"key"`
 	Value string `json:"value" form:"value"`
 }
+
+// 设置修改的来源
+const (
+	SettingSourceWeb    = "web"
+	SettingSourceCli    = "cli"
+	SettingSourceImport = "import"
+	SettingSourceReset  = "reset"
+	SettingSourceRevert = "revert"
+)
+
+// SettingVersion 设置的一个历史版本，即一次修改及其修改的设置项。
+// 回滚也会产生新版本，RevertTo 为回滚到的版本
+type SettingVersion struct {
+	Id        int              `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserId    int              `json:"userId"`
+	Username  string           `json:"username"`
+	Source    string           `json:"source"`
+	RevertTo  int              `json:"revertTo"`
+	CreatedAt int64            `json:"createdAt"`
+	Changes   []*SettingChange `json:"changes" gorm:"-"`
+}
+
+// SettingChange 一个设置项的修改，值与 Setting 一样以字符串保存
+type SettingChange struct {
+	Id        int    `json:"-" gorm:"primaryKey;autoIncrement"`
+	VersionId int    `json:"-" gorm:"index"`
+	Key       string `json:"key"`
+	OldValue  string `json:"oldValue"`
+	NewValue  string `json:"newValue"`
+	// xray 配置模板的差异，只在接口返回时填充
+	Diff []*json_util.DiffEntry `json:"diff,omitempty" gorm:"-"`
+}
+
+// RoutingRule 路由规则，多值字段以逗号分隔保存
+type RoutingRule struct {
+	Id       int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Priority int    `json:"priority" form:"priority"`
+	Enable   bool   `json:"enable" form:"enable"`
+	Remark   string `json:"remark" form:"remark"`
+
+	Domain      string `json:"domain" form:"domain"`
+	Ip          string `json:"ip" form:"ip"`
+	Port        string `json:"port" form:"port"`
+	Network     string `json:"network" form:"network"`
+	Protocol    string `json:"protocol" form:"protocol"`
+	InboundTag  string `json:"inboundTag" form:"inboundTag"`
+	User        string `json:"user" form:"user"`
+	OutboundTag string `json:"outboundTag" form:"outboundTag"`
+	BalancerTag string `json:"balancerTag" form:"balancerTag"`
+}
+
+// RuleConfig 对应 xray routing.rules 中的一条 field 规则
+type RuleConfig struct {
+	Id          int                  `json:"-"`
+	Type        string               `json:"type"`
+	Domain      []string             `json:"domain,omitempty"`
+	IP          []string             `json:"ip,omitempty"`
+	Port        json_util.RawMessage `json:"port,omitempty"`
+	Network     string               `json:"network,omitempty"`
+	Protocol    []string             `json:"protocol,omitempty"`
+	InboundTag  []string             `json:"inboundTag,omitempty"`
+	User        []string             `json:"user,omitempty"`
+	OutboundTag string               `json:"outboundTag,omitempty"`
+	BalancerTag string               `json:"balancerTag,omitempty"`
+}
+
+func (r *RoutingRule) GenXrayRuleConfig() *RuleConfig {
+	config := &RuleConfig{
+		Id:          r.Id,
+		Type:        "field",
+		Domain:      SplitList(r.Domain),
+		IP:          SplitList(r.Ip),
+		Network:     strings.Join(SplitList(r.Network), ","),
+		Protocol:    SplitList(r.Protocol),
+		InboundTag:  SplitList(r.InboundTag),
+		User:        SplitList(r.User),
+		OutboundTag: r.OutboundTag,
+		BalancerTag: r.BalancerTag,
+	}
+	port := strings.Join(SplitList(r.Port), ",")
+	if port != "" {
+		config.Port = json_util.RawMessage(strconv.Quote(port))
+	}
+	return config
+}
+
+// SplitList 将逗号或换行分隔的字符串拆分为去空白后的列表
+func SplitList(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	})
+	list := make([]string, 0, len(fields))
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			list = append(list, field)
+		}
+	}
+	return list
+}
+
+// 状态采样的精度，单位为秒
+const (
+	StatusResolutionMinute  = 60
+	StatusResolutionQuarter = 900
+)
+
+// StatusSample 系统状态的历史采样，分钟精度保留一天，15 分钟精度保留一个月
+type StatusSample struct {
+	Id         int     `json:"-" gorm:"primaryKey;autoIncrement"`
+	Resolution int     `json:"resolution" gorm:"index:idx_status_sample,priority:1"`
+	Time       int64   `json:"time" gorm:"index:idx_status_sample,priority:2"`
+	Cpu        float64 `json:"cpu"`
+	Mem        uint64  `json:"mem"`
+	MemTotal   uint64  `json:"memTotal"`
+	NetUp      uint64  `json:"netUp"`
+	NetDown    uint64  `json:"netDown"`
+	TcpCount   int     `json:"tcpCount"`
+	UdpCount   int     `json:"udpCount"`
+}
+
+// 告警指标，inbound 开头的指标对每个入站分别计算
+const (
+	AlertMetricCpu          = "cpu"          // CPU 使用率 %
+	AlertMetricMem          = "mem"          // 内存使用率 %
+	AlertMetricSwap         = "swap"         // swap 使用率 %
+	AlertMetricDisk         = "disk"         // 磁盘使用率 %
+	AlertMetricLoad         = "load"         // 1 分钟负载
+	AlertMetricTcpCount     = "tcpCount"     // TCP 连接数
+	AlertMetricUdpCount     = "udpCount"     // UDP 连接数
+	AlertMetricXrayError    = "xrayError"    // xray 处于错误状态时为 1，否则为 0
+	AlertMetricInboundUsage = "inboundUsage" // 入站已用流量占总流量的百分比，未限制流量的入站不计算
+	AlertMetricInboundDays  = "inboundDays"  // 入站距离到期的天数，未设置到期时间的入站不计算
+	AlertMetricCertDays     = "certDays"     // 证书库中的证书距离到期的天数
+)
+
+// AlertRule 告警规则，指标满足条件并持续 Duration 秒后触发，
+// 恢复时需要越过阈值 Hysteresis 的幅度，避免在阈值附近反复触发
+type AlertRule struct {
+	Id         int     `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name       string  `json:"name" form:"name"`
+	Enable     bool    `json:"enable" form:"enable"`
+	Metric     string  `json:"metric" form:"metric"`
+	Operator   string  `json:"operator" form:"operator"`
+	Threshold  float64 `json:"threshold" form:"threshold"`
+	Hysteresis float64 `json:"hysteresis" form:"hysteresis"`
+	Duration   int     `json:"duration" form:"duration"`
+}
+
+// AlertEvent 一次告警从触发到恢复的记录，ResolvedAt 为 0 表示仍在告警中
+type AlertEvent struct {
+	Id         int     `json:"id" gorm:"primaryKey;autoIncrement"`
+	RuleId     int     `json:"ruleId" gorm:"index"`
+	RuleName   string  `json:"ruleName"`
+	Subject    string  `json:"subject"`
+	Value      float64 `json:"value"`
+	Message    string  `json:"message"`
+	FiredAt    int64   `json:"firedAt"`
+	ResolvedAt int64   `json:"resolvedAt" gorm:"index"`
+}
+
+// NotifyChannel 通知渠道，Settings 为对应类型通知器的 JSON 配置，
+// Templates 为事件到自定义模板的 JSON 对象，未设置的事件使用默认模板
+type NotifyChannel struct {
+	Id        int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name      string `json:"name" form:"name"`
+	Type      string `json:"type" form:"type"`
+	Enable    bool   `json:"enable" form:"enable"`
+	Settings  string `json:"settings" form:"settings"`
+	Templates string `json:"templates" form:"templates"`
+}
+
+// TgBinding 终端用户的电报账号与入站的绑定。ChatId 为 0 时表示绑定码尚未使用，
+// Link 为生成绑定码时面板生成的分享链接
+type TgBinding struct {
+	Id         int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	InboundId  int    `json:"inboundId" gorm:"index"`
+	ChatId     int64  `json:"chatId" gorm:"index"`
+	Code       string `json:"-" gorm:"index"`
+	CodeExpiry int64  `json:"-"`
+	Link       string `json:"-"`
+	// 已发送过的最高流量提醒百分比，流量重置后清零
+	WarnPercent int `json:"-"`
+	// 是否已发送到期提醒，到期时间延后后清除
+	ExpiryWarned bool  `json:"-"`
+	BoundAt      int64 `json:"boundAt"`
+}
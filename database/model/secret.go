@@ -0,0 +1,160 @@
+package model
+
+import (
+	"x-ui/util/seal"
+
+	"gorm.io/gorm"
+)
+
+// SecretMask API 返回时替代敏感字段的掩码，提交该值表示保持原值不变
+const SecretMask = "******"
+
+// secretSettingKeys 加密保存的设置项
+var secretSettingKeys = []string{"tgBotToken", "secret", "metricsToken"}
+
+// SecretColumns 各表中加密保存的列，供批量加密和密钥轮换使用，需与下面的 secretFields 保持一致
+var SecretColumns = map[string][]string{
+	"inbounds":             {"settings", "secondary_forward_password", "secondary_forward_settings"},
+	"forward_pool_members": {"password", "settings"},
+	"notify_channels":      {"settings"},
+	"tg_bindings":          {"link"},
+	"setting_changes":      {"old_value", "new_value"},
+	"tls_certs":            {"key"},
+}
+
+func GetSecretSettingKeys() []string {
+	return secretSettingKeys
+}
+
+func IsSecretSetting(key string) bool {
+	for _, k := range secretSettingKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func encryptFields(fields []*string) error {
+	for _, field := range fields {
+		value, err := seal.Encrypt(*field)
+		if err != nil {
+			return err
+		}
+		*field = value
+	}
+	return nil
+}
+
+func decryptFields(fields []*string) error {
+	for _, field := range fields {
+		value, err := seal.Decrypt(*field)
+		if err != nil {
+			return err
+		}
+		*field = value
+	}
+	return nil
+}
+
+func (i *Inbound) secretFields() []*string {
+	return []*string{&i.Settings, &i.SecondaryForwardPassword, &i.SecondaryForwardSettings}
+}
+
+// BeforeSave 写入数据库前加密敏感字段，AfterSave 再解密回来，调用方拿到的始终是明文
+func (i *Inbound) BeforeSave(tx *gorm.DB) error {
+	return encryptFields(i.secretFields())
+}
+
+func (i *Inbound) AfterSave(tx *gorm.DB) error {
+	return decryptFields(i.secretFields())
+}
+
+func (i *Inbound) AfterFind(tx *gorm.DB) error {
+	return decryptFields(i.secretFields())
+}
+
+func (m *ForwardPoolMember) secretFields() []*string {
+	return []*string{&m.Password, &m.Settings}
+}
+
+func (m *ForwardPoolMember) BeforeSave(tx *gorm.DB) error {
+	return encryptFields(m.secretFields())
+}
+
+func (m *ForwardPoolMember) AfterSave(tx *gorm.DB) error {
+	return decryptFields(m.secretFields())
+}
+
+func (m *ForwardPoolMember) AfterFind(tx *gorm.DB) error {
+	return decryptFields(m.secretFields())
+}
+
+func (c *NotifyChannel) BeforeSave(tx *gorm.DB) error {
+	return encryptFields([]*string{&c.Settings})
+}
+
+func (c *NotifyChannel) AfterSave(tx *gorm.DB) error {
+	return decryptFields([]*string{&c.Settings})
+}
+
+func (c *NotifyChannel) AfterFind(tx *gorm.DB) error {
+	return decryptFields([]*string{&c.Settings})
+}
+
+func (b *TgBinding) BeforeSave(tx *gorm.DB) error {
+	return encryptFields([]*string{&b.Link})
+}
+
+func (b *TgBinding) AfterSave(tx *gorm.DB) error {
+	return decryptFields([]*string{&b.Link})
+}
+
+func (b *TgBinding) AfterFind(tx *gorm.DB) error {
+	return decryptFields([]*string{&b.Link})
+}
+
+// 设置历史中可能包含令牌等敏感设置，统一加密保存
+func (c *SettingChange) BeforeSave(tx *gorm.DB) error {
+	return encryptFields([]*string{&c.OldValue, &c.NewValue})
+}
+
+func (c *SettingChange) AfterSave(tx *gorm.DB) error {
+	return decryptFields([]*string{&c.OldValue, &c.NewValue})
+}
+
+func (c *SettingChange) AfterFind(tx *gorm.DB) error {
+	return decryptFields([]*string{&c.OldValue, &c.NewValue})
+}
+
+func (c *TlsCert) BeforeSave(tx *gorm.DB) error {
+	return encryptFields([]*string{&c.Key})
+}
+
+func (c *TlsCert) AfterSave(tx *gorm.DB) error {
+	return decryptFields([]*string{&c.Key})
+}
+
+func (c *TlsCert) AfterFind(tx *gorm.DB) error {
+	return decryptFields([]*string{&c.Key})
+}
+
+// MaskSecrets 将敏感字段替换为掩码
+func (i *Inbound) MaskSecrets() {
+	if i.SecondaryForwardPassword != "" {
+		i.SecondaryForwardPassword = SecretMask
+	}
+	i.Settings = MaskInboundSettings(i.Protocol, i.Settings)
+}
+
+func (m *ForwardPoolMember) MaskSecrets() {
+	if m.Password != "" {
+		m.Password = SecretMask
+	}
+}
+
+func (c *TlsCert) MaskSecrets() {
+	if c.Key != "" {
+		c.Key = SecretMask
+	}
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"fmt"
+	"x-ui/config"
+	"x-ui/database/model"
+	"x-ui/util/seal"
+
+	"gorm.io/gorm"
+)
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// hasColumn 检查表中是否有该列，表不存在时返回 false
+func hasColumn(tx *gorm.DB, table string, column string) bool {
+	var count int64
+	err := tx.Raw("SELECT count(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count).Error
+	return err == nil && count > 0
+}
+
+// transformSecrets 直接按表读写所有敏感列，绕过模型的加解密钩子
+func transformSecrets(tx *gorm.DB, transform func(string) (string, error)) error {
+	for table, allColumns := range model.SecretColumns {
+		// 旧版本的数据库（如待恢复的备份）中可能还没有这些表或列
+		columns := make([]string, 0, len(allColumns))
+		for _, column := range allColumns {
+			if hasColumn(tx, table, column) {
+				columns = append(columns, column)
+			}
+		}
+		if len(columns) == 0 {
+			continue
+		}
+		rows := make([]map[string]interface{}, 0)
+		err := tx.Table(table).Select(append([]string{"id"}, columns...)).Find(&rows).Error
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			updates := map[string]interface{}{}
+			for _, column := range columns {
+				value := toString(row[column])
+				newValue, err := transform(value)
+				if err != nil {
+					return fmt.Errorf("%v.%v of id %v: %v", table, column, row["id"], err)
+				}
+				if newValue != value {
+					updates[column] = newValue
+				}
+			}
+			if len(updates) == 0 {
+				continue
+			}
+			err = tx.Table(table).Where("id = ?", row["id"]).UpdateColumns(updates).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	settings := make([]*model.Setting, 0)
+	err := tx.Model(model.Setting{}).Where("key in ?", model.GetSecretSettingKeys()).Find(&settings).Error
+	if err != nil {
+		return err
+	}
+	for _, setting := range settings {
+		value, err := transform(setting.Value)
+		if err != nil {
+			return fmt.Errorf("setting %v: %v", setting.Key, err)
+		}
+		if value == setting.Value {
+			continue
+		}
+		err = tx.Model(model.Setting{}).Where("id = ?", setting.Id).Update("value", value).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RotateKey 生成新的主密钥，并用新密钥重新加密数据库中的所有敏感数据
+// 在运行中的面板内执行时，第一遍重新加密期间其他请求可能已经用旧密钥加密了数据，
+// 第二遍在移除旧密钥前再次处理仍使用旧密钥的值
+func RotateKey() error {
+	return seal.RotateKey(config.GetKeyPath(), func() error {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return transformSecrets(tx, seal.Reencrypt)
+		})
+		if err != nil {
+			return err
+		}
+		return db.Transaction(func(tx *gorm.DB) error {
+			return transformSecrets(tx, seal.ReencryptStale)
+		})
+	})
+}
+
+// ReloadKey 重新读取主密钥文件，用于命令行轮换密钥后通知运行中的面板
+func ReloadKey() error {
+	return seal.LoadKeyFile(config.GetKeyPath())
+}
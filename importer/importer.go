@@ -0,0 +1,115 @@
+package importer
+
+import (
+	"sort"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/web/service"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Source 从其他面板或配置文件读取入站
+type Source interface {
+	// Load 读取 path 中的入站，warnings 为无法完整迁移的内容，供预览时提示
+	Load(path string) (inbounds []*model.Inbound, warnings []string, err error)
+}
+
+var sources = map[string]Source{
+	"v2-ui": &V2uiSource{},
+	"xray":  &XraySource{},
+	"3x-ui": &X3uiSource{},
+}
+
+// GetSourceNames 返回支持的导入来源
+func GetSourceNames() []string {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func GetSource(name string) (Source, error) {
+	source, ok := sources[name]
+	if !ok {
+		return nil, common.NewErrorf("unsupported import source %v, supported: %v", name, GetSourceNames())
+	}
+	return source, nil
+}
+
+// Report 导入报告，Import 为各入站的处理结果
+type Report struct {
+	Source   string                `json:"source"`
+	Warnings []string              `json:"warnings"`
+	Import   *service.ImportReport `json:"import"`
+}
+
+// Import 读取来源中的入站并导入到 x-ui 数据库，端口冲突按 options.Conflict 处理，
+// options.DryRun 时只返回预览报告。需要先初始化 x-ui 数据库
+func Import(name string, path string, options *service.ImportOptions) (*Report, error) {
+	source, err := GetSource(name)
+	if err != nil {
+		return nil, err
+	}
+	inbounds, warnings, err := source.Load(path)
+	if err != nil {
+		return nil, common.NewErrorf("load %v failed: %v", name, err)
+	}
+	if warnings == nil {
+		warnings = make([]string, 0)
+	}
+	data := &service.ExportData{
+		Version:  service.ExportVersion,
+		Inbounds: inbounds,
+	}
+	transferService := service.TransferService{}
+	report, err := transferService.Import(data, options)
+	return &Report{
+		Source:   name,
+		Warnings: warnings,
+		Import:   report,
+	}, err
+}
+
+// openDB 以只读方式打开其他面板的数据库
+func openDB(path string) (*gorm.DB, error) {
+	return gorm.Open(sqlite.Open("file:"+path+"?mode=ro"), &gorm.Config{
+		Logger: logger.Discard,
+	})
+}
+
+func closeDB(db *gorm.DB) {
+	sqlDB, err := db.DB()
+	if err == nil {
+		sqlDB.Close()
+	}
+}
+
+func getColumns(db *gorm.DB, table string) (map[string]bool, error) {
+	var names []string
+	err := db.Raw("SELECT name FROM pragma_table_info(?)", table).Scan(&names).Error
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]bool, len(names))
+	for _, name := range names {
+		columns[name] = true
+	}
+	return columns, nil
+}
+
+// toMillis 将秒或毫秒时间戳统一为毫秒
+func toMillis(t int64) int64 {
+	if t > 0 && t < 1e12 {
+		return t * 1000
+	}
+	return t
+}
+
+func errNotFound(table string) error {
+	return common.NewErrorf("table %v not found, please check the database path", table)
+}
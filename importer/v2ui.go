@@ -0,0 +1,95 @@
+package importer
+
+import (
+	"strings"
+	"x-ui/database/model"
+)
+
+type V2Inbound struct {
+	Id             int `gorm:"primaryKey;autoIncrement"`
+	Port           int `gorm:"unique"`
+	Listen         string
+	Protocol       string
+	Settings       string
+	StreamSettings string
+	Tag            string `gorm:"unique"`
+	Sniffing       string
+	Remark         string
+	Up             int64
+	Down           int64
+	Total          int64
+	ExpiryTime     int64
+	Enable         bool
+}
+
+func (i *V2Inbound) TableName() string {
+	return "inbound"
+}
+
+func (i *V2Inbound) ToInbound() *model.Inbound {
+	return &model.Inbound{
+		Up:             i.Up,
+		Down:           i.Down,
+		Total:          i.Total,
+		Remark:         i.Remark,
+		Enable:         i.Enable,
+		ExpiryTime:     toMillis(i.ExpiryTime),
+		Listen:         i.Listen,
+		Port:           i.Port,
+		Protocol:       model.Protocol(i.Protocol),
+		Settings:       i.Settings,
+		StreamSettings: i.StreamSettings,
+		Tag:            i.Tag,
+		Sniffing:       i.Sniffing,
+	}
+}
+
+// v2-ui 的基础字段，流量限制和到期时间只有部分版本才有
+var v2uiColumns = []string{"id", "port", "listen", "protocol", "settings", "stream_settings", "tag", "sniffing", "remark", "up", "down", "enable"}
+
+// V2uiSource 从 v2-ui 数据库导入
+type V2uiSource struct {
+}
+
+func (s *V2uiSource) Load(path string) ([]*model.Inbound, []string, error) {
+	db, err := openDB(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closeDB(db)
+
+	columns, err := getColumns(db, "inbound")
+	if err != nil {
+		return nil, nil, err
+	}
+	if !columns["port"] {
+		return nil, nil, errNotFound("inbound")
+	}
+	selects := append([]string{}, v2uiColumns...)
+	warnings := make([]string, 0)
+	if columns["total"] {
+		selects = append(selects, "total")
+	} else {
+		warnings = append(warnings, "v2-ui 数据库中没有流量限制字段，导入的入站不限流量")
+	}
+	// 不同版本的到期时间字段名不同
+	switch {
+	case columns["expiry_time"]:
+		selects = append(selects, "expiry_time")
+	case columns["expire_time"]:
+		selects = append(selects, "expire_time AS expiry_time")
+	default:
+		warnings = append(warnings, "v2-ui 数据库中没有到期时间字段，导入的入站不会过期")
+	}
+
+	v2Inbounds := make([]*V2Inbound, 0)
+	err = db.Model(V2Inbound{}).Select(strings.Join(selects, ", ")).Find(&v2Inbounds).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	inbounds := make([]*model.Inbound, 0, len(v2Inbounds))
+	for _, v2Inbound := range v2Inbounds {
+		inbounds = append(inbounds, v2Inbound.ToInbound())
+	}
+	return inbounds, warnings, nil
+}
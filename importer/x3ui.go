@@ -0,0 +1,134 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"x-ui/database/model"
+)
+
+type X3Inbound struct {
+	Id             int
+	Up             int64
+	Down           int64
+	Total          int64
+	Remark         string
+	Enable         bool
+	ExpiryTime     int64
+	Listen         string
+	Port           int
+	Protocol       string
+	Settings       string
+	StreamSettings string
+	Tag            string
+	Sniffing       string
+}
+
+func (i *X3Inbound) TableName() string {
+	return "inbounds"
+}
+
+// 3x-ui 在客户端中保存的面板字段，xray 用不到，导入时去掉
+var x3uiClientKeys = []string{"limitIp", "totalGB", "expiryTime", "enable", "tgId", "subId", "reset", "comment", "created_at", "updated_at"}
+
+// X3uiSource 从 3x-ui 数据库导入。x-ui 只支持入站级别的流量限制和到期时间，
+// 客户端级别的限制不会导入，被禁用的客户端会被移除
+type X3uiSource struct {
+}
+
+func (s *X3uiSource) Load(path string) ([]*model.Inbound, []string, error) {
+	db, err := openDB(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closeDB(db)
+
+	columns, err := getColumns(db, "inbounds")
+	if err != nil {
+		return nil, nil, err
+	}
+	if !columns["port"] {
+		return nil, nil, errNotFound("inbounds")
+	}
+	x3Inbounds := make([]*X3Inbound, 0)
+	err = db.Model(X3Inbound{}).Find(&x3Inbounds).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inbounds := make([]*model.Inbound, 0, len(x3Inbounds))
+	warnings := make([]string, 0)
+	for _, x3Inbound := range x3Inbounds {
+		settings, clientWarnings, err := convertX3Clients(x3Inbound.Settings)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("入站 %v (端口 %v) 的 settings 无效，已跳过: %v", x3Inbound.Remark, x3Inbound.Port, err))
+			continue
+		}
+		for _, warning := range clientWarnings {
+			warnings = append(warnings, fmt.Sprintf("入站 %v (端口 %v): %v", x3Inbound.Remark, x3Inbound.Port, warning))
+		}
+		inbounds = append(inbounds, &model.Inbound{
+			Up:             x3Inbound.Up,
+			Down:           x3Inbound.Down,
+			Total:          x3Inbound.Total,
+			Remark:         x3Inbound.Remark,
+			Enable:         x3Inbound.Enable,
+			ExpiryTime:     toMillis(x3Inbound.ExpiryTime),
+			Listen:         x3Inbound.Listen,
+			Port:           x3Inbound.Port,
+			Protocol:       model.Protocol(x3Inbound.Protocol),
+			Settings:       settings,
+			StreamSettings: x3Inbound.StreamSettings,
+			Sniffing:       x3Inbound.Sniffing,
+		})
+	}
+	return inbounds, warnings, nil
+}
+
+// convertX3Clients 移除被禁用的客户端和 3x-ui 专用字段
+func convertX3Clients(settings string) (string, []string, error) {
+	if settings == "" {
+		return "{}", nil, nil
+	}
+	m := map[string]interface{}{}
+	err := json.Unmarshal([]byte(settings), &m)
+	if err != nil {
+		return "", nil, err
+	}
+	clients, ok := m["clients"].([]interface{})
+	if !ok {
+		return settings, nil, nil
+	}
+	warnings := make([]string, 0)
+	limited := false
+	newClients := make([]interface{}, 0, len(clients))
+	for _, c := range clients {
+		client, ok := c.(map[string]interface{})
+		if !ok {
+			newClients = append(newClients, c)
+			continue
+		}
+		if enable, ok := client["enable"].(bool); ok && !enable {
+			warnings = append(warnings, fmt.Sprintf("客户端 %v 已被禁用，不会导入", client["email"]))
+			continue
+		}
+		if total, ok := client["totalGB"].(float64); ok && total > 0 {
+			limited = true
+		}
+		if expiry, ok := client["expiryTime"].(float64); ok && expiry != 0 {
+			limited = true
+		}
+		for _, key := range x3uiClientKeys {
+			delete(client, key)
+		}
+		newClients = append(newClients, client)
+	}
+	if limited {
+		warnings = append(warnings, "客户端级别的流量限制和到期时间不受支持，已忽略")
+	}
+	m["clients"] = newClients
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", nil, err
+	}
+	return string(data), warnings, nil
+}
@@ -0,0 +1,81 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"x-ui/database/model"
+)
+
+type xrayInbound struct {
+	Listen         string          `json:"listen"`
+	Port           json.RawMessage `json:"port"`
+	Protocol       string          `json:"protocol"`
+	Settings       json.RawMessage `json:"settings"`
+	StreamSettings json.RawMessage `json:"streamSettings"`
+	Tag            string          `json:"tag"`
+	Sniffing       json.RawMessage `json:"sniffing"`
+}
+
+type xrayConfig struct {
+	Inbounds []*xrayInbound `json:"inbounds"`
+}
+
+// XraySource 从 xray 的 config.json 导入入站，
+// 面板自己使用的 api 入站和端口范围等无法对应到单个入站的配置会被跳过
+type XraySource struct {
+}
+
+func rawToString(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	return string(raw)
+}
+
+func (s *XraySource) Load(path string) ([]*model.Inbound, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	config := &xrayConfig{}
+	err = json.Unmarshal(data, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	inbounds := make([]*model.Inbound, 0, len(config.Inbounds))
+	warnings := make([]string, 0)
+	for i, xrayInbound := range config.Inbounds {
+		if xrayInbound.Tag == "api" {
+			continue
+		}
+		port := 0
+		err = json.Unmarshal(xrayInbound.Port, &port)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("第 %v 个入站的端口 %v 不是单个端口，已跳过", i+1, rawToString(xrayInbound.Port)))
+			continue
+		}
+		remark := xrayInbound.Tag
+		if remark == "" {
+			remark = fmt.Sprintf("%v-%v", xrayInbound.Protocol, port)
+		}
+		settings := rawToString(xrayInbound.Settings)
+		if settings == "" {
+			settings = "{}"
+		}
+		inbounds = append(inbounds, &model.Inbound{
+			Remark:         remark,
+			Enable:         true,
+			Listen:         xrayInbound.Listen,
+			Port:           port,
+			Protocol:       model.Protocol(xrayInbound.Protocol),
+			Settings:       settings,
+			StreamSettings: rawToString(xrayInbound.StreamSettings),
+			Sniffing:       rawToString(xrayInbound.Sniffing),
+		})
+	}
+	if len(config.Inbounds) > 0 {
+		warnings = append(warnings, "xray 配置中的出站和路由规则不会导入，入站的 tag 将改为 inbound-端口")
+	}
+	return inbounds, warnings, nil
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/web/control"
+	"x-ui/web/service"
+)
+
+const inboundUsage = `Usage: x-ui inbound <command> [flags] [id]
+
+Commands:
+    list                 list inbounds
+    show <id>            show an inbound
+    add                  add an inbound
+    update <id>          update an inbound, only the given flags are changed
+    del <id>             delete an inbound
+    enable <id>          enable an inbound
+    disable <id>         disable an inbound
+    reset-traffic <id>   reset the traffic of an inbound
+`
+
+const defaultInboundSniffing = `{"enabled":true,"destOverride":["http","tls"]}`
+
+// inboundFlags add 和 update 共用的参数，update 只修改明确指定的参数
+type inboundFlags struct {
+	file           string
+	remark         string
+	listen         string
+	port           int
+	protocol       string
+	settings       string
+	streamSettings string
+	sniffing       string
+	total          int64
+	expiry         string
+	enable         bool
+}
+
+func (f *inboundFlags) register(cmd *flag.FlagSet) {
+	cmd.StringVar(&f.file, "file", "", "read the inbound from a JSON file, other flags override its fields")
+	cmd.StringVar(&f.remark, "remark", "", "remark")
+	cmd.StringVar(&f.listen, "listen", "", "listen address")
+	cmd.IntVar(&f.port, "port", 0, "port")
+	cmd.StringVar(&f.protocol, "protocol", "", "protocol, e.g. vmess, vless, trojan, shadowsocks")
+	cmd.StringVar(&f.settings, "settings", "", "settings JSON")
+	cmd.StringVar(&f.streamSettings, "stream", "", "stream settings JSON")
+	cmd.StringVar(&f.sniffing, "sniffing", "", "sniffing JSON")
+	cmd.Int64Var(&f.total, "total", 0, "traffic limit in bytes, 0 means unlimited")
+	cmd.StringVar(&f.expiry, "expiry", "", "expiry time, format 2006-01-02 or 2006-01-02 15:04:05, 0 means never")
+	cmd.BoolVar(&f.enable, "enable", true, "enable the inbound")
+}
+
+func parseExpiry(expiry string) (int64, error) {
+	if expiry == "" || expiry == "0" {
+		return 0, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02"} {
+		t, err := time.ParseInLocation(layout, expiry, time.Local)
+		if err == nil {
+			return t.Unix() * 1000, nil
+		}
+	}
+	return 0, common.NewError("invalid expiry time:", expiry)
+}
+
+// apply 将明确指定的参数写入 inbound
+func (f *inboundFlags) apply(cmd *flag.FlagSet, inbound *model.Inbound) error {
+	if f.file != "" {
+		data, err := os.ReadFile(f.file)
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal(data, inbound)
+		if err != nil {
+			return err
+		}
+	}
+	var err error
+	cmd.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "remark":
+			inbound.Remark = f.remark
+		case "listen":
+			inbound.Listen = f.listen
+		case "port":
+			inbound.Port = f.port
+		case "protocol":
+			inbound.Protocol = model.Protocol(f.protocol)
+		case "settings":
+			inbound.Settings = f.settings
+		case "stream":
+			inbound.StreamSettings = f.streamSettings
+		case "sniffing":
+			inbound.Sniffing = f.sniffing
+		case "total":
+			inbound.Total = f.total
+		case "expiry":
+			var expiryTime int64
+			expiryTime, err = parseExpiry(f.expiry)
+			inbound.ExpiryTime = expiryTime
+		case "enable":
+			inbound.Enable = f.enable
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for name, value := range map[string]string{"settings": inbound.Settings, "stream": inbound.StreamSettings, "sniffing": inbound.Sniffing} {
+		if value != "" && !json.Valid([]byte(value)) {
+			return common.NewErrorf("%v is not valid JSON", name)
+		}
+	}
+	return nil
+}
+
+func formatExpiry(expiryTime int64) string {
+	if expiryTime == 0 {
+		return "never"
+	}
+	return time.Unix(expiryTime/1000, 0).Format("2006-01-02 15:04:05")
+}
+
+func printInbounds(inbounds []*model.Inbound, asJson bool) {
+	if asJson {
+		data, _ := json.MarshalIndent(inbounds, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tREMARK\tPROTOCOL\tPORT\tENABLE\tUP\tDOWN\tTOTAL\tEXPIRY")
+	for _, inbound := range inbounds {
+		total := "unlimited"
+		if inbound.Total > 0 {
+			total = common.FormatTraffic(inbound.Total)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", inbound.Id, inbound.Remark, inbound.Protocol, inbound.Port,
+			inbound.Enable, common.FormatTraffic(inbound.Up), common.FormatTraffic(inbound.Down), total, formatExpiry(inbound.ExpiryTime))
+	}
+	w.Flush()
+}
+
+func printInbound(inbound *model.Inbound, asJson bool) {
+	if asJson {
+		data, _ := json.MarshalIndent(inbound, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	printInbounds([]*model.Inbound{inbound}, false)
+	fmt.Println()
+	fmt.Println("listen:", inbound.Listen)
+	fmt.Println("tag:", inbound.Tag)
+	fmt.Println("settings:", inbound.Settings)
+	fmt.Println("streamSettings:", inbound.StreamSettings)
+	fmt.Println("sniffing:", inbound.Sniffing)
+	if inbound.SecondaryForwardEnable {
+		fmt.Printf("secondaryForward: %v %v:%v\n", inbound.SecondaryForwardProtocol, inbound.SecondaryForwardAddress, inbound.SecondaryForwardPort)
+	}
+}
+
+func getInboundId(cmd *flag.FlagSet) (int, error) {
+	if cmd.NArg() < 1 {
+		return 0, common.NewError("please specify the inbound id")
+	}
+	id, err := strconv.Atoi(cmd.Arg(0))
+	if err != nil {
+		return 0, common.NewError("invalid inbound id:", cmd.Arg(0))
+	}
+	return id, nil
+}
+
+func runInboundCmd(args []string) {
+	if len(args) < 1 {
+		fmt.Print(inboundUsage)
+		return
+	}
+	action := args[0]
+	switch action {
+	case "list", "show", "add", "update", "del", "enable", "disable", "reset-traffic":
+	default:
+		fmt.Print(inboundUsage)
+		return
+	}
+	cmd := flag.NewFlagSet("inbound "+action, flag.ExitOnError)
+	var asJson bool
+	var reveal bool
+	cmd.BoolVar(&asJson, "json", false, "output as JSON")
+	cmd.BoolVar(&reveal, "reveal", false, "show secrets instead of masks")
+	f := &inboundFlags{}
+	if action == "add" || action == "update" {
+		f.register(cmd)
+	}
+	err := cmd.Parse(args[1:])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	err = initDB()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	inboundService := service.InboundService{}
+	changed := false
+	switch action {
+	case "list":
+		var inbounds []*model.Inbound
+		inbounds, err = inboundService.GetAllInbounds()
+		if err == nil {
+			if !reveal {
+				for _, inbound := range inbounds {
+					inbound.MaskSecrets()
+				}
+			}
+			printInbounds(inbounds, asJson)
+		}
+	case "show":
+		var id int
+		var inbound *model.Inbound
+		id, err = getInboundId(cmd)
+		if err == nil {
+			inbound, err = inboundService.GetInbound(id)
+		}
+		if err == nil {
+			if !reveal {
+				inbound.MaskSecrets()
+			}
+			printInbound(inbound, asJson)
+		}
+	case "add":
+		userService := service.UserService{}
+		var user *model.User
+		user, err = userService.GetFirstUser()
+		if err != nil {
+			break
+		}
+		inbound := &model.Inbound{
+			Enable:         true,
+			StreamSettings: `{"network":"tcp"}`,
+			Sniffing:       defaultInboundSniffing,
+			Settings:       "{}",
+		}
+		err = f.apply(cmd, inbound)
+		if err != nil {
+			break
+		}
+		if inbound.Port <= 0 || inbound.Port > 65535 || inbound.Protocol == "" {
+			err = common.NewError("port and protocol are required")
+			break
+		}
+		inbound.Id = 0
+		inbound.UserId = user.Id
+		err = inboundService.AddInbound(inbound)
+		if err == nil {
+			changed = true
+			fmt.Println("add inbound success, id:", inbound.Id)
+		}
+	case "update":
+		var id int
+		var inbound *model.Inbound
+		id, err = getInboundId(cmd)
+		if err == nil {
+			inbound, err = inboundService.GetInbound(id)
+		}
+		if err != nil {
+			break
+		}
+		err = f.apply(cmd, inbound)
+		if err != nil {
+			break
+		}
+		inbound.Id = id
+		err = inboundService.UpdateInbound(inbound)
+		if err == nil {
+			changed = true
+			fmt.Println("update inbound success")
+		}
+	case "del", "enable", "disable", "reset-traffic":
+		var id int
+		id, err = getInboundId(cmd)
+		if err == nil {
+			_, err = inboundService.GetInbound(id)
+		}
+		if err != nil {
+			break
+		}
+		switch action {
+		case "del":
+			err = inboundService.DelInbound(id)
+		case "enable":
+			err = inboundService.SetInboundEnable(id, true)
+		case "disable":
+			err = inboundService.SetInboundEnable(id, false)
+		case "reset-traffic":
+			err = inboundService.ResetInboundTraffic(id)
+		}
+		if err == nil {
+			changed = action != "reset-traffic"
+			fmt.Println(action, "inbound success")
+		}
+	}
+	if err != nil {
+		fmt.Println(action, "inbound failed:", err)
+		os.Exit(1)
+	}
+	if changed {
+		notifyPanel(control.CmdReloadXray)
+	}
+}
@@ -1,30 +1,99 @@
 package logger
 
 import (
-	"github.com/op/go-logging"
+	"fmt"
 	"os"
+	"sync"
+	"time"
+
+	"github.com/op/go-logging"
 )
 
 var logger *logging.Logger
 
+var logLevel = logging.INFO
+var logFile *os.File
+var logFilePath string
+var fileLock sync.Mutex
+
 func init() {
 	InitLogger(logging.INFO)
 }
 
 func InitLogger(level logging.Level) {
+	logLevel = level
+	setBackend()
+}
+
+func setBackend() {
 	format := logging.MustStringFormatter(
 		`%{time:2006/01/02 15:04:05} %{level} - %{message}`,
 	)
 	newLogger := logging.MustGetLogger("x-ui")
-	backend := logging.NewLogBackend(os.Stderr, "", 0)
-	backendFormatter := logging.NewBackendFormatter(backend, format)
-	backendLeveled := logging.AddModuleLevel(backendFormatter)
-	backendLeveled.SetLevel(level, "")
-	newLogger.SetBackend(backendLeveled)
+	backends := []logging.Backend{logging.NewLogBackend(os.Stderr, "", 0)}
+	if logFile != nil {
+		backends = append(backends, logging.NewLogBackend(logFile, "", 0))
+	}
+	leveledBackends := make([]logging.Backend, 0, len(backends))
+	for _, backend := range backends {
+		backendFormatter := logging.NewBackendFormatter(backend, format)
+		backendLeveled := logging.AddModuleLevel(backendFormatter)
+		backendLeveled.SetLevel(logLevel, "")
+		leveledBackends = append(leveledBackends, backendLeveled)
+	}
+	newLogger.SetBackend(logging.MultiLogger(leveledBackends...))
 
 	logger = newLogger
 }
 
+// SetLogFile 日志同时写入文件，path 为空时只输出到标准错误
+func SetLogFile(path string) error {
+	fileLock.Lock()
+	defer fileLock.Unlock()
+	if path == logFilePath {
+		return nil
+	}
+	var file *os.File
+	if path != "" {
+		var err error
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+	}
+	old := logFile
+	logFile = file
+	logFilePath = path
+	setBackend()
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// RotateLogFile 将日志文件改名保存并重新打开，返回改名后的文件，没有日志文件时返回空字符串
+func RotateLogFile() (string, error) {
+	fileLock.Lock()
+	defer fileLock.Unlock()
+	if logFile == nil {
+		return "", nil
+	}
+	newPath := fmt.Sprintf("%s.%s", logFilePath, time.Now().Format("20060102-150405"))
+	err := os.Rename(logFilePath, newPath)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return "", err
+	}
+	old := logFile
+	logFile = file
+	setBackend()
+	old.Close()
+	return newPath, nil
+}
+
 func Debug(args ...interface{}) {
 	logger.Debug(args...)
 }
@@ -1,18 +1,23 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 	_ "unsafe"
 	"x-ui/config"
 	"x-ui/database"
+	"x-ui/importer"
 	"x-ui/logger"
-	"x-ui/v2ui"
+	"x-ui/util/seal"
 	"x-ui/web"
+	"x-ui/web/control"
 	"x-ui/web/global"
 	"x-ui/web/service"
 
@@ -35,10 +40,11 @@ func runWebServer() {
 		log.Fatal("unknown log level:", config.GetLogLevel())
 	}
 
-	err := database.InitDB(config.GetDBPath())
+	err := initDB()
 	if err != nil {
 		log.Fatal(err)
 	}
+	initLogFile()
 
 	var server *web.Server
 
@@ -50,6 +56,17 @@ func runWebServer() {
 		return
 	}
 
+	// 控制 socket 与进程同生命周期，reload-settings 与 SIGHUP 的处理相同
+	panelService := service.PanelService{}
+	controlServer := control.NewServer(config.GetControlSocketPath(), config.GetVersion(), func() {
+		panelService.RestartPanel(0)
+	})
+	err = controlServer.Start()
+	if err != nil {
+		logger.Warning("start control socket failed:", err)
+	}
+	defer controlServer.Stop()
+
 	sigCh := make(chan os.Signal, 1)
 	//信号量捕获处理
 	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGKILL)
@@ -58,7 +75,18 @@ func runWebServer() {
 
 		switch sig {
 		case syscall.SIGHUP:
-			err := server.Stop()
+			// 命令行轮换密钥后通过 SIGHUP 通知面板重新加载密钥
+			err := database.ReloadKey()
+			if err != nil {
+				logger.Warning("reload key err:", err)
+			}
+			settingService := service.SettingService{}
+			err = settingService.LoadPathSettings()
+			if err != nil {
+				logger.Warning("load path settings err:", err)
+			}
+			initLogFile()
+			err = server.Stop()
 			if err != nil {
 				logger.Warning("stop server err:", err)
 			}
@@ -76,8 +104,47 @@ func runWebServer() {
 	}
 }
 
-func resetSetting() {
+// initDB 打开数据库并加载数据库中设置的路径
+func initDB() error {
 	err := database.InitDB(config.GetDBPath())
+	if err != nil {
+		return err
+	}
+	settingService := service.SettingService{}
+	return settingService.LoadPathSettings()
+}
+
+// initLogFile 设置了日志目录时面板日志同时写入 x-ui.log
+func initLogFile() {
+	path := ""
+	dir := config.GetLogDir()
+	if dir != "" {
+		err := os.MkdirAll(dir, 0700)
+		if err != nil {
+			logger.Warning("create log dir failed:", err)
+			return
+		}
+		path = filepath.Join(dir, config.GetName()+".log")
+	}
+	err := logger.SetLogFile(path)
+	if err != nil {
+		logger.Warning("open log file failed:", err)
+	}
+}
+
+func showPaths() {
+	fmt.Println("paths:")
+	for _, name := range config.GetPathNames() {
+		value, source := config.GetPath(name)
+		if value == "" {
+			value = "<empty>"
+		}
+		fmt.Printf("%v: %v (%v)\n", name, value, source)
+	}
+}
+
+func resetSetting() {
+	err := initDB()
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -113,6 +180,7 @@ func showSetting(show bool) {
 		fmt.Println("username:", username)
 		fmt.Println("userpasswd:", userpasswd)
 		fmt.Println("port:", port)
+		showPaths()
 	}
 }
 
@@ -137,7 +205,7 @@ func updateTgbotEnableSts(status bool) {
 }
 
 func updateTgbotSetting(tgBotToken string, tgBotChatid int, tgBotRuntime string) {
-	err := database.InitDB(config.GetDBPath())
+	err := initDB()
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -177,7 +245,7 @@ func updateTgbotSetting(tgBotToken string, tgBotChatid int, tgBotRuntime string)
 }
 
 func updateSetting(port int, username string, password string) {
-	err := database.InitDB(config.GetDBPath())
+	err := initDB()
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -204,21 +272,229 @@ func updateSetting(port int, username string, password string) {
 	}
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		runWebServer()
+// rotateKey 面板运行时由面板进程轮换密钥，否则直接在命令行中轮换
+func rotateKey() {
+	_, err := control.Call(config.GetControlSocketPath(), control.CmdRotateKey)
+	if err == nil {
+		fmt.Println("rotate key success, rotated by the running panel")
+		return
+	} else if err != control.ErrNotRunning {
+		fmt.Println("rotate key failed:", err)
+		return
+	}
+	err = initDB()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	err = database.RotateKey()
+	if err != nil {
+		fmt.Println("rotate key failed:", err)
+		return
+	}
+	fmt.Println("rotate key success")
+}
+
+func backupDB(output string) {
+	err := initDB()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if output == "" {
+		settingService := service.SettingService{}
+		dir, err := settingService.GetBackupDir()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		output = filepath.Join(dir, service.GetBackupFileName(time.Now()))
+	}
+	err = database.Backup(output)
+	if err != nil {
+		fmt.Println("backup failed:", err)
+		return
+	}
+	fmt.Println("backup success:", output)
+}
+
+func restoreDB(backupPath string) {
+	if backupPath == "" {
+		fmt.Println("please specify the backup file: x-ui restore <file>")
+		return
+	}
+	// 面板运行时会继续写入被移走的数据库，需要先停止面板
+	_, err := control.Call(config.GetControlSocketPath(), control.CmdDumpStatus)
+	if err != control.ErrNotRunning {
+		fmt.Println("the panel is running, please stop it before restoring the database")
+		return
+	}
+	// 校验备份时需要用当前密钥解密敏感数据
+	err = seal.LoadKeyFile(config.GetKeyPath())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	old, err := database.Restore(backupPath, config.GetDBPath())
+	if err != nil {
+		fmt.Println("restore failed:", err)
+		return
+	}
+	if old != "" {
+		fmt.Println("the previous database has been moved to", old)
+	}
+	fmt.Println("restore success, please start the panel to use the restored database")
+}
+
+func printImportReport(report *importer.Report) {
+	for _, warning := range report.Warnings {
+		fmt.Println("warning:", warning)
+	}
+	if report.Import == nil {
+		return
+	}
+	for _, result := range report.Import.Inbounds {
+		line := fmt.Sprintf("%-10v port %v", result.Action, result.Port)
+		if result.NewPort != result.Port {
+			line += fmt.Sprint(" -> ", result.NewPort)
+		}
+		line += fmt.Sprint("  ", result.Remark)
+		if result.Reason != "" {
+			line += fmt.Sprint("  (", result.Reason, ")")
+		}
+		fmt.Println(line)
+	}
+}
+
+func importInbounds(from string, path string, conflict string, dryRun bool, yes bool) {
+	if path == "" {
+		fmt.Println("please specify the file to import: x-ui import -from=<kind> <path>")
+		return
+	}
+	err := initDB()
+	if err != nil {
+		fmt.Println(err)
 		return
 	}
+	userService := service.UserService{}
+	user, err := userService.GetFirstUser()
+	if err != nil {
+		fmt.Println("get x-ui user failed:", err)
+		return
+	}
+	options := &service.ImportOptions{
+		UserId:   user.Id,
+		Conflict: conflict,
+		DryRun:   true,
+	}
+	report, err := importer.Import(from, path, options)
+	if report != nil {
+		printImportReport(report)
+	}
+	if err != nil {
+		fmt.Println("import failed:", err)
+		return
+	}
+	if dryRun {
+		return
+	}
+	if !yes {
+		fmt.Print("continue to import? [y/N] ")
+		var answer string
+		fmt.Scanln(&answer)
+		if answer != "y" && answer != "Y" {
+			fmt.Println("import canceled")
+			return
+		}
+	}
+	options.DryRun = false
+	report, err = importer.Import(from, path, options)
+	if err != nil {
+		fmt.Println("import failed:", err)
+		return
+	}
+	count := 0
+	for _, result := range report.Import.Inbounds {
+		if result.Action != service.ImportActionSkip {
+			count++
+		}
+	}
+	fmt.Println("import success:", count, "inbounds")
+	notifyPanel(control.CmdReloadXray)
+}
+
+func runDoctor(asJson bool) {
+	// xray 程序和 geo 文件默认使用相对于服务工作目录的路径，不在安装目录执行时按程序所在目录解析
+	if _, err := os.Stat(config.GetBinDir()); err != nil {
+		exe, err := os.Executable()
+		if err == nil {
+			config.SetRelativeBase(filepath.Dir(exe))
+		}
+	}
+	// 密钥文件不存在时不生成新密钥，加密数据无法解密会在数据库检查中报告
+	if _, err := os.Stat(config.GetKeyPath()); err == nil {
+		err = seal.LoadKeyFile(config.GetKeyPath())
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	doctorService := service.DoctorService{}
+	checks := doctorService.Run(config.GetDBPath())
+	failed := false
+	for _, check := range checks {
+		if check.Status == service.DoctorFail {
+			failed = true
+		}
+	}
+	if asJson {
+		data, _ := json.MarshalIndent(checks, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		for _, check := range checks {
+			fmt.Printf("[%-4v] %-12v %v\n", check.Status, check.Name, check.Message)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
 
+func main() {
 	var showVersion bool
 	flag.BoolVar(&showVersion, "v", false, "show version")
 
+	// 路径参数放在子命令之前，优先于环境变量和数据库中的设置
+	pathFlags := map[string]*string{}
+	for _, f := range []struct {
+		name  string
+		flag  string
+		usage string
+	}{
+		{config.PathDB, "db", "database file path"},
+		{config.PathBinDir, "bin-dir", "directory of the xray binary and geo files"},
+		{config.PathXrayConfig, "xray-config", "path of the generated xray config"},
+		{config.PathLogDir, "log-dir", "directory of the panel log file"},
+	} {
+		pathFlags[f.name] = flag.String(f.flag, "", fmt.Sprintf("%v, env %v", f.usage, config.GetPathEnv(f.name)))
+	}
+
 	runCmd := flag.NewFlagSet("run", flag.ExitOnError)
 
 	v2uiCmd := flag.NewFlagSet("v2-ui", flag.ExitOnError)
 	var dbPath string
 	v2uiCmd.StringVar(&dbPath, "db", "/etc/v2-ui/v2-ui.db", "set v2-ui db file path")
 
+	importCmd := flag.NewFlagSet("import", flag.ExitOnError)
+	var importFrom string
+	var importConflict string
+	var importDryRun bool
+	var importYes bool
+	importCmd.StringVar(&importFrom, "from", "", fmt.Sprint("import source, one of ", importer.GetSourceNames()))
+	importCmd.StringVar(&importConflict, "conflict", service.ConflictSkip, "how to handle port conflicts: skip, renumber or overwrite")
+	importCmd.BoolVar(&importDryRun, "dry-run", false, "only show the preview report")
+	importCmd.BoolVar(&importYes, "y", false, "import without confirmation")
+
 	settingCmd := flag.NewFlagSet("setting", flag.ExitOnError)
 	var port int
 	var username string
@@ -239,14 +515,29 @@ func main() {
 	settingCmd.IntVar(&tgbotchatid, "tgbotchatid", 0, "set telegrame bot chat id")
 	settingCmd.BoolVar(&enabletgbot, "enabletgbot", false, "enable telegram bot notify")
 
+	doctorCmd := flag.NewFlagSet("doctor", flag.ExitOnError)
+	var doctorJson bool
+	doctorCmd.BoolVar(&doctorJson, "json", false, "output as JSON")
+
+	backupCmd := flag.NewFlagSet("backup", flag.ExitOnError)
+	var backupOutput string
+	backupCmd.StringVar(&backupOutput, "o", "", "backup file path, default is a new file in the backup dir")
+
 	oldUsage := flag.Usage
 	flag.Usage = func() {
 		oldUsage()
 		fmt.Println()
 		fmt.Println("Commands:")
 		fmt.Println("    run            run web panel")
-		fmt.Println("    v2-ui          migrate form v2-ui")
+		fmt.Println("    v2-ui          migrate form v2-ui, same as import -from=v2-ui")
+		fmt.Println("    import         import inbounds from v2-ui, xray config.json or 3x-ui")
+		fmt.Println("    inbound        manage inbounds, see 'x-ui inbound' for details")
+		fmt.Println("    control        send a command to the running panel, see 'x-ui control' for details")
 		fmt.Println("    setting        set settings")
+		fmt.Println("    rotate-key     rotate the key used to encrypt secrets")
+		fmt.Println("    doctor         check the panel environment and configuration")
+		fmt.Println("    backup         backup database")
+		fmt.Println("    restore        restore database from a backup file")
 	}
 
 	flag.Parse()
@@ -254,27 +545,44 @@ func main() {
 		fmt.Println(config.GetVersion())
 		return
 	}
+	for name, value := range pathFlags {
+		config.SetPathFlag(name, *value)
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		runWebServer()
+		return
+	}
 
-	switch os.Args[1] {
+	switch args[0] {
 	case "run":
-		err := runCmd.Parse(os.Args[2:])
+		err := runCmd.Parse(args[1:])
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
 		runWebServer()
 	case "v2-ui":
-		err := v2uiCmd.Parse(os.Args[2:])
+		err := v2uiCmd.Parse(args[1:])
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
-		err = v2ui.MigrateFromV2UI(dbPath)
+		importInbounds("v2-ui", dbPath, service.ConflictSkip, false, true)
+	case "import":
+		err := importCmd.Parse(args[1:])
 		if err != nil {
-			fmt.Println("migrate from v2-ui failed:", err)
+			fmt.Println(err)
+			return
 		}
+		importInbounds(importFrom, importCmd.Arg(0), importConflict, importDryRun, importYes)
+	case "inbound":
+		runInboundCmd(args[1:])
+	case "control":
+		runControlCmd(args[1:])
 	case "setting":
-		err := settingCmd.Parse(os.Args[2:])
+		err := settingCmd.Parse(args[1:])
 		if err != nil {
 			fmt.Println(err)
 			return
@@ -290,13 +598,36 @@ func main() {
 		if (tgbottoken != "") || (tgbotchatid != 0) || (tgbotRuntime != "") {
 			updateTgbotSetting(tgbottoken, tgbotchatid, tgbotRuntime)
 		}
+		if reset || port > 0 || (tgbottoken != "") || (tgbotchatid != 0) || (tgbotRuntime != "") {
+			notifyPanel(control.CmdReloadSettings)
+		}
+	case "rotate-key":
+		rotateKey()
+	case "doctor":
+		err := doctorCmd.Parse(args[1:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		runDoctor(doctorJson)
+	case "backup":
+		err := backupCmd.Parse(args[1:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		backupDB(backupOutput)
+	case "restore":
+		restoreDB(flag.Arg(1))
 	default:
-		fmt.Println("except 'run' or 'v2-ui' or 'setting' subcommands")
+		fmt.Println("except 'run' or 'v2-ui' or 'import' or 'inbound' or 'control' or 'setting' or 'rotate-key' or 'doctor' or 'backup' or 'restore' subcommands")
 		fmt.Println()
 		runCmd.Usage()
 		fmt.Println()
 		v2uiCmd.Usage()
 		fmt.Println()
+		importCmd.Usage()
+		fmt.Println()
 		settingCmd.Usage()
 	}
 }
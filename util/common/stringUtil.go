@@ -1,9 +1,59 @@
 package common
 
-import "sort"
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
 
 func IsSubString(target string, str_array []string) bool {
 	sort.Strings(str_array)
 	index := sort.SearchStrings(str_array, target)
 	return index < len(str_array) && str_array[index] == target
 }
+
+// ParseInts 解析以逗号分隔的整数列表，忽略空项
+func ParseInts(str string) ([]int, error) {
+	nums := make([]int, 0)
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		num, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, NewError("invalid number:", item)
+		}
+		nums = append(nums, num)
+	}
+	return nums, nil
+}
+
+// ParseChatIds 解析以逗号分隔的 chat id 列表，忽略空项
+func ParseChatIds(str string) ([]int64, error) {
+	chatIds := make([]int64, 0)
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		chatId, err := strconv.ParseInt(item, 10, 64)
+		if err != nil {
+			return nil, NewError("invalid chat id:", item)
+		}
+		chatIds = append(chatIds, chatId)
+	}
+	return chatIds, nil
+}
+
+// SplitTrim 解析以逗号分隔的字符串列表，去掉首尾空白并忽略空项
+func SplitTrim(str string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,148 @@
+package json_util
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// 差异类型
+const (
+	DiffAdd    = "add"
+	DiffRemove = "remove"
+	DiffChange = "change"
+)
+
+// DiffEntry 两个 JSON 文档在某个路径上的差异，路径形如 routing.rules[0].outboundTag，
+// 元素都带有唯一 tag 的数组按 tag 对应，如 inbounds[tag=api].port
+type DiffEntry struct {
+	Path string      `json:"path"`
+	Op   string      `json:"op"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// Diff 比较两个 JSON 文档，忽略格式和对象中键的顺序
+func Diff(oldData []byte, newData []byte) ([]*DiffEntry, error) {
+	var oldValue, newValue interface{}
+	err := json.Unmarshal(oldData, &oldValue)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(newData, &newValue)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*DiffEntry, 0)
+	diffValue("", oldValue, newValue, &entries)
+	return entries, nil
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func diffValue(path string, oldValue interface{}, newValue interface{}, entries *[]*DiffEntry) {
+	switch o := oldValue.(type) {
+	case map[string]interface{}:
+		if n, ok := newValue.(map[string]interface{}); ok {
+			diffObject(path, o, n, entries)
+			return
+		}
+	case []interface{}:
+		if n, ok := newValue.([]interface{}); ok {
+			diffArray(path, o, n, entries)
+			return
+		}
+	}
+	if !reflect.DeepEqual(oldValue, newValue) {
+		*entries = append(*entries, &DiffEntry{Path: path, Op: DiffChange, Old: oldValue, New: newValue})
+	}
+}
+
+func diffObject(path string, oldObj map[string]interface{}, newObj map[string]interface{}, entries *[]*DiffEntry) {
+	keys := make([]string, 0, len(oldObj)+len(newObj))
+	for key := range oldObj {
+		keys = append(keys, key)
+	}
+	for key := range newObj {
+		if _, ok := oldObj[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		oldValue, inOld := oldObj[key]
+		newValue, inNew := newObj[key]
+		keyPath := joinPath(path, key)
+		switch {
+		case !inOld:
+			*entries = append(*entries, &DiffEntry{Path: keyPath, Op: DiffAdd, New: newValue})
+		case !inNew:
+			*entries = append(*entries, &DiffEntry{Path: keyPath, Op: DiffRemove, Old: oldValue})
+		default:
+			diffValue(keyPath, oldValue, newValue, entries)
+		}
+	}
+}
+
+// getTags 数组元素都是带有唯一 tag 的对象时返回各元素的 tag
+func getTags(arr []interface{}) ([]string, bool) {
+	tags := make([]string, 0, len(arr))
+	seen := map[string]bool{}
+	for _, item := range arr {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		tag, ok := obj["tag"].(string)
+		if !ok || tag == "" || seen[tag] {
+			return nil, false
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags, true
+}
+
+func diffArray(path string, oldArr []interface{}, newArr []interface{}, entries *[]*DiffEntry) {
+	oldTags, oldOk := getTags(oldArr)
+	newTags, newOk := getTags(newArr)
+	if oldOk && newOk && len(oldArr) > 0 && len(newArr) > 0 {
+		newIndex := map[string]int{}
+		for i, tag := range newTags {
+			newIndex[tag] = i
+		}
+		oldIndex := map[string]int{}
+		for i, tag := range oldTags {
+			oldIndex[tag] = i
+			itemPath := fmt.Sprintf("%v[tag=%v]", path, tag)
+			if j, ok := newIndex[tag]; ok {
+				diffValue(itemPath, oldArr[i], newArr[j], entries)
+			} else {
+				*entries = append(*entries, &DiffEntry{Path: itemPath, Op: DiffRemove, Old: oldArr[i]})
+			}
+		}
+		for j, tag := range newTags {
+			if _, ok := oldIndex[tag]; !ok {
+				*entries = append(*entries, &DiffEntry{Path: fmt.Sprintf("%v[tag=%v]", path, tag), Op: DiffAdd, New: newArr[j]})
+			}
+		}
+		return
+	}
+	for i := 0; i < len(oldArr) || i < len(newArr); i++ {
+		itemPath := fmt.Sprintf("%v[%v]", path, i)
+		switch {
+		case i >= len(newArr):
+			*entries = append(*entries, &DiffEntry{Path: itemPath, Op: DiffRemove, Old: oldArr[i]})
+		case i >= len(oldArr):
+			*entries = append(*entries, &DiffEntry{Path: itemPath, Op: DiffAdd, New: newArr[i]})
+		default:
+			diffValue(itemPath, oldArr[i], newArr[i], entries)
+		}
+	}
+}
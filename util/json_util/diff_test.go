@@ -0,0 +1,99 @@
+package json_util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		old  string
+		new  string
+		want []*DiffEntry
+	}{
+		{
+			name: "format and key order",
+			old:  `{"a": 1, "b": {"c": [1, 2]}}`,
+			new:  `{"b":{"c":[1,2]},"a":1}`,
+			want: []*DiffEntry{},
+		},
+		{
+			name: "object keys",
+			old:  `{"log": {"loglevel": "warning", "access": "none"}, "dns": {}}`,
+			new:  `{"log": {"loglevel": "debug", "error": "/var/log/error.log"}, "dns": {}}`,
+			want: []*DiffEntry{
+				{Path: "log.access", Op: DiffRemove, Old: "none"},
+				{Path: "log.error", Op: DiffAdd, New: "/var/log/error.log"},
+				{Path: "log.loglevel", Op: DiffChange, Old: "warning", New: "debug"},
+			},
+		},
+		{
+			name: "tagged array reordered",
+			old:  `{"inbounds": [{"tag": "api", "port": 62789}, {"tag": "in", "port": 443}]}`,
+			new:  `{"inbounds": [{"tag": "in", "port": 443}, {"tag": "api", "port": 62789}]}`,
+			want: []*DiffEntry{},
+		},
+		{
+			name: "tagged array",
+			old:  `{"outbounds": [{"tag": "direct", "protocol": "freedom"}, {"tag": "blocked", "protocol": "blackhole"}]}`,
+			new:  `{"outbounds": [{"tag": "proxy", "protocol": "socks"}, {"tag": "direct", "protocol": "dns"}]}`,
+			want: []*DiffEntry{
+				{Path: "outbounds[tag=direct].protocol", Op: DiffChange, Old: "freedom", New: "dns"},
+				{Path: "outbounds[tag=blocked]", Op: DiffRemove, Old: map[string]interface{}{"tag": "blocked", "protocol": "blackhole"}},
+				{Path: "outbounds[tag=proxy]", Op: DiffAdd, New: map[string]interface{}{"tag": "proxy", "protocol": "socks"}},
+			},
+		},
+		{
+			name: "array by index",
+			old:  `{"rules": [{"outboundTag": "a"}, {"outboundTag": "b"}]}`,
+			new:  `{"rules": [{"outboundTag": "a"}, {"outboundTag": "c"}, {"outboundTag": "d"}]}`,
+			want: []*DiffEntry{
+				{Path: "rules[1].outboundTag", Op: DiffChange, Old: "b", New: "c"},
+				{Path: "rules[2]", Op: DiffAdd, New: map[string]interface{}{"outboundTag": "d"}},
+			},
+		},
+		{
+			name: "duplicate tags compared by index",
+			old:  `[{"tag": "a", "v": 1}, {"tag": "a", "v": 2}]`,
+			new:  `[{"tag": "a", "v": 1}]`,
+			want: []*DiffEntry{
+				{Path: "[1]", Op: DiffRemove, Old: map[string]interface{}{"tag": "a", "v": float64(2)}},
+			},
+		},
+		{
+			name: "type change",
+			old:  `{"a": {"b": 1}, "c": [1], "d": 1}`,
+			new:  `{"a": [1], "c": "x", "d": "1"}`,
+			want: []*DiffEntry{
+				{Path: "a", Op: DiffChange, Old: map[string]interface{}{"b": float64(1)}, New: []interface{}{float64(1)}},
+				{Path: "c", Op: DiffChange, Old: []interface{}{float64(1)}, New: "x"},
+				{Path: "d", Op: DiffChange, Old: float64(1), New: "1"},
+			},
+		},
+	} {
+		got, err := Diff([]byte(c.old), []byte(c.new))
+		if err != nil {
+			t.Errorf("%v: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v: Diff =", c.name)
+			for _, entry := range got {
+				t.Errorf("  %+v", entry)
+			}
+		}
+	}
+}
+
+func TestDiffInvalid(t *testing.T) {
+	for _, c := range [][2]string{
+		{`{`, `{}`},
+		{`{}`, `not json`},
+	} {
+		_, err := Diff([]byte(c[0]), []byte(c[1]))
+		if err == nil {
+			t.Errorf("Diff(%q, %q) succeeded", c[0], c[1])
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	AuthNone    = "none"
+	AuthSuccess = "success"
+	AuthFailed  = "failed"
+)
+
+var ErrAuthFailed = errors.New("proxy authentication failed")
+
+// Result 代理握手测试结果，耗时单位为毫秒
+type Result struct {
+	ConnectLatency   int64  `json:"connectLatency"`
+	HandshakeLatency int64  `json:"handshakeLatency"`
+	Auth             string `json:"auth"`
+	ExitIP           string `json:"exitIp"`
+}
+
+// TLSOptions https 代理的 TLS 参数。ServerName 为空时使用代理地址，
+// 代理地址是 IP 而证书只签发给域名时需要填写 ServerName 或允许不安全的证书
+type TLSOptions struct {
+	ServerName    string
+	AllowInsecure bool
+}
+
+func (o *TLSOptions) getConfig(address string) *tls.Config {
+	config := &tls.Config{ServerName: address}
+	if o != nil {
+		if o.ServerName != "" {
+			config.ServerName = o.ServerName
+		}
+		config.InsecureSkipVerify = o.AllowInsecure
+	}
+	return config
+}
+
+// Probe 通过 socks5 或 http(s) 代理连接 target，并经由代理请求 target 获取出口 IP，tlsOptions 仅用于 https 代理。
+// 出错时也会返回已完成部分的结果，便于区分连接失败和认证失败
+func Probe(protocol string, address string, port int, username string, password string, tlsOptions *TLSOptions, target string, timeout time.Duration) (*Result, error) {
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if targetURL.Scheme != "http" && targetURL.Scheme != "https" {
+		return nil, fmt.Errorf("probe target must be http or https url: %v", target)
+	}
+	targetHost := targetURL.Hostname()
+	targetPort := targetURL.Port()
+	if targetPort == "" {
+		if targetURL.Scheme == "https" {
+			targetPort = "443"
+		} else {
+			targetPort = "80"
+		}
+	}
+
+	result := &Result{Auth: AuthNone}
+	deadline := time.Now().Add(timeout)
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(address, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return result, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline)
+	if protocol == "https" {
+		tlsConn := tls.Client(conn, tlsOptions.getConfig(address))
+		err = tlsConn.Handshake()
+		if err != nil {
+			return result, err
+		}
+		conn = tlsConn
+	}
+	result.ConnectLatency = time.Since(start).Milliseconds()
+
+	start = time.Now()
+	switch protocol {
+	case "socks", "socks5":
+		err = socks5Connect(conn, username, password, targetHost, targetPort, result)
+	case "http", "https":
+		err = httpConnect(conn, username, password, targetHost, targetPort, result)
+	default:
+		return result, fmt.Errorf("unsupported proxy protocol: %v", protocol)
+	}
+	if err != nil {
+		return result, err
+	}
+	result.HandshakeLatency = time.Since(start).Milliseconds()
+
+	if targetURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: targetHost})
+		err = tlsConn.Handshake()
+		if err != nil {
+			return result, err
+		}
+		conn = tlsConn
+	}
+	result.ExitIP, err = requestExitIP(conn, targetURL)
+	return result, err
+}
+
+func socks5Connect(conn net.Conn, username string, password string, host string, port string, result *Result) error {
+	methods := []byte{0x00}
+	if username != "" || password != "" {
+		methods = []byte{0x00, 0x02}
+	}
+	_, err := conn.Write(append([]byte{0x05, byte(len(methods))}, methods...))
+	if err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	_, err = io.ReadFull(conn, reply)
+	if err != nil {
+		return err
+	}
+	if reply[0] != 0x05 {
+		return fmt.Errorf("unexpected socks version: %v", reply[0])
+	}
+	switch reply[1] {
+	case 0x00:
+	case 0x02:
+		if len(username) > 255 || len(password) > 255 {
+			return errors.New("socks username or password too long")
+		}
+		req := []byte{0x01, byte(len(username))}
+		req = append(req, username...)
+		req = append(req, byte(len(password)))
+		req = append(req, password...)
+		_, err = conn.Write(req)
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadFull(conn, reply)
+		if err != nil {
+			return err
+		}
+		if reply[1] != 0x00 {
+			result.Auth = AuthFailed
+			return ErrAuthFailed
+		}
+		result.Auth = AuthSuccess
+	case 0xff:
+		result.Auth = AuthFailed
+		return errors.New("socks server accepts none of the offered auth methods")
+	default:
+		return fmt.Errorf("unsupported socks auth method: %v", reply[1])
+	}
+
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		return err
+	}
+	req := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			req = append(req, 0x01)
+			req = append(req, ip4...)
+		} else {
+			req = append(req, 0x04)
+			req = append(req, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return errors.New("probe target host too long")
+		}
+		req = append(req, 0x03, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = append(req, 0, 0)
+	binary.BigEndian.PutUint16(req[len(req)-2:], uint16(portNum))
+	_, err = conn.Write(req)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	_, err = io.ReadFull(conn, header)
+	if err != nil {
+		return err
+	}
+	if header[1] != 0x00 {
+		return fmt.Errorf("socks connect failed, reply code: %v", header[1])
+	}
+	var addrLen int
+	switch header[3] {
+	case 0x01:
+		addrLen = net.IPv4len
+	case 0x04:
+		addrLen = net.IPv6len
+	case 0x03:
+		l := make([]byte, 1)
+		_, err = io.ReadFull(conn, l)
+		if err != nil {
+			return err
+		}
+		addrLen = int(l[0])
+	default:
+		return fmt.Errorf("unknown socks address type: %v", header[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, addrLen+2))
+	return err
+}
+
+func httpConnect(conn net.Conn, username string, password string, host string, port string, result *Result) error {
+	hostPort := net.JoinHostPort(host, port)
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: hostPort},
+		Host:   hostPort,
+		Header: http.Header{},
+	}
+	if username != "" || password != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	err := req.Write(conn)
+	if err != nil {
+		return err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusProxyAuthRequired:
+		result.Auth = AuthFailed
+		return ErrAuthFailed
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("http connect failed: %v", resp.Status)
+	}
+	if username != "" || password != "" {
+		result.Auth = AuthSuccess
+	}
+	return nil
+}
+
+// requestExitIP 通过已建立的隧道请求探测地址，支持纯文本或 {"ip": "..."} 格式的响应
+func requestExitIP(conn net.Conn, target *url.URL) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "curl/7.68.0")
+	req.Close = true
+	err = req.Write(conn)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("probe target response: %v", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	text := strings.TrimSpace(string(body))
+	if net.ParseIP(text) != nil {
+		return text, nil
+	}
+	obj := struct {
+		IP string `json:"ip"`
+	}{}
+	if json.Unmarshal(body, &obj) == nil && net.ParseIP(obj.IP) != nil {
+		return obj.IP, nil
+	}
+	return "", fmt.Errorf("probe target response is not an ip: %.64s", text)
+}
@@ -0,0 +1,242 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testExitIP = "203.0.113.7"
+
+// startTarget 启动返回出口 IP 的测试地址
+func startTarget(t *testing.T, body string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// startProxy 启动代理监听，每个连接交给 handle 处理，返回监听端口
+func startProxy(t *testing.T, listener net.Listener, handle func(conn net.Conn)) int {
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func listen(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return listener
+}
+
+// relay 连接目标地址并在两端之间转发数据，reader 中可能已经缓存了客户端发来的数据
+func relay(conn net.Conn, reader io.Reader, addr string) {
+	upstream, err := net.Dial("tcp", addr)
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+	go io.Copy(upstream, reader)
+	io.Copy(conn, upstream)
+}
+
+// socks5Handler 最小的 socks5 服务端，username 为空时不要求认证
+func socks5Handler(username string, password string) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		methods := make([]byte, header[1])
+		if _, err := io.ReadFull(conn, methods); err != nil {
+			return
+		}
+		if username == "" {
+			conn.Write([]byte{0x05, 0x00})
+		} else {
+			conn.Write([]byte{0x05, 0x02})
+			buf := make([]byte, 2)
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				return
+			}
+			user := make([]byte, buf[1])
+			io.ReadFull(conn, user)
+			io.ReadFull(conn, buf[:1])
+			pass := make([]byte, buf[0])
+			io.ReadFull(conn, pass)
+			if string(user) != username || string(pass) != password {
+				conn.Write([]byte{0x01, 0x01})
+				return
+			}
+			conn.Write([]byte{0x01, 0x00})
+		}
+
+		req := make([]byte, 4)
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		var host string
+		switch req[3] {
+		case 0x01:
+			ip := make([]byte, net.IPv4len)
+			io.ReadFull(conn, ip)
+			host = net.IP(ip).String()
+		case 0x03:
+			l := make([]byte, 1)
+			io.ReadFull(conn, l)
+			name := make([]byte, l[0])
+			io.ReadFull(conn, name)
+			host = string(name)
+		default:
+			return
+		}
+		port := make([]byte, 2)
+		io.ReadFull(conn, port)
+		conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		relay(conn, conn, net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	}
+}
+
+// httpConnectHandler 最小的 http CONNECT 代理，username 为空时不要求认证
+func httpConnectHandler(username string, password string) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		req, err := http.ReadRequest(reader)
+		if err != nil || req.Method != http.MethodConnect {
+			return
+		}
+		if username != "" {
+			auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+			if req.Header.Get("Proxy-Authorization") != auth {
+				io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\nContent-Length: 0\r\n\r\n")
+				return
+			}
+		}
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		relay(conn, reader, req.Host)
+	}
+}
+
+func TestProbeSocks5NoAuth(t *testing.T) {
+	target := startTarget(t, testExitIP)
+	port := startProxy(t, listen(t), socks5Handler("", ""))
+	result, err := Probe("socks", "127.0.0.1", port, "", "", nil, target, time.Second*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Auth != AuthNone {
+		t.Errorf("auth = %v, want %v", result.Auth, AuthNone)
+	}
+	if result.ExitIP != testExitIP {
+		t.Errorf("exit ip = %v, want %v", result.ExitIP, testExitIP)
+	}
+}
+
+func TestProbeSocks5Auth(t *testing.T) {
+	target := startTarget(t, testExitIP)
+	port := startProxy(t, listen(t), socks5Handler("user", "pass"))
+
+	result, err := Probe("socks", "127.0.0.1", port, "user", "pass", nil, target, time.Second*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Auth != AuthSuccess || result.ExitIP != testExitIP {
+		t.Errorf("result = %+v, want auth success and exit ip %v", result, testExitIP)
+	}
+
+	result, err = Probe("socks", "127.0.0.1", port, "user", "wrong", nil, target, time.Second*5)
+	if err != ErrAuthFailed {
+		t.Fatalf("err = %v, want %v", err, ErrAuthFailed)
+	}
+	if result.Auth != AuthFailed {
+		t.Errorf("auth = %v, want %v", result.Auth, AuthFailed)
+	}
+}
+
+func TestProbeHttpConnect(t *testing.T) {
+	target := startTarget(t, testExitIP)
+	port := startProxy(t, listen(t), httpConnectHandler("user", "pass"))
+
+	result, err := Probe("http", "127.0.0.1", port, "user", "pass", nil, target, time.Second*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Auth != AuthSuccess || result.ExitIP != testExitIP {
+		t.Errorf("result = %+v, want auth success and exit ip %v", result, testExitIP)
+	}
+
+	result, err = Probe("http", "127.0.0.1", port, "user", "wrong", nil, target, time.Second*5)
+	if err != ErrAuthFailed {
+		t.Fatalf("err = %v, want %v", err, ErrAuthFailed)
+	}
+	if result.Auth != AuthFailed {
+		t.Errorf("auth = %v, want %v", result.Auth, AuthFailed)
+	}
+}
+
+func TestProbeHttpsProxyByIP(t *testing.T) {
+	// httptest 的自签名证书不受系统信任，模拟使用 IP 连接证书不匹配的 https 代理
+	certServer := httptest.NewTLSServer(http.NotFoundHandler())
+	certServer.Close()
+	listener := tls.NewListener(listen(t), &tls.Config{Certificates: certServer.TLS.Certificates})
+	port := startProxy(t, listener, httpConnectHandler("", ""))
+	target := startTarget(t, testExitIP)
+
+	_, err := Probe("https", "127.0.0.1", port, "", "", nil, target, time.Second*5)
+	if err == nil {
+		t.Fatal("probe https proxy with untrusted certificate should fail")
+	}
+
+	result, err := Probe("https", "127.0.0.1", port, "", "", &TLSOptions{ServerName: "example.com", AllowInsecure: true}, target, time.Second*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitIP != testExitIP {
+		t.Errorf("exit ip = %v, want %v", result.ExitIP, testExitIP)
+	}
+}
+
+func TestProbeExitIP(t *testing.T) {
+	port := startProxy(t, listen(t), socks5Handler("", ""))
+	for _, c := range []struct {
+		body    string
+		exitIP  string
+		success bool
+	}{
+		{testExitIP + "\n", testExitIP, true},
+		{`{"ip": "2001:db8::1", "country": "ZZ"}`, "2001:db8::1", true},
+		{"<html>blocked</html>", "", false},
+	} {
+		target := startTarget(t, c.body)
+		result, err := Probe("socks5", "127.0.0.1", port, "", "", nil, target, time.Second*5)
+		if (err == nil) != c.success {
+			t.Errorf("body %q: err = %v, want success %v", c.body, err, c.success)
+			continue
+		}
+		if result.ExitIP != c.exitIP {
+			t.Errorf("body %q: exit ip = %v, want %v", c.body, result.ExitIP, c.exitIP)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package random
 
 import (
+	crand "crypto/rand"
+	"math/big"
 	"math/rand"
 	"time"
 )
@@ -41,3 +43,17 @@ func Seq(n int) string {
 	}
 	return string(runes)
 }
+
+// SecureSeq 使用 crypto/rand 生成随机字符串，用于密钥、绑定码等不能被猜测的值
+func SecureSeq(n int) (string, error) {
+	runes := make([]rune, n)
+	max := big.NewInt(int64(len(allSeq)))
+	for i := 0; i < n; i++ {
+		index, err := crand.Int(crand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		runes[i] = allSeq[index.Int64()]
+	}
+	return string(runes), nil
+}
@@ -0,0 +1,300 @@
+package seal
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// 密文格式：enc:v1:<主密钥 id>:<被主密钥加密的数据密钥>:<被数据密钥加密的内容>，
+// 每个值使用独立随机的数据密钥，轮换主密钥时只需要用新主密钥重新加密
+const prefix = "enc:v1:"
+
+const keySize = 32
+
+var ErrNoKey = errors.New("encryption key not loaded")
+
+type masterKey struct {
+	id  string
+	key []byte
+}
+
+var keys []*masterKey
+var keyLock sync.RWMutex
+
+// LoadKeyFile 读取主密钥文件，文件不存在时生成新密钥。
+// 文件每行一个 "<id> <base64 密钥>"，第一行为当前用于加密的密钥，其余仅用于解密
+func LoadKeyFile(path string) error {
+	loaded, err := readKeyFile(path)
+	if os.IsNotExist(err) {
+		key, genErr := generateKey()
+		if genErr != nil {
+			return genErr
+		}
+		loaded = []*masterKey{key}
+		err = writeKeyFile(path, loaded)
+	}
+	if err != nil {
+		return err
+	}
+	keyLock.Lock()
+	keys = loaded
+	keyLock.Unlock()
+	return nil
+}
+
+func generateKey() (*masterKey, error) {
+	key := make([]byte, keySize)
+	_, err := io.ReadFull(rand.Reader, key)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 4)
+	_, err = io.ReadFull(rand.Reader, id)
+	if err != nil {
+		return nil, err
+	}
+	return &masterKey{id: hex.EncodeToString(id), key: key}, nil
+}
+
+func readKeyFile(path string) ([]*masterKey, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	loaded := make([]*masterKey, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid key file line: %v", line)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("invalid key length of key %v: %v", fields[0], len(key))
+		}
+		loaded = append(loaded, &masterKey{id: fields[0], key: key})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(loaded) == 0 {
+		return nil, fmt.Errorf("no key found in key file: %v", path)
+	}
+	return loaded, nil
+}
+
+// writeKeyFile 先写临时文件再重命名，避免写入中断导致密钥文件损坏
+func writeKeyFile(path string, writeKeys []*masterKey) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	builder := strings.Builder{}
+	for _, key := range writeKeys {
+		builder.WriteString(key.id)
+		builder.WriteString(" ")
+		builder.WriteString(base64.StdEncoding.EncodeToString(key.key))
+		builder.WriteString("\n")
+	}
+	tmpPath := path + ".tmp"
+	err = os.WriteFile(tmpPath, []byte(builder.String()), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// RotateKey 生成新的主密钥并调用 reencrypt 用新密钥重新加密所有数据。
+// reencrypt 执行期间旧密钥仍保留在密钥文件中，失败时不会丢失解密能力；成功后移除旧密钥
+func RotateKey(path string, reencrypt func() error) error {
+	keyLock.RLock()
+	oldKeys := keys
+	keyLock.RUnlock()
+	if len(oldKeys) == 0 {
+		return ErrNoKey
+	}
+	newKey, err := generateKey()
+	if err != nil {
+		return err
+	}
+	allKeys := append([]*masterKey{newKey}, oldKeys...)
+	err = writeKeyFile(path, allKeys)
+	if err != nil {
+		return err
+	}
+	keyLock.Lock()
+	keys = allKeys
+	keyLock.Unlock()
+
+	err = reencrypt()
+	if err != nil {
+		return err
+	}
+
+	err = writeKeyFile(path, allKeys[:1])
+	if err != nil {
+		return err
+	}
+	keyLock.Lock()
+	keys = allKeys[:1]
+	keyLock.Unlock()
+	return nil
+}
+
+// GetKeyId 返回当前用于加密的主密钥 id
+func GetKeyId() string {
+	keyLock.RLock()
+	defer keyLock.RUnlock()
+	if len(keys) == 0 {
+		return ""
+	}
+	return keys[0].id
+}
+
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+func gcmSeal(key []byte, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func gcmOpen(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce := data[:gcm.NonceSize()]
+	return gcm.Open(nil, nonce, data[gcm.NonceSize():], nil)
+}
+
+// Encrypt 使用当前主密钥加密，空字符串和已加密的值原样返回
+func Encrypt(value string) (string, error) {
+	if value == "" || IsEncrypted(value) {
+		return value, nil
+	}
+	keyLock.RLock()
+	if len(keys) == 0 {
+		keyLock.RUnlock()
+		return "", ErrNoKey
+	}
+	key := keys[0]
+	keyLock.RUnlock()
+
+	dataKey := make([]byte, keySize)
+	_, err := io.ReadFull(rand.Reader, dataKey)
+	if err != nil {
+		return "", err
+	}
+	wrappedKey, err := gcmSeal(key.key, dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := gcmSeal(dataKey, []byte(value))
+	if err != nil {
+		return "", err
+	}
+	return prefix + key.id + ":" +
+		base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt 解密 Encrypt 生成的密文，未加密的值原样返回，兼容加密前写入的旧数据
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("invalid ciphertext format")
+	}
+	keyLock.RLock()
+	var key *masterKey
+	for _, k := range keys {
+		if k.id == parts[0] {
+			key = k
+			break
+		}
+	}
+	keyLock.RUnlock()
+	if key == nil {
+		return "", fmt.Errorf("encryption key %v not found", parts[0])
+	}
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := gcmOpen(key.key, wrappedKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := gcmOpen(dataKey, ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// ReencryptStale 只重新加密不是使用当前主密钥加密的值，未加密的值原样返回
+func ReencryptStale(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	keyId := strings.SplitN(strings.TrimPrefix(value, prefix), ":", 2)[0]
+	if keyId == GetKeyId() {
+		return value, nil
+	}
+	return Reencrypt(value)
+}
+
+// Reencrypt 解密后使用当前主密钥重新加密，用于密钥轮换
+func Reencrypt(value string) (string, error) {
+	plaintext, err := Decrypt(value)
+	if err != nil {
+		return "", err
+	}
+	return Encrypt(plaintext)
+}
@@ -0,0 +1,185 @@
+package seal
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadTestKey(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "secret.key")
+	err := LoadKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func mustEncrypt(t *testing.T, value string) string {
+	encrypted, err := Encrypt(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encrypted
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	loadTestKey(t)
+	for _, value := range []string{"password", "中文密码", strings.Repeat("x", 4096)} {
+		encrypted := mustEncrypt(t, value)
+		if !IsEncrypted(encrypted) || strings.Contains(encrypted, value) {
+			t.Errorf("Encrypt(%q) = %q", value, encrypted)
+		}
+		// 每次加密使用随机的数据密钥和 nonce
+		if again := mustEncrypt(t, value); again == encrypted {
+			t.Errorf("Encrypt(%q) returned the same ciphertext twice", value)
+		}
+		// 已加密的值不会被再次加密
+		if twice := mustEncrypt(t, encrypted); twice != encrypted {
+			t.Errorf("Encrypt of ciphertext = %q, want unchanged", twice)
+		}
+		decrypted, err := Decrypt(encrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decrypted != value {
+			t.Errorf("Decrypt = %q, want %q", decrypted, value)
+		}
+	}
+	if empty := mustEncrypt(t, ""); empty != "" {
+		t.Errorf("Encrypt(\"\") = %q, want empty", empty)
+	}
+}
+
+func TestDecryptPlaintext(t *testing.T) {
+	loadTestKey(t)
+	// 加密前写入的旧数据原样返回
+	for _, value := range []string{"", "password", "enc:", "enc:v2:abc"} {
+		decrypted, err := Decrypt(value)
+		if err != nil {
+			t.Errorf("Decrypt(%q) error: %v", value, err)
+		}
+		if decrypted != value {
+			t.Errorf("Decrypt(%q) = %q, want unchanged", value, decrypted)
+		}
+	}
+}
+
+func TestDecryptWrongKey(t *testing.T) {
+	path := loadTestKey(t)
+	encrypted := mustEncrypt(t, "password")
+	keyId := GetKeyId()
+
+	// 其他密钥文件中没有这个密钥 id
+	loadTestKey(t)
+	_, err := Decrypt(encrypted)
+	if err == nil {
+		t.Error("Decrypt with another key file succeeded")
+	}
+
+	// 密钥 id 相同但密钥内容不同
+	other := base64.StdEncoding.EncodeToString(make([]byte, keySize))
+	err = os.WriteFile(path, []byte(keyId+" "+other+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = LoadKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Decrypt(encrypted)
+	if err == nil {
+		t.Error("Decrypt with a different key of the same id succeeded")
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	loadTestKey(t)
+	encrypted := mustEncrypt(t, "password")
+	parts := strings.Split(strings.TrimPrefix(encrypted, prefix), ":")
+
+	flip := func(s string) string {
+		data, err := base64.RawStdEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[len(data)-1] ^= 1
+		return base64.RawStdEncoding.EncodeToString(data)
+	}
+	for _, value := range []string{
+		prefix + parts[0] + ":" + flip(parts[1]) + ":" + parts[2],
+		prefix + parts[0] + ":" + parts[1] + ":" + flip(parts[2]),
+		prefix + parts[0] + ":" + parts[1] + ":" + parts[2][:8],
+		prefix + parts[0] + ":" + parts[1],
+		prefix + parts[0] + ":" + parts[1] + ":!!!",
+	} {
+		_, err := Decrypt(value)
+		if err == nil {
+			t.Errorf("Decrypt(%q) succeeded", value)
+		}
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	path := loadTestKey(t)
+	oldKeyId := GetKeyId()
+	stored := []string{mustEncrypt(t, "a"), mustEncrypt(t, "b"), "plain"}
+	original := append([]string{}, stored...)
+
+	// 重新加密失败时保留旧密钥，已有数据仍能解密
+	err := RotateKey(path, func() error {
+		return errors.New("failed")
+	})
+	if err == nil {
+		t.Fatal("RotateKey succeeded with a failed reencrypt")
+	}
+	for _, value := range original {
+		if _, err := Decrypt(value); err != nil {
+			t.Errorf("Decrypt after failed rotation: %v", err)
+		}
+	}
+
+	err = RotateKey(path, func() error {
+		for i := range stored {
+			value, err := ReencryptStale(stored[i])
+			if err != nil {
+				return err
+			}
+			stored[i] = value
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKeyId := GetKeyId()
+	if newKeyId == oldKeyId {
+		t.Fatal("key id did not change after rotation")
+	}
+	for i, want := range []string{"a", "b", "plain"} {
+		value, err := Decrypt(stored[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != want {
+			t.Errorf("Decrypt after rotation = %q, want %q", value, want)
+		}
+	}
+	if stored[2] != "plain" {
+		t.Errorf("plaintext value was encrypted during rotation: %q", stored[2])
+	}
+	// 旧密钥已经从密钥文件中移除
+	if _, err := Decrypt(original[0]); err == nil {
+		t.Error("Decrypt with the removed key succeeded")
+	}
+	loaded, err := readKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 1 || loaded[0].id != newKeyId {
+		t.Errorf("key file has %v keys, want only %v", len(loaded), newKeyId)
+	}
+}
@@ -0,0 +1,33 @@
+package sys
+
+import (
+	"github.com/shirou/gopsutil/net"
+	"github.com/shirou/gopsutil/process"
+)
+
+// GetListenPortOwner 返回监听该 TCP 端口的进程名，端口未被监听时返回空字符串，
+// 无法获取进程时返回 unknown
+func GetListenPortOwner(port int) (string, error) {
+	conns, err := net.Connections("tcp")
+	if err != nil {
+		return "", err
+	}
+	for _, conn := range conns {
+		if conn.Status != "LISTEN" || int(conn.Laddr.Port) != port {
+			continue
+		}
+		if conn.Pid <= 0 {
+			return "unknown", nil
+		}
+		p, err := process.NewProcess(conn.Pid)
+		if err != nil {
+			return "unknown", nil
+		}
+		name, err := p.Name()
+		if err != nil {
+			return "unknown", nil
+		}
+		return name, nil
+	}
+	return "", nil
+}
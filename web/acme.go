@@ -0,0 +1,116 @@
+package web
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+	"x-ui/config"
+	"x-ui/logger"
+	"x-ui/web/service"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newAcmeManager 启用 ACME 时创建证书管理器，未启用时返回 nil。
+// 账号密钥和证书缓存在数据库所在目录的 acme 目录，证书通过 GetCertificate 提供，
+// 到期前自动续期并替换，不需要重启面板
+func (s *Server) newAcmeManager() (*autocert.Manager, error) {
+	enable, err := s.settingService.GetAcmeEnable()
+	if err != nil || !enable {
+		return nil, err
+	}
+	domains, err := s.settingService.GetAcmeDomains()
+	if err != nil {
+		return nil, err
+	}
+	email, err := s.settingService.GetAcmeEmail()
+	if err != nil {
+		return nil, err
+	}
+	client, err := s.settingService.NewAcmeClient()
+	if err != nil {
+		return nil, err
+	}
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(config.GetAcmeCacheDir()),
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Email:      email,
+		Client:     client,
+	}, nil
+}
+
+// startAcmeHttpServer 使用 HTTP-01 验证时在 acmeHttpListen 上响应验证请求，
+// 其他请求跳转到面板的 https 地址。autocert 总是先尝试 TLS-ALPN-01，失败后再使用 HTTP-01
+func (s *Server) startAcmeHttpServer(m *autocert.Manager, port int) error {
+	challenge, err := s.settingService.GetAcmeChallenge()
+	if err != nil {
+		return err
+	}
+	if challenge != service.AcmeChallengeHttp01 {
+		// 端口可能通过命令行修改，没有经过设置校验
+		if port != 443 {
+			logger.Warningf("acme tls-alpn-01 challenge requires the panel port to be 443, current port is %v", port)
+		}
+		return nil
+	}
+	httpListen, err := s.settingService.GetAcmeHttpListen()
+	if err != nil {
+		return err
+	}
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := "https://" + net.JoinHostPort(r.Host, strconv.Itoa(port)) + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusFound)
+	})
+	handler := m.HTTPHandler(redirect)
+	listener, err := net.Listen("tcp", httpListen)
+	if err != nil {
+		return err
+	}
+	logger.Info("acme http-01 server run on", listener.Addr())
+	s.acmeListener = listener
+	service.SetAcmeHttpServing(true)
+	s.acmeServer = &http.Server{
+		// autocert 按 Host 检查域名，监听非 80 端口时 Host 中带有端口，需要先去掉
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// 证书库签发入站证书时也通过这个服务验证
+			if service.HandleAcmeHttpChallenge(w, r) {
+				return
+			}
+			host, _, err := net.SplitHostPort(r.Host)
+			if err == nil {
+				r.Host = host
+			}
+			handler.ServeHTTP(w, r)
+		}),
+	}
+	go func() {
+		s.acmeServer.Serve(listener)
+	}()
+	return nil
+}
+
+// prefetchAcmeCerts 启动后立即为所有域名获取证书，已缓存的证书直接加载并安排续期，
+// 避免第一次访问面板时等待签发
+func (s *Server) prefetchAcmeCerts(m *autocert.Manager) {
+	domains, err := s.settingService.GetAcmeDomains()
+	if err != nil {
+		logger.Warning("get acme domains failed:", err)
+		return
+	}
+	for _, domain := range domains {
+		hello := &tls.ClientHelloInfo{
+			ServerName:   domain,
+			CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		}
+		cert, err := m.GetCertificate(hello)
+		if err != nil {
+			logger.Warningf("acme obtain certificate for %v failed: %v", domain, err)
+			continue
+		}
+		if cert.Leaf != nil {
+			logger.Infof("acme certificate for %v is valid until %v", domain, cert.Leaf.NotAfter.Format("2006-01-02 15:04:05"))
+		}
+	}
+}
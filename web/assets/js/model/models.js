@@ -52,6 +52,9 @@ class DBInbound {
         this.secondaryForwardPort = 0;
         this.secondaryForwardUsername = "";
         this.secondaryForwardPassword = "";
+        this.secondaryForwardSettings = "";
+        this.secondaryForwardLink = "";
+        this.secondaryForwardPoolId = 0;
 
         if (data == null) {
             return;
@@ -130,6 +133,9 @@ class DBInbound {
         if (!this.hasSecondaryForward) {
             return "";
         }
+        if (this.secondaryForwardProtocol === "pool") {
+            return `pool-${this.secondaryForwardPoolId}`;
+        }
         return `${this.secondaryForwardAddress}:${this.secondaryForwardPort}`;
     }
 
@@ -170,6 +176,8 @@ class DBInbound {
             secondaryForwardPort: this.secondaryForwardPort,
             secondaryForwardUsername: this.secondaryForwardUsername,
             secondaryForwardPassword: this.secondaryForwardPassword,
+            secondaryForwardSettings: this.secondaryForwardSettings,
+            secondaryForwardPoolId: this.secondaryForwardPoolId,
         };
         return Inbound.fromJson(config);
     }
@@ -197,9 +205,29 @@ class DBInbound {
             return { valid: true, message: "" };
         }
         
+        // 填写了分享链接时由服务端解析
+        if (!ObjectUtil.isEmpty(this.secondaryForwardLink)) {
+            return { valid: true, message: "" };
+        }
+
         if (this.secondaryForwardProtocol === "none" || this.secondaryForwardProtocol === "") {
             return { valid: false, message: "启用二次转发时必须选择协议类型" };
         }
+
+        if (this.secondaryForwardProtocol === "pool") {
+            if (this.secondaryForwardPoolId <= 0) {
+                return { valid: false, message: "请选择上游池" };
+            }
+            return { valid: true, message: "" };
+        }
+
+        if (!ObjectUtil.isEmpty(this.secondaryForwardSettings)) {
+            try {
+                JSON.parse(this.secondaryForwardSettings);
+            } catch (e) {
+                return { valid: false, message: "二次转发扩展参数不是有效的 JSON" };
+            }
+        }
         
         if (ObjectUtil.isEmpty(this.secondaryForwardAddress)) {
             return { valid: false, message: "二次转发服务器地址不能为空" };
@@ -215,24 +243,14 @@ class DBInbound {
 
 class AllSetting {
 
+    // 设置项由后端的设置项定义决定，这里原样保存接口返回的所有设置
     constructor(data) {
-        this.webListen = "";
-        this.webPort = 54321;
-        this.webCertFile = "";
-        this.webKeyFile = "";
-        this.webBasePath = "/";
-        this.tgBotEnable = false;
-        this.tgBotToken = "";
-        this.tgBotChatId = 0;
-        this.tgRunTime = "";
-        this.xrayTemplateConfig = "";
-
-        this.timeLocation = "Asia/Shanghai";
-
         if (data == null) {
             return
         }
-        ObjectUtil.cloneProps(this, data);
+        for (const key of Object.keys(data)) {
+            this[key] = data[key];
+        }
     }
 
     equals(other) {
@@ -24,6 +24,9 @@ const SSMethods = {
     CHACHA20_POLY1305: 'chacha20-poly1305',
     AES_256_GCM: 'aes-256-gcm',
     AES_128_GCM: 'aes-128-gcm',
+    BLAKE3_AES_128_GCM: '2022-blake3-aes-128-gcm',
+    BLAKE3_AES_256_GCM: '2022-blake3-aes-256-gcm',
+    BLAKE3_CHACHA20_POLY1305: '2022-blake3-chacha20-poly1305',
 };
 
 const RULE_IP = {
@@ -43,6 +46,16 @@ const RULE_DOMAIN = {
 const FLOW_CONTROL = {
     ORIGIN: "xtls-rprx-origin",
     DIRECT: "xtls-rprx-direct",
+    VISION: "xtls-rprx-vision",
+};
+
+const UTLS_FINGERPRINT = {
+    CHROME: 'chrome',
+    FIREFOX: 'firefox',
+    SAFARI: 'safari',
+    IOS: 'ios',
+    EDGE: 'edge',
+    RANDOM: 'random',
 };
 
 Object.freeze(Protocols);
@@ -51,6 +64,7 @@ Object.freeze(SSMethods);
 Object.freeze(RULE_IP);
 Object.freeze(RULE_DOMAIN);
 Object.freeze(FLOW_CONTROL);
+Object.freeze(UTLS_FINGERPRINT);
 
 class XrayCommonClass {
 
@@ -455,17 +469,26 @@ class TlsStreamSettings extends XrayCommonClass {
 }
 
 TlsStreamSettings.Cert = class extends XrayCommonClass {
-    constructor(useFile=true, certificateFile='', keyFile='', certificate='', key='') {
+    constructor(useFile=true, certificateFile='', keyFile='', certificate='', key='', useStore=false, certId=0) {
         super();
         this.useFile = useFile;
         this.certFile = certificateFile;
         this.keyFile = keyFile;
         this.cert = certificate instanceof Array ? certificate.join('\n') : certificate;
         this.key = key instanceof Array ? key.join('\n') : key;
+        // 引用面板证书库中的证书，useFile 决定生成配置时使用文件路径还是证书内容
+        this.useStore = useStore;
+        this.certId = certId;
     }
 
     static fromJson(json={}) {
-        if ('certificateFile' in json && 'keyFile' in json) {
+        if ('certId' in json) {
+            return new TlsStreamSettings.Cert(
+                json.useFile, '', '', '', '',
+                true,
+                json.certId,
+            );
+        } else if ('certificateFile' in json && 'keyFile' in json) {
             return new TlsStreamSettings.Cert(
                 true,
                 json.certificateFile,
@@ -481,7 +504,12 @@ TlsStreamSettings.Cert = class extends XrayCommonClass {
     }
 
     toJson() {
-        if (this.useFile) {
+        if (this.useStore) {
+            return {
+                certId: this.certId,
+                useFile: this.useFile,
+            };
+        } else if (this.useFile) {
             return {
                 certificateFile: this.certFile,
                 keyFile: this.keyFile,
@@ -495,6 +523,62 @@ TlsStreamSettings.Cert = class extends XrayCommonClass {
     }
 };
 
+class RealityStreamSettings extends XrayCommonClass {
+    constructor(show=false, dest='', xver=0, serverNames=[], privateKey='', shortIds=[''],
+                publicKey='', fingerprint=UTLS_FINGERPRINT.CHROME, spiderX='/') {
+        super();
+        this.show = show;
+        this.dest = dest;
+        this.xver = xver;
+        this.serverNames = serverNames instanceof Array ? serverNames.join(',') : serverNames;
+        this.privateKey = privateKey;
+        this.shortIds = shortIds instanceof Array ? shortIds.join(',') : shortIds;
+        // 以下为客户端参数，xray 不使用，保存在 settings 中用于生成分享链接
+        this.publicKey = publicKey;
+        this.fingerprint = fingerprint;
+        this.spiderX = spiderX;
+    }
+
+    get serverNameList() {
+        return this.serverNames.split(',').map(name => name.trim()).filter(name => name !== '');
+    }
+
+    get shortIdList() {
+        return this.shortIds.split(',').map(id => id.trim());
+    }
+
+    static fromJson(json={}) {
+        const settings = json.settings || {};
+        return new RealityStreamSettings(
+            json.show,
+            json.dest,
+            json.xver,
+            json.serverNames,
+            json.privateKey,
+            json.shortIds,
+            settings.publicKey,
+            settings.fingerprint,
+            settings.spiderX,
+        );
+    }
+
+    toJson() {
+        return {
+            show: this.show,
+            dest: this.dest,
+            xver: this.xver,
+            serverNames: this.serverNameList,
+            privateKey: this.privateKey,
+            shortIds: this.shortIdList,
+            settings: {
+                publicKey: this.publicKey,
+                fingerprint: this.fingerprint,
+                spiderX: this.spiderX,
+            },
+        };
+    }
+}
+
 class StreamSettings extends XrayCommonClass {
     constructor(network='tcp',
                 security='none',
@@ -505,11 +589,13 @@ class StreamSettings extends XrayCommonClass {
                 httpSettings=new HttpStreamSettings(),
                 quicSettings=new QuicStreamSettings(),
                 grpcSettings=new GrpcStreamSettings(),
+                realitySettings=new RealityStreamSettings(),
                 ) {
         super();
         this.network = network;
         this.security = security;
         this.tls = tlsSettings;
+        this.reality = realitySettings;
         this.tcp = tcpSettings;
         this.kcp = kcpSettings;
         this.ws = wsSettings;
@@ -542,6 +628,18 @@ class StreamSettings extends XrayCommonClass {
         }
     }
 
+    get isReality() {
+        return this.security === "reality";
+    }
+
+    set isReality(isReality) {
+        if (isReality) {
+            this.security = 'reality';
+        } else {
+            this.security = 'none';
+        }
+    }
+
     static fromJson(json={}) {
         let tls;
         if (json.security === "xtls") {
@@ -559,6 +657,7 @@ class StreamSettings extends XrayCommonClass {
             HttpStreamSettings.fromJson(json.httpSettings),
             QuicStreamSettings.fromJson(json.quicSettings),
             GrpcStreamSettings.fromJson(json.grpcSettings),
+            RealityStreamSettings.fromJson(json.realitySettings),
         );
     }
 
@@ -569,6 +668,7 @@ class StreamSettings extends XrayCommonClass {
             security: this.security,
             tlsSettings: this.isTls ? this.tls.toJson() : undefined,
             xtlsSettings: this.isXTls ? this.tls.toJson() : undefined,
+            realitySettings: this.isReality ? this.reality.toJson() : undefined,
             tcpSettings: network === 'tcp' ? this.tcp.toJson() : undefined,
             kcpSettings: network === 'kcp' ? this.kcp.toJson() : undefined,
             wsSettings: network === 'ws' ? this.ws.toJson() : undefined,
@@ -629,6 +729,9 @@ class Inbound extends XrayCommonClass {
         if (protocol === Protocols.TROJAN) {
             this.tls = true;
         }
+        if (this.reality && !this.canEnableReality()) {
+            this.reality = false;
+        }
     }
 
     get tls() {
@@ -655,6 +758,18 @@ class Inbound extends XrayCommonClass {
         }
     }
 
+    get reality() {
+        return this.stream.security === 'reality';
+    }
+
+    set reality(isReality) {
+        if (isReality) {
+            this.stream.security = 'reality';
+        } else {
+            this.stream.security = 'none';
+        }
+    }
+
     get network() {
         return this.stream.network;
     }
@@ -848,6 +963,24 @@ class Inbound extends XrayCommonClass {
         return this.network === "tcp";
     }
 
+    canEnableReality() {
+        switch (this.protocol) {
+            case Protocols.VLESS:
+            case Protocols.TROJAN:
+                break;
+            default:
+                return false;
+        }
+        switch (this.network) {
+            case "tcp":
+            case "http":
+            case "grpc":
+                return true;
+            default:
+                return false;
+        }
+    }
+
     canEnableStream() {
         switch (this.protocol) {
             case Protocols.VMESS:
@@ -1008,7 +1141,11 @@ class Inbound extends XrayCommonClass {
             }
         }
 
-        if (this.xtls) {
+        if (this.reality) {
+            this.setRealityParams(params);
+        }
+
+        if (this.xtls || (this.reality && !ObjectUtil.isEmpty(this.settings.vlesses[0].flow))) {
             params.set("flow", this.settings.vlesses[0].flow);
         }
 
@@ -1021,19 +1158,54 @@ class Inbound extends XrayCommonClass {
         return url.toString();
     }
 
+    // setRealityParams 写入客户端连接 REALITY 需要的参数，shortId 和 serverName 使用第一个
+    setRealityParams(params) {
+        const reality = this.stream.reality;
+        const serverNames = reality.serverNameList;
+        if (serverNames.length > 0) {
+            params.set("sni", serverNames[0]);
+        }
+        params.set("pbk", reality.publicKey);
+        params.set("sid", reality.shortIdList[0]);
+        params.set("fp", reality.fingerprint);
+        if (!ObjectUtil.isEmpty(reality.spiderX)) {
+            params.set("spx", reality.spiderX);
+        }
+    }
+
     genSSLink(address='', remark='') {
         let settings = this.settings;
         const server = this.stream.tls.server;
         if (!ObjectUtil.isEmpty(server)) {
             address = server;
         }
+        if (settings.method.startsWith('2022-')) {
+            // SS 2022 的密钥是 base64，按 SIP002 使用百分号编码而不是 base64 编码用户信息
+            const userInfo = encodeURIComponent(settings.method) + ':' + encodeURIComponent(settings.password);
+            return `ss://${userInfo}@${address}:${this.port}#${encodeURIComponent(remark)}`;
+        }
         return 'ss://' + safeBase64(settings.method + ':' + settings.password + '@' + address + ':' + this.port)
             + '#' + encodeURIComponent(remark);
     }
 
     genTrojanLink(address='', remark='') {
         let settings = this.settings;
-        return `trojan://${settings.clients[0].password}@${address}:${this.port}#${encodeURIComponent(remark)}`;
+        const link = `trojan://${settings.clients[0].password}@${address}:${this.port}#${encodeURIComponent(remark)}`;
+        if (!this.reality) {
+            return link;
+        }
+        const url = new URL(link);
+        const params = new Map();
+        params.set("type", this.stream.network);
+        params.set("security", "reality");
+        if (this.stream.network === "grpc") {
+            params.set("serviceName", this.stream.grpc.serviceName);
+        }
+        this.setRealityParams(params);
+        for (const [key, value] of params) {
+            url.searchParams.set(key, value)
+        }
+        return url.toString();
     }
 
     genLink(address='', remark='') {
@@ -0,0 +1,217 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"x-ui/database"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/web/entity"
+	"x-ui/web/service"
+)
+
+// 控制命令
+const (
+	CmdReloadXray     = "reload-xray"
+	CmdReloadSettings = "reload-settings"
+	CmdDumpStatus     = "dump-status"
+	CmdRotateLogs     = "rotate-logs"
+	CmdRotateKey      = "rotate-key"
+)
+
+// ErrNotRunning 面板没有运行，控制 socket 不存在或无法连接
+var ErrNotRunning = errors.New("panel is not running")
+
+type Request struct {
+	Command string `json:"command"`
+}
+
+// Status dump-status 返回的面板状态
+type Status struct {
+	Pid     int             `json:"pid"`
+	Version string          `json:"version"`
+	Uptime  int64           `json:"uptime"`
+	Server  *service.Status `json:"server"`
+}
+
+type handler func() (interface{}, error)
+
+// Server 面板进程中的控制 socket，只接受 root 用户的连接，
+// 生命周期与进程相同，不随 web 服务重启
+type Server struct {
+	path         string
+	listener     net.Listener
+	startTime    time.Time
+	version      string
+	restartPanel func()
+	handlers     map[string]handler
+	wg           sync.WaitGroup
+
+	xrayService   service.XrayService
+	serverService service.ServerService
+}
+
+// NewServer restartPanel 用于 reload-settings，需要重新读取设置并重启 web 服务
+func NewServer(path string, version string, restartPanel func()) *Server {
+	s := &Server{
+		path:         path,
+		startTime:    time.Now(),
+		version:      version,
+		restartPanel: restartPanel,
+	}
+	s.handlers = map[string]handler{
+		CmdReloadXray:     s.reloadXray,
+		CmdReloadSettings: s.reloadSettings,
+		CmdDumpStatus:     s.dumpStatus,
+		CmdRotateLogs:     s.rotateLogs,
+		CmdRotateKey:      s.rotateKey,
+	}
+	return s
+}
+
+func (s *Server) Start() error {
+	err := os.MkdirAll(filepath.Dir(s.path), 0700)
+	if err != nil {
+		return err
+	}
+	// 上次异常退出时残留的 socket 文件
+	if _, err := Call(s.path, CmdDumpStatus); err == nil {
+		return common.NewError("another panel is already listening on", s.path)
+	}
+	os.Remove(s.path)
+	listener, err := net.Listen("unix", s.path)
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(s.path, 0600)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	s.listener = listener
+	s.wg.Add(1)
+	go s.serve()
+	return nil
+}
+
+func (s *Server) Stop() error {
+	if s.listener == nil {
+		return nil
+	}
+	err := s.listener.Close()
+	s.wg.Wait()
+	os.Remove(s.path)
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer conn.Close()
+	defer common.Recover("handle control connection")
+	conn.SetDeadline(time.Now().Add(time.Minute))
+
+	msg := &entity.Msg{}
+	err := checkPeer(conn)
+	if err == nil {
+		req := &Request{}
+		err = json.NewDecoder(bufio.NewReader(conn)).Decode(req)
+		if err == nil {
+			msg.Obj, err = s.handle(req)
+		}
+	}
+	if err != nil {
+		msg.Msg = err.Error()
+		logger.Warning("control command failed:", err)
+	} else {
+		msg.Success = true
+	}
+	json.NewEncoder(conn).Encode(msg)
+}
+
+func (s *Server) handle(req *Request) (interface{}, error) {
+	h, ok := s.handlers[req.Command]
+	if !ok {
+		return nil, common.NewError("unknown command:", req.Command)
+	}
+	logger.Info("control command:", req.Command)
+	return h()
+}
+
+func (s *Server) reloadXray() (interface{}, error) {
+	return nil, s.xrayService.RestartXray(true)
+}
+
+func (s *Server) reloadSettings() (interface{}, error) {
+	// 先返回结果再重启 web 服务
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		s.restartPanel()
+	}()
+	return nil, nil
+}
+
+func (s *Server) dumpStatus() (interface{}, error) {
+	return &Status{
+		Pid:     os.Getpid(),
+		Version: s.version,
+		Uptime:  int64(time.Since(s.startTime).Seconds()),
+		Server:  s.serverService.GetStatus(nil),
+	}, nil
+}
+
+func (s *Server) rotateLogs() (interface{}, error) {
+	rotated, err := s.xrayService.RotateLogs()
+	if err != nil {
+		return rotated, err
+	}
+	panelLog, err := logger.RotateLogFile()
+	if panelLog != "" {
+		rotated = append(rotated, panelLog)
+	}
+	return rotated, err
+}
+
+// rotateKey 在面板进程内轮换主密钥，面板在轮换前后都使用内存中最新的密钥，
+// 不会出现命令行轮换后面板仍用已删除的旧密钥加密的情况
+func (s *Server) rotateKey() (interface{}, error) {
+	return nil, database.RotateKey()
+}
+
+// Call 通过控制 socket 向面板发送命令，面板没有运行时返回 ErrNotRunning
+func Call(path string, command string) (*entity.Msg, error) {
+	conn, err := net.DialTimeout("unix", path, 3*time.Second)
+	if err != nil {
+		return nil, ErrNotRunning
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	err = json.NewEncoder(conn).Encode(&Request{Command: command})
+	if err != nil {
+		return nil, err
+	}
+	msg := &entity.Msg{}
+	err = json.NewDecoder(conn).Decode(msg)
+	if err != nil {
+		return nil, err
+	}
+	if !msg.Success {
+		return msg, errors.New(msg.Msg)
+	}
+	return msg, nil
+}
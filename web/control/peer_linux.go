@@ -0,0 +1,37 @@
+//go:build linux
+// +build linux
+
+package control
+
+import (
+	"net"
+	"syscall"
+	"x-ui/util/common"
+)
+
+// checkPeer 只允许 root 用户连接控制 socket
+func checkPeer(conn net.Conn) error {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return common.NewError("not a unix connection")
+	}
+	rawConn, err := unixConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	err = rawConn.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return err
+	}
+	if credErr != nil {
+		return credErr
+	}
+	if cred.Uid != 0 {
+		return common.NewError("permission denied, uid:", cred.Uid)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package control
+
+import "net"
+
+// checkPeer 其他系统上只依赖 socket 文件的权限
+func checkPeer(conn net.Conn) error {
+	return nil
+}
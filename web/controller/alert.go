@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type alertEventsForm struct {
+	Limit int `json:"limit" form:"limit"`
+}
+
+type AlertController struct {
+	alertService service.AlertService
+}
+
+func NewAlertController(g *gin.RouterGroup) *AlertController {
+	a := &AlertController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *AlertController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/alert")
+
+	g.POST("/list", a.getAlertRules)
+	g.POST("/add", a.addAlertRule)
+	g.POST("/del/:id", a.delAlertRule)
+	g.POST("/update/:id", a.updateAlertRule)
+	g.POST("/events", a.getAlertEvents)
+}
+
+func (a *AlertController) getAlertRules(c *gin.Context) {
+	rules, err := a.alertService.GetAlertRules()
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	jsonObj(c, rules, nil)
+}
+
+func (a *AlertController) addAlertRule(c *gin.Context) {
+	rule := &model.AlertRule{}
+	err := c.ShouldBind(rule)
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	rule.Id = 0
+	err = a.alertService.AddAlertRule(rule)
+	jsonMsgObj(c, "添加", rule, err)
+}
+
+func (a *AlertController) delAlertRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "删除", err)
+		return
+	}
+	err = a.alertService.DelAlertRule(id)
+	jsonMsg(c, "删除", err)
+}
+
+func (a *AlertController) updateAlertRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	rule := &model.AlertRule{}
+	err = c.ShouldBind(rule)
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	rule.Id = id
+	err = a.alertService.UpdateAlertRule(rule)
+	jsonMsgObj(c, "修改", rule, err)
+}
+
+func (a *AlertController) getAlertEvents(c *gin.Context) {
+	form := &alertEventsForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	events, err := a.alertService.GetAlertEvents(form.Limit)
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	jsonObj(c, events, nil)
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ForwardPoolController struct {
+	forwardPoolService service.ForwardPoolService
+	xrayService        service.XrayService
+}
+
+func NewForwardPoolController(g *gin.RouterGroup) *ForwardPoolController {
+	a := &ForwardPoolController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *ForwardPoolController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/forwardPool")
+
+	g.POST("/list", a.getForwardPools)
+	g.POST("/add", a.addForwardPool)
+	g.POST("/del/:id", a.delForwardPool)
+	g.POST("/update/:id", a.updateForwardPool)
+}
+
+func (a *ForwardPoolController) getForwardPools(c *gin.Context) {
+	pools, err := a.forwardPoolService.GetForwardPools()
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	if !isReveal(c) {
+		for _, pool := range pools {
+			for i := range pool.Members {
+				pool.Members[i].MaskSecrets()
+			}
+		}
+	}
+	jsonObj(c, pools, nil)
+}
+
+func (a *ForwardPoolController) addForwardPool(c *gin.Context) {
+	pool := &model.ForwardPool{}
+	err := c.ShouldBindJSON(pool)
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	err = a.forwardPoolService.AddForwardPool(pool)
+	jsonMsgObj(c, "添加", pool, err)
+}
+
+func (a *ForwardPoolController) delForwardPool(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "删除", err)
+		return
+	}
+	err = a.forwardPoolService.DelForwardPool(id)
+	jsonMsg(c, "删除", err)
+}
+
+func (a *ForwardPoolController) updateForwardPool(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	pool := &model.ForwardPool{}
+	err = c.ShouldBindJSON(pool)
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	pool.Id = id
+	err = a.forwardPoolService.UpdateForwardPool(pool)
+	jsonMsg(c, "修改", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
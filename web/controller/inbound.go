@@ -6,14 +6,50 @@ import (
 	"strconv"
 	"x-ui/database/model"
 	"x-ui/logger"
+	"x-ui/util/common"
 	"x-ui/web/global"
 	"x-ui/web/service"
 	"x-ui/web/session"
+	"x-ui/xray"
 )
 
+type testForwardForm struct {
+	// 编辑已有入站时密码可能是掩码，通过入站 id 取回原密码
+	Id       int    `json:"id" form:"id"`
+	Protocol string `json:"protocol" form:"protocol"`
+	Address  string `json:"address" form:"address"`
+	Port     int    `json:"port" form:"port"`
+	Username string `json:"username" form:"username"`
+	Password string `json:"password" form:"password"`
+	Settings string `json:"settings" form:"settings"`
+	Target   string `json:"target" form:"target"`
+}
+
+type genX25519Form struct {
+	// 不为空时由私钥计算公钥
+	PrivateKey string `json:"privateKey" form:"privateKey"`
+}
+
+type genShortIdsForm struct {
+	Count  int `json:"count" form:"count"`
+	Length int `json:"length" form:"length"`
+}
+
+type genSSKeyForm struct {
+	Method string `json:"method" form:"method"`
+}
+
+type checkRealityForm struct {
+	Dest        string   `json:"dest" form:"dest"`
+	ServerNames []string `json:"serverNames" form:"serverNames"`
+}
+
 type InboundController struct {
-	inboundService service.InboundService
-	xrayService    service.XrayService
+	inboundService       service.InboundService
+	xrayService          service.XrayService
+	forwardHealthService service.ForwardHealthService
+	tgBindingService     service.TgBindingService
+	tgBotService         service.TgBotService
 }
 
 func NewInboundController(g *gin.RouterGroup) *InboundController {
@@ -27,9 +63,20 @@ func (a *InboundController) initRouter(g *gin.RouterGroup) {
 	g = g.Group("/inbound")
 
 	g.POST("/list", a.getInbounds)
+	g.POST("/get/:id", a.getInbound)
 	g.POST("/add", a.addInbound)
 	g.POST("/del/:id", a.delInbound)
 	g.POST("/update/:id", a.updateInbound)
+	g.POST("/forwardHealth/:id", a.getForwardHealth)
+	g.POST("/testForward", a.testForward)
+	g.POST("/tgBindCode", a.generateTgBindCode)
+	g.POST("/tgBindings/:id", a.getTgBindings)
+	g.POST("/tgUnbind/:id", a.delTgBinding)
+	g.POST("/genX25519", a.generateX25519)
+	g.POST("/genShortIds", a.generateShortIds)
+	g.POST("/genUUID", a.generateUUID)
+	g.POST("/genSSKey", a.generateSSKey)
+	g.POST("/checkReality", a.checkReality)
 }
 
 func (a *InboundController) startTask() {
@@ -52,9 +99,44 @@ func (a *InboundController) getInbounds(c *gin.Context) {
 		jsonMsg(c, "获取", err)
 		return
 	}
+	if !isReveal(c) {
+		for _, inbound := range inbounds {
+			inbound.MaskSecrets()
+		}
+	}
 	jsonObj(c, inbounds, nil)
 }
 
+// getUserInbound 获取当前登录用户的入站，其他用户的入站视为不存在
+func (a *InboundController) getUserInbound(c *gin.Context, id int) (*model.Inbound, error) {
+	inbound, err := a.inboundService.GetInbound(id)
+	if err != nil {
+		return nil, err
+	}
+	if inbound.UserId != session.GetLoginUser(c).Id {
+		return nil, common.NewError("入站不存在:", id)
+	}
+	return inbound, nil
+}
+
+// getInbound 获取单个入站，生成分享链接时使用 reveal 获取客户端凭据的明文
+func (a *InboundController) getInbound(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	inbound, err := a.getUserInbound(c, id)
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	if !isReveal(c) {
+		inbound.MaskSecrets()
+	}
+	jsonObj(c, inbound, nil)
+}
+
 func (a *InboundController) addInbound(c *gin.Context) {
 	inbound := &model.Inbound{}
 	err := c.ShouldBind(inbound)
@@ -63,20 +145,11 @@ func (a *InboundController) addInbound(c *gin.Context) {
 		return
 	}
 	
-	// 验证二次转发配置
-	if err := a.validateSecondaryForward(inbound); err != nil {
-		jsonMsg(c, "添加", err)
-		return
-	}
-	
 	user := session.GetLoginUser(c)
 	inbound.UserId = user.Id
 	inbound.Enable = true
 	inbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
 	
-	// 设置二次转发默认值
-	a.setSecondaryForwardDefaults(inbound)
-	
 	err = a.inboundService.AddInbound(inbound)
 	jsonMsg(c, "添加", err)
 	if err == nil {
@@ -112,15 +185,6 @@ func (a *InboundController) updateInbound(c *gin.Context) {
 		return
 	}
 	
-	// 验证二次转发配置
-	if err := a.validateSecondaryForward(inbound); err != nil {
-		jsonMsg(c, "修改", err)
-		return
-	}
-	
-	// 设置二次转发默认值
-	a.setSecondaryForwardDefaults(inbound)
-	
 	err = a.inboundService.UpdateInbound(inbound)
 	jsonMsg(c, "修改", err)
 	if err == nil {
@@ -128,53 +192,207 @@ func (a *InboundController) updateInbound(c *gin.Context) {
 	}
 }
 
-// validateSecondaryForward 验证二次转发配置
-func (a *InboundController) validateSecondaryForward(inbound *model.Inbound) error {
-	if !inbound.SecondaryForwardEnable {
-		return nil
+func (a *InboundController) getForwardHealth(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
 	}
-	
-	if inbound.SecondaryForwardProtocol == model.SecondaryForwardNone {
-		return fmt.Errorf("启用二次转发时必须选择协议类型")
+	_, err = a.getUserInbound(c, id)
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
 	}
-	
-	if inbound.SecondaryForwardAddress == "" {
-		return fmt.Errorf("二次转发服务器地址不能为空")
+	healths, err := a.forwardHealthService.GetInboundForwardHealth(id)
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
 	}
-	
-	if inbound.SecondaryForwardPort <= 0 || inbound.SecondaryForwardPort > 65535 {
-		return fmt.Errorf("二次转发端口必须在1-65535之间")
+	jsonObj(c, healths, nil)
+}
+
+func (a *InboundController) testForward(c *gin.Context) {
+	form := &testForwardForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "测试", err)
+		return
 	}
-	
-	// 如果选择了SOCKS或HTTP协议，确保地址和端口有效
-	if inbound.SecondaryForwardProtocol == model.SecondaryForwardSOCKS || 
-		inbound.SecondaryForwardProtocol == model.SecondaryForwardHTTP {
-		if inbound.SecondaryForwardAddress == "" {
-			return fmt.Errorf("%s服务器地址不能为空", inbound.SecondaryForwardProtocol)
+	if form.Id > 0 {
+		inbound, err := a.getUserInbound(c, form.Id)
+		if err != nil {
+			jsonMsg(c, "测试", err)
+			return
 		}
-		if inbound.SecondaryForwardPort == 0 {
-			return fmt.Errorf("%s服务器端口不能为0", inbound.SecondaryForwardProtocol)
+		// 只有上游与已保存的一致时才使用原密码，否则修改地址即可把密码发送到任意主机
+		if form.Password == model.SecretMask {
+			if form.Protocol != inbound.SecondaryForwardProtocol || form.Address != inbound.SecondaryForwardAddress ||
+				form.Port != inbound.SecondaryForwardPort || form.Username != inbound.SecondaryForwardUsername {
+				jsonMsg(c, "测试", common.NewError("上游已修改，请重新填写密码"))
+				return
+			}
+			form.Password = inbound.SecondaryForwardPassword
 		}
 	}
-	
-	return nil
-}
-
-// setSecondaryForwardDefaults 设置二次转发默认值
-func (a *InboundController) setSecondaryForwardDefaults(inbound *model.Inbound) {
-	if !inbound.SecondaryForwardEnable {
-		// 如果未启用二次转发，重置相关字段
-		inbound.SecondaryForwardProtocol = model.SecondaryForwardNone
-		inbound.SecondaryForwardAddress = ""
-		inbound.SecondaryForwardPort = 0
-		inbound.SecondaryForwardUsername = ""
-		inbound.SecondaryForwardPassword = ""
-	} else if inbound.SecondaryForwardProtocol == model.SecondaryForwardNone {
-		// 如果协议为none，也视为未启用
-		inbound.SecondaryForwardEnable = false
-		inbound.SecondaryForwardAddress = ""
-		inbound.SecondaryForwardPort = 0
-		inbound.SecondaryForwardUsername = ""
-		inbound.SecondaryForwardPassword = ""
+	if form.Password == model.SecretMask {
+		jsonMsg(c, "测试", common.NewError("请重新填写密码"))
+		return
+	}
+	result, err := a.forwardHealthService.TestForward(form.Protocol, form.Address, form.Port, form.Username, form.Password, form.Settings, form.Target)
+	if err != nil {
+		jsonMsg(c, "测试", err)
+		return
+	}
+	jsonObj(c, result, nil)
+}
+
+type tgBindCodeForm struct {
+	Id   int    `json:"id" form:"id"`
+	Link string `json:"link" form:"link"`
+}
+
+type tgBindCodeResult struct {
+	Code    string `json:"code"`
+	Expiry  int64  `json:"expiry"`
+	BotLink string `json:"botLink"`
+}
+
+// generateTgBindCode 为入站生成电报绑定码，link 为前端生成的分享链接
+func (a *InboundController) generateTgBindCode(c *gin.Context) {
+	form := &tgBindCodeForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "生成绑定码", err)
+		return
+	}
+	_, err = a.getUserInbound(c, form.Id)
+	if err != nil {
+		jsonMsg(c, "生成绑定码", err)
+		return
+	}
+	binding, err := a.tgBindingService.GenerateBindCode(form.Id, form.Link)
+	if err != nil {
+		jsonMsg(c, "生成绑定码", err)
+		return
+	}
+	result := &tgBindCodeResult{
+		Code:   binding.Code,
+		Expiry: binding.CodeExpiry,
+	}
+	userName := a.tgBotService.GetBotUserName()
+	if userName != "" {
+		result.BotLink = fmt.Sprintf("https://t.me/%s?start=%s", userName, binding.Code)
+	}
+	jsonObj(c, result, nil)
+}
+
+func (a *InboundController) getTgBindings(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	_, err = a.getUserInbound(c, id)
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	bindings, err := a.tgBindingService.GetBindingsByInbound(id)
+	jsonObj(c, bindings, err)
+}
+
+func (a *InboundController) delTgBinding(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "解除绑定", err)
+		return
+	}
+	binding, err := a.tgBindingService.GetBinding(id)
+	if err != nil {
+		jsonMsg(c, "解除绑定", err)
+		return
+	}
+	_, err = a.getUserInbound(c, binding.InboundId)
+	if err != nil {
+		jsonMsg(c, "解除绑定", err)
+		return
+	}
+	err = a.tgBindingService.DelBinding(id)
+	jsonMsg(c, "解除绑定", err)
+}
+
+func (a *InboundController) generateX25519(c *gin.Context) {
+	form := &genX25519Form{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "生成密钥", err)
+		return
+	}
+	keyPair, err := xray.GenerateX25519(form.PrivateKey)
+	if err != nil {
+		jsonMsg(c, "生成密钥", err)
+		return
+	}
+	jsonObj(c, keyPair, nil)
+}
+
+func (a *InboundController) generateShortIds(c *gin.Context) {
+	form := &genShortIdsForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "生成 shortId", err)
+		return
+	}
+	if form.Count == 0 {
+		form.Count = 1
+	}
+	if form.Length == 0 {
+		form.Length = 8
+	}
+	shortIds, err := xray.GenerateShortIds(form.Count, form.Length)
+	if err != nil {
+		jsonMsg(c, "生成 shortId", err)
+		return
+	}
+	jsonObj(c, shortIds, nil)
+}
+
+func (a *InboundController) generateUUID(c *gin.Context) {
+	uuid, err := xray.GenerateUUID()
+	if err != nil {
+		jsonMsg(c, "生成 UUID", err)
+		return
+	}
+	jsonObj(c, uuid, nil)
+}
+
+func (a *InboundController) generateSSKey(c *gin.Context) {
+	form := &genSSKeyForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "生成密钥", err)
+		return
+	}
+	key, err := xray.GenerateSS2022Key(form.Method)
+	if err != nil {
+		jsonMsg(c, "生成密钥", err)
+		return
+	}
+	jsonObj(c, key, nil)
+}
+
+// checkReality 检测 REALITY 目标是否支持 TLS 1.3 并且证书对各个 serverName 有效
+func (a *InboundController) checkReality(c *gin.Context) {
+	form := &checkRealityForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "检测", err)
+		return
+	}
+	results, err := xray.CheckRealityDest(form.Dest, form.ServerNames)
+	if err != nil {
+		jsonMsg(c, "检测", err)
+		return
 	}
+	jsonObj(c, results, nil)
 }
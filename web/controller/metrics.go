@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"x-ui/logger"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsController struct {
+	metricsService service.MetricsService
+	settingService service.SettingService
+	// 挂在面板监听地址上时必须设置令牌，否则入站备注和流量会公开
+	requireToken bool
+}
+
+func NewMetricsController(g *gin.RouterGroup, requireToken bool) *MetricsController {
+	a := &MetricsController{requireToken: requireToken}
+	a.initRouter(g)
+	return a
+}
+
+func (a *MetricsController) initRouter(g *gin.RouterGroup) {
+	g.GET("/metrics", a.checkToken, a.metrics)
+}
+
+// checkToken 校验 Authorization: Bearer 令牌。未设置令牌时只有单独监听的指标接口可以访问
+func (a *MetricsController) checkToken(c *gin.Context) {
+	token, err := a.settingService.GetMetricsToken()
+	if err != nil {
+		logger.Warning("get metrics token failed:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if token == "" {
+		if a.requireToken {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+		return
+	}
+	auth := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(auth), []byte(token)) != 1 {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	c.Next()
+}
+
+func (a *MetricsController) metrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	err := a.metricsService.WriteMetrics(c.Writer)
+	if err != nil {
+		logger.Warning("write metrics failed:", err)
+	}
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"x-ui/config"
+	"x-ui/database"
+	"x-ui/database/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func initTestDB(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "x-ui.db")
+	config.SetPathFlag(config.PathDB, dbPath)
+	t.Cleanup(func() { config.SetPathFlag(config.PathDB, "") })
+	err := database.InitDB(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestMetricsEngine(requireToken bool) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	NewMetricsController(engine.Group("/"), requireToken)
+	return engine
+}
+
+func getTestMetrics(engine *gin.Engine, auth string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestMetricsToken(t *testing.T) {
+	initTestDB(t)
+
+	// 未设置令牌时只有单独监听的指标接口可以访问
+	if w := getTestMetrics(newTestMetricsEngine(false), ""); w.Code != http.StatusOK {
+		t.Errorf("standalone metrics without token = %v, want %v", w.Code, http.StatusOK)
+	}
+	if w := getTestMetrics(newTestMetricsEngine(true), ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("panel metrics without token = %v, want %v", w.Code, http.StatusUnauthorized)
+	}
+
+	err := database.GetDB().Create(&model.Setting{Key: "metricsToken", Value: "secret"}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, requireToken := range []bool{false, true} {
+		engine := newTestMetricsEngine(requireToken)
+		for _, c := range []struct {
+			auth string
+			code int
+		}{
+			{"", http.StatusUnauthorized},
+			{"Bearer wrong", http.StatusUnauthorized},
+			{"Bearer secre", http.StatusUnauthorized},
+			{"Basic secret", http.StatusUnauthorized},
+			{"Bearer secret", http.StatusOK},
+		} {
+			if w := getTestMetrics(engine, c.auth); w.Code != c.code {
+				t.Errorf("requireToken %v, auth %q = %v, want %v", requireToken, c.auth, w.Code, c.code)
+			}
+		}
+	}
+}
+
+func TestMetricsOutput(t *testing.T) {
+	initTestDB(t)
+	inbound := &model.Inbound{
+		UserId:   1,
+		Enable:   true,
+		Port:     20000,
+		Protocol: model.Socks,
+		Settings: `{"auth": "noauth"}`,
+		Tag:      "inbound-20000",
+		Remark:   `a "quoted" \ remark`,
+		Up:       100,
+		Down:     200,
+		Total:    1000,
+	}
+	err := database.GetDB().Create(inbound).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := getTestMetrics(newTestMetricsEngine(false), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("metrics = %v, want %v", w.Code, http.StatusOK)
+	}
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+	body := w.Body.String()
+	labels := `{id="1",tag="inbound-20000",remark="a \"quoted\" \\ remark"}`
+	for _, want := range []string{
+		"# HELP x_ui_cpu_usage_percent ",
+		"# TYPE x_ui_cpu_usage_percent gauge\n",
+		"# TYPE x_ui_inbound_up_bytes_total counter\n",
+		"x_ui_inbound_up_bytes_total" + labels + " 100\n",
+		"x_ui_inbound_down_bytes_total" + labels + " 200\n",
+		"x_ui_inbound_quota_bytes" + labels + " 1000\n",
+		"x_ui_inbound_enabled" + labels + " 1\n",
+		"# TYPE x_ui_xray_restarts_total counter\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output does not contain %q", want)
+		}
+	}
+	// 每一行都是注释或 "名称{标签} 值"
+	for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+		if strings.HasPrefix(line, "# HELP ") || strings.HasPrefix(line, "# TYPE ") {
+			continue
+		}
+		if !strings.HasPrefix(line, "x_ui_") || strings.LastIndex(line, " ") <= 0 {
+			t.Errorf("invalid metrics line %q", line)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type NotifyController struct {
+	notificationService service.NotificationService
+}
+
+func NewNotifyController(g *gin.RouterGroup) *NotifyController {
+	a := &NotifyController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *NotifyController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/notify")
+
+	g.POST("/list", a.getNotifyChannels)
+	g.POST("/add", a.addNotifyChannel)
+	g.POST("/del/:id", a.delNotifyChannel)
+	g.POST("/update/:id", a.updateNotifyChannel)
+	g.POST("/test", a.testNotifyChannel)
+}
+
+func (a *NotifyController) getNotifyChannels(c *gin.Context) {
+	channels, err := a.notificationService.GetNotifyChannels()
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	if !isReveal(c) {
+		for _, channel := range channels {
+			a.notificationService.MaskNotifyChannel(channel)
+		}
+	}
+	jsonObj(c, channels, nil)
+}
+
+func (a *NotifyController) addNotifyChannel(c *gin.Context) {
+	channel := &model.NotifyChannel{}
+	err := c.ShouldBind(channel)
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	channel.Id = 0
+	err = a.notificationService.AddNotifyChannel(channel)
+	jsonMsg(c, "添加", err)
+}
+
+func (a *NotifyController) delNotifyChannel(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "删除", err)
+		return
+	}
+	err = a.notificationService.DelNotifyChannel(id)
+	jsonMsg(c, "删除", err)
+}
+
+func (a *NotifyController) updateNotifyChannel(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	channel := &model.NotifyChannel{}
+	err = c.ShouldBind(channel)
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	channel.Id = id
+	err = a.notificationService.UpdateNotifyChannel(channel)
+	jsonMsg(c, "修改", err)
+}
+
+// testNotifyChannel 使用提交的配置发送测试通知，编辑已有渠道时带上 id 以取回被掩码的字段
+func (a *NotifyController) testNotifyChannel(c *gin.Context) {
+	channel := &model.NotifyChannel{}
+	err := c.ShouldBind(channel)
+	if err != nil {
+		jsonMsg(c, "发送测试通知", err)
+		return
+	}
+	err = a.notificationService.SendTestNotification(channel)
+	jsonMsg(c, "发送测试通知", err)
+}
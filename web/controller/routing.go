@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/web/service"
+	"x-ui/xray"
+
+	"github.com/gin-gonic/gin"
+)
+
+type sortRoutingForm struct {
+	Ids []int `json:"ids" form:"ids"`
+}
+
+type importGeoForm struct {
+	Kind        string   `json:"kind" form:"kind"`
+	Categories  []string `json:"categories" form:"categories"`
+	OutboundTag string   `json:"outboundTag" form:"outboundTag"`
+	BalancerTag string   `json:"balancerTag" form:"balancerTag"`
+}
+
+type RoutingController struct {
+	routingService service.RoutingService
+	xrayService    service.XrayService
+}
+
+func NewRoutingController(g *gin.RouterGroup) *RoutingController {
+	a := &RoutingController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *RoutingController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/routing")
+
+	g.POST("/list", a.getRoutingRules)
+	g.POST("/add", a.addRoutingRule)
+	g.POST("/del/:id", a.delRoutingRule)
+	g.POST("/update/:id", a.updateRoutingRule)
+	g.POST("/sort", a.sortRoutingRules)
+	g.POST("/geoCategories/:kind", a.getGeoCategories)
+	g.POST("/importGeo", a.importGeo)
+	g.POST("/match", a.matchRoute)
+}
+
+func (a *RoutingController) getRoutingRules(c *gin.Context) {
+	rules, err := a.routingService.GetRoutingRules()
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	jsonObj(c, rules, nil)
+}
+
+func (a *RoutingController) addRoutingRule(c *gin.Context) {
+	rule := &model.RoutingRule{}
+	err := c.ShouldBind(rule)
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	rule.Id = 0
+	err = a.routingService.AddRoutingRule(rule)
+	jsonMsgObj(c, "添加", rule, err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *RoutingController) delRoutingRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "删除", err)
+		return
+	}
+	err = a.routingService.DelRoutingRule(id)
+	jsonMsg(c, "删除", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *RoutingController) updateRoutingRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	rule := &model.RoutingRule{}
+	err = c.ShouldBind(rule)
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	rule.Id = id
+	err = a.routingService.UpdateRoutingRule(rule)
+	jsonMsg(c, "修改", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *RoutingController) sortRoutingRules(c *gin.Context) {
+	form := &sortRoutingForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "排序", err)
+		return
+	}
+	err = a.routingService.SortRoutingRules(form.Ids)
+	jsonMsg(c, "排序", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *RoutingController) getGeoCategories(c *gin.Context) {
+	categories, err := a.routingService.GetGeoCategories(c.Param("kind"))
+	if err != nil {
+		jsonMsg(c, "获取分类", err)
+		return
+	}
+	jsonObj(c, categories, nil)
+}
+
+func (a *RoutingController) importGeo(c *gin.Context) {
+	form := &importGeoForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "导入", err)
+		return
+	}
+	rule, err := a.routingService.ImportGeoRule(form.Kind, form.Categories, form.OutboundTag, form.BalancerTag)
+	jsonMsgObj(c, "导入", rule, err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *RoutingController) matchRoute(c *gin.Context) {
+	target := &xray.RouteTarget{}
+	err := c.ShouldBind(target)
+	if err != nil {
+		jsonMsg(c, "路由试算", err)
+		return
+	}
+	xrayConfig, err := a.xrayService.GetXrayConfig()
+	if err != nil {
+		jsonMsg(c, "路由试算", err)
+		return
+	}
+	result, err := xrayConfig.MatchRoute(target)
+	if err != nil {
+		jsonMsg(c, "路由试算", err)
+		return
+	}
+	jsonObj(c, result, nil)
+}
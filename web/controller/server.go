@@ -7,10 +7,16 @@ import (
 	"x-ui/web/service"
 )
 
+type statusHistoryForm struct {
+	From int64 `json:"from" form:"from"`
+	To   int64 `json:"to" form:"to"`
+}
+
 type ServerController struct {
 	BaseController
 
-	serverService service.ServerService
+	serverService        service.ServerService
+	statusHistoryService service.StatusHistoryService
 
 	lastStatus        *service.Status
 	lastGetStatusTime time.Time
@@ -33,6 +39,7 @@ func (a *ServerController) initRouter(g *gin.RouterGroup) {
 
 	g.Use(a.checkLogin)
 	g.POST("/status", a.status)
+	g.POST("/history", a.history)
 	g.POST("/getXrayVersion", a.getXrayVersion)
 	g.POST("/installXray/:version", a.installXray)
 }
@@ -83,3 +90,27 @@ func (a *ServerController) installXray(c *gin.Context) {
 	err := a.serverService.UpdateXray(version)
 	jsonMsg(c, "安装 xray", err)
 }
+
+// history 返回历史状态，from、to 为 unix 秒，默认最近一天
+func (a *ServerController) history(c *gin.Context) {
+	form := &statusHistoryForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "获取历史状态", err)
+		return
+	}
+	to := time.Now()
+	if form.To > 0 {
+		to = time.Unix(form.To, 0)
+	}
+	from := to.Add(-time.Hour * 24)
+	if form.From > 0 {
+		from = time.Unix(form.From, 0)
+	}
+	series, err := a.statusHistoryService.GetSeries(from, to)
+	if err != nil {
+		jsonMsg(c, "获取历史状态", err)
+		return
+	}
+	jsonObj(c, series, nil)
+}
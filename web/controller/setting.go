@@ -2,9 +2,13 @@ package controller
 
 import (
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
 	"time"
-	"x-ui/web/entity"
+	"x-ui/database"
+	"x-ui/database/model"
 	"x-ui/web/service"
 	"x-ui/web/session"
 )
@@ -32,9 +36,13 @@ func (a *SettingController) initRouter(g *gin.RouterGroup) {
 	g = g.Group("/setting")
 
 	g.POST("/all", a.getAllSetting)
+	g.POST("/defs", a.getSettingDefs)
 	g.POST("/update", a.updateSetting)
+	g.POST("/history", a.getSettingHistory)
+	g.POST("/revert/:id", a.revertSetting)
 	g.POST("/updateUser", a.updateUser)
 	g.POST("/restartPanel", a.restartPanel)
+	g.GET("/backup", a.downloadBackup)
 }
 
 func (a *SettingController) getAllSetting(c *gin.Context) {
@@ -43,20 +51,62 @@ func (a *SettingController) getAllSetting(c *gin.Context) {
 		jsonMsg(c, "获取设置", err)
 		return
 	}
+	if !isReveal(c) {
+		service.MaskSecretSettings(allSetting)
+	}
 	jsonObj(c, allSetting, nil)
 }
 
+// getSettingDefs 返回设置项定义，前端据此判断修改后是否需要重启面板
+func (a *SettingController) getSettingDefs(c *gin.Context) {
+	jsonObj(c, service.GetSettingDefs(), nil)
+}
+
 func (a *SettingController) updateSetting(c *gin.Context) {
-	allSetting := &entity.AllSetting{}
-	err := c.ShouldBind(allSetting)
+	err := c.Request.ParseForm()
 	if err != nil {
 		jsonMsg(c, "修改设置", err)
 		return
 	}
-	err = a.settingService.UpdateAllSetting(allSetting)
+	values := map[string]interface{}{}
+	for key := range c.Request.PostForm {
+		values[key] = c.Request.PostForm.Get(key)
+	}
+	allSetting, err := service.ParseAllSetting(values)
+	if err != nil {
+		jsonMsg(c, "修改设置", err)
+		return
+	}
+	user := session.GetLoginUser(c)
+	_, err = a.settingService.UpdateAllSetting(allSetting, &model.SettingVersion{
+		UserId:   user.Id,
+		Username: user.Username,
+		Source:   model.SettingSourceWeb,
+	})
 	jsonMsg(c, "修改设置", err)
 }
 
+func (a *SettingController) getSettingHistory(c *gin.Context) {
+	versions, err := a.settingService.GetSettingHistory()
+	if err != nil {
+		jsonMsg(c, "获取设置历史", err)
+		return
+	}
+	jsonObj(c, versions, nil)
+}
+
+// revertSetting 回滚到某个版本，返回需要重启面板才能生效的设置项
+func (a *SettingController) revertSetting(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "回滚设置", err)
+		return
+	}
+	user := session.GetLoginUser(c)
+	restartKeys, err := a.settingService.RevertSettings(id, user.Id)
+	jsonMsgObj(c, "回滚设置", restartKeys, err)
+}
+
 func (a *SettingController) updateUser(c *gin.Context) {
 	form := &updateUserForm{}
 	err := c.ShouldBind(form)
@@ -86,3 +136,15 @@ func (a *SettingController) restartPanel(c *gin.Context) {
 	err := a.panelService.RestartPanel(time.Second * 3)
 	jsonMsg(c, "重启面板", err)
 }
+
+// downloadBackup 生成数据库备份并下载
+func (a *SettingController) downloadBackup(c *gin.Context) {
+	data, err := database.BackupBytes()
+	if err != nil {
+		jsonMsg(c, "备份数据库", err)
+		return
+	}
+	name := service.GetBackupFileName(time.Now())
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", name))
+	c.Data(http.StatusOK, "application/octet-stream", data)
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TlsCertController struct {
+	tlsCertService service.TlsCertService
+	xrayService    service.XrayService
+}
+
+func NewTlsCertController(g *gin.RouterGroup) *TlsCertController {
+	a := &TlsCertController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *TlsCertController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/tlsCert")
+
+	g.POST("/list", a.getTlsCerts)
+	g.POST("/add", a.addTlsCert)
+	g.POST("/del/:id", a.delTlsCert)
+	g.POST("/update/:id", a.updateTlsCert)
+	g.POST("/renew/:id", a.renewTlsCert)
+}
+
+func (a *TlsCertController) getTlsCerts(c *gin.Context) {
+	certs, err := a.tlsCertService.GetTlsCerts()
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	if !isReveal(c) {
+		for _, cert := range certs {
+			cert.MaskSecrets()
+		}
+	}
+	jsonObj(c, certs, nil)
+}
+
+func (a *TlsCertController) addTlsCert(c *gin.Context) {
+	cert := &model.TlsCert{}
+	err := c.ShouldBind(cert)
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	err = a.tlsCertService.AddTlsCert(cert)
+	if err == nil {
+		cert.MaskSecrets()
+	}
+	jsonMsgObj(c, "添加", cert, err)
+}
+
+func (a *TlsCertController) delTlsCert(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "删除", err)
+		return
+	}
+	err = a.tlsCertService.DelTlsCert(id)
+	jsonMsg(c, "删除", err)
+}
+
+func (a *TlsCertController) updateTlsCert(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	cert := &model.TlsCert{}
+	err = c.ShouldBind(cert)
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	cert.Id = id
+	changed, err := a.tlsCertService.UpdateTlsCert(cert)
+	jsonMsg(c, "修改", err)
+	if err == nil && changed {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *TlsCertController) renewTlsCert(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "续期", err)
+		return
+	}
+	err = a.tlsCertService.RenewTlsCert(id)
+	jsonMsg(c, "续期", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
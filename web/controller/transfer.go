@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"x-ui/util/common"
+	"x-ui/web/service"
+	"x-ui/web/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+type exportForm struct {
+	InboundIds      string `json:"inboundIds" form:"inboundIds"`
+	IncludeSettings bool   `json:"includeSettings" form:"includeSettings"`
+	IncludeTemplate bool   `json:"includeTemplate" form:"includeTemplate"`
+}
+
+type importForm struct {
+	Data           string `json:"data" form:"data"`
+	Conflict       string `json:"conflict" form:"conflict"`
+	DryRun         bool   `json:"dryRun" form:"dryRun"`
+	ImportSettings bool   `json:"importSettings" form:"importSettings"`
+	ImportTemplate bool   `json:"importTemplate" form:"importTemplate"`
+}
+
+type TransferController struct {
+	transferService service.TransferService
+	xrayService     service.XrayService
+}
+
+func NewTransferController(g *gin.RouterGroup) *TransferController {
+	a := &TransferController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *TransferController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/transfer")
+
+	g.POST("/export", a.export)
+	g.POST("/import", a.importData)
+}
+
+func (a *TransferController) export(c *gin.Context) {
+	form := &exportForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "导出", err)
+		return
+	}
+	ids, err := common.ParseInts(form.InboundIds)
+	if err != nil {
+		jsonMsg(c, "导出", err)
+		return
+	}
+	data, err := a.transferService.Export(&service.ExportOptions{
+		InboundIds:      ids,
+		IncludeSettings: form.IncludeSettings,
+		IncludeTemplate: form.IncludeTemplate,
+	})
+	if err != nil {
+		jsonMsg(c, "导出", err)
+		return
+	}
+	// 默认不导出客户端凭据，带有掩码的入站导入时会被拒绝
+	if !isReveal(c) {
+		for _, inbound := range data.Inbounds {
+			inbound.MaskSecrets()
+		}
+	}
+	jsonObj(c, data, nil)
+}
+
+// importData 导入导出文件，dryRun 时只返回将要进行的修改
+func (a *TransferController) importData(c *gin.Context) {
+	form := &importForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "导入", err)
+		return
+	}
+	data := &service.ExportData{}
+	err = json.Unmarshal([]byte(form.Data), data)
+	if err != nil {
+		jsonMsg(c, "导入", fmt.Errorf("导入文件不是有效的 JSON: %v", err))
+		return
+	}
+	report, err := a.transferService.Import(data, &service.ImportOptions{
+		UserId:         session.GetLoginUser(c).Id,
+		Conflict:       form.Conflict,
+		DryRun:         form.DryRun,
+		ImportSettings: form.ImportSettings,
+		ImportTemplate: form.ImportTemplate,
+	})
+	if err == nil && !form.DryRun {
+		a.xrayService.SetToNeedRestart()
+	}
+	jsonMsgObj(c, "导入", report, err)
+}
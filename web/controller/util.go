@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net"
 	"net/http"
@@ -19,6 +20,11 @@ func getUriId(c *gin.Context) int64 {
 	return s.Id
 }
 
+// isReveal 请求是否显式要求返回敏感字段的明文，默认返回掩码
+func isReveal(c *gin.Context) bool {
+	return c.Query("reveal") == "true" || c.PostForm("reveal") == "true"
+}
+
 func getRemoteIp(c *gin.Context) string {
 	value := c.GetHeader("X-Forwarded-For")
 	if value != "" {
@@ -51,6 +57,11 @@ func jsonMsgObj(c *gin.Context, msg string, obj interface{}, err error) {
 	} else {
 		m.Success = false
 		m.Msg = msg + "失败: " + err.Error()
+		// 校验失败时返回字段级错误，便于前端定位
+		var validationErr *entity.ValidationError
+		if errors.As(err, &validationErr) {
+			m.Obj = validationErr.Errors
+		}
 		logger.Warning(msg+"失败: ", err)
 	}
 	c.JSON(http.StatusOK, m)
@@ -7,8 +7,14 @@ import (
 type XUIController struct {
 	BaseController
 
-	inboundController *InboundController
-	settingController *SettingController
+	inboundController     *InboundController
+	settingController     *SettingController
+	routingController     *RoutingController
+	forwardPoolController *ForwardPoolController
+	alertController       *AlertController
+	notifyController      *NotifyController
+	transferController    *TransferController
+	tlsCertController     *TlsCertController
 }
 
 func NewXUIController(g *gin.RouterGroup) *XUIController {
@@ -24,9 +30,16 @@ func (a *XUIController) initRouter(g *gin.RouterGroup) {
 	g.GET("/", a.index)
 	g.GET("/inbounds", a.inbounds)
 	g.GET("/setting", a.setting)
+	g.GET("/routing", a.routing)
 
 	a.inboundController = NewInboundController(g)
 	a.settingController = NewSettingController(g)
+	a.routingController = NewRoutingController(g)
+	a.forwardPoolController = NewForwardPoolController(g)
+	a.alertController = NewAlertController(g)
+	a.notifyController = NewNotifyController(g)
+	a.transferController = NewTransferController(g)
+	a.tlsCertController = NewTlsCertController(g)
 }
 
 func (a *XUIController) index(c *gin.Context) {
@@ -40,3 +53,7 @@ func (a *XUIController) inbounds(c *gin.Context) {
 func (a *XUIController) setting(c *gin.Context) {
 	html(c, "setting.html", "设置", nil)
 }
+
+func (a *XUIController) routing(c *gin.Context) {
+	html(c, "routing.html", "路由规则", nil)
+}
@@ -1,14 +1,6 @@
 package entity
 
-import (
-	"crypto/tls"
-	"encoding/json"
-	"net"
-	"strings"
-	"time"
-	"x-ui/util/common"
-	"x-ui/xray"
-)
+import "strings"
 
 type Msg struct {
 	Success bool        `json:"success"`
@@ -16,6 +8,29 @@ type Msg struct {
 	Obj     interface{} `json:"obj"`
 }
 
+// FieldError 某个字段的校验错误，Field 为字段路径，如 settings.clients[0].id
+type FieldError struct {
+	Field string `json:"field"`
+	Msg   string `json:"msg"`
+}
+
+// ValidationError 校验失败时返回的所有字段错误
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Add(field string, msg string) {
+	e.Errors = append(e.Errors, &FieldError{Field: field, Msg: msg})
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fieldError := range e.Errors {
+		msgs = append(msgs, fieldError.Field+": "+fieldError.Msg)
+	}
+	return strings.Join(msgs, "; ")
+}
+
 type Pager struct {
 	Current  int         `json:"current"`
 	PageSize int         `json:"page_size"`
@@ -26,57 +41,20 @@ type Pager struct {
 	List     interface{} `json:"list"`
 }
 
-type AllSetting struct {
-	WebListen          string `json:"webListen" form:"webListen"`
-	WebPort            int    `json:"webPort" form:"webPort"`
-	WebCertFile        string `json:"webCertFile" form:"webCertFile"`
-	WebKeyFile         string `json:"webKeyFile" form:"webKeyFile"`
-	WebBasePath        string `json:"webBasePath" form:"webBasePath"`
-	TgBotEnable        bool   `json:"tgBotEnable" form:"tgBotEnable"`
-	TgBotToken         string `json:"tgBotToken" form:"tgBotToken"`
-	TgBotChatId        int    `json:"tgBotChatId" form:"tgBotChatId"`
-	TgRunTime          string `json:"tgRunTime" form:"tgRunTime"`
-	XrayTemplateConfig string `json:"xrayTemplateConfig" form:"xrayTemplateConfig"`
+// AllSetting 可以在面板修改的所有设置，设置项及其值的类型由 service 中的设置项定义决定
+type AllSetting map[string]interface{}
 
-	TimeLocation string `json:"timeLocation" form:"timeLocation"`
+func (s AllSetting) GetString(key string) string {
+	value, _ := s[key].(string)
+	return value
 }
 
-func (s *AllSetting) CheckValid() error {
-	if s.WebListen != "" {
-		ip := net.ParseIP(s.WebListen)
-		if ip == nil {
-			return common.NewError("web listen is not valid ip:", s.WebListen)
-		}
-	}
-
-	if s.WebPort <= 0 || s.WebPort > 65535 {
-		return common.NewError("web port is not a valid port:", s.WebPort)
-	}
-
-	if s.WebCertFile != "" || s.WebKeyFile != "" {
-		_, err := tls.LoadX509KeyPair(s.WebCertFile, s.WebKeyFile)
-		if err != nil {
-			return common.NewErrorf("cert file <%v> or key file <%v> invalid: %v", s.WebCertFile, s.WebKeyFile, err)
-		}
-	}
-
-	if !strings.HasPrefix(s.WebBasePath, "/") {
-		s.WebBasePath = "/" + s.WebBasePath
-	}
-	if !strings.HasSuffix(s.WebBasePath, "/") {
-		s.WebBasePath += "/"
-	}
-
-	xrayConfig := &xray.Config{}
-	err := json.Unmarshal([]byte(s.XrayTemplateConfig), xrayConfig)
-	if err != nil {
-		return common.NewError("xray template config invalid:", err)
-	}
-
-	_, err = time.LoadLocation(s.TimeLocation)
-	if err != nil {
-		return common.NewError("time location not exist:", s.TimeLocation)
-	}
+func (s AllSetting) GetInt(key string) int {
+	value, _ := s[key].(int)
+	return value
+}
 
-	return nil
+func (s AllSetting) GetBool(key string) bool {
+	value, _ := s[key].(bool)
+	return value
 }
@@ -0,0 +1,39 @@
+package job
+
+import (
+	"os"
+	"time"
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type AlertJob struct {
+	serverService       service.ServerService
+	alertService        service.AlertService
+	notificationService service.NotificationService
+
+	cpuSampler service.CpuSampler
+}
+
+func NewAlertJob() *AlertJob {
+	return new(AlertJob)
+}
+
+func (j *AlertJob) Run() {
+	// CPU 使用率按距离上一次检查的时间计算，第一次运行只记录 CPU 时间
+	status, ok := j.serverService.GetStatusWithCpuSampler(nil, &j.cpuSampler)
+	if !ok {
+		return
+	}
+	notices, err := j.alertService.Evaluate(status, time.Now())
+	if err != nil {
+		logger.Warning("evaluate alert rules failed:", err)
+	}
+	hostname, _ := os.Hostname()
+	for _, notice := range notices {
+		err = j.notificationService.NotifyEvent(service.NotifyEventAlert, service.NewNotifyAlertData(hostname, notice))
+		if err != nil {
+			logger.Warning("send alert notification failed:", err)
+		}
+	}
+}
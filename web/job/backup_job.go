@@ -0,0 +1,22 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+// BackupJob 定时备份数据库
+type BackupJob struct {
+	backupService service.BackupService
+}
+
+func NewBackupJob() *BackupJob {
+	return new(BackupJob)
+}
+
+func (j *BackupJob) Run() {
+	err := j.backupService.RunScheduledBackup()
+	if err != nil {
+		logger.Warning("scheduled backup failed:", err)
+	}
+}
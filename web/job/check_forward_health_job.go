@@ -0,0 +1,21 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type CheckForwardHealthJob struct {
+	forwardHealthService service.ForwardHealthService
+}
+
+func NewCheckForwardHealthJob() *CheckForwardHealthJob {
+	return new(CheckForwardHealthJob)
+}
+
+func (j *CheckForwardHealthJob) Run() {
+	err := j.forwardHealthService.CheckAll()
+	if err != nil {
+		logger.Warning("check forward health failed:", err)
+	}
+}
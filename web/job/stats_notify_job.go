@@ -5,13 +5,8 @@ import (
 	"net"
 	"os"
 
-	"time"
-
 	"x-ui/logger"
-	"x-ui/util/common"
 	"x-ui/web/service"
-
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 type LoginStatus byte
@@ -26,50 +21,33 @@ type StatsNotifyJob struct {
 	xrayService    service.XrayService
 	inboundService service.InboundService
 	settingService service.SettingService
+
+	notificationService service.NotificationService
 }
 
 func NewStatsNotifyJob() *StatsNotifyJob {
 	return new(StatsNotifyJob)
 }
 
-func (j *StatsNotifyJob) SendMsgToTgbot(msg string) {
-	//Telegram bot basic info
-	tgBottoken, err := j.settingService.GetTgBotToken()
-	if err != nil {
-		logger.Warning("sendMsgToTgbot failed,GetTgBotToken fail:", err)
+//Here run is a interface method of Job interface
+func (j *StatsNotifyJob) Run() {
+	if !j.xrayService.IsXrayRunning() {
 		return
 	}
-	tgBotid, err := j.settingService.GetTgBotChatId()
+	enabled, err := j.notificationService.HasEnabledChannel()
 	if err != nil {
-		logger.Warning("sendMsgToTgbot failed,GetTgBotChatId fail:", err)
+		logger.Warning("StatsNotifyJob run failed:", err)
 		return
 	}
-
-	bot, err := tgbotapi.NewBotAPI(tgBottoken)
-	if err != nil {
-		fmt.Println("get tgbot error:", err)
+	if !enabled {
 		return
 	}
-	bot.Debug = true
-	fmt.Printf("Authorized on account %s", bot.Self.UserName)
-	info := tgbotapi.NewMessage(int64(tgBotid), msg)
-	//msg.ReplyToMessageID = int(tgBotid)
-	bot.Send(info)
-}
-
-//Here run is a interface method of Job interface
-func (j *StatsNotifyJob) Run() {
-	if !j.xrayService.IsXrayRunning() {
-		return
-	}
-	var info string
 	//get hostname
 	name, err := os.Hostname()
 	if err != nil {
 		fmt.Println("get hostname error:", err)
 		return
 	}
-	info = fmt.Sprintf("主机名称:%s\r\n", name)
 	//get ip address
 	var ip string
 	netInterfaces, err := net.Interfaces()
@@ -95,7 +73,6 @@ func (j *StatsNotifyJob) Run() {
 			}
 		}
 	}
-	info += fmt.Sprintf("IP地址:%s\r\n \r\n", ip)
 
 	//get traffic
 	inbouds, err := j.inboundService.GetAllInbounds()
@@ -103,17 +80,19 @@ func (j *StatsNotifyJob) Run() {
 		logger.Warning("StatsNotifyJob run failed:", err)
 		return
 	}
-	//NOTE:If there no any sessions here,need to notify here
-	//TODO:分节点推送,自动转化格式
+	data := &service.NotifyStatsData{
+		Hostname: name,
+		Ip:       ip,
+		Inbounds: make([]*service.NotifyInbound, 0, len(inbouds)),
+	}
 	for _, inbound := range inbouds {
-		info += fmt.Sprintf("节点名称:%s\r\n端口:%d\r\n上行流量↑:%s\r\n下行流量↓:%s\r\n总流量:%s\r\n", inbound.Remark, inbound.Port, common.FormatTraffic(inbound.Up), common.FormatTraffic(inbound.Down), common.FormatTraffic((inbound.Up + inbound.Down)))
-		if inbound.ExpiryTime == 0 {
-			info += fmt.Sprintf("到期时间:无限期\r\n \r\n")
-		} else {
-			info += fmt.Sprintf("到期时间:%s\r\n \r\n", time.Unix((inbound.ExpiryTime/1000), 0).Format("2006-01-02 15:04:05"))
-		}
+		data.Inbounds = append(data.Inbounds, service.NewNotifyInbound(inbound))
+	}
+	// 入站较多时按渠道的长度限制自动分页发送
+	err = j.notificationService.NotifyEvent(service.NotifyEventStats, data)
+	if err != nil {
+		logger.Warning("send stats notification failed:", err)
 	}
-	j.SendMsgToTgbot(info)
 }
 
 func (j *StatsNotifyJob) UserLoginNotify(username string, ip string, time string, status LoginStatus) {
@@ -121,20 +100,21 @@ func (j *StatsNotifyJob) UserLoginNotify(username string, ip string, time string
 		logger.Warning("UserLoginNotify failed,invalid info")
 		return
 	}
-	var msg string
 	//get hostname
 	name, err := os.Hostname()
 	if err != nil {
 		fmt.Println("get hostname error:", err)
 		return
 	}
-	if status == LoginSuccess {
-		msg = fmt.Sprintf("面板登录成功提醒\r\n主机名称:%s\r\n", name)
-	} else if status == LoginFail {
-		msg = fmt.Sprintf("面板登录失败提醒\r\n主机名称:%s\r\n", name)
+	data := &service.NotifyLoginData{
+		Hostname: name,
+		Username: username,
+		Ip:       ip,
+		Time:     time,
+		Success:  status == LoginSuccess,
+	}
+	err = j.notificationService.NotifyEvent(service.NotifyEventLogin, data)
+	if err != nil {
+		logger.Warning("send login notification failed:", err)
 	}
-	msg += fmt.Sprintf("时间:%s\r\n", time)
-	msg += fmt.Sprintf("用户:%s\r\n", username)
-	msg += fmt.Sprintf("IP:%s\r\n", ip)
-	j.SendMsgToTgbot(msg)
 }
@@ -0,0 +1,41 @@
+package job
+
+import (
+	"time"
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type StatusHistoryJob struct {
+	serverService        service.ServerService
+	statusHistoryService service.StatusHistoryService
+
+	lastStatus *service.Status
+	cpuSampler service.CpuSampler
+}
+
+func NewStatusHistoryJob() *StatusHistoryJob {
+	return new(StatusHistoryJob)
+}
+
+func (j *StatusHistoryJob) Run() {
+	// 网速和 CPU 使用率都按距离上一次采样的时间计算，即一分钟内的平均值
+	status, ok := j.serverService.GetStatusWithCpuSampler(j.lastStatus, &j.cpuSampler)
+	first := j.lastStatus == nil
+	j.lastStatus = status
+	if !first && ok {
+		err := j.statusHistoryService.RecordStatus(status)
+		if err != nil {
+			logger.Warning("record status failed:", err)
+		}
+	}
+	now := time.Now()
+	err := j.statusHistoryService.Rollup(now)
+	if err != nil {
+		logger.Warning("rollup status failed:", err)
+	}
+	err = j.statusHistoryService.Prune(now)
+	if err != nil {
+		logger.Warning("prune status failed:", err)
+	}
+}
@@ -0,0 +1,42 @@
+package job
+
+import (
+	"time"
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+// TgBindingWarnJob 向绑定了电报的终端用户发送流量和到期提醒
+type TgBindingWarnJob struct {
+	settingService   service.SettingService
+	tgBindingService service.TgBindingService
+	tgBotService     service.TgBotService
+}
+
+func NewTgBindingWarnJob() *TgBindingWarnJob {
+	return new(TgBindingWarnJob)
+}
+
+func (j *TgBindingWarnJob) Run() {
+	enabled, err := j.settingService.GetTgbotenabled()
+	if err != nil || !enabled {
+		return
+	}
+	warnings, err := j.tgBindingService.CheckWarnings(time.Now())
+	if err != nil {
+		logger.Warning("check telegram binding warnings failed:", err)
+	}
+	for _, warning := range warnings {
+		if warning.Text != "" {
+			err = j.tgBotService.SendMessage(warning.ChatId, warning.Text)
+			if err != nil {
+				logger.Warningf("send telegram warning to %v failed: %v", warning.ChatId, err)
+				continue
+			}
+		}
+		err = j.tgBindingService.SaveWarningState(warning)
+		if err != nil {
+			logger.Warning("save telegram binding warning state failed:", err)
+		}
+	}
+}
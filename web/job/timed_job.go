@@ -0,0 +1,29 @@
+package job
+
+import (
+	"time"
+	"x-ui/web/service"
+
+	"github.com/robfig/cron/v3"
+)
+
+// TimedJob 记录任务每次执行的耗时，供 /metrics 输出
+type TimedJob struct {
+	name string
+	job  cron.Job
+}
+
+func NewTimedJob(name string, job cron.Job) *TimedJob {
+	return &TimedJob{
+		name: name,
+		job:  job,
+	}
+}
+
+func (j *TimedJob) Run() {
+	start := time.Now()
+	defer func() {
+		service.RecordJobDuration(j.name, time.Since(start))
+	}()
+	j.job.Run()
+}
@@ -0,0 +1,26 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type TlsCertRenewJob struct {
+	xrayService    service.XrayService
+	tlsCertService service.TlsCertService
+}
+
+func NewTlsCertRenewJob() *TlsCertRenewJob {
+	return new(TlsCertRenewJob)
+}
+
+func (j *TlsCertRenewJob) Run() {
+	count, err := j.tlsCertService.RenewExpiringTlsCerts()
+	if err != nil {
+		logger.Warning("renew tls certificates failed:", err)
+	}
+	if count > 0 {
+		// 证书文件名或内容变化，重新生成配置后 xray 会重启
+		j.xrayService.SetToNeedRestart()
+	}
+}
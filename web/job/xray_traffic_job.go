@@ -23,6 +23,7 @@ func (j *XrayTrafficJob) Run() {
 		logger.Warning("get xray traffic failed:", err)
 		return
 	}
+	service.RecordTraffic(traffics)
 	err = j.inboundService.AddTraffic(traffics)
 	if err != nil {
 		logger.Warning("add traffic failed:", err)
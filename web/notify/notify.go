@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// 通知渠道类型
+const (
+	TypeTelegram = "telegram"
+	TypeWebhook  = "webhook"
+	TypeSMTP     = "smtp"
+	TypeDiscord  = "discord"
+	TypeSlack    = "slack"
+)
+
+// Message 一条通知，Title 为空时只发送正文
+type Message struct {
+	Title string
+	Text  string
+	Time  time.Time
+}
+
+// FullText 标题和正文合并后的文本，用于不区分标题的渠道
+func (m *Message) FullText() string {
+	if m.Title == "" {
+		return m.Text
+	}
+	return m.Title + "\r\n" + m.Text
+}
+
+type Notifier interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// NewNotifier 根据渠道类型和 JSON 配置创建通知器
+func NewNotifier(notifierType string, settings string) (Notifier, error) {
+	var notifier interface {
+		Notifier
+		validate() error
+	}
+	switch notifierType {
+	case TypeTelegram:
+		notifier = &TelegramNotifier{}
+	case TypeWebhook:
+		notifier = &WebhookNotifier{}
+	case TypeSMTP:
+		notifier = &SMTPNotifier{}
+	case TypeDiscord:
+		notifier = &ChatWebhookNotifier{Kind: TypeDiscord}
+	case TypeSlack:
+		notifier = &ChatWebhookNotifier{Kind: TypeSlack}
+	default:
+		return nil, fmt.Errorf("unsupported notifier type: %v", notifierType)
+	}
+	if settings != "" {
+		err := json.Unmarshal([]byte(settings), notifier)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := notifier.validate()
+	if err != nil {
+		return nil, err
+	}
+	return notifier, nil
+}
+
+// RetryPolicy 发送失败后按指数退避重试
+type RetryPolicy struct {
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:  4,
+	BaseDelay: time.Second,
+	MaxDelay:  time.Second * 30,
+}
+
+// SendWithRetry 发送通知，失败时重试，ctx 取消后停止重试并返回最后一次的错误
+func SendWithRetry(ctx context.Context, notifier Notifier, msg *Message, policy RetryPolicy) error {
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+	delay := policy.BaseDelay
+	var err error
+	for i := 0; i < policy.Attempts || i == 0; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(delay):
+			}
+			delay *= 2
+			if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+				delay = policy.MaxDelay
+			}
+		}
+		err = notifier.Send(ctx, msg)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,287 @@
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordServer 记录收到的请求，前 fails 次请求返回 500
+type recordServer struct {
+	*httptest.Server
+	lock     sync.Mutex
+	fails    int
+	times    []time.Time
+	headers  []http.Header
+	bodies   [][]byte
+	requests int
+}
+
+func newRecordServer(t *testing.T, fails int) *recordServer {
+	s := &recordServer{fails: fails}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.requests++
+		s.times = append(s.times, time.Now())
+		s.headers = append(s.headers, r.Header.Clone())
+		s.bodies = append(s.bodies, body)
+		if s.requests <= s.fails {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestWebhookSignature(t *testing.T) {
+	server := newRecordServer(t, 0)
+	notifier, err := NewNotifier(TypeWebhook, `{"url": "`+server.URL+`", "secret": "s3cret"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &Message{Title: "title", Text: "text", Time: time.Unix(1700000000, 0)}
+	err = notifier.Send(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, body := server.headers[0], server.bodies[0]
+	timestamp := header.Get("X-XUI-Timestamp")
+	if timestamp == "" {
+		t.Fatal("timestamp header is missing")
+	}
+	want := "sha256=" + Sign("s3cret", timestamp, body)
+	if got := header.Get("X-XUI-Signature"); got != want {
+		t.Errorf("signature = %v, want %v", got, want)
+	}
+	// 签名必须覆盖请求体，修改请求体后签名不再匹配
+	if Sign("s3cret", timestamp, append(body, ' ')) == Sign("s3cret", timestamp, body) {
+		t.Error("signature does not depend on body")
+	}
+	payload := webhookPayload{}
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload != (webhookPayload{Title: "title", Text: "text", Time: 1700000000}) {
+		t.Errorf("payload = %+v", payload)
+	}
+}
+
+func TestWebhookWithoutSecret(t *testing.T) {
+	server := newRecordServer(t, 0)
+	notifier := &WebhookNotifier{URL: server.URL}
+	err := notifier.Send(context.Background(), &Message{Text: "text", Time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.headers[0].Get("X-XUI-Signature") != "" {
+		t.Error("signature header should be empty without secret")
+	}
+}
+
+func TestChatWebhookPayload(t *testing.T) {
+	for _, c := range []struct {
+		kind string
+		key  string
+	}{
+		{TypeDiscord, "content"},
+		{TypeSlack, "text"},
+	} {
+		server := newRecordServer(t, 0)
+		notifier, err := NewNotifier(c.kind, `{"url": "`+server.URL+`"}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = notifier.Send(context.Background(), &Message{Title: "title", Text: "text"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload := map[string]string{}
+		err = json.Unmarshal(server.bodies[0], &payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(payload) != 1 || payload[c.key] != "title\r\ntext" {
+			t.Errorf("%v payload = %v, want only %v", c.kind, payload, c.key)
+		}
+	}
+}
+
+func TestSendWithRetry(t *testing.T) {
+	server := newRecordServer(t, 2)
+	notifier := &WebhookNotifier{URL: server.URL}
+	policy := RetryPolicy{Attempts: 4, BaseDelay: time.Millisecond * 50, MaxDelay: time.Millisecond * 80}
+	err := SendWithRetry(context.Background(), notifier, &Message{Text: "text"}, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.requests != 3 {
+		t.Fatalf("requests = %v, want 3", server.requests)
+	}
+	// 第一次重试等待 BaseDelay，之后翻倍但不超过 MaxDelay
+	for i, want := range []time.Duration{policy.BaseDelay, policy.MaxDelay} {
+		if delay := server.times[i+1].Sub(server.times[i]); delay < want {
+			t.Errorf("retry %v delay = %v, want at least %v", i+1, delay, want)
+		}
+	}
+
+	server = newRecordServer(t, 100)
+	notifier = &WebhookNotifier{URL: server.URL}
+	err = SendWithRetry(context.Background(), notifier, &Message{Text: "text"}, policy)
+	if err == nil {
+		t.Fatal("send should fail after all attempts")
+	}
+	if server.requests != policy.Attempts {
+		t.Errorf("requests = %v, want %v", server.requests, policy.Attempts)
+	}
+}
+
+func TestSendWithRetryCanceled(t *testing.T) {
+	server := newRecordServer(t, 100)
+	notifier := &WebhookNotifier{URL: server.URL}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	policy := RetryPolicy{Attempts: 10, BaseDelay: time.Second}
+	start := time.Now()
+	err := SendWithRetry(ctx, notifier, &Message{Text: "text"}, policy)
+	if err == nil {
+		t.Fatal("send should fail")
+	}
+	if time.Since(start) > policy.BaseDelay || server.requests != 1 {
+		t.Errorf("retry did not stop after cancel, requests = %v", server.requests)
+	}
+}
+
+// smtpMail 测试 SMTP 服务收到的一封邮件
+type smtpMail struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// startSMTPServer 最小的 SMTP 服务，不支持 STARTTLS，收到的邮件写入 mails
+func startSMTPServer(t *testing.T) (int, chan *smtpMail) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	mails := make(chan *smtpMail, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		text := textproto.NewConn(conn)
+		mail := &smtpMail{}
+		text.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch cmd {
+			case "EHLO":
+				text.PrintfLine("250-localhost")
+				text.PrintfLine("250 AUTH PLAIN")
+			case "AUTH":
+				mail.auth = strings.TrimPrefix(line, "AUTH PLAIN ")
+				text.PrintfLine("235 ok")
+			case "MAIL":
+				mail.from = line
+				text.PrintfLine("250 ok")
+			case "RCPT":
+				mail.to = append(mail.to, line)
+				text.PrintfLine("250 ok")
+			case "DATA":
+				text.PrintfLine("354 go ahead")
+				data, err := text.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				mail.data = string(data)
+				text.PrintfLine("250 ok")
+			case "QUIT":
+				text.PrintfLine("221 bye")
+				mails <- mail
+				return
+			default:
+				text.PrintfLine("502 unknown command")
+			}
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, mails
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	port, mails := startSMTPServer(t)
+	notifier := &SMTPNotifier{
+		Host:     "127.0.0.1",
+		Port:     port,
+		Username: "user",
+		Password: "pass",
+		From:     "x-ui@example.com",
+		To:       []string{"a@example.com", "b@example.com"},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	err := notifier.Send(ctx, &Message{Title: "流量提醒", Text: "text", Time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mail := <-mails
+	if mail.auth != base64.StdEncoding.EncodeToString([]byte("\x00user\x00pass")) {
+		t.Errorf("auth = %v", mail.auth)
+	}
+	if mail.from != "MAIL FROM:<x-ui@example.com>" {
+		t.Errorf("from = %v", mail.from)
+	}
+	if len(mail.to) != 2 || mail.to[1] != "RCPT TO:<b@example.com>" {
+		t.Errorf("to = %v", mail.to)
+	}
+	if !strings.Contains(mail.data, "Subject: =?utf-8?b?") {
+		t.Errorf("subject is not encoded: %v", mail.data)
+	}
+	if !strings.Contains(mail.data, base64.StdEncoding.EncodeToString([]byte("text"))) {
+		t.Errorf("body is not base64 encoded: %v", mail.data)
+	}
+}
+
+func TestSMTPNotifierCanceled(t *testing.T) {
+	// 只接受连接不响应的服务，发送应在 ctx 到期时返回
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	notifier := &SMTPNotifier{
+		Host: "127.0.0.1",
+		Port: listener.Addr().(*net.TCPAddr).Port,
+		From: "x-ui@example.com",
+		To:   []string{"a@example.com"},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	err = notifier.Send(ctx, &Message{Text: "text", Time: time.Now()})
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("err = %v, want timeout", err)
+	}
+}
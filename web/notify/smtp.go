@@ -0,0 +1,129 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPNotifier 通过 SMTP 发送邮件，465 端口使用隐式 TLS，其余端口在服务器支持时使用 STARTTLS
+type SMTPNotifier struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+func (n *SMTPNotifier) validate() error {
+	if n.Host == "" {
+		return errors.New("smtp host is empty")
+	}
+	if n.Port <= 0 || n.Port > 65535 {
+		return fmt.Errorf("smtp port is invalid: %v", n.Port)
+	}
+	if n.From == "" {
+		return errors.New("smtp from is empty")
+	}
+	if len(n.To) == 0 {
+		return errors.New("smtp to is empty")
+	}
+	return nil
+}
+
+func (n *SMTPNotifier) buildMail(msg *Message) []byte {
+	subject := msg.Title
+	if subject == "" {
+		subject = "x-ui"
+	}
+	builder := strings.Builder{}
+	builder.WriteString("From: " + n.From + "\r\n")
+	builder.WriteString("To: " + strings.Join(n.To, ", ") + "\r\n")
+	builder.WriteString("Subject: " + mime.BEncoding.Encode("utf-8", subject) + "\r\n")
+	builder.WriteString("Date: " + msg.Time.Format(time.RFC1123Z) + "\r\n")
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	builder.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(msg.Text))
+	for len(encoded) > 76 {
+		builder.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	builder.WriteString(encoded + "\r\n")
+	return []byte(builder.String())
+}
+
+func (n *SMTPNotifier) Send(ctx context.Context, msg *Message) error {
+	addr := net.JoinHostPort(n.Host, strconv.Itoa(n.Port))
+	dialer := &net.Dialer{Timeout: time.Second * 15}
+	var conn net.Conn
+	var err error
+	tlsConfig := &tls.Config{ServerName: n.Host}
+	if n.Port == 465 {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsConfig}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(time.Minute)
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, n.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if n.Port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			err = client.StartTLS(tlsConfig)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if n.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", n.Username, n.Password, n.Host))
+		if err != nil {
+			return err
+		}
+	}
+	err = client.Mail(n.From)
+	if err != nil {
+		return err
+	}
+	for _, to := range n.To {
+		err = client.Rcpt(to)
+		if err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(n.buildMail(msg))
+	if err != nil {
+		return err
+	}
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 按 token 复用 bot 连接，避免每条消息都重新调用 getMe
+var botMap = map[string]*tgbotapi.BotAPI{}
+var botLock sync.Mutex
+
+// GetBot 返回 token 对应的 bot，首次调用时创建
+func GetBot(token string) (*tgbotapi.BotAPI, error) {
+	botLock.Lock()
+	defer botLock.Unlock()
+	bot, ok := botMap[token]
+	if ok {
+		return bot, nil
+	}
+	bot, err := tgbotapi.NewBotAPI(token)
+	if err != nil {
+		return nil, err
+	}
+	botMap[token] = bot
+	return bot, nil
+}
+
+type TelegramNotifier struct {
+	Token  string `json:"token"`
+	ChatId int64  `json:"chatId"`
+}
+
+func (n *TelegramNotifier) validate() error {
+	if n.Token == "" {
+		return errors.New("telegram bot token is empty")
+	}
+	if n.ChatId == 0 {
+		return errors.New("telegram chat id is empty")
+	}
+	return nil
+}
+
+func (n *TelegramNotifier) Send(ctx context.Context, msg *Message) error {
+	bot, err := GetBot(n.Token)
+	if err != nil {
+		return err
+	}
+	_, err = bot.Send(tgbotapi.NewMessage(n.ChatId, msg.FullText()))
+	return err
+}
+
+func (n *TelegramNotifier) maxLength() int {
+	return telegramMaxLength
+}
@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+	"x-ui/util/common"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// 各渠道单条消息的最大长度，0 表示不限制
+const (
+	telegramMaxLength = 4096
+	discordMaxLength  = 2000
+	slackMaxLength    = 40000
+)
+
+// MaxLength 返回通知器单条消息的最大字符数，0 表示不限制
+func MaxLength(notifier Notifier) int {
+	if n, ok := notifier.(interface{ maxLength() int }); ok {
+		return n.maxLength()
+	}
+	return 0
+}
+
+func templateFuncs(localizer *i18n.Localizer) template.FuncMap {
+	return template.FuncMap{
+		// i18n 按 key 翻译，后面可以跟成对的参数名和参数值
+		"i18n": func(key string, params ...interface{}) string {
+			data := map[string]interface{}{}
+			for i := 0; i+1 < len(params); i += 2 {
+				if name, ok := params[i].(string); ok {
+					data[name] = params[i+1]
+				}
+			}
+			text, err := localizer.Localize(&i18n.LocalizeConfig{
+				MessageID:    key,
+				TemplateData: data,
+			})
+			if err != nil {
+				return key
+			}
+			return text
+		},
+		"add": func(a int64, b int64) int64 {
+			return a + b
+		},
+		"traffic": func(bytes int64) string {
+			return common.FormatTraffic(bytes)
+		},
+		// time 格式化 unix 秒
+		"time": func(t int64) string {
+			return time.Unix(t, 0).Format("2006-01-02 15:04:05")
+		},
+	}
+}
+
+// ParseTemplate 解析通知模板，用于保存前检查模板是否正确
+func ParseTemplate(text string) (*template.Template, error) {
+	return template.New("notify").Funcs(templateFuncs(nil)).Parse(text)
+}
+
+// Render 使用 localizer 渲染通知模板，模板中可以使用 i18n、traffic、time 函数
+func Render(text string, localizer *i18n.Localizer, data interface{}) (string, error) {
+	t, err := template.New("notify").Funcs(templateFuncs(localizer)).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	err = t.Execute(buf, data)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Split 将过长的文本拆分为不超过 limit 个字符的多段，在换行处拆分并尽量保持空行分隔的段落完整，
+// 单行仍然过长时按字符截断。limit <= 0 时不拆分
+func Split(text string, limit int) []string {
+	if limit <= 0 || utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+	parts := make([]string, 0)
+	lines := make([]string, 0)
+	flush := func(n int) {
+		part := strings.TrimSpace(strings.Join(lines[:n], "\n"))
+		if part != "" {
+			parts = append(parts, part)
+		}
+		lines = lines[n:]
+	}
+	for _, line := range strings.Split(text, "\n") {
+		runes := []rune(line)
+		for len(runes) > limit {
+			flush(len(lines))
+			parts = append(parts, string(runes[:limit]))
+			runes = runes[limit:]
+		}
+		line = string(runes)
+		if len(lines) > 0 && utf8.RuneCountInString(strings.Join(lines, "\n"))+1+len(runes) > limit {
+			// 优先在最后一个空行处拆分，剩余的行留给下一段
+			cut := len(lines)
+			for i := len(lines) - 1; i > 0; i-- {
+				if strings.TrimSpace(lines[i]) == "" {
+					cut = i
+					break
+				}
+			}
+			flush(cut)
+			if utf8.RuneCountInString(strings.Join(lines, "\n"))+1+len(runes) > limit {
+				flush(len(lines))
+			}
+		}
+		lines = append(lines, line)
+	}
+	flush(len(lines))
+	return parts
+}
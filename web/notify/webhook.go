@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var httpClient = &http.Client{
+	Timeout: time.Second * 15,
+}
+
+// Sign 计算 webhook 签名：hex(HMAC-SHA256(secret, timestamp + "." + body))
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func postJSON(ctx context.Context, url string, body []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook response %v: %s", resp.Status, data)
+	}
+	return nil
+}
+
+// WebhookNotifier 以 JSON 格式 POST 通知，设置了 Secret 时在请求头中附带签名
+type WebhookNotifier struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+type webhookPayload struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+	Time  int64  `json:"time"`
+}
+
+func (n *WebhookNotifier) validate() error {
+	if n.URL == "" {
+		return errors.New("webhook url is empty")
+	}
+	return nil
+}
+
+func (n *WebhookNotifier) Send(ctx context.Context, msg *Message) error {
+	body, err := json.Marshal(&webhookPayload{
+		Title: msg.Title,
+		Text:  msg.Text,
+		Time:  msg.Time.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	if n.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		header.Set("X-XUI-Timestamp", timestamp)
+		header.Set("X-XUI-Signature", "sha256="+Sign(n.Secret, timestamp, body))
+	}
+	return postJSON(ctx, n.URL, body, header)
+}
+
+// ChatWebhookNotifier Discord 和 Slack 兼容的 incoming webhook
+type ChatWebhookNotifier struct {
+	Kind string `json:"-"`
+	URL  string `json:"url"`
+}
+
+func (n *ChatWebhookNotifier) validate() error {
+	if n.URL == "" {
+		return errors.New("webhook url is empty")
+	}
+	return nil
+}
+
+func (n *ChatWebhookNotifier) Send(ctx context.Context, msg *Message) error {
+	payload := map[string]string{}
+	if n.Kind == TypeDiscord {
+		payload["content"] = msg.FullText()
+	} else {
+		payload["text"] = msg.FullText()
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, n.URL, body, nil)
+}
+
+func (n *ChatWebhookNotifier) maxLength() int {
+	if n.Kind == TypeDiscord {
+		return discordMaxLength
+	}
+	return slackMaxLength
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/config"
+	"x-ui/util/common"
+
+	"go.uber.org/atomic"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ACME 验证方式
+const (
+	AcmeChallengeHttp01    = "http-01"
+	AcmeChallengeTlsAlpn01 = "tls-alpn-01"
+)
+
+// acmeAccountKeyName 账号密钥在缓存目录中的文件名，与 autocert 一致，面板和证书库共用一个账号
+const acmeAccountKeyName = "acme_account+key"
+
+// acmeHttpTokens 证书库签发证书时 HTTP-01 验证的响应，key 为验证路径
+var acmeHttpTokens sync.Map
+
+// acmeHttpServing 面板的 HTTP-01 验证服务是否在运行，没有运行时证书库签发证书时临时监听
+var acmeHttpServing atomic.Bool
+
+// LoadCertPool 读取 PEM 格式的 CA 证书，用于信任 Pebble 等测试 ACME 服务器
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, common.NewError("read acme ca file failed:", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, common.NewError("no certificate found in acme ca file:", caFile)
+	}
+	return pool, nil
+}
+
+// isValidDomain 检查 ACME 可以签发的域名，至少包含两级且不是 IP
+func isValidDomain(domain string) bool {
+	return strings.Contains(strings.Trim(domain, "."), ".") && net.ParseIP(domain) == nil && !strings.ContainsAny(domain, " /:")
+}
+
+// SetAcmeHttpServing 面板启动或停止 HTTP-01 验证服务时调用
+func SetAcmeHttpServing(serving bool) {
+	acmeHttpServing.Store(serving)
+}
+
+// HandleAcmeHttpChallenge 响应证书库签发证书的 HTTP-01 验证请求，不是这类请求时返回 false
+func HandleAcmeHttpChallenge(w http.ResponseWriter, r *http.Request) bool {
+	if !strings.HasPrefix(r.URL.Path, "/.well-known/acme-challenge/") {
+		return false
+	}
+	response, ok := acmeHttpTokens.Load(r.URL.Path)
+	if !ok {
+		return false
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(response.(string)))
+	return true
+}
+
+func (s *SettingService) GetAcmeEnable() (bool, error) {
+	return s.getBool("acmeEnable")
+}
+
+// GetAcmeDomains 返回需要签发证书的面板域名
+func (s *SettingService) GetAcmeDomains() ([]string, error) {
+	str, err := s.getString("acmeDomains")
+	if err != nil {
+		return nil, err
+	}
+	return common.SplitTrim(str), nil
+}
+
+func (s *SettingService) GetAcmeEmail() (string, error) {
+	return s.getString("acmeEmail")
+}
+
+func (s *SettingService) GetAcmeDirectory() (string, error) {
+	return s.getString("acmeDirectory")
+}
+
+func (s *SettingService) GetAcmeChallenge() (string, error) {
+	return s.getString("acmeChallenge")
+}
+
+func (s *SettingService) GetAcmeHttpListen() (string, error) {
+	return s.getString("acmeHttpListen")
+}
+
+func (s *SettingService) GetAcmeCaFile() (string, error) {
+	return s.getString("acmeCaFile")
+}
+
+// NewAcmeClient 按设置创建 ACME 客户端，未设置账号密钥，由调用方设置
+func (s *SettingService) NewAcmeClient() (*acme.Client, error) {
+	directory, err := s.GetAcmeDirectory()
+	if err != nil {
+		return nil, err
+	}
+	caFile, err := s.GetAcmeCaFile()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile != "" {
+		pool, err := LoadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	httpClient := &http.Client{
+		Timeout: time.Minute,
+		Transport: &acmeTransport{
+			RoundTripper: transport,
+			orders:       map[string]string{},
+		},
+	}
+	return &acme.Client{
+		DirectoryURL: directory,
+		HTTPClient:   httpClient,
+	}, nil
+}
+
+// getAcmeAccountKey 读取 autocert 保存的账号密钥，不存在时生成并以相同格式保存
+func getAcmeAccountKey(ctx context.Context) (crypto.Signer, error) {
+	cache := autocert.DirCache(config.GetAcmeCacheDir())
+	data, err := cache.Get(ctx, acmeAccountKeyName)
+	if err == autocert.ErrCacheMiss {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		data = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		err = cache.Put(ctx, acmeAccountKeyName, data)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	} else if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, common.NewError("invalid acme account key")
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// acmeTransport 在 finalize 响应缺少 Location 头时补上订单地址。
+// 客户端在异步签发时按该头等待订单完成，Let's Encrypt 会返回它，Pebble 不返回
+type acmeTransport struct {
+	http.RoundTripper
+
+	lock sync.Mutex
+	// finalize 地址到订单地址
+	orders map[string]string
+}
+
+func (t *acmeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil || req.Method != http.MethodPost {
+		return resp, err
+	}
+	location := resp.Header.Get("Location")
+	if resp.StatusCode == http.StatusCreated && location != "" {
+		// 新订单的响应中带有 finalize 地址
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		order := &struct {
+			Finalize string `json:"finalize"`
+		}{}
+		if json.Unmarshal(body, order) == nil && order.Finalize != "" {
+			t.lock.Lock()
+			t.orders[order.Finalize] = location
+			t.lock.Unlock()
+		}
+		return resp, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		// badNonce 等错误会重试同一个请求
+		return resp, nil
+	}
+	t.lock.Lock()
+	orderURL, ok := t.orders[req.URL.String()]
+	delete(t.orders, req.URL.String())
+	t.lock.Unlock()
+	if ok && location == "" {
+		resp.Header.Set("Location", orderURL)
+	}
+	return resp, nil
+}
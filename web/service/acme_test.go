@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// newFakeAcmeServer 模拟 Pebble 的行为：finalize 响应中订单状态为 processing 且没有 Location 头，
+// 订单地址需要从新建订单的响应中得到
+func newFakeAcmeServer(t *testing.T) *httptest.Server {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	var server *httptest.Server
+	writeJSON := func(w http.ResponseWriter, status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+	order := func(status string) map[string]interface{} {
+		o := map[string]interface{}{
+			"status":         status,
+			"identifiers":    []map[string]string{{"type": "dns", "value": "example.com"}},
+			"authorizations": []string{},
+			"finalize":       server.URL + "/finalize/1",
+		}
+		if status == acme.StatusValid {
+			o["certificate"] = server.URL + "/cert/1"
+		}
+		return o
+	}
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "nonce")
+		switch r.URL.Path {
+		case "/directory":
+			writeJSON(w, http.StatusOK, map[string]string{
+				"newNonce":   server.URL + "/nonce",
+				"newAccount": server.URL + "/account",
+				"newOrder":   server.URL + "/order",
+			})
+		case "/nonce":
+			w.WriteHeader(http.StatusOK)
+		case "/account":
+			w.Header().Set("Location", server.URL+"/account/1")
+			writeJSON(w, http.StatusCreated, map[string]string{"status": acme.StatusValid})
+		case "/order":
+			w.Header().Set("Location", server.URL+"/order/1")
+			writeJSON(w, http.StatusCreated, order(acme.StatusReady))
+		case "/finalize/1":
+			writeJSON(w, http.StatusOK, order(acme.StatusProcessing))
+		case "/order/1":
+			writeJSON(w, http.StatusOK, order(acme.StatusValid))
+		case "/cert/1":
+			w.Header().Set("Content-Type", "application/pem-certificate-chain")
+			w.Write(certPEM)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// obtainCert 使用给定的 HTTP 客户端完成注册、下单和签发
+func obtainCert(t *testing.T, directory string, httpClient *http.Client) ([][]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &acme.Client{
+		Key:          key,
+		DirectoryURL: directory,
+		HTTPClient:   httpClient,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	_, err = client.Register(ctx, &acme.Account{}, acme.AcceptTOS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs("example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{"example.com"}}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	return der, err
+}
+
+func TestAcmeTransportFinalizeLocation(t *testing.T) {
+	server := newFakeAcmeServer(t)
+	directory := server.URL + "/directory"
+
+	// 不补 Location 头时客户端不知道等待哪个订单
+	_, err := obtainCert(t, directory, server.Client())
+	if err == nil {
+		t.Fatal("obtain certificate without acmeTransport should fail")
+	}
+
+	httpClient := &http.Client{
+		Transport: &acmeTransport{
+			RoundTripper: server.Client().Transport,
+			orders:       map[string]string{},
+		},
+	}
+	der, err := obtainCert(t, directory, httpClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(der) != 1 {
+		t.Fatalf("certificate chain length = %v, want 1", len(der))
+	}
+	cert, err := x509.ParseCertificate(der[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(cert.DNSNames, ","), "example.com") {
+		t.Errorf("certificate names = %v", cert.DNSNames)
+	}
+	transport := httpClient.Transport.(*acmeTransport)
+	if len(transport.orders) != 0 {
+		t.Errorf("finished orders are not removed: %v", transport.orders)
+	}
+}
@@ -0,0 +1,343 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+
+	"gorm.io/gorm"
+)
+
+const alertSystemSubject = "system"
+
+// alertPendingMap 记录条件已满足但还未持续足够时间的告警，key 为 规则 id 和对象
+var alertPendingMap = map[string]int64{}
+var alertPendingLock sync.Mutex
+
+// AlertNotice 告警状态变化，需要发送通知
+type AlertNotice struct {
+	Resolved bool
+	Event    *model.AlertEvent
+}
+
+type alertSample struct {
+	subject string
+	name    string
+	value   float64
+}
+
+type AlertService struct {
+	inboundService InboundService
+	tlsCertService TlsCertService
+}
+
+func (s *AlertService) GetAlertRules() ([]*model.AlertRule, error) {
+	db := database.GetDB()
+	var rules []*model.AlertRule
+	err := db.Model(model.AlertRule{}).Order("id asc").Find(&rules).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (s *AlertService) checkAlertRule(rule *model.AlertRule) error {
+	if rule.Name == "" {
+		return common.NewError("告警名称不能为空")
+	}
+	switch rule.Metric {
+	case model.AlertMetricCpu, model.AlertMetricMem, model.AlertMetricSwap, model.AlertMetricDisk,
+		model.AlertMetricLoad, model.AlertMetricTcpCount, model.AlertMetricUdpCount, model.AlertMetricXrayError,
+		model.AlertMetricInboundUsage, model.AlertMetricInboundDays, model.AlertMetricCertDays:
+	default:
+		return common.NewError("不支持的告警指标:", rule.Metric)
+	}
+	switch rule.Operator {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return common.NewError("不支持的比较运算符:", rule.Operator)
+	}
+	if rule.Hysteresis < 0 {
+		return common.NewError("恢复幅度不能小于 0")
+	}
+	if rule.Duration < 0 {
+		return common.NewError("持续时间不能小于 0")
+	}
+	return nil
+}
+
+func (s *AlertService) AddAlertRule(rule *model.AlertRule) error {
+	err := s.checkAlertRule(rule)
+	if err != nil {
+		return err
+	}
+	db := database.GetDB()
+	return db.Create(rule).Error
+}
+
+func (s *AlertService) UpdateAlertRule(rule *model.AlertRule) error {
+	err := s.checkAlertRule(rule)
+	if err != nil {
+		return err
+	}
+	db := database.GetDB()
+	err = db.Model(model.AlertRule{}).First(&model.AlertRule{}, rule.Id).Error
+	if err != nil {
+		return err
+	}
+	return db.Save(rule).Error
+}
+
+// DelAlertRule 删除规则，并结束该规则仍在告警中的记录
+func (s *AlertService) DelAlertRule(id int) error {
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(model.AlertEvent{}).
+			Where("rule_id = ? and resolved_at = 0", id).
+			Update("resolved_at", time.Now().Unix()).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(model.AlertRule{}, id).Error
+	})
+}
+
+// GetAlertEvents 返回最近的告警记录，仍在告警中的排在前面
+func (s *AlertService) GetAlertEvents(limit int) ([]*model.AlertEvent, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	db := database.GetDB()
+	var events []*model.AlertEvent
+	err := db.Model(model.AlertEvent{}).
+		Order("resolved_at = 0 desc, fired_at desc").
+		Limit(limit).
+		Find(&events).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return events, nil
+}
+
+func percent(current uint64, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(current) / float64(total) * 100
+}
+
+func (s *AlertService) collectSamples(metric string, status *Status, inbounds []*model.Inbound, certs []*model.TlsCert, now time.Time) []alertSample {
+	system := func(value float64) []alertSample {
+		return []alertSample{{subject: alertSystemSubject, name: "系统", value: value}}
+	}
+	switch metric {
+	case model.AlertMetricCpu:
+		return system(status.Cpu)
+	case model.AlertMetricMem:
+		return system(percent(status.Mem.Current, status.Mem.Total))
+	case model.AlertMetricSwap:
+		return system(percent(status.Swap.Current, status.Swap.Total))
+	case model.AlertMetricDisk:
+		return system(percent(status.Disk.Current, status.Disk.Total))
+	case model.AlertMetricLoad:
+		if len(status.Loads) == 0 {
+			return nil
+		}
+		return system(status.Loads[0])
+	case model.AlertMetricTcpCount:
+		return system(float64(status.TcpCount))
+	case model.AlertMetricUdpCount:
+		return system(float64(status.UdpCount))
+	case model.AlertMetricXrayError:
+		value := 0.0
+		if status.Xray.State == Error {
+			value = 1
+		}
+		return system(value)
+	case model.AlertMetricCertDays:
+		samples := make([]alertSample, 0, len(certs))
+		for _, cert := range certs {
+			samples = append(samples, alertSample{
+				subject: fmt.Sprintf("cert:%d", cert.Id),
+				name:    fmt.Sprintf("证书 %s (%s)", cert.Name, cert.Domains),
+				value:   float64(cert.NotAfter-now.Unix()) / float64(24*time.Hour/time.Second),
+			})
+		}
+		return samples
+	}
+
+	samples := make([]alertSample, 0)
+	for _, inbound := range inbounds {
+		if !inbound.Enable {
+			continue
+		}
+		sample := alertSample{
+			subject: fmt.Sprintf("inbound:%d", inbound.Id),
+			name:    fmt.Sprintf("入站 %s (端口 %d)", inbound.Remark, inbound.Port),
+		}
+		switch metric {
+		case model.AlertMetricInboundUsage:
+			if inbound.Total <= 0 {
+				continue
+			}
+			sample.value = float64(inbound.Up+inbound.Down) / float64(inbound.Total) * 100
+		case model.AlertMetricInboundDays:
+			if inbound.ExpiryTime <= 0 {
+				continue
+			}
+			sample.value = float64(inbound.ExpiryTime-now.Unix()*1000) / float64(24*time.Hour/time.Millisecond)
+		default:
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+func compareAlert(operator string, value float64, threshold float64) bool {
+	switch operator {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	}
+	return false
+}
+
+// resolveThreshold 恢复时使用的阈值，向告警条件的反方向偏移 Hysteresis
+func resolveThreshold(rule *model.AlertRule) float64 {
+	switch rule.Operator {
+	case ">", ">=":
+		return rule.Threshold - rule.Hysteresis
+	case "<", "<=":
+		return rule.Threshold + rule.Hysteresis
+	}
+	return rule.Threshold
+}
+
+func getAlertPendingKey(ruleId int, subject string) string {
+	return fmt.Sprintf("%d|%s", ruleId, subject)
+}
+
+func (s *AlertService) getActiveEvents() (map[string]*model.AlertEvent, error) {
+	db := database.GetDB()
+	var events []*model.AlertEvent
+	err := db.Model(model.AlertEvent{}).Where("resolved_at = 0").Find(&events).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	eventMap := make(map[string]*model.AlertEvent, len(events))
+	for _, event := range events {
+		eventMap[getAlertPendingKey(event.RuleId, event.Subject)] = event
+	}
+	return eventMap, nil
+}
+
+// Evaluate 按所有规则检查当前状态，触发新的告警并恢复不再满足条件的告警。
+// 同一规则和对象在恢复前只会触发一次，返回需要发送通知的状态变化
+func (s *AlertService) Evaluate(status *Status, now time.Time) ([]*AlertNotice, error) {
+	rules, err := s.GetAlertRules()
+	if err != nil {
+		return nil, err
+	}
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	certs, err := s.tlsCertService.GetTlsCerts()
+	if err != nil {
+		return nil, err
+	}
+	activeEvents, err := s.getActiveEvents()
+	if err != nil {
+		return nil, err
+	}
+
+	db := database.GetDB()
+	notices := make([]*AlertNotice, 0)
+	seen := map[string]bool{}
+
+	alertPendingLock.Lock()
+	defer alertPendingLock.Unlock()
+
+	for _, rule := range rules {
+		if !rule.Enable {
+			continue
+		}
+		for _, sample := range s.collectSamples(rule.Metric, status, inbounds, certs, now) {
+			key := getAlertPendingKey(rule.Id, sample.subject)
+			seen[key] = true
+			event, active := activeEvents[key]
+			if active {
+				if compareAlert(rule.Operator, sample.value, resolveThreshold(rule)) {
+					continue
+				}
+				event.Value = sample.value
+				event.ResolvedAt = now.Unix()
+				err = db.Save(event).Error
+				if err != nil {
+					return notices, err
+				}
+				notices = append(notices, &AlertNotice{Resolved: true, Event: event})
+				continue
+			}
+
+			if !compareAlert(rule.Operator, sample.value, rule.Threshold) {
+				delete(alertPendingMap, key)
+				continue
+			}
+			since, pending := alertPendingMap[key]
+			if !pending {
+				since = now.Unix()
+				alertPendingMap[key] = since
+			}
+			if now.Unix()-since < int64(rule.Duration) {
+				continue
+			}
+			delete(alertPendingMap, key)
+			event = &model.AlertEvent{
+				RuleId:   rule.Id,
+				RuleName: rule.Name,
+				Subject:  sample.subject,
+				Value:    sample.value,
+				Message:  fmt.Sprintf("%s: %.2f %s %v", sample.name, sample.value, rule.Operator, rule.Threshold),
+				FiredAt:  now.Unix(),
+			}
+			err = db.Create(event).Error
+			if err != nil {
+				return notices, err
+			}
+			notices = append(notices, &AlertNotice{Event: event})
+		}
+	}
+
+	// 规则被禁用、指标不再产生数据（如入站被删除或解除限制）时结束告警
+	for key, event := range activeEvents {
+		if seen[key] {
+			continue
+		}
+		event.ResolvedAt = now.Unix()
+		err = db.Save(event).Error
+		if err != nil {
+			return notices, err
+		}
+		notices = append(notices, &AlertNotice{Resolved: true, Event: event})
+	}
+	for key := range alertPendingMap {
+		if !seen[key] {
+			delete(alertPendingMap, key)
+		}
+	}
+	return notices, nil
+}
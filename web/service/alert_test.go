@@ -0,0 +1,135 @@
+package service
+
+import (
+	"testing"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+)
+
+type alertStep struct {
+	second int64
+	cpu    float64
+	// 期望的通知："" 无通知，"fire" 触发，"resolve" 恢复
+	want string
+}
+
+func TestAlertEvaluate(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		rule  model.AlertRule
+		steps []alertStep
+	}{
+		{
+			name: "hysteresis",
+			rule: model.AlertRule{Operator: ">", Threshold: 80, Hysteresis: 10},
+			steps: []alertStep{
+				{0, 90, "fire"},
+				// 低于阈值但还在恢复幅度内，继续告警
+				{60, 75, ""},
+				{120, 85, ""},
+				{180, 71, ""},
+				{240, 70, "resolve"},
+				{300, 81, "fire"},
+			},
+		},
+		{
+			name: "hysteresis below",
+			rule: model.AlertRule{Operator: "<", Threshold: 10, Hysteresis: 5},
+			steps: []alertStep{
+				{0, 5, "fire"},
+				{60, 12, ""},
+				{120, 16, "resolve"},
+			},
+		},
+		{
+			name: "duration",
+			rule: model.AlertRule{Operator: ">=", Threshold: 80, Duration: 120},
+			steps: []alertStep{
+				{0, 90, ""},
+				{60, 90, ""},
+				// 中途恢复后重新计时
+				{90, 50, ""},
+				{120, 90, ""},
+				{180, 90, ""},
+				{240, 90, "fire"},
+				{300, 50, "resolve"},
+			},
+		},
+		{
+			name: "dedup",
+			rule: model.AlertRule{Operator: ">", Threshold: 80},
+			steps: []alertStep{
+				{0, 90, "fire"},
+				{60, 95, ""},
+				{120, 99, ""},
+				{180, 10, "resolve"},
+				{240, 10, ""},
+				{300, 90, "fire"},
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			initTestDB(t)
+			alertPendingLock.Lock()
+			alertPendingMap = map[string]int64{}
+			alertPendingLock.Unlock()
+			rule := c.rule
+			rule.Name = "cpu"
+			rule.Enable = true
+			rule.Metric = model.AlertMetricCpu
+			service := AlertService{}
+			err := service.AddAlertRule(&rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Unix(1700000000, 0)
+			for _, step := range c.steps {
+				notices, err := service.Evaluate(&Status{Cpu: step.cpu}, start.Add(time.Duration(step.second)*time.Second))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := ""
+				if len(notices) > 1 {
+					t.Fatalf("step %+v: notices = %v, want at most 1", step, len(notices))
+				} else if len(notices) == 1 && notices[0].Resolved {
+					got = "resolve"
+				} else if len(notices) == 1 {
+					got = "fire"
+				}
+				if got != step.want {
+					t.Errorf("step %+v: notice = %q, want %q", step, got, step.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAlertEvaluateDisabledRule(t *testing.T) {
+	initTestDB(t)
+	service := AlertService{}
+	rule := &model.AlertRule{Name: "cpu", Enable: true, Metric: model.AlertMetricCpu, Operator: ">", Threshold: 80}
+	err := service.AddAlertRule(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	notices, err := service.Evaluate(&Status{Cpu: 90}, now)
+	if err != nil || len(notices) != 1 {
+		t.Fatalf("notices = %v, err = %v, want 1", len(notices), err)
+	}
+
+	// 规则禁用后仍在告警中的记录会被结束
+	err = database.GetDB().Model(rule).Update("enable", false).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	notices, err = service.Evaluate(&Status{Cpu: 90}, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notices) != 1 || !notices[0].Resolved {
+		t.Errorf("notices after disabling = %+v, want one resolved", notices)
+	}
+}
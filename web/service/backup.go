@@ -0,0 +1,114 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"x-ui/database"
+	"x-ui/logger"
+)
+
+const backupFilePrefix = "x-ui-"
+const backupFileSuffix = ".db"
+
+// scheduledBackupFilePrefix 定时备份使用单独的前缀，清理旧备份时不会删除手动生成的备份
+const scheduledBackupFilePrefix = "x-ui-auto-"
+
+type BackupService struct {
+	settingService SettingService
+	tgBotService   TgBotService
+}
+
+// GetBackupFileName 以当前时间生成备份文件名
+func GetBackupFileName(t time.Time) string {
+	return backupFilePrefix + t.Format("20060102-150405") + backupFileSuffix
+}
+
+func getScheduledBackupFileName(t time.Time) string {
+	return scheduledBackupFilePrefix + t.Format("20060102-150405") + backupFileSuffix
+}
+
+// CreateBackup 在备份目录中生成一份定时备份，返回备份文件路径
+func (s *BackupService) CreateBackup() (string, error) {
+	dir, err := s.settingService.GetBackupDir()
+	if err != nil {
+		return "", err
+	}
+	dest := filepath.Join(dir, getScheduledBackupFileName(time.Now()))
+	err = database.Backup(dest)
+	if err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// PruneBackups 只保留最新的 keep 份定时备份，至少保留刚生成的一份
+func (s *BackupService) PruneBackups(keep int) error {
+	if keep < 1 {
+		keep = 1
+	}
+	dir, err := s.settingService.GetBackupDir()
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, scheduledBackupFilePrefix) && strings.HasSuffix(name, backupFileSuffix) {
+			names = append(names, name)
+		}
+	}
+	if len(names) <= keep {
+		return nil
+	}
+	// 文件名中的时间可以直接按字符串排序
+	sort.Strings(names)
+	for _, name := range names[:len(names)-keep] {
+		err = os.Remove(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunScheduledBackup 生成备份、清理旧备份，设置了发送到电报时将备份发送给通知 chat
+func (s *BackupService) RunScheduledBackup() error {
+	path, err := s.CreateBackup()
+	if err != nil {
+		return err
+	}
+	logger.Info("database backup created:", path)
+	keep, err := s.settingService.GetBackupKeep()
+	if err != nil {
+		return err
+	}
+	err = s.PruneBackups(keep)
+	if err != nil {
+		logger.Warning("prune backups failed:", err)
+	}
+
+	toTelegram, err := s.settingService.GetBackupTelegram()
+	if err != nil || !toTelegram {
+		return err
+	}
+	chatId, err := s.settingService.GetTgBotChatId()
+	if err != nil {
+		return err
+	}
+	if chatId == 0 {
+		return fmt.Errorf("telegram chat id is not set")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return s.tgBotService.SendDocument(int64(chatId), filepath.Base(path), data)
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPruneBackups(t *testing.T) {
+	initTestDB(t)
+	service := BackupService{}
+	dir := t.TempDir()
+	err := service.settingService.setString("backupDir", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manual := GetBackupFileName(time.Now().Add(-time.Hour * 72))
+	names := []string{manual}
+	for i := 3; i > 0; i-- {
+		names = append(names, getScheduledBackupFileName(time.Now().Add(-time.Hour*time.Duration(i))))
+	}
+	for _, name := range names {
+		err = os.WriteFile(filepath.Join(dir, name), nil, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	latest := names[len(names)-1]
+
+	list := func() []string {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			result = append(result, entry.Name())
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	err = service.PruneBackups(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := list(); len(files) != 3 || files[0] != manual {
+		t.Errorf("files after keep 2 = %v, want the manual backup and 2 scheduled backups", files)
+	}
+
+	// 保留份数设置错误时仍保留最新的定时备份，不删除手动备份
+	for _, keep := range []int{0, -1} {
+		err = service.PruneBackups(keep)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if files := list(); len(files) != 2 || files[0] != manual || files[1] != latest {
+			t.Errorf("files after keep %v = %v, want %v and %v", keep, files, manual, latest)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"x-ui/config"
+	"x-ui/database"
+	"x-ui/util/sys"
+	"x-ui/xray"
+)
+
+// 检查结果状态
+const (
+	DoctorOk   = "ok"
+	DoctorWarn = "warn"
+	DoctorFail = "fail"
+)
+
+// 证书剩余有效期少于该天数时提示
+const doctorCertWarnDays = 30
+
+// DoctorCheck 单项检查的结果
+type DoctorCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+type DoctorService struct {
+	settingService SettingService
+	inboundService InboundService
+	xrayService    XrayService
+	tlsCertService TlsCertService
+}
+
+type doctorResult struct {
+	checks []*DoctorCheck
+}
+
+func (r *doctorResult) add(name string, status string, format string, a ...interface{}) {
+	r.checks = append(r.checks, &DoctorCheck{
+		Name:    name,
+		Status:  status,
+		Message: strings.TrimSpace(fmt.Sprintf(format, a...)),
+	})
+}
+
+// Run 依次检查数据库、xray 程序、配置、端口、证书和时区。
+// 数据库无法打开时跳过依赖数据库的检查。调用前需要加载加密密钥
+func (s *DoctorService) Run(dbPath string) []*DoctorCheck {
+	r := &doctorResult{}
+	dbOk := s.checkDatabase(r, dbPath)
+	binaryOk := s.checkBinary(r)
+	s.checkGeoFiles(r)
+	if !dbOk {
+		return r.checks
+	}
+	xrayConfig := s.checkTemplate(r)
+	if xrayConfig != nil && binaryOk {
+		s.checkXrayTest(r, xrayConfig)
+	}
+	s.checkPorts(r)
+	s.checkCert(r)
+	s.checkTlsCerts(r)
+	s.checkTimeLocation(r)
+	if xrayConfig != nil {
+		s.checkApiPort(r, xrayConfig)
+	}
+	return r.checks
+}
+
+func (s *DoctorService) checkDatabase(r *doctorResult, dbPath string) bool {
+	_, err := os.Stat(dbPath)
+	if err != nil {
+		r.add("database", DoctorFail, "数据库 %v 不存在: %v", dbPath, err)
+		return false
+	}
+	version, err := database.ValidateBackup(dbPath)
+	if err != nil {
+		r.add("database", DoctorFail, "%v", err)
+		return false
+	}
+	// 诊断不能修改数据库，不使用会迁移表结构的 InitDB
+	err = database.OpenReadOnly(dbPath)
+	if err == nil {
+		err = s.settingService.LoadPathSettings()
+	}
+	if err != nil {
+		r.add("database", DoctorFail, "打开数据库失败: %v", err)
+		return false
+	}
+	if version < database.SchemaVersion {
+		r.add("database", DoctorWarn, "数据库结构版本 %v 低于当前版本 %v，启动面板时会自动升级，部分检查可能失败", version, database.SchemaVersion)
+	} else {
+		r.add("database", DoctorOk, "%v，结构版本 %v", dbPath, version)
+	}
+	return true
+}
+
+func (s *DoctorService) checkBinary(r *doctorResult) bool {
+	path := xray.GetBinaryPath()
+	info, err := os.Stat(path)
+	if err != nil {
+		r.add("xray", DoctorFail, "找不到当前架构的 xray 程序 %v: %v", path, err)
+		return false
+	}
+	if info.Mode()&0111 == 0 {
+		r.add("xray", DoctorFail, "%v 没有执行权限", path)
+		return false
+	}
+	r.add("xray", DoctorOk, "%v", path)
+	return true
+}
+
+func (s *DoctorService) checkGeoFiles(r *doctorResult) {
+	for _, path := range []string{xray.GetGeoipPath(), xray.GetGeositePath()} {
+		info, err := os.Stat(path)
+		if err != nil {
+			r.add("geo", DoctorFail, "%v 不存在，使用 geoip/geosite 的路由规则将无法加载", path)
+		} else if info.Size() == 0 {
+			r.add("geo", DoctorFail, "%v 是空文件", path)
+		} else {
+			r.add("geo", DoctorOk, "%v", path)
+		}
+	}
+}
+
+func (s *DoctorService) checkTemplate(r *doctorResult) *xray.Config {
+	xrayConfig, err := s.xrayService.GetXrayConfig()
+	if err != nil {
+		r.add("template", DoctorFail, "xray 配置模板无效: %v", err)
+		return nil
+	}
+	r.add("template", DoctorOk, "xray 配置模板有效")
+	return xrayConfig
+}
+
+func (s *DoctorService) checkXrayTest(r *doctorResult, xrayConfig *xray.Config) {
+	output, err := xray.TestConfig(xrayConfig)
+	if err != nil {
+		r.add("xray-test", DoctorFail, "xray -test 未通过: %v\n%v", err, output)
+		return
+	}
+	r.add("xray-test", DoctorOk, "生成的 xray 配置通过 xray -test")
+}
+
+// checkPorts 检查启用的入站端口空闲或被 xray 占用
+func (s *DoctorService) checkPorts(r *doctorResult) {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		r.add("ports", DoctorFail, "获取入站失败: %v", err)
+		return
+	}
+	busy := 0
+	for _, inbound := range inbounds {
+		if !inbound.Enable {
+			continue
+		}
+		owner, err := sys.GetListenPortOwner(inbound.Port)
+		if err != nil {
+			r.add("ports", DoctorWarn, "无法检查端口占用: %v", err)
+			return
+		}
+		if owner != "" && !strings.HasPrefix(owner, "xray") {
+			busy++
+			r.add("ports", DoctorFail, "入站 %v 的端口 %v 被 %v 占用", inbound.Remark, inbound.Port, owner)
+		}
+	}
+	if busy == 0 {
+		r.add("ports", DoctorOk, "入站端口空闲或由 xray 监听")
+	}
+}
+
+func (s *DoctorService) checkCert(r *doctorResult) {
+	acmeEnable, err := s.settingService.GetAcmeEnable()
+	if err != nil {
+		r.add("cert", DoctorFail, "%v", err)
+		return
+	}
+	if acmeEnable {
+		s.checkAcmeCert(r)
+		return
+	}
+	certFile, err := s.settingService.GetCertFile()
+	if err != nil {
+		r.add("cert", DoctorFail, "%v", err)
+		return
+	}
+	keyFile, err := s.settingService.GetKeyFile()
+	if err != nil {
+		r.add("cert", DoctorFail, "%v", err)
+		return
+	}
+	if certFile == "" && keyFile == "" {
+		r.add("cert", DoctorWarn, "面板未配置证书，使用 http 访问")
+		return
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		r.add("cert", DoctorFail, "加载面板证书失败: %v", err)
+		return
+	}
+	s.checkCertExpiry(r, "面板证书", &cert)
+}
+
+func (s *DoctorService) checkCertExpiry(r *doctorResult, name string, cert *tls.Certificate) {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		r.add("cert", DoctorFail, "解析%v失败: %v", name, err)
+		return
+	}
+	days := int(time.Until(leaf.NotAfter).Hours() / 24)
+	expiry := leaf.NotAfter.Format("2006-01-02 15:04:05")
+	switch {
+	case days < 0:
+		r.add("cert", DoctorFail, "%v已于 %v 过期", name, expiry)
+	case days < doctorCertWarnDays:
+		r.add("cert", DoctorWarn, "%v将于 %v 过期，剩余 %v 天", name, expiry, days)
+	default:
+		r.add("cert", DoctorOk, "%v有效期至 %v", name, expiry)
+	}
+}
+
+// checkAcmeCert 检查 ACME 缓存的证书，证书由面板自动续期，过期说明续期一直失败
+func (s *DoctorService) checkAcmeCert(r *doctorResult) {
+	domains, err := s.settingService.GetAcmeDomains()
+	if err != nil {
+		r.add("cert", DoctorFail, "%v", err)
+		return
+	}
+	for _, domain := range domains {
+		// autocert 缓存文件中依次保存私钥和证书链
+		data, err := os.ReadFile(filepath.Join(config.GetAcmeCacheDir(), domain))
+		if err != nil {
+			r.add("cert", DoctorWarn, "%v 还没有 ACME 证书，面板启动后会自动签发: %v", domain, err)
+			continue
+		}
+		cert, err := tls.X509KeyPair(data, data)
+		if err != nil {
+			r.add("cert", DoctorFail, "%v 的 ACME 证书无效: %v", domain, err)
+			continue
+		}
+		s.checkCertExpiry(r, domain+" 的 ACME 证书", &cert)
+	}
+}
+
+// checkTlsCerts 检查证书库中的证书，自签和 ACME 证书由面板自动续期
+func (s *DoctorService) checkTlsCerts(r *doctorResult) {
+	certs, err := s.tlsCertService.GetTlsCerts()
+	if err != nil {
+		r.add("cert", DoctorFail, "%v", err)
+		return
+	}
+	for _, tlsCert := range certs {
+		name := fmt.Sprintf("证书库证书 %v ", tlsCert.Name)
+		if tlsCert.LastError != "" {
+			r.add("cert", DoctorWarn, "%v续期失败: %v", name, tlsCert.LastError)
+		}
+		cert, err := tls.X509KeyPair([]byte(tlsCert.Cert), []byte(tlsCert.Key))
+		if err != nil {
+			r.add("cert", DoctorFail, "%v无效: %v", name, err)
+			continue
+		}
+		s.checkCertExpiry(r, name, &cert)
+	}
+}
+
+func (s *DoctorService) checkTimeLocation(r *doctorResult) {
+	name, err := s.settingService.getString("timeLocation")
+	if err != nil {
+		r.add("timeLocation", DoctorFail, "%v", err)
+		return
+	}
+	_, err = time.LoadLocation(name)
+	if err != nil {
+		r.add("timeLocation", DoctorFail, "时区 %v 无效，将使用默认时区 %v: %v", name, settingDefMap["timeLocation"].Default, err)
+		return
+	}
+	r.add("timeLocation", DoctorOk, "%v", name)
+}
+
+// checkApiPort 检查 xray api 入站可以连接，xray 没有运行时只提示
+func (s *DoctorService) checkApiPort(r *doctorResult, xrayConfig *xray.Config) {
+	port := 0
+	for _, inbound := range xrayConfig.InboundConfigs {
+		if inbound.Tag == "api" {
+			port = inbound.Port
+		}
+	}
+	if port == 0 {
+		r.add("api", DoctorFail, "xray 配置模板中没有 tag 为 api 的入站，无法统计流量")
+		return
+	}
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%v", port), 3*time.Second)
+	if err != nil {
+		r.add("api", DoctorWarn, "无法连接 api 端口 %v，xray 可能没有运行: %v", port, err)
+		return
+	}
+	conn.Close()
+	r.add("api", DoctorOk, "api 端口 %v 可以连接", port)
+}
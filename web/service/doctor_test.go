@@ -0,0 +1,42 @@
+package service
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"x-ui/config"
+	"x-ui/database"
+)
+
+func TestDoctorDatabaseReadOnly(t *testing.T) {
+	initTestDB(t)
+	// 模拟旧版本的数据库
+	err := database.GetDB().Exec("PRAGMA user_version = 0").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbPath := config.GetDBPath()
+	before, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &doctorResult{}
+	ok := (&DoctorService{}).checkDatabase(r, dbPath)
+	if !ok || len(r.checks) != 1 || r.checks[0].Status != DoctorWarn {
+		t.Fatalf("checks = %+v, want a warning for the old schema version", r.checks)
+	}
+
+	after, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("doctor modified the database")
+	}
+	// 只读连接不能写入
+	err = database.GetDB().Exec("PRAGMA user_version = 1").Error
+	if err == nil {
+		t.Error("doctor database connection is writable")
+	}
+}
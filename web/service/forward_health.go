@@ -0,0 +1,235 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/proxy"
+	"x-ui/xray"
+)
+
+const (
+	ForwardUnknown = "unknown"
+	ForwardUp      = "up"
+	ForwardDown    = "down"
+)
+
+// ForwardHealth 二次转发上游的探测结果
+type ForwardHealth struct {
+	Key       string `json:"key"`
+	Remark    string `json:"remark"`
+	Protocol  string `json:"protocol"`
+	Address   string `json:"address"`
+	Port      int    `json:"port"`
+	Status    string `json:"status"`
+	Latency   int64  `json:"latency"`
+	Error     string `json:"error"`
+	CheckTime int64  `json:"checkTime"`
+}
+
+var forwardHealthMap = map[string]*ForwardHealth{}
+var forwardHealthLock sync.RWMutex
+
+// ForwardProbeTimeout 单个上游的探测超时时间
+var ForwardProbeTimeout = time.Second * 5
+
+// ForwardTestResult 通过上游完成一次真实的代理握手并请求测试地址的结果，耗时单位为毫秒
+type ForwardTestResult struct {
+	Success          bool   `json:"success"`
+	Target           string `json:"target"`
+	ConnectLatency   int64  `json:"connectLatency"`
+	HandshakeLatency int64  `json:"handshakeLatency"`
+	Auth             string `json:"auth"`
+	ExitIP           string `json:"exitIp"`
+	Error            string `json:"error"`
+}
+
+type ForwardHealthService struct {
+	inboundService     InboundService
+	forwardPoolService ForwardPoolService
+	settingService     SettingService
+}
+
+func getInboundForwardKey(inboundId int) string {
+	return fmt.Sprintf("inbound-%d", inboundId)
+}
+
+func getPoolMemberForwardKey(memberId int) string {
+	return fmt.Sprintf("member-%d", memberId)
+}
+
+// ProbeUpstream 建立到上游的 TCP 连接并记录耗时
+func ProbeUpstream(address string, port int) (time.Duration, error) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(address, strconv.Itoa(port)), ForwardProbeTimeout)
+	if err != nil {
+		return 0, err
+	}
+	latency := time.Since(start)
+	conn.Close()
+	return latency, nil
+}
+
+func (s *ForwardHealthService) getTargets() ([]*ForwardHealth, error) {
+	targets := make([]*ForwardHealth, 0)
+	inbounds, err := s.inboundService.GetInboundsWithSecondaryForward()
+	if err != nil {
+		return nil, err
+	}
+	for _, inbound := range inbounds {
+		if inbound.SecondaryForwardProtocol == model.SecondaryForwardPool {
+			continue
+		}
+		targets = append(targets, &ForwardHealth{
+			Key:      getInboundForwardKey(inbound.Id),
+			Remark:   inbound.Remark,
+			Protocol: inbound.SecondaryForwardProtocol,
+			Address:  inbound.SecondaryForwardAddress,
+			Port:     inbound.SecondaryForwardPort,
+		})
+	}
+	pools, err := s.forwardPoolService.GetForwardPools()
+	if err != nil {
+		return nil, err
+	}
+	for _, pool := range pools {
+		for _, member := range pool.Members {
+			targets = append(targets, &ForwardHealth{
+				Key:      getPoolMemberForwardKey(member.Id),
+				Remark:   member.Remark,
+				Protocol: member.Protocol,
+				Address:  member.Address,
+				Port:     member.Port,
+			})
+		}
+	}
+	return targets, nil
+}
+
+// CheckAll 并发探测所有上游，并替换保存的探测结果
+func (s *ForwardHealthService) CheckAll() error {
+	targets, err := s.getTargets()
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target *ForwardHealth) {
+			defer wg.Done()
+			latency, err := ProbeUpstream(target.Address, target.Port)
+			target.CheckTime = time.Now().Unix() * 1000
+			if err != nil {
+				target.Status = ForwardDown
+				target.Error = err.Error()
+			} else {
+				target.Status = ForwardUp
+				target.Latency = latency.Milliseconds()
+			}
+		}(target)
+	}
+	wg.Wait()
+
+	healthMap := make(map[string]*ForwardHealth, len(targets))
+	for _, target := range targets {
+		healthMap[target.Key] = target
+	}
+	forwardHealthLock.Lock()
+	forwardHealthMap = healthMap
+	forwardHealthLock.Unlock()
+	return nil
+}
+
+func (s *ForwardHealthService) getHealth(key string, remark string, protocol string, address string, port int) *ForwardHealth {
+	forwardHealthLock.RLock()
+	health, ok := forwardHealthMap[key]
+	forwardHealthLock.RUnlock()
+	if ok && health.Address == address && health.Port == port {
+		h := *health
+		h.Remark = remark
+		return &h
+	}
+	return &ForwardHealth{
+		Key:      key,
+		Remark:   remark,
+		Protocol: protocol,
+		Address:  address,
+		Port:     port,
+		Status:   ForwardUnknown,
+	}
+}
+
+// GetInboundForwardHealth 返回入站的每个上游的最近一次探测结果
+func (s *ForwardHealthService) GetInboundForwardHealth(inboundId int) ([]*ForwardHealth, error) {
+	inbound, err := s.inboundService.GetInbound(inboundId)
+	if err != nil {
+		return nil, err
+	}
+	healths := make([]*ForwardHealth, 0)
+	if !inbound.SecondaryForwardEnable {
+		return healths, nil
+	}
+	if inbound.SecondaryForwardProtocol != model.SecondaryForwardPool {
+		healths = append(healths, s.getHealth(getInboundForwardKey(inbound.Id), inbound.Remark,
+			inbound.SecondaryForwardProtocol, inbound.SecondaryForwardAddress, inbound.SecondaryForwardPort))
+		return healths, nil
+	}
+	pool, err := s.forwardPoolService.GetForwardPool(inbound.SecondaryForwardPoolId)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range pool.Members {
+		healths = append(healths, s.getHealth(getPoolMemberForwardKey(member.Id), member.Remark,
+			member.Protocol, member.Address, member.Port))
+	}
+	return healths, nil
+}
+
+// TestForward 使用给定的认证信息与上游进行 socks5 或 http CONNECT 握手，
+// 并经由上游请求测试地址获取出口 IP，target 为空时使用面板设置中的测试地址。
+// https 上游使用扩展参数中的 serverName 和 allowInsecure 进行 TLS 握手
+func (s *ForwardHealthService) TestForward(protocol string, address string, port int, username string, password string, settings string, target string) (*ForwardTestResult, error) {
+	switch protocol {
+	case model.SecondaryForwardSOCKS, model.SecondaryForwardHTTP, model.SecondaryForwardHTTPS:
+	default:
+		return nil, common.NewError("仅支持测试 socks、http、https 上游:", protocol)
+	}
+	if address == "" {
+		return nil, common.NewError("上游地址不能为空")
+	}
+	if port <= 0 || port > 65535 {
+		return nil, common.NewError("上游端口无效:", port)
+	}
+	upstream, err := xray.NewForwardUpstream(protocol, address, port, username, password, settings)
+	if err != nil {
+		return nil, err
+	}
+	if target == "" {
+		target, err = s.settingService.GetForwardProbeTarget()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := &ForwardTestResult{Target: target}
+	probeResult, err := proxy.Probe(protocol, address, port, username, password, &proxy.TLSOptions{
+		ServerName:    upstream.ServerName,
+		AllowInsecure: upstream.AllowInsecure,
+	}, target, ForwardProbeTimeout)
+	if probeResult != nil {
+		result.ConnectLatency = probeResult.ConnectLatency
+		result.HandshakeLatency = probeResult.HandshakeLatency
+		result.Auth = probeResult.Auth
+		result.ExitIP = probeResult.ExitIP
+	}
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Success = true
+	}
+	return result, nil
+}
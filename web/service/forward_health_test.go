@@ -0,0 +1,55 @@
+package service
+
+import (
+	"net"
+	"testing"
+)
+
+func TestForwardHealthCheckAll(t *testing.T) {
+	initTestDB(t)
+	up, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer up.Close()
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down.Close()
+
+	pool := newTestPool("pool", up.Addr().(*net.TCPAddr).Port, down.Addr().(*net.TCPAddr).Port)
+	err = (&ForwardPoolService{}).AddForwardPool(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := ForwardHealthService{}
+	upMember, downMember := pool.Members[0], pool.Members[1]
+	health := service.getHealth(getPoolMemberForwardKey(upMember.Id), upMember.Remark, upMember.Protocol, upMember.Address, upMember.Port)
+	if health.Status != ForwardUnknown {
+		t.Errorf("status before check = %v, want %v", health.Status, ForwardUnknown)
+	}
+
+	err = service.CheckAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	health = service.getHealth(getPoolMemberForwardKey(upMember.Id), upMember.Remark, upMember.Protocol, upMember.Address, upMember.Port)
+	if health.Status != ForwardUp || health.Error != "" || health.CheckTime == 0 {
+		t.Errorf("listening member = %+v, want up", health)
+	}
+	if health.Latency < 0 || health.Latency > ForwardProbeTimeout.Milliseconds() {
+		t.Errorf("latency = %vms, want between 0 and %vms", health.Latency, ForwardProbeTimeout.Milliseconds())
+	}
+	health = service.getHealth(getPoolMemberForwardKey(downMember.Id), downMember.Remark, downMember.Protocol, downMember.Address, downMember.Port)
+	if health.Status != ForwardDown || health.Error == "" {
+		t.Errorf("closed member = %+v, want down with error", health)
+	}
+
+	// 上游地址修改后旧的探测结果不再适用
+	health = service.getHealth(getPoolMemberForwardKey(upMember.Id), upMember.Remark, upMember.Protocol, upMember.Address, upMember.Port+1)
+	if health.Status != ForwardUnknown {
+		t.Errorf("status after address change = %v, want %v", health.Status, ForwardUnknown)
+	}
+}
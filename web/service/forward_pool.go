@@ -0,0 +1,217 @@
+package service
+
+import (
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+)
+
+type ForwardPoolService struct {
+}
+
+func (s *ForwardPoolService) fillMembers(db *gorm.DB, pools []*model.ForwardPool) error {
+	for _, pool := range pools {
+		members := make([]model.ForwardPoolMember, 0)
+		err := db.Model(model.ForwardPoolMember{}).Where("pool_id = ?", pool.Id).Order("id asc").Find(&members).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		}
+		pool.Members = members
+	}
+	return nil
+}
+
+func (s *ForwardPoolService) GetForwardPools() ([]*model.ForwardPool, error) {
+	db := database.GetDB()
+	var pools []*model.ForwardPool
+	err := db.Model(model.ForwardPool{}).Order("id asc").Find(&pools).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	err = s.fillMembers(db, pools)
+	if err != nil {
+		return nil, err
+	}
+	return pools, nil
+}
+
+func (s *ForwardPoolService) GetForwardPool(id int) (*model.ForwardPool, error) {
+	db := database.GetDB()
+	pool := &model.ForwardPool{}
+	err := db.Model(model.ForwardPool{}).First(pool, id).Error
+	if err != nil {
+		return nil, err
+	}
+	err = s.fillMembers(db, []*model.ForwardPool{pool})
+	if err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+func (s *ForwardPoolService) checkForwardPool(pool *model.ForwardPool) error {
+	if pool.Name == "" {
+		return common.NewError("上游池名称不能为空")
+	}
+	switch pool.Strategy {
+	case "":
+		pool.Strategy = model.BalancerRandom
+	case model.BalancerRandom, model.BalancerLeastPing:
+	default:
+		return common.NewError("不支持的负载均衡策略:", pool.Strategy)
+	}
+	if len(pool.Members) == 0 {
+		return common.NewError("上游池至少需要一个上游")
+	}
+	for i := range pool.Members {
+		member := &pool.Members[i]
+		if member.Link != "" {
+			upstream, err := xray.ParseShareLink(member.Link)
+			if err != nil {
+				return err
+			}
+			member.Protocol = upstream.Protocol
+			member.Address = upstream.Address
+			member.Port = upstream.Port
+			member.Username = upstream.Username
+			member.Password = upstream.Password
+			member.Settings = upstream.SettingsJSON()
+			member.Link = ""
+		}
+		upstream, err := xray.GetPoolMemberUpstream(member)
+		if err != nil {
+			return err
+		}
+		err = upstream.Validate()
+		if err != nil {
+			return err
+		}
+		member.Settings = upstream.SettingsJSON()
+	}
+	return nil
+}
+
+func (s *ForwardPoolService) saveMembers(tx *gorm.DB, pool *model.ForwardPool) error {
+	keepIds := make([]int, 0, len(pool.Members))
+	for i := range pool.Members {
+		member := &pool.Members[i]
+		// 成员 id 由前端提交，只能更新属于本上游池的成员
+		if member.Id > 0 {
+			var count int64
+			err := tx.Model(model.ForwardPoolMember{}).Where("id = ? and pool_id = ?", member.Id, pool.Id).Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count == 0 {
+				return common.NewError("上游不属于该上游池:", member.Id)
+			}
+		}
+		member.PoolId = pool.Id
+		err := tx.Save(member).Error
+		if err != nil {
+			return err
+		}
+		keepIds = append(keepIds, member.Id)
+	}
+	return tx.Where("pool_id = ? and id not in ?", pool.Id, keepIds).Delete(model.ForwardPoolMember{}).Error
+}
+
+func (s *ForwardPoolService) AddForwardPool(pool *model.ForwardPool) (err error) {
+	err = s.checkForwardPool(pool)
+	if err != nil {
+		return err
+	}
+	pool.Id = 0
+	for i := range pool.Members {
+		pool.Members[i].Id = 0
+	}
+
+	db := database.GetDB()
+	tx := db.Begin()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			tx.Commit()
+		}
+	}()
+	err = tx.Save(pool).Error
+	if err != nil {
+		return
+	}
+	err = s.saveMembers(tx, pool)
+	return
+}
+
+func (s *ForwardPoolService) UpdateForwardPool(pool *model.ForwardPool) (err error) {
+	oldPool, err := s.GetForwardPool(pool.Id)
+	if err != nil {
+		return err
+	}
+	// 前端提交掩码表示未修改密码
+	for i := range pool.Members {
+		member := &pool.Members[i]
+		if member.Password != model.SecretMask {
+			continue
+		}
+		member.Password = ""
+		for _, oldMember := range oldPool.Members {
+			if oldMember.Id == member.Id {
+				member.Password = oldMember.Password
+				break
+			}
+		}
+	}
+	err = s.checkForwardPool(pool)
+	if err != nil {
+		return err
+	}
+
+	db := database.GetDB()
+	tx := db.Begin()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			tx.Commit()
+		}
+	}()
+	err = tx.Save(pool).Error
+	if err != nil {
+		return
+	}
+	err = s.saveMembers(tx, pool)
+	return
+}
+
+func (s *ForwardPoolService) DelForwardPool(id int) (err error) {
+	db := database.GetDB()
+	var count int64
+	err = db.Model(model.Inbound{}).
+		Where("secondary_forward_protocol = ? and secondary_forward_pool_id = ?", model.SecondaryForwardPool, id).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return common.NewError("上游池正在被入站使用:", count)
+	}
+
+	tx := db.Begin()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			tx.Commit()
+		}
+	}()
+	err = tx.Where("pool_id = ?", id).Delete(model.ForwardPoolMember{}).Error
+	if err != nil {
+		return
+	}
+	err = tx.Delete(model.ForwardPool{}, id).Error
+	return
+}
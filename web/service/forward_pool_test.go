@@ -0,0 +1,74 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+	"x-ui/config"
+	"x-ui/database"
+	"x-ui/database/model"
+)
+
+// initTestDB 在临时目录中初始化数据库，主密钥文件也保存在同一目录
+func initTestDB(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "x-ui.db")
+	config.SetPathFlag(config.PathDB, dbPath)
+	t.Cleanup(func() { config.SetPathFlag(config.PathDB, "") })
+	err := database.InitDB(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestPool(name string, ports ...int) *model.ForwardPool {
+	pool := &model.ForwardPool{Name: name}
+	for _, port := range ports {
+		pool.Members = append(pool.Members, model.ForwardPoolMember{
+			Protocol: model.SecondaryForwardSOCKS,
+			Address:  "127.0.0.1",
+			Port:     port,
+		})
+	}
+	return pool
+}
+
+func TestUpdateForwardPoolRejectsForeignMember(t *testing.T) {
+	initTestDB(t)
+	service := ForwardPoolService{}
+	poolA := newTestPool("a", 1080)
+	poolB := newTestPool("b", 1081)
+	for _, pool := range []*model.ForwardPool{poolA, poolB} {
+		err := service.AddForwardPool(pool)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 提交 b 的成员 id 更新 a，不能把 b 的成员移动到 a
+	update := newTestPool("a", 2080)
+	update.Id = poolA.Id
+	update.Members[0].Id = poolB.Members[0].Id
+	err := service.UpdateForwardPool(update)
+	if err == nil {
+		t.Fatal("update pool with a member of another pool should fail")
+	}
+	pool, err := service.GetForwardPool(poolB.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pool.Members) != 1 || pool.Members[0].Port != 1081 {
+		t.Errorf("members of pool b changed: %+v", pool.Members)
+	}
+
+	update.Members[0].Id = poolA.Members[0].Id
+	err = service.UpdateForwardPool(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err = service.GetForwardPool(poolA.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pool.Members) != 1 || pool.Members[0].Id != poolA.Members[0].Id || pool.Members[0].Port != 2080 {
+		t.Errorf("members of pool a = %+v, want member %v on port 2080", pool.Members, poolA.Members[0].Id)
+	}
+}
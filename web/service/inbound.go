@@ -12,6 +12,8 @@ import (
 )
 
 type InboundService struct {
+	forwardPoolService ForwardPoolService
+	tlsCertService     TlsCertService
 }
 
 func (s *InboundService) GetInbounds(userId int) ([]*model.Inbound, error) {
@@ -48,77 +50,106 @@ func (s *InboundService) checkPortExist(port int, ignoreId int) (bool, error) {
 	return count > 0, nil
 }
 
-func (s *InboundService) AddInbound(inbound *model.Inbound) error {
+// checkInbound 恢复掩码、校验入站配置，并设置二次转发默认值和 tag。
+// oldSettings 为修改前的 settings，新增的入站没有原值，不能提交掩码
+func (s *InboundService) checkInbound(inbound *model.Inbound, ignoreId int, oldSettings string) error {
+	settings, err := model.RestoreInboundSettings(inbound.Protocol, inbound.Settings, oldSettings)
+	if err != nil {
+		return err
+	}
+	inbound.Settings = settings
+
 	// 验证端口是否存在
-	exist, err := s.checkPortExist(inbound.Port, 0)
+	exist, err := s.checkPortExist(inbound.Port, ignoreId)
 	if err != nil {
 		return err
 	}
 	if exist {
 		return common.NewError("端口已存在:", inbound.Port)
 	}
-	
+
+	if err := ValidateInboundConfig(inbound); err != nil {
+		return err
+	}
+
 	// 验证二次转发配置
 	if err := s.validateSecondaryForward(inbound); err != nil {
 		return err
 	}
-	
+	if err := s.tlsCertService.CheckStreamCerts(inbound.StreamSettings); err != nil {
+		return err
+	}
+
 	// 设置二次转发默认值
 	s.setSecondaryForwardDefaults(inbound)
-	
+
 	// 设置tag
 	inbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
-	
+	return nil
+}
+
+func (s *InboundService) AddInbound(inbound *model.Inbound) error {
+	err := s.checkInbound(inbound, 0, "")
+	if err != nil {
+		return err
+	}
 	db := database.GetDB()
 	return db.Save(inbound).Error
 }
 
-func (s *InboundService) AddInbounds(inbounds []*model.Inbound) error {
+// prepareInbounds 校验批量新增的入站，全部通过后才能保存
+func (s *InboundService) prepareInbounds(inbounds []*model.Inbound) error {
 	for _, inbound := range inbounds {
-		exist, err := s.checkPortExist(inbound.Port, 0)
+		err := s.checkInbound(inbound, 0, "")
 		if err != nil {
 			return err
 		}
-		if exist {
-			return common.NewError("端口已存在:", inbound.Port)
-		}
-		
-		// 验证二次转发配置
-		if err := s.validateSecondaryForward(inbound); err != nil {
+	}
+	return nil
+}
+
+func (s *InboundService) saveInbounds(tx *gorm.DB, inbounds []*model.Inbound) error {
+	for _, inbound := range inbounds {
+		err := tx.Save(inbound).Error
+		if err != nil {
 			return err
 		}
-		
-		// 设置二次转发默认值
-		s.setSecondaryForwardDefaults(inbound)
-		
-		// 设置tag
-		inbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
 	}
+	return nil
+}
 
+func (s *InboundService) AddInbounds(inbounds []*model.Inbound) error {
+	err := s.prepareInbounds(inbounds)
+	if err != nil {
+		return err
+	}
 	db := database.GetDB()
-	tx := db.Begin()
-	var err error
-	defer func() {
-		if err == nil {
-			tx.Commit()
-		} else {
-			tx.Rollback()
-		}
-	}()
+	return db.Transaction(func(tx *gorm.DB) error {
+		return s.saveInbounds(tx, inbounds)
+	})
+}
 
-	for _, inbound := range inbounds {
-		err = tx.Save(inbound).Error
+func (s *InboundService) DelInbound(id int) error {
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("inbound_id = ?", id).Delete(model.TgBinding{}).Error
 		if err != nil {
 			return err
 		}
-	}
+		return tx.Delete(model.Inbound{}, id).Error
+	})
+}
 
-	return nil
+// SetInboundEnable 只修改入站的启用状态
+func (s *InboundService) SetInboundEnable(id int, enable bool) error {
+	db := database.GetDB()
+	return db.Model(&model.Inbound{}).Where("id = ?", id).Update("enable", enable).Error
 }
 
-func (s *InboundService) DelInbound(id int) error {
+// ResetInboundTraffic 清零入站的上下行流量
+func (s *InboundService) ResetInboundTraffic(id int) error {
 	db := database.GetDB()
-	return db.Delete(model.Inbound{}, id).Error
+	return db.Model(&model.Inbound{}).Where("id = ?", id).Updates(map[string]interface{}{"up": 0, "down": 0}).Error
 }
 
 func (s *InboundService) GetInbound(id int) (*model.Inbound, error) {
@@ -131,28 +162,21 @@ func (s *InboundService) GetInbound(id int) (*model.Inbound, error) {
 	return inbound, nil
 }
 
-func (s *InboundService) UpdateInbound(inbound *model.Inbound) error {
-	// 验证端口是否存在
-	exist, err := s.checkPortExist(inbound.Port, inbound.Id)
+// prepareUpdateInbound 校验修改后的入站，返回合并了修改的原入站，前端提交的掩码恢复为原值
+func (s *InboundService) prepareUpdateInbound(inbound *model.Inbound) (*model.Inbound, error) {
+	oldInbound, err := s.GetInbound(inbound.Id)
 	if err != nil {
-		return err
-	}
-	if exist {
-		return common.NewError("端口已存在:", inbound.Port)
+		return nil, err
 	}
-
-	// 验证二次转发配置
-	if err := s.validateSecondaryForward(inbound); err != nil {
-		return err
+	// 前端提交掩码表示未修改密码
+	if inbound.SecondaryForwardPassword == model.SecretMask {
+		inbound.SecondaryForwardPassword = oldInbound.SecondaryForwardPassword
 	}
-	
-	// 设置二次转发默认值
-	s.setSecondaryForwardDefaults(inbound)
-
-	oldInbound, err := s.GetInbound(inbound.Id)
+	err = s.checkInbound(inbound, inbound.Id, oldInbound.Settings)
 	if err != nil {
-		return err
+		return nil, err
 	}
+
 	oldInbound.Up = inbound.Up
 	oldInbound.Down = inbound.Down
 	oldInbound.Total = inbound.Total
@@ -173,11 +197,20 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) error {
 	oldInbound.SecondaryForwardPort = inbound.SecondaryForwardPort
 	oldInbound.SecondaryForwardUsername = inbound.SecondaryForwardUsername
 	oldInbound.SecondaryForwardPassword = inbound.SecondaryForwardPassword
+	oldInbound.SecondaryForwardSettings = inbound.SecondaryForwardSettings
+	oldInbound.SecondaryForwardPoolId = inbound.SecondaryForwardPoolId
 	
-	oldInbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
+	oldInbound.Tag = inbound.Tag
+	return oldInbound, nil
+}
 
+func (s *InboundService) UpdateInbound(inbound *model.Inbound) error {
+	updated, err := s.prepareUpdateInbound(inbound)
+	if err != nil {
+		return err
+	}
 	db := database.GetDB()
-	return db.Save(oldInbound).Error
+	return db.Save(updated).Error
 }
 
 func (s *InboundService) AddTraffic(traffics []*xray.Traffic) (err error) {
@@ -211,7 +244,8 @@ func (s *InboundService) AddTraffic(traffics []*xray.Traffic) (err error) {
 func (s *InboundService) DisableInvalidInbounds() (int64, error) {
 	db := database.GetDB()
 	now := time.Now().Unix() * 1000
-	result := db.Model(model.Inbound{}).
+	// Inbound 带有加解密钩子，gorm 调用钩子需要可寻址的模型
+	result := db.Model(&model.Inbound{}).
 		Where("((total > 0 and up + down >= total) or (expiry_time > 0 and expiry_time <= ?)) and enable = ?", now, true).
 		Update("enable", false)
 	err := result.Error
@@ -219,34 +253,56 @@ func (s *InboundService) DisableInvalidInbounds() (int64, error) {
 	return count, err
 }
 
+// applySecondaryForwardLink 解析提交的上游分享链接，填充二次转发字段
+func (s *InboundService) applySecondaryForwardLink(inbound *model.Inbound) error {
+	if !inbound.SecondaryForwardEnable || inbound.SecondaryForwardLink == "" {
+		return nil
+	}
+	upstream, err := xray.ParseShareLink(inbound.SecondaryForwardLink)
+	if err != nil {
+		return err
+	}
+	inbound.SecondaryForwardProtocol = upstream.Protocol
+	inbound.SecondaryForwardAddress = upstream.Address
+	inbound.SecondaryForwardPort = upstream.Port
+	inbound.SecondaryForwardUsername = upstream.Username
+	inbound.SecondaryForwardPassword = upstream.Password
+	inbound.SecondaryForwardSettings = upstream.SettingsJSON()
+	inbound.SecondaryForwardLink = ""
+	return nil
+}
+
 // validateSecondaryForward 验证二次转发配置
 func (s *InboundService) validateSecondaryForward(inbound *model.Inbound) error {
 	if !inbound.SecondaryForwardEnable {
 		return nil
 	}
 	
-	if inbound.SecondaryForwardProtocol == model.SecondaryForwardNone {
-		return common.NewError("启用二次转发时必须选择协议类型")
+	if err := s.applySecondaryForwardLink(inbound); err != nil {
+		return err
 	}
 	
-	if inbound.SecondaryForwardAddress == "" {
-		return common.NewError("二次转发服务器地址不能为空")
+	if inbound.SecondaryForwardProtocol == model.SecondaryForwardNone || inbound.SecondaryForwardProtocol == "" {
+		return common.NewError("启用二次转发时必须选择协议类型")
 	}
 	
-	if inbound.SecondaryForwardPort <= 0 || inbound.SecondaryForwardPort > 65535 {
-		return common.NewError("二次转发端口必须在1-65535之间")
+	if inbound.SecondaryForwardProtocol == model.SecondaryForwardPool {
+		_, err := s.forwardPoolService.GetForwardPool(inbound.SecondaryForwardPoolId)
+		if database.IsNotFound(err) {
+			return common.NewError("上游池不存在:", inbound.SecondaryForwardPoolId)
+		}
+		return err
 	}
 	
-	// 如果选择了SOCKS或HTTP协议，确保地址和端口有效
-	if inbound.SecondaryForwardProtocol == model.SecondaryForwardSOCKS || 
-		inbound.SecondaryForwardProtocol == model.SecondaryForwardHTTP {
-		if inbound.SecondaryForwardAddress == "" {
-			return common.NewError("%s服务器地址不能为空", inbound.SecondaryForwardProtocol)
-		}
-		if inbound.SecondaryForwardPort == 0 {
-			return common.NewError("%s服务器端口不能为0", inbound.SecondaryForwardProtocol)
-		}
+	upstream, err := xray.GetForwardUpstream(inbound.GenXrayInboundConfig())
+	if err != nil {
+		return err
 	}
+	if err := upstream.Validate(); err != nil {
+		return err
+	}
+	// 规范化扩展参数，去掉与协议无关的空字段
+	inbound.SecondaryForwardSettings = upstream.SettingsJSON()
 	
 	return nil
 }
@@ -260,6 +316,8 @@ func (s *InboundService) setSecondaryForwardDefaults(inbound *model.Inbound) {
 		inbound.SecondaryForwardPort = 0
 		inbound.SecondaryForwardUsername = ""
 		inbound.SecondaryForwardPassword = ""
+		inbound.SecondaryForwardSettings = ""
+		inbound.SecondaryForwardPoolId = 0
 	} else if inbound.SecondaryForwardProtocol == model.SecondaryForwardNone {
 		// 如果协议为none，也视为未启用
 		inbound.SecondaryForwardEnable = false
@@ -267,6 +325,17 @@ func (s *InboundService) setSecondaryForwardDefaults(inbound *model.Inbound) {
 		inbound.SecondaryForwardPort = 0
 		inbound.SecondaryForwardUsername = ""
 		inbound.SecondaryForwardPassword = ""
+		inbound.SecondaryForwardSettings = ""
+		inbound.SecondaryForwardPoolId = 0
+	} else if inbound.SecondaryForwardProtocol == model.SecondaryForwardPool {
+		// 上游池模式下上游信息由池成员提供
+		inbound.SecondaryForwardAddress = ""
+		inbound.SecondaryForwardPort = 0
+		inbound.SecondaryForwardUsername = ""
+		inbound.SecondaryForwardPassword = ""
+		inbound.SecondaryForwardSettings = ""
+	} else {
+		inbound.SecondaryForwardPoolId = 0
 	}
 }
 
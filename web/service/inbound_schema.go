@@ -0,0 +1,617 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"x-ui/database/model"
+	"x-ui/web/entity"
+	"x-ui/xray"
+)
+
+// schemaObject 校验中的 JSON 对象，path 为其在入站中的字段路径，错误统一记录到 err
+type schemaObject struct {
+	path   string
+	values map[string]interface{}
+	err    *entity.ValidationError
+}
+
+func (o *schemaObject) field(key string) string {
+	return o.path + "." + key
+}
+
+func (o *schemaObject) fail(key string, format string, args ...interface{}) {
+	o.err.Add(o.field(key), fmt.Sprintf(format, args...))
+}
+
+// get 返回字段的值，null 视为未填写
+func (o *schemaObject) get(key string) (interface{}, bool) {
+	value, ok := o.values[key]
+	return value, ok && value != nil
+}
+
+func (o *schemaObject) str(key string, required bool) string {
+	value, ok := o.get(key)
+	if !ok {
+		if required {
+			o.fail(key, "不能为空")
+		}
+		return ""
+	}
+	s, ok := value.(string)
+	if !ok {
+		o.fail(key, "必须是字符串")
+		return ""
+	}
+	if required && s == "" {
+		o.fail(key, "不能为空")
+	}
+	return s
+}
+
+// oneOf 检查字符串字段的取值，未填写时返回 def
+func (o *schemaObject) oneOf(key string, def string, options ...string) string {
+	s := o.str(key, false)
+	if s == "" {
+		return def
+	}
+	for _, option := range options {
+		if s == option {
+			return s
+		}
+	}
+	o.fail(key, "不支持的值 %v，可选: %v", s, strings.Join(options, ", "))
+	return def
+}
+
+// integer 检查整数字段的范围，未填写时返回 0
+func (o *schemaObject) integer(key string, min int, max int, required bool) int {
+	value, ok := o.get(key)
+	if !ok {
+		if required {
+			o.fail(key, "不能为空")
+		}
+		return 0
+	}
+	n, ok := value.(float64)
+	if !ok || n != math.Trunc(n) {
+		o.fail(key, "必须是整数")
+		return 0
+	}
+	if int(n) < min || int(n) > max {
+		o.fail(key, "必须在 %d 到 %d 之间", min, max)
+	}
+	return int(n)
+}
+
+func (o *schemaObject) boolean(key string) bool {
+	value, ok := o.get(key)
+	if !ok {
+		return false
+	}
+	b, ok := value.(bool)
+	if !ok {
+		o.fail(key, "必须是布尔值")
+	}
+	return b
+}
+
+func (o *schemaObject) object(key string, required bool) *schemaObject {
+	value, ok := o.get(key)
+	if !ok {
+		if required {
+			o.fail(key, "不能为空")
+		}
+		return nil
+	}
+	values, ok := value.(map[string]interface{})
+	if !ok {
+		o.fail(key, "必须是对象")
+		return nil
+	}
+	return &schemaObject{path: o.field(key), values: values, err: o.err}
+}
+
+// objects 返回对象数组字段中的各个对象，不是对象的元素记录错误后跳过
+func (o *schemaObject) objects(key string, required bool) []*schemaObject {
+	value, ok := o.get(key)
+	if !ok {
+		if required {
+			o.fail(key, "不能为空")
+		}
+		return nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		o.fail(key, "必须是数组")
+		return nil
+	}
+	if required && len(items) == 0 {
+		o.fail(key, "至少需要一项")
+	}
+	objects := make([]*schemaObject, 0, len(items))
+	for i, item := range items {
+		path := fmt.Sprintf("%v[%d]", o.field(key), i)
+		values, ok := item.(map[string]interface{})
+		if !ok {
+			o.err.Add(path, "必须是对象")
+			continue
+		}
+		objects = append(objects, &schemaObject{path: path, values: values, err: o.err})
+	}
+	return objects
+}
+
+// strings 返回字符串数组字段，xray 同时接受以逗号分隔的字符串
+func (o *schemaObject) strings(key string) []string {
+	value, ok := o.get(key)
+	if !ok {
+		return nil
+	}
+	switch v := value.(type) {
+	case string:
+		return strings.Split(v, ",")
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				o.err.Add(fmt.Sprintf("%v[%d]", o.field(key), i), "必须是字符串")
+				continue
+			}
+			items = append(items, s)
+		}
+		return items
+	default:
+		o.fail(key, "必须是字符串数组")
+		return nil
+	}
+}
+
+func parseSchemaObject(path string, data string, required bool, err *entity.ValidationError) *schemaObject {
+	if strings.TrimSpace(data) == "" {
+		if required {
+			err.Add(path, "不能为空")
+		}
+		return nil
+	}
+	values := map[string]interface{}{}
+	if e := json.Unmarshal([]byte(data), &values); e != nil {
+		err.Add(path, "不是有效的 JSON 对象: "+e.Error())
+		return nil
+	}
+	return &schemaObject{path: path, values: values, err: err}
+}
+
+// inboundSchema 一种入站协议的 settings 校验规则
+type inboundSchema struct {
+	// 是否使用 streamSettings
+	stream bool
+	// 可以启用的传输层安全
+	securities []string
+	check      func(settings *schemaObject, ctx *inboundSchemaContext)
+}
+
+// inboundSchemaContext 协议校验时可用的传输层信息
+type inboundSchemaContext struct {
+	network  string
+	security string
+}
+
+// transportSchema 一种传输方式的 streamSettings 校验规则
+type transportSchema struct {
+	settingsKey string
+	// 可以启用的传输层安全
+	securities []string
+	check      func(settings *schemaObject)
+}
+
+var vlessFlows = []string{"xtls-rprx-origin", "xtls-rprx-origin-udp443", "xtls-rprx-direct", "xtls-rprx-direct-udp443", "xtls-rprx-splice", "xtls-rprx-splice-udp443", "xtls-rprx-vision", "xtls-rprx-vision-udp443"}
+
+// trojanFlows trojan 只支持旧版 XTLS 的流控，不支持 xtls-rprx-vision
+var trojanFlows = []string{"xtls-rprx-origin", "xtls-rprx-origin-udp443", "xtls-rprx-direct", "xtls-rprx-direct-udp443", "xtls-rprx-splice", "xtls-rprx-splice-udp443"}
+
+var ssMethods = []string{"aes-128-gcm", "aes-256-gcm", "chacha20-poly1305", "chacha20-ietf-poly1305", "xchacha20-poly1305", "xchacha20-ietf-poly1305", "none", "plain", "2022-blake3-aes-128-gcm", "2022-blake3-aes-256-gcm", "2022-blake3-chacha20-poly1305"}
+
+var inboundSchemas = map[model.Protocol]*inboundSchema{
+	model.VMess: {
+		stream:     true,
+		securities: []string{"none", "tls"},
+		check: func(settings *schemaObject, ctx *inboundSchemaContext) {
+			for _, client := range settings.objects("clients", true) {
+				checkUUID(client, "id")
+				client.integer("alterId", 0, 65535, false)
+				client.str("email", false)
+			}
+			settings.boolean("disableInsecureEncryption")
+		},
+	},
+	model.VLESS: {
+		stream:     true,
+		securities: []string{"none", "tls", "xtls", "reality"},
+		check: func(settings *schemaObject, ctx *inboundSchemaContext) {
+			for _, client := range settings.objects("clients", true) {
+				checkUUID(client, "id")
+				checkFlow(client, ctx, vlessFlows)
+				client.str("email", false)
+			}
+			if decryption := settings.str("decryption", true); decryption != "" && decryption != "none" {
+				settings.fail("decryption", "vless 的 decryption 必须为 none")
+			}
+			checkFallbacks(settings, ctx)
+		},
+	},
+	model.Trojan: {
+		stream:     true,
+		securities: []string{"none", "tls", "xtls", "reality"},
+		check: func(settings *schemaObject, ctx *inboundSchemaContext) {
+			for _, client := range settings.objects("clients", true) {
+				client.str("password", true)
+				checkFlow(client, ctx, trojanFlows)
+				client.str("email", false)
+			}
+			checkFallbacks(settings, ctx)
+		},
+	},
+	model.Shadowsocks: {
+		stream:     true,
+		securities: []string{"none", "tls"},
+		check: func(settings *schemaObject, ctx *inboundSchemaContext) {
+			method := ""
+			if _, ok := settings.get("method"); ok {
+				method = settings.oneOf("method", "", ssMethods...)
+			} else {
+				settings.fail("method", "不能为空")
+			}
+			password := settings.str("password", method != "none" && method != "plain")
+			if xray.IsSS2022Method(method) && password != "" {
+				if err := xray.CheckSS2022Key(method, password); err != nil {
+					settings.fail("password", "%v", err)
+				}
+			}
+			for _, client := range settings.objects("clients", false) {
+				clientPassword := client.str("password", true)
+				if xray.IsSS2022Method(method) && clientPassword != "" {
+					if err := xray.CheckSS2022Key(method, clientPassword); err != nil {
+						client.fail("password", "%v", err)
+					}
+				}
+			}
+			settings.oneOf("network", "", "tcp", "udp", "tcp,udp")
+		},
+	},
+	model.Dokodemo: {
+		check: func(settings *schemaObject, ctx *inboundSchemaContext) {
+			settings.str("address", false)
+			settings.integer("port", 0, 65535, false)
+			settings.oneOf("network", "", "tcp", "udp", "tcp,udp")
+			settings.boolean("followRedirect")
+		},
+	},
+	model.Socks: {
+		check: func(settings *schemaObject, ctx *inboundSchemaContext) {
+			auth := settings.oneOf("auth", "noauth", "noauth", "password")
+			for _, account := range settings.objects("accounts", auth == "password") {
+				account.str("user", true)
+				account.str("pass", true)
+			}
+			settings.boolean("udp")
+			settings.str("ip", false)
+		},
+	},
+	model.Http: {
+		check: func(settings *schemaObject, ctx *inboundSchemaContext) {
+			for _, account := range settings.objects("accounts", false) {
+				account.str("user", true)
+				account.str("pass", true)
+			}
+			settings.boolean("allowTransparent")
+		},
+	},
+	model.MTProto: {
+		check: func(settings *schemaObject, ctx *inboundSchemaContext) {
+			for _, user := range settings.objects("users", true) {
+				secret := user.str("secret", true)
+				if secret != "" && !isHexString(secret, 32) {
+					user.fail("secret", "必须是 32 位十六进制字符串")
+				}
+			}
+		},
+	},
+}
+
+var transportSchemas = map[string]*transportSchema{
+	"tcp": {
+		settingsKey: "tcpSettings",
+		securities:  []string{"none", "tls", "xtls", "reality"},
+		check: func(settings *schemaObject) {
+			settings.boolean("acceptProxyProtocol")
+			header := settings.object("header", false)
+			if header == nil {
+				return
+			}
+			if header.oneOf("type", "none", "none", "http") == "http" {
+				if request := header.object("request", false); request != nil {
+					request.strings("path")
+					request.object("headers", false)
+				}
+				if response := header.object("response", false); response != nil {
+					response.object("headers", false)
+				}
+			}
+		},
+	},
+	"kcp": {
+		settingsKey: "kcpSettings",
+		securities:  []string{"none"},
+		check: func(settings *schemaObject) {
+			settings.integer("mtu", 576, 1460, false)
+			settings.integer("tti", 10, 100, false)
+			settings.integer("uplinkCapacity", 0, math.MaxInt32, false)
+			settings.integer("downlinkCapacity", 0, math.MaxInt32, false)
+			settings.boolean("congestion")
+			settings.integer("readBufferSize", 0, math.MaxInt32, false)
+			settings.integer("writeBufferSize", 0, math.MaxInt32, false)
+			if header := settings.object("header", false); header != nil {
+				header.oneOf("type", "none", "none", "srtp", "utp", "wechat-video", "dtls", "wireguard")
+			}
+			settings.str("seed", false)
+		},
+	},
+	"ws": {
+		settingsKey: "wsSettings",
+		securities:  []string{"none", "tls"},
+		check: func(settings *schemaObject) {
+			settings.boolean("acceptProxyProtocol")
+			checkPath(settings, "path")
+			settings.object("headers", false)
+		},
+	},
+	"http": {
+		settingsKey: "httpSettings",
+		securities:  []string{"none", "tls", "reality"},
+		check:       checkHttpTransport,
+	},
+	"h2": {
+		settingsKey: "httpSettings",
+		securities:  []string{"none", "tls", "reality"},
+		check:       checkHttpTransport,
+	},
+	"quic": {
+		settingsKey: "quicSettings",
+		securities:  []string{"none", "tls"},
+		check: func(settings *schemaObject) {
+			security := settings.oneOf("security", "none", "none", "aes-128-gcm", "chacha20-poly1305")
+			settings.str("key", security != "none")
+			if header := settings.object("header", false); header != nil {
+				header.oneOf("type", "none", "none", "srtp", "utp", "wechat-video", "dtls", "wireguard")
+			}
+		},
+	},
+	"grpc": {
+		settingsKey: "grpcSettings",
+		securities:  []string{"none", "tls", "reality"},
+		check: func(settings *schemaObject) {
+			settings.str("serviceName", false)
+			settings.boolean("multiMode")
+		},
+	},
+	"httpupgrade": {
+		settingsKey: "httpupgradeSettings",
+		securities:  []string{"none", "tls"},
+		check: func(settings *schemaObject) {
+			settings.boolean("acceptProxyProtocol")
+			checkPath(settings, "path")
+			settings.str("host", false)
+		},
+	},
+}
+
+func checkHttpTransport(settings *schemaObject) {
+	settings.strings("host")
+	checkPath(settings, "path")
+}
+
+func checkPath(settings *schemaObject, key string) {
+	path := settings.str(key, false)
+	if path != "" && !strings.HasPrefix(path, "/") {
+		settings.fail(key, "必须以 / 开头")
+	}
+}
+
+func checkUUID(obj *schemaObject, key string) {
+	id := obj.str(key, true)
+	if id != "" && !xray.IsValidUUID(id) {
+		obj.fail(key, "不是有效的 UUID: %v", id)
+	}
+}
+
+// checkFlow 检查 vless 和 trojan 客户端的流控，flows 为协议支持的流控，
+// xtls-rprx-vision 只能与 tls 或 reality 一起使用
+func checkFlow(client *schemaObject, ctx *inboundSchemaContext, flows []string) {
+	flow := client.oneOf("flow", "", flows...)
+	if strings.HasPrefix(flow, "xtls-rprx-vision") {
+		if ctx.security != "tls" && ctx.security != "reality" {
+			client.fail("flow", "%v 需要启用 tls 或 reality", flow)
+		} else if ctx.network != "tcp" {
+			client.fail("flow", "%v 只能用于 tcp 传输", flow)
+		}
+	}
+}
+
+// checkFallbacks 检查 vless 和 trojan 的回落，回落只能用于 tcp 传输
+func checkFallbacks(settings *schemaObject, ctx *inboundSchemaContext) {
+	fallbacks := settings.objects("fallbacks", false)
+	if len(fallbacks) > 0 && ctx.network != "tcp" {
+		settings.fail("fallbacks", "回落只能用于 tcp 传输")
+	}
+	for _, fallback := range fallbacks {
+		fallback.str("name", false)
+		fallback.str("alpn", false)
+		checkPath(fallback, "path")
+		switch dest := fallback.values["dest"].(type) {
+		case float64:
+			fallback.integer("dest", 1, 65535, true)
+		case string:
+			if dest == "" {
+				fallback.fail("dest", "不能为空")
+			}
+		default:
+			fallback.fail("dest", "必须是端口或地址")
+		}
+		fallback.integer("xver", 0, 2, false)
+	}
+}
+
+func isHexString(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTlsSettings 检查 tlsSettings 或 xtlsSettings，证书库的引用由 TlsCertService.CheckStreamCerts 检查
+func checkTlsSettings(tls *schemaObject) {
+	tls.str("serverName", false)
+	tls.strings("alpn")
+	for _, cert := range tls.objects("certificates", true) {
+		if _, ok := cert.get("certId"); ok {
+			cert.integer("certId", 1, math.MaxInt32, true)
+			cert.boolean("useFile")
+			continue
+		}
+		if _, ok := cert.get("certificateFile"); ok {
+			cert.str("certificateFile", true)
+			cert.str("keyFile", true)
+			continue
+		}
+		if strings.TrimSpace(strings.Join(cert.strings("certificate"), "")) == "" {
+			cert.fail("certificate", "证书文件路径和证书内容不能都为空")
+		}
+		if strings.TrimSpace(strings.Join(cert.strings("key"), "")) == "" {
+			cert.fail("key", "密钥文件路径和密钥内容不能都为空")
+		}
+	}
+}
+
+func checkRealitySettings(reality *schemaObject) {
+	dest := reality.values["dest"]
+	switch d := dest.(type) {
+	case float64:
+		reality.integer("dest", 1, 65535, true)
+	case string:
+		if d == "" {
+			reality.fail("dest", "不能为空")
+		}
+	default:
+		reality.fail("dest", "必须是端口或地址")
+	}
+	reality.integer("xver", 0, 2, false)
+	reality.boolean("show")
+	serverNames := reality.strings("serverNames")
+	if len(serverNames) == 0 || serverNames[0] == "" {
+		reality.fail("serverNames", "至少需要一项")
+	}
+	privateKey := reality.str("privateKey", true)
+	if privateKey != "" {
+		if _, err := xray.GenerateX25519(privateKey); err != nil {
+			reality.fail("privateKey", "不是有效的 x25519 私钥")
+		}
+	}
+	shortIds := reality.strings("shortIds")
+	if len(shortIds) == 0 {
+		reality.fail("shortIds", "至少需要一项")
+	}
+	for i, shortId := range shortIds {
+		if len(shortId) > 16 || len(shortId)%2 != 0 || (shortId != "" && !isHexString(shortId, len(shortId))) {
+			reality.err.Add(fmt.Sprintf("%v[%d]", reality.field("shortIds"), i), "必须是不超过 16 位的偶数长度十六进制字符串")
+		}
+	}
+}
+
+func checkStreamSettings(stream *schemaObject, schema *inboundSchema, ctx *inboundSchemaContext) {
+	ctx.network = stream.oneOf("network", "tcp", "tcp", "kcp", "ws", "http", "h2", "quic", "grpc", "httpupgrade")
+	ctx.security = stream.oneOf("security", "none", "none", "tls", "xtls", "reality")
+	transport := transportSchemas[ctx.network]
+	if settings := stream.object(transport.settingsKey, false); settings != nil {
+		transport.check(settings)
+	}
+
+	if !containsString(schema.securities, ctx.security) {
+		stream.fail("security", "当前协议不支持 %v", ctx.security)
+	} else if !containsString(transport.securities, ctx.security) {
+		stream.fail("security", "%v 传输不支持 %v", ctx.network, ctx.security)
+	}
+	switch ctx.security {
+	case "tls":
+		if tls := stream.object("tlsSettings", true); tls != nil {
+			checkTlsSettings(tls)
+		}
+	case "xtls":
+		if tls := stream.object("xtlsSettings", true); tls != nil {
+			checkTlsSettings(tls)
+		}
+	case "reality":
+		if reality := stream.object("realitySettings", true); reality != nil {
+			checkRealitySettings(reality)
+		}
+	}
+}
+
+func checkSniffing(sniffing *schemaObject) {
+	sniffing.boolean("enabled")
+	for i, dest := range sniffing.strings("destOverride") {
+		switch dest {
+		case "http", "tls", "quic", "fakedns", "fakedns+others":
+		default:
+			sniffing.err.Add(fmt.Sprintf("%v[%d]", sniffing.field("destOverride"), i), "不支持的值 "+dest)
+		}
+	}
+}
+
+// ValidateInboundConfig 按协议和传输方式检查入站的 settings、streamSettings 和 sniffing，
+// 返回包含所有字段错误的 *entity.ValidationError
+func ValidateInboundConfig(inbound *model.Inbound) error {
+	err := &entity.ValidationError{}
+	schema, ok := inboundSchemas[inbound.Protocol]
+	if !ok {
+		err.Add("protocol", fmt.Sprintf("不支持的协议 %v", inbound.Protocol))
+		return err
+	}
+	if inbound.Port <= 0 || inbound.Port > 65535 {
+		err.Add("port", "必须在 1 到 65535 之间")
+	}
+
+	ctx := &inboundSchemaContext{network: "tcp", security: "none"}
+	if schema.stream {
+		if stream := parseSchemaObject("streamSettings", inbound.StreamSettings, false, err); stream != nil {
+			checkStreamSettings(stream, schema, ctx)
+		}
+	}
+	if settings := parseSchemaObject("settings", inbound.Settings, true, err); settings != nil {
+		schema.check(settings, ctx)
+	}
+	if sniffing := parseSchemaObject("sniffing", inbound.Sniffing, false, err); sniffing != nil {
+		checkSniffing(sniffing)
+	}
+
+	if len(err.Errors) > 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package service
+
+import (
+	"testing"
+	"x-ui/database/model"
+)
+
+func TestValidateInboundFlow(t *testing.T) {
+	const stream = `{"network": "tcp", "security": "tls", "tlsSettings": {"certificates": [{"certificateFile": "/a.crt", "keyFile": "/a.key"}]}}`
+	for _, c := range []struct {
+		protocol model.Protocol
+		settings string
+		valid    bool
+	}{
+		{model.VLESS, `{"clients": [{"id": "b831381d-6324-4d53-ad4f-8cda48b30811", "flow": "xtls-rprx-vision"}], "decryption": "none"}`, true},
+		{model.Trojan, `{"clients": [{"password": "pass", "flow": "xtls-rprx-vision"}]}`, false},
+		{model.Trojan, `{"clients": [{"password": "pass", "flow": ""}]}`, true},
+	} {
+		inbound := &model.Inbound{Port: 443, Protocol: c.protocol, Settings: c.settings, StreamSettings: stream}
+		err := ValidateInboundConfig(inbound)
+		if (err == nil) != c.valid {
+			t.Errorf("%v %v: err = %v, want valid %v", c.protocol, c.settings, err, c.valid)
+		}
+	}
+}
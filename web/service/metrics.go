@@ -0,0 +1,236 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/xray"
+)
+
+// 面板运行期间累计的指标，面板重启后从零开始，prometheus 会自动处理计数器归零
+var metricsLock sync.Mutex
+var xrayRestartCount int64
+var trafficCounters = map[trafficKey]int64{}
+var jobStats = map[string]*jobStat{}
+
+// 计算两次抓取之间的 CPU 使用率
+var metricsCpuSampler CpuSampler
+
+type trafficKey struct {
+	isInbound bool
+	tag       string
+	isDown    bool
+}
+
+type jobStat struct {
+	count        int64
+	sum          float64
+	lastDuration float64
+}
+
+// RecordXrayRestart 记录一次 xray 进程启动
+func RecordXrayRestart() {
+	metricsLock.Lock()
+	xrayRestartCount++
+	metricsLock.Unlock()
+}
+
+// RecordTraffic 累加从 xray 读取并重置后的流量
+func RecordTraffic(traffics []*xray.Traffic) {
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	for _, traffic := range traffics {
+		trafficCounters[trafficKey{traffic.IsInbound, traffic.Tag, false}] += traffic.Up
+		trafficCounters[trafficKey{traffic.IsInbound, traffic.Tag, true}] += traffic.Down
+	}
+}
+
+// RecordJobDuration 记录定时任务的执行耗时
+func RecordJobDuration(name string, duration time.Duration) {
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	stat, ok := jobStats[name]
+	if !ok {
+		stat = &jobStat{}
+		jobStats[name] = stat
+	}
+	seconds := duration.Seconds()
+	stat.count++
+	stat.sum += seconds
+	stat.lastDuration = seconds
+}
+
+type metricsWriter struct {
+	w   io.Writer
+	err error
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (m *metricsWriter) header(name string, metricType string, help string) {
+	if m.err != nil {
+		return
+	}
+	_, m.err = fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// sample labels 为成对的 key、value
+func (m *metricsWriter) sample(name string, value interface{}, labels ...string) {
+	if m.err != nil {
+		return
+	}
+	builder := strings.Builder{}
+	builder.WriteString(name)
+	if len(labels) > 0 {
+		builder.WriteString("{")
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				builder.WriteString(",")
+			}
+			builder.WriteString(labels[i])
+			builder.WriteString(`="`)
+			builder.WriteString(labelEscaper.Replace(labels[i+1]))
+			builder.WriteString(`"`)
+		}
+		builder.WriteString("}")
+	}
+	_, m.err = fmt.Fprintf(m.w, "%s %v\n", builder.String(), value)
+}
+
+func (m *metricsWriter) gauge(name string, help string, value interface{}) {
+	m.header(name, "gauge", help)
+	m.sample(name, value)
+}
+
+func (m *metricsWriter) counter(name string, help string, value interface{}) {
+	m.header(name, "counter", help)
+	m.sample(name, value)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// getMetricsCpuPercent 计算与上一次抓取之间的 CPU 使用率，不影响面板状态使用的 cpu.Percent
+func getMetricsCpuPercent() float64 {
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	percent, _ := metricsCpuSampler.Percent()
+	return percent
+}
+
+type MetricsService struct {
+	serverService  ServerService
+	inboundService InboundService
+}
+
+// WriteMetrics 以 prometheus 文本格式输出所有指标
+func (s *MetricsService) WriteMetrics(w io.Writer) error {
+	m := &metricsWriter{w: w}
+
+	status := s.serverService.getStatusWithoutCpu(nil)
+	m.gauge("x_ui_cpu_usage_percent", "CPU usage in percent since the last scrape.", getMetricsCpuPercent())
+	m.gauge("x_ui_memory_used_bytes", "Used memory in bytes.", status.Mem.Current)
+	m.gauge("x_ui_memory_total_bytes", "Total memory in bytes.", status.Mem.Total)
+	m.gauge("x_ui_swap_used_bytes", "Used swap in bytes.", status.Swap.Current)
+	m.gauge("x_ui_swap_total_bytes", "Total swap in bytes.", status.Swap.Total)
+	m.gauge("x_ui_disk_used_bytes", "Used disk space of / in bytes.", status.Disk.Current)
+	m.gauge("x_ui_disk_total_bytes", "Total disk space of / in bytes.", status.Disk.Total)
+	m.gauge("x_ui_uptime_seconds", "Host uptime in seconds.", status.Uptime)
+	m.header("x_ui_load", "gauge", "Host load average.")
+	periods := []string{"1", "5", "15"}
+	for i, load := range status.Loads {
+		if i < len(periods) {
+			m.sample("x_ui_load", load, "period", periods[i])
+		}
+	}
+	m.counter("x_ui_network_sent_bytes_total", "Bytes sent by all network interfaces.", status.NetTraffic.Sent)
+	m.counter("x_ui_network_received_bytes_total", "Bytes received by all network interfaces.", status.NetTraffic.Recv)
+	m.gauge("x_ui_tcp_connections", "Number of TCP connections.", status.TcpCount)
+	m.gauge("x_ui_udp_connections", "Number of UDP connections.", status.UdpCount)
+
+	m.gauge("x_ui_xray_up", "Whether xray is running.", boolToInt(status.Xray.State == Running))
+	m.header("x_ui_xray_state", "gauge", "Current xray process state.")
+	for _, state := range []ProcessState{Running, Stop, Error} {
+		m.sample("x_ui_xray_state", boolToInt(status.Xray.State == state), "state", string(state))
+	}
+
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return err
+	}
+	m.header("x_ui_inbound_up_bytes_total", "counter", "Uploaded bytes of inbound recorded in database.")
+	for _, inbound := range inbounds {
+		m.sample("x_ui_inbound_up_bytes_total", inbound.Up, "id", fmt.Sprint(inbound.Id), "tag", inbound.Tag, "remark", inbound.Remark)
+	}
+	m.header("x_ui_inbound_down_bytes_total", "counter", "Downloaded bytes of inbound recorded in database.")
+	for _, inbound := range inbounds {
+		m.sample("x_ui_inbound_down_bytes_total", inbound.Down, "id", fmt.Sprint(inbound.Id), "tag", inbound.Tag, "remark", inbound.Remark)
+	}
+	m.header("x_ui_inbound_quota_bytes", "gauge", "Traffic quota of inbound, 0 means unlimited.")
+	for _, inbound := range inbounds {
+		m.sample("x_ui_inbound_quota_bytes", inbound.Total, "id", fmt.Sprint(inbound.Id), "tag", inbound.Tag, "remark", inbound.Remark)
+	}
+	m.header("x_ui_inbound_enabled", "gauge", "Whether inbound is enabled.")
+	for _, inbound := range inbounds {
+		m.sample("x_ui_inbound_enabled", boolToInt(inbound.Enable), "id", fmt.Sprint(inbound.Id), "tag", inbound.Tag, "remark", inbound.Remark)
+	}
+
+	metricsLock.Lock()
+	restartCount := xrayRestartCount
+	keys := make([]trafficKey, 0, len(trafficCounters))
+	values := make(map[trafficKey]int64, len(trafficCounters))
+	for key, value := range trafficCounters {
+		keys = append(keys, key)
+		values[key] = value
+	}
+	jobNames := make([]string, 0, len(jobStats))
+	jobs := make(map[string]jobStat, len(jobStats))
+	for name, stat := range jobStats {
+		jobNames = append(jobNames, name)
+		jobs[name] = *stat
+	}
+	metricsLock.Unlock()
+
+	m.counter("x_ui_xray_restarts_total", "Number of times xray has been started by the panel.", restartCount)
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].tag != keys[j].tag {
+			return keys[i].tag < keys[j].tag
+		}
+		if keys[i].isInbound != keys[j].isInbound {
+			return keys[i].isInbound
+		}
+		return !keys[i].isDown && keys[j].isDown
+	})
+	m.header("x_ui_traffic_bytes_total", "counter", "Traffic reported by xray since panel start.")
+	for _, key := range keys {
+		kind := "outbound"
+		if key.isInbound {
+			kind = "inbound"
+		}
+		direction := "up"
+		if key.isDown {
+			direction = "down"
+		}
+		m.sample("x_ui_traffic_bytes_total", values[key], "type", kind, "tag", key.tag, "direction", direction)
+	}
+
+	sort.Strings(jobNames)
+	m.header("x_ui_job_duration_seconds", "summary", "Duration of scheduled jobs.")
+	for _, name := range jobNames {
+		m.sample("x_ui_job_duration_seconds_sum", jobs[name].sum, "job", name)
+		m.sample("x_ui_job_duration_seconds_count", jobs[name].count, "job", name)
+	}
+	m.header("x_ui_job_last_duration_seconds", "gauge", "Duration of the last run of scheduled jobs.")
+	for _, name := range jobNames {
+		m.sample("x_ui_job_last_duration_seconds", jobs[name].lastDuration, "job", name)
+	}
+	return m.err
+}
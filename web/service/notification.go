@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/web/notify"
+
+	"gorm.io/gorm"
+)
+
+// 通知渠道配置中需要掩码的字段
+var notifySecretKeys = []string{"token", "secret", "password"}
+
+type NotificationService struct {
+	settingService SettingService
+}
+
+func (s *NotificationService) GetNotifyChannels() ([]*model.NotifyChannel, error) {
+	db := database.GetDB()
+	var channels []*model.NotifyChannel
+	err := db.Model(model.NotifyChannel{}).Order("id asc").Find(&channels).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return channels, nil
+}
+
+func (s *NotificationService) GetNotifyChannel(id int) (*model.NotifyChannel, error) {
+	db := database.GetDB()
+	channel := &model.NotifyChannel{}
+	err := db.Model(model.NotifyChannel{}).First(channel, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return channel, nil
+}
+
+// MaskNotifyChannel 将渠道配置中的令牌、密码等替换为掩码
+func (s *NotificationService) MaskNotifyChannel(channel *model.NotifyChannel) {
+	settings := map[string]interface{}{}
+	if json.Unmarshal([]byte(channel.Settings), &settings) != nil {
+		return
+	}
+	for _, key := range notifySecretKeys {
+		if value, ok := settings[key].(string); ok && value != "" {
+			settings[key] = model.SecretMask
+		}
+	}
+	data, err := json.Marshal(settings)
+	if err == nil {
+		channel.Settings = string(data)
+	}
+}
+
+// restoreMaskedSettings 提交的配置中值为掩码的字段使用原配置的值
+func (s *NotificationService) restoreMaskedSettings(channel *model.NotifyChannel) error {
+	if channel.Id <= 0 {
+		return nil
+	}
+	settings := map[string]interface{}{}
+	if json.Unmarshal([]byte(channel.Settings), &settings) != nil {
+		return nil
+	}
+	masked := false
+	for _, key := range notifySecretKeys {
+		if settings[key] == model.SecretMask {
+			masked = true
+		}
+	}
+	if !masked {
+		return nil
+	}
+	oldChannel, err := s.GetNotifyChannel(channel.Id)
+	if err != nil {
+		return err
+	}
+	oldSettings := map[string]interface{}{}
+	json.Unmarshal([]byte(oldChannel.Settings), &oldSettings)
+	for _, key := range notifySecretKeys {
+		if settings[key] == model.SecretMask {
+			settings[key] = oldSettings[key]
+		}
+	}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	channel.Settings = string(data)
+	return nil
+}
+
+func (s *NotificationService) checkNotifyChannel(channel *model.NotifyChannel) error {
+	if channel.Name == "" {
+		return common.NewError("通知渠道名称不能为空")
+	}
+	_, err := notify.NewNotifier(channel.Type, channel.Settings)
+	if err != nil {
+		return err
+	}
+	_, err = parseNotifyTemplates(channel.Templates)
+	return err
+}
+
+func (s *NotificationService) AddNotifyChannel(channel *model.NotifyChannel) error {
+	err := s.checkNotifyChannel(channel)
+	if err != nil {
+		return err
+	}
+	db := database.GetDB()
+	return db.Create(channel).Error
+}
+
+func (s *NotificationService) UpdateNotifyChannel(channel *model.NotifyChannel) error {
+	err := s.restoreMaskedSettings(channel)
+	if err != nil {
+		return err
+	}
+	err = s.checkNotifyChannel(channel)
+	if err != nil {
+		return err
+	}
+	_, err = s.GetNotifyChannel(channel.Id)
+	if err != nil {
+		return err
+	}
+	db := database.GetDB()
+	return db.Save(channel).Error
+}
+
+func (s *NotificationService) DelNotifyChannel(id int) error {
+	db := database.GetDB()
+	return db.Delete(model.NotifyChannel{}, id).Error
+}
+
+type namedNotifier struct {
+	name      string
+	notifier  notify.Notifier
+	templates map[string]string
+}
+
+// HasEnabledChannel 是否启用了电报机器人或任一通知渠道
+func (s *NotificationService) HasEnabledChannel() (bool, error) {
+	enabled, err := s.settingService.GetTgbotenabled()
+	if err != nil || enabled {
+		return enabled, err
+	}
+	var count int64
+	err = database.GetDB().Model(model.NotifyChannel{}).Where("enable = ?", true).Count(&count).Error
+	return count > 0, err
+}
+
+// getNotifiers 返回所有启用的渠道，兼容原有的电报机器人设置
+func (s *NotificationService) getNotifiers() ([]*namedNotifier, error) {
+	notifiers := make([]*namedNotifier, 0)
+	enabled, err := s.settingService.GetTgbotenabled()
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		token, err := s.settingService.GetTgBotToken()
+		if err != nil {
+			return nil, err
+		}
+		chatId, err := s.settingService.GetTgBotChatId()
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, &namedNotifier{
+			name:      "tgbot",
+			notifier:  &notify.TelegramNotifier{Token: token, ChatId: int64(chatId)},
+			templates: map[string]string{},
+		})
+	}
+
+	channels, err := s.GetNotifyChannels()
+	if err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		if !channel.Enable {
+			continue
+		}
+		notifier, err := notify.NewNotifier(channel.Type, channel.Settings)
+		if err != nil {
+			logger.Warningf("notify channel %v invalid: %v", channel.Name, err)
+			continue
+		}
+		templates, err := parseNotifyTemplates(channel.Templates)
+		if err != nil {
+			logger.Warningf("notify channel %v templates invalid, use default: %v", channel.Name, err)
+			templates = map[string]string{}
+		}
+		notifiers = append(notifiers, &namedNotifier{name: channel.Name, notifier: notifier, templates: templates})
+	}
+	return notifiers, nil
+}
+
+// sendSplit 按渠道的长度限制拆分消息后依次发送，拆分后在标题后加上页码
+func sendSplit(ctx context.Context, notifier notify.Notifier, title string, text string) error {
+	limit := notify.MaxLength(notifier)
+	if limit > 0 {
+		// 预留标题和页码的长度
+		limit -= utf8.RuneCountInString(title) + 16
+	}
+	parts := notify.Split(text, limit)
+	now := time.Now()
+	for i, part := range parts {
+		msg := &notify.Message{
+			Title: title,
+			Text:  part,
+			Time:  now,
+		}
+		if len(parts) > 1 {
+			msg.Title = strings.TrimSpace(fmt.Sprintf("%s (%d/%d)", title, i+1, len(parts)))
+		}
+		err := notify.SendWithRetry(ctx, notifier, msg, notify.DefaultRetryPolicy)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dispatch 并发发送到所有启用的渠道，render 生成每个渠道的标题和正文
+func (s *NotificationService) dispatch(render func(n *namedNotifier) (string, string)) error {
+	notifiers, err := s.getNotifiers()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+	defer cancel()
+	errs := make([]error, len(notifiers))
+	var wg sync.WaitGroup
+	for i, n := range notifiers {
+		wg.Add(1)
+		go func(i int, n *namedNotifier) {
+			defer wg.Done()
+			title, text := render(n)
+			err := sendSplit(ctx, n.notifier, title, text)
+			if err != nil {
+				logger.Warningf("send notification to %v failed: %v", n.name, err)
+				errs[i] = common.NewErrorf("%v: %v", n.name, err)
+			}
+		}(i, n)
+	}
+	wg.Wait()
+	return common.Combine(errs...)
+}
+
+// Notify 将同样的标题和正文发送到所有启用的渠道，失败时按退避策略重试
+func (s *NotificationService) Notify(title string, text string) error {
+	return s.dispatch(func(n *namedNotifier) (string, string) {
+		return title, text
+	})
+}
+
+// NotifyEvent 使用各渠道的模板渲染事件后发送，渠道未设置或模板渲染失败时使用默认模板
+func (s *NotificationService) NotifyEvent(event string, data interface{}) error {
+	defaultTemplate, ok := defaultNotifyTemplates[event]
+	if !ok {
+		return common.NewError("不支持的通知事件:", event)
+	}
+	localizer, err := getNotifyLocalizer(&s.settingService)
+	if err != nil {
+		return err
+	}
+	title := ""
+	if key, ok := notifyTitleKeys[event]; ok {
+		title = localize(localizer, key, nil)
+	}
+	defaultText, err := notify.Render(defaultTemplate, localizer, data)
+	if err != nil {
+		return err
+	}
+	return s.dispatch(func(n *namedNotifier) (string, string) {
+		custom, ok := n.templates[event]
+		if !ok {
+			return title, defaultText
+		}
+		text, err := notify.Render(custom, localizer, data)
+		if err != nil {
+			logger.Warningf("render notify template %v of %v failed: %v", event, n.name, err)
+			return title, defaultText
+		}
+		return title, text
+	})
+}
+
+// SendTestNotification 使用提交的渠道配置发送一条测试通知，不重试，便于立即看到错误
+func (s *NotificationService) SendTestNotification(channel *model.NotifyChannel) error {
+	err := s.restoreMaskedSettings(channel)
+	if err != nil {
+		return err
+	}
+	notifier, err := notify.NewNotifier(channel.Type, channel.Settings)
+	if err != nil {
+		return err
+	}
+	_, err = parseNotifyTemplates(channel.Templates)
+	if err != nil {
+		return err
+	}
+	localizer, err := getNotifyLocalizer(&s.settingService)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	return notifier.Send(ctx, &notify.Message{
+		Title: localize(localizer, "notifyTestTitle", nil),
+		Text:  localize(localizer, "notifyTestText", map[string]interface{}{"Name": channel.Name}),
+		Time:  time.Now(),
+	})
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+	"x-ui/database/model"
+	"x-ui/web/notify"
+)
+
+func TestHasEnabledChannel(t *testing.T) {
+	initTestDB(t)
+	service := NotificationService{}
+	assertEnabled := func(want bool) {
+		t.Helper()
+		enabled, err := service.HasEnabledChannel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if enabled != want {
+			t.Errorf("enabled = %v, want %v", enabled, want)
+		}
+	}
+
+	assertEnabled(false)
+	channel := &model.NotifyChannel{
+		Name:     "webhook",
+		Type:     notify.TypeWebhook,
+		Settings: `{"url": "http://127.0.0.1/"}`,
+	}
+	err := service.AddNotifyChannel(channel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEnabled(false)
+
+	// 只启用通知渠道、不启用电报机器人时也需要发送统计通知
+	channel.Enable = true
+	err = service.UpdateNotifyChannel(channel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEnabled(true)
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"encoding/json"
+	"sync"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/web/notify"
+	"x-ui/web/translation"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// 通知事件，渠道可以按事件设置自定义模板
+const (
+	NotifyEventStats = "stats"
+	NotifyEventLogin = "login"
+	NotifyEventAlert = "alert"
+)
+
+// 各事件的默认模板，流量统计中每个入站之间以空行分隔，超长时在空行处分页
+var defaultNotifyTemplates = map[string]string{
+	NotifyEventStats: `{{i18n "notifyHostname"}}:{{.Hostname}}
+{{i18n "notifyIp"}}:{{.Ip}}
+{{range .Inbounds}}
+{{i18n "notifyInboundRemark"}}:{{.Remark}}
+{{i18n "notifyPort"}}:{{.Port}}
+{{i18n "notifyUp"}}:{{traffic .Up}}
+{{i18n "notifyDown"}}:{{traffic .Down}}
+{{i18n "notifyTotal"}}:{{traffic (.Up | add .Down)}}
+{{i18n "notifyExpiry"}}:{{if .ExpiryTime}}{{time .ExpiryTime}}{{else}}{{i18n "notifyNoExpiry"}}{{end}}
+{{end}}`,
+	NotifyEventLogin: `{{if .Success}}{{i18n "notifyLoginSuccess"}}{{else}}{{i18n "notifyLoginFail"}}{{end}}
+{{i18n "notifyHostname"}}:{{.Hostname}}
+{{i18n "notifyTime"}}:{{.Time}}
+{{i18n "notifyUser"}}:{{.Username}}
+{{i18n "notifyIp"}}:{{.Ip}}`,
+	NotifyEventAlert: `{{if .Resolved}}{{i18n "notifyAlertResolved"}}{{else}}{{i18n "notifyAlertFired"}}{{end}}: {{.RuleName}}
+{{i18n "notifyHostname"}}:{{.Hostname}}
+{{i18n "notifyAlertDetail"}}:{{.Message}}
+{{i18n "notifyFiredAt"}}:{{time .FiredAt}}
+{{if .Resolved}}{{i18n "notifyResolvedAt"}}:{{time .ResolvedAt}}{{end}}`,
+}
+
+// 各事件通知标题的翻译 key，没有的事件不带标题
+var notifyTitleKeys = map[string]string{
+	NotifyEventStats: "notifyStatsTitle",
+}
+
+// NotifyInbound 模板中使用的入站信息，ExpiryTime 为 unix 秒，0 表示不过期
+type NotifyInbound struct {
+	Remark     string
+	Port       int
+	Enable     bool
+	Up         int64
+	Down       int64
+	Total      int64
+	ExpiryTime int64
+}
+
+// NotifyStatsData 流量统计通知的模板数据
+type NotifyStatsData struct {
+	Hostname string
+	Ip       string
+	Inbounds []*NotifyInbound
+}
+
+// NotifyLoginData 登录通知的模板数据
+type NotifyLoginData struct {
+	Hostname string
+	Username string
+	Ip       string
+	Time     string
+	Success  bool
+}
+
+// NotifyAlertData 告警通知的模板数据，时间为 unix 秒
+type NotifyAlertData struct {
+	Hostname   string
+	Resolved   bool
+	RuleName   string
+	Subject    string
+	Value      float64
+	Message    string
+	FiredAt    int64
+	ResolvedAt int64
+}
+
+func NewNotifyInbound(inbound *model.Inbound) *NotifyInbound {
+	return &NotifyInbound{
+		Remark:     inbound.Remark,
+		Port:       inbound.Port,
+		Enable:     inbound.Enable,
+		Up:         inbound.Up,
+		Down:       inbound.Down,
+		Total:      inbound.Total,
+		ExpiryTime: inbound.ExpiryTime / 1000,
+	}
+}
+
+func NewNotifyAlertData(hostname string, notice *AlertNotice) *NotifyAlertData {
+	event := notice.Event
+	return &NotifyAlertData{
+		Hostname:   hostname,
+		Resolved:   notice.Resolved,
+		RuleName:   event.RuleName,
+		Subject:    event.Subject,
+		Value:      event.Value,
+		Message:    event.Message,
+		FiredAt:    event.FiredAt,
+		ResolvedAt: event.ResolvedAt,
+	}
+}
+
+var notifyBundle *i18n.Bundle
+var notifyBundleOnce sync.Once
+var notifyBundleErr error
+
+// getNotifyLocalizer 返回通知语言设置对应的 localizer，通知和电报机器人的回复都使用它
+func getNotifyLocalizer(settingService *SettingService) (*i18n.Localizer, error) {
+	notifyBundleOnce.Do(func() {
+		notifyBundle, notifyBundleErr = translation.NewBundle()
+	})
+	if notifyBundleErr != nil {
+		return nil, notifyBundleErr
+	}
+	lang, err := settingService.GetNotifyLanguage()
+	if err != nil {
+		return nil, err
+	}
+	return i18n.NewLocalizer(notifyBundle, lang), nil
+}
+
+// parseNotifyTemplates 解析渠道的自定义模板，并检查事件和模板语法
+func parseNotifyTemplates(templates string) (map[string]string, error) {
+	result := map[string]string{}
+	if templates == "" {
+		return result, nil
+	}
+	err := json.Unmarshal([]byte(templates), &result)
+	if err != nil {
+		return nil, common.NewError("通知模板不是有效的 JSON:", err)
+	}
+	for event, text := range result {
+		if _, ok := defaultNotifyTemplates[event]; !ok {
+			return nil, common.NewError("不支持的通知事件:", event)
+		}
+		_, err = notify.ParseTemplate(text)
+		if err != nil {
+			return nil, common.NewErrorf("通知模板 %v 无效: %v", event, err)
+		}
+	}
+	return result, nil
+}
+
+func localize(localizer *i18n.Localizer, key string, data map[string]interface{}) string {
+	text, err := localizer.Localize(&i18n.LocalizeConfig{
+		MessageID:    key,
+		TemplateData: data,
+	})
+	if err != nil {
+		return key
+	}
+	return text
+}
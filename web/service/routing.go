@@ -0,0 +1,210 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+)
+
+const (
+	GeoSite = "geosite"
+	GeoIP   = "geoip"
+)
+
+type RoutingService struct {
+}
+
+func (s *RoutingService) GetRoutingRules() ([]*model.RoutingRule, error) {
+	db := database.GetDB()
+	var rules []*model.RoutingRule
+	err := db.Model(model.RoutingRule{}).Order("priority asc, id asc").Find(&rules).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (s *RoutingService) GetEnabledRoutingRules() ([]*model.RoutingRule, error) {
+	db := database.GetDB()
+	var rules []*model.RoutingRule
+	err := db.Model(model.RoutingRule{}).Where("enable = ?", true).Order("priority asc, id asc").Find(&rules).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (s *RoutingService) GetRoutingRule(id int) (*model.RoutingRule, error) {
+	db := database.GetDB()
+	rule := &model.RoutingRule{}
+	err := db.Model(model.RoutingRule{}).First(rule, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (s *RoutingService) getMaxPriority() (int, error) {
+	db := database.GetDB()
+	var priority int
+	err := db.Model(model.RoutingRule{}).Select("coalesce(max(priority), 0)").Scan(&priority).Error
+	return priority, err
+}
+
+func (s *RoutingService) AddRoutingRule(rule *model.RoutingRule) error {
+	err := s.checkRoutingRule(rule)
+	if err != nil {
+		return err
+	}
+	if rule.Priority <= 0 {
+		priority, err := s.getMaxPriority()
+		if err != nil {
+			return err
+		}
+		rule.Priority = priority + 1
+	}
+	db := database.GetDB()
+	return db.Save(rule).Error
+}
+
+func (s *RoutingService) UpdateRoutingRule(rule *model.RoutingRule) error {
+	err := s.checkRoutingRule(rule)
+	if err != nil {
+		return err
+	}
+	oldRule, err := s.GetRoutingRule(rule.Id)
+	if err != nil {
+		return err
+	}
+	if rule.Priority <= 0 {
+		rule.Priority = oldRule.Priority
+	}
+	db := database.GetDB()
+	return db.Save(rule).Error
+}
+
+func (s *RoutingService) DelRoutingRule(id int) error {
+	db := database.GetDB()
+	return db.Delete(model.RoutingRule{}, id).Error
+}
+
+// SortRoutingRules 按给定的 id 顺序重新设置优先级
+func (s *RoutingService) SortRoutingRules(ids []int) (err error) {
+	db := database.GetDB()
+	tx := db.Begin()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			tx.Commit()
+		}
+	}()
+	for i, id := range ids {
+		err = tx.Model(model.RoutingRule{}).Where("id = ?", id).Update("priority", i+1).Error
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// GetGeoCategories 返回 geosite 或 geoip 文件中可用的分类
+func (s *RoutingService) GetGeoCategories(kind string) ([]string, error) {
+	switch kind {
+	case GeoSite:
+		return xray.GetGeoSiteCategories()
+	case GeoIP:
+		return xray.GetGeoIPCategories()
+	default:
+		return nil, common.NewError("unknown geo kind:", kind)
+	}
+}
+
+// ImportGeoRule 以 geosite/geoip 分类生成一条路由规则
+func (s *RoutingService) ImportGeoRule(kind string, categories []string, outboundTag string, balancerTag string) (*model.RoutingRule, error) {
+	if len(categories) == 0 {
+		return nil, common.NewError("请选择要导入的分类")
+	}
+	rule := &model.RoutingRule{
+		Enable:      true,
+		Remark:      kind + ":" + strings.Join(categories, ","),
+		OutboundTag: outboundTag,
+		BalancerTag: balancerTag,
+	}
+	values := make([]string, 0, len(categories))
+	for _, category := range categories {
+		category = strings.ToLower(strings.TrimSpace(category))
+		var err error
+		switch kind {
+		case GeoSite:
+			_, err = xray.LoadGeoSite(xray.GetGeositePath(), strings.SplitN(category, "@", 2)[0])
+		case GeoIP:
+			_, err = xray.LoadGeoIP(xray.GetGeoipPath(), strings.TrimPrefix(category, "!"))
+		default:
+			err = common.NewError("unknown geo kind:", kind)
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, kind+":"+category)
+	}
+	if kind == GeoSite {
+		rule.Domain = strings.Join(values, ",")
+	} else {
+		rule.Ip = strings.Join(values, ",")
+	}
+	err := s.AddRoutingRule(rule)
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (s *RoutingService) checkRoutingRule(rule *model.RoutingRule) error {
+	if rule.OutboundTag == "" && rule.BalancerTag == "" {
+		return common.NewError("出站标签和负载均衡标签不能同时为空")
+	}
+	if rule.OutboundTag != "" && rule.BalancerTag != "" {
+		return common.NewError("出站标签和负载均衡标签只能填写一个")
+	}
+	config := rule.GenXrayRuleConfig()
+	if len(config.Domain) == 0 && len(config.IP) == 0 && len(config.Port) == 0 && config.Network == "" &&
+		len(config.Protocol) == 0 && len(config.InboundTag) == 0 && len(config.User) == 0 {
+		return common.NewError("路由规则至少需要一个匹配条件")
+	}
+	for _, domain := range config.Domain {
+		if strings.HasPrefix(domain, "regexp:") {
+			_, err := regexp.Compile(strings.TrimPrefix(domain, "regexp:"))
+			if err != nil {
+				return common.NewError("domain regexp invalid:", err)
+			}
+		}
+	}
+	for _, ip := range config.IP {
+		if strings.HasPrefix(ip, "geoip:") || strings.HasPrefix(ip, "ext:") {
+			continue
+		}
+		if _, err := xray.MatchRule(&model.RuleConfig{IP: []string{ip}}, &xray.RouteTarget{IP: "127.0.0.1"}); err != nil {
+			return err
+		}
+	}
+	if config.Network != "" {
+		for _, network := range strings.Split(config.Network, ",") {
+			if network != "tcp" && network != "udp" {
+				return common.NewError("network must be tcp or udp:", network)
+			}
+		}
+	}
+	if rule.Port != "" {
+		err := xray.ValidatePortList(strings.Join(model.SplitList(rule.Port), ","))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -73,17 +73,31 @@ type ServerService struct {
 }
 
 func (s *ServerService) GetStatus(lastStatus *Status) *Status {
-	now := time.Now()
-	status := &Status{
-		T: now,
-	}
-
+	status := s.getStatusWithoutCpu(lastStatus)
 	percents, err := cpu.Percent(0, false)
 	if err != nil {
 		logger.Warning("get cpu percent failed:", err)
 	} else {
 		status.Cpu = percents[0]
 	}
+	return status
+}
+
+// GetStatusWithCpuSampler 与 GetStatus 相同，但 CPU 使用率由调用者自己的采样器计算，
+// 第一次采样时 CPU 使用率为 0，ok 为 false
+func (s *ServerService) GetStatusWithCpuSampler(lastStatus *Status, sampler *CpuSampler) (status *Status, ok bool) {
+	status = s.getStatusWithoutCpu(lastStatus)
+	status.Cpu, ok = sampler.Percent()
+	return status, ok
+}
+
+// getStatusWithoutCpu 获取除 CPU 使用率以外的状态。cpu.Percent(0) 计算的是与上一次调用之间的使用率，
+// 由所有调用者共享，指标接口等需要自己计算 CPU 使用率的调用者使用这个方法
+func (s *ServerService) getStatusWithoutCpu(lastStatus *Status) *Status {
+	now := time.Now()
+	status := &Status{
+		T: now,
+	}
 
 	upTime, err := host.Uptime()
 	if err != nil {
@@ -299,3 +313,45 @@ func (s *ServerService) UpdateXray(version string) error {
 	return nil
 
 }
+
+// CpuSampler 按两次采样之间的 CPU 时间计算使用率，每个调用者持有自己的采样器，互不影响
+type CpuSampler struct {
+	last *cpu.TimesStat
+}
+
+// Percent 返回与上一次采样之间的 CPU 使用率，第一次采样或获取失败时 ok 为 false
+func (c *CpuSampler) Percent() (percent float64, ok bool) {
+	times, err := cpu.Times(false)
+	if err != nil || len(times) == 0 {
+		logger.Warning("get cpu times failed:", err)
+		return 0, false
+	}
+	current := times[0]
+	last := c.last
+	c.last = &current
+	if last == nil {
+		return 0, false
+	}
+	return cpuPercentBetween(last, &current), true
+}
+
+func cpuPercentBetween(last *cpu.TimesStat, current *cpu.TimesStat) float64 {
+	busy := func(t *cpu.TimesStat) float64 {
+		return t.User + t.System + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal
+	}
+	total := func(t *cpu.TimesStat) float64 {
+		return busy(t) + t.Idle
+	}
+	totalDelta := total(current) - total(last)
+	if totalDelta <= 0 {
+		return 0
+	}
+	percent := (busy(current) - busy(last)) / totalDelta * 100
+	if percent < 0 {
+		return 0
+	}
+	if percent > 100 {
+		return 100
+	}
+	return percent
+}
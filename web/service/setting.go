@@ -1,121 +1,90 @@
 package service
 
 import (
-	_ "embed"
-	"errors"
-	"fmt"
-	"reflect"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"x-ui/config"
 	"x-ui/database"
 	"x-ui/database/model"
 	"x-ui/logger"
 	"x-ui/util/common"
-	"x-ui/util/random"
-	"x-ui/util/reflect_util"
+	"x-ui/util/seal"
 	"x-ui/web/entity"
-)
 
-//go:embed config.json
-var xrayTemplateConfig string
+	"gorm.io/gorm"
+)
 
-var defaultValueMap = map[string]string{
-	"xrayTemplateConfig": xrayTemplateConfig,
-	"webListen":          "",
-	"webPort":            "54321",
-	"webCertFile":        "",
-	"webKeyFile":         "",
-	"secret":             random.Seq(32),
-	"webBasePath":        "/",
-	"timeLocation":       "Asia/Shanghai",
-	"tgBotEnable":        "false",
-	"tgBotToken":         "",
-	"tgBotChatId":        "0",
-	"tgRunTime":          "",
-}
+// 生成设置默认值时加锁，保证只保存一个值
+var generateSettingLock sync.Mutex
 
 type SettingService struct {
 }
 
-func (s *SettingService) GetAllSetting() (*entity.AllSetting, error) {
+// GetAllSetting 按设置项定义读取所有可修改的设置，没有保存过的使用默认值。
+// 数据库中未定义的设置项会被忽略并记录警告
+func (s *SettingService) GetAllSetting() (entity.AllSetting, error) {
 	db := database.GetDB()
 	settings := make([]*model.Setting, 0)
 	err := db.Model(model.Setting{}).Find(&settings).Error
 	if err != nil {
 		return nil, err
 	}
-	allSetting := &entity.AllSetting{}
-	t := reflect.TypeOf(allSetting).Elem()
-	v := reflect.ValueOf(allSetting).Elem()
-	fields := reflect_util.GetFields(t)
-
-	setSetting := func(key, value string) (err error) {
-		defer func() {
-			panicErr := recover()
-			if panicErr != nil {
-				err = errors.New(fmt.Sprint(panicErr))
-			}
-		}()
-
-		var found bool
-		var field reflect.StructField
-		for _, f := range fields {
-			if f.Tag.Get("json") == key {
-				field = f
-				found = true
-				break
-			}
+	allSetting := entity.AllSetting{}
+	for _, setting := range settings {
+		def, ok := settingDefMap[setting.Key]
+		if !ok {
+			logger.Warningf("unknown setting <%v> in database, ignored", setting.Key)
+			continue
 		}
-
-		if !found {
-			// 有些设置自动生成，不需要返回到前端给用户修改
-			return nil
+		if def.Internal {
+			continue
 		}
-
-		fieldV := v.FieldByName(field.Name)
-		switch t := fieldV.Interface().(type) {
-		case int:
-			n, err := strconv.ParseInt(value, 10, 64)
-			if err != nil {
-				return err
-			}
-			fieldV.SetInt(n)
-		case string:
-			fieldV.SetString(value)
-		case bool:
-			fieldV.SetBool(value == "true")
-		default:
-			return common.NewErrorf("unknown field %v type %v", key, t)
+		value, err := s.decryptSetting(setting.Key, setting.Value)
+		if err != nil {
+			return nil, err
 		}
-		return
-	}
-
-	keyMap := map[string]bool{}
-	for _, setting := range settings {
-		err := setSetting(setting.Key, setting.Value)
+		allSetting[def.Key], err = def.Parse(value)
 		if err != nil {
 			return nil, err
 		}
-		keyMap[setting.Key] = true
 	}
-
-	for key, value := range defaultValueMap {
-		if keyMap[key] {
+	for _, def := range GetSettingDefs() {
+		if _, ok := allSetting[def.Key]; ok {
 			continue
 		}
-		err := setSetting(key, value)
+		allSetting[def.Key], err = def.Parse(def.Default)
 		if err != nil {
 			return nil, err
 		}
 	}
-
 	return allSetting, nil
 }
 
+// ResetSettings 删除所有设置恢复默认值，可修改的设置记录到历史中
 func (s *SettingService) ResetSettings() error {
+	allSetting, err := s.GetAllSetting()
+	if err != nil {
+		return err
+	}
+	changes := make([]*model.SettingChange, 0)
+	for _, def := range GetSettingDefs() {
+		value := def.Format(allSetting[def.Key])
+		if value != def.Default {
+			changes = append(changes, &model.SettingChange{Key: def.Key, OldValue: value, NewValue: def.Default})
+		}
+	}
 	db := database.GetDB()
-	return db.Where("1 = 1").Delete(model.Setting{}).Error
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("1 = 1").Delete(model.Setting{}).Error
+		if err != nil {
+			return err
+		}
+		return s.addVersion(tx, &model.SettingVersion{Source: model.SettingSourceReset}, changes)
+	})
 }
 
 func (s *SettingService) getSetting(key string) (*model.Setting, error) {
@@ -128,11 +97,30 @@ func (s *SettingService) getSetting(key string) (*model.Setting, error) {
 	return setting, nil
 }
 
+// decryptSetting 解密加密保存的设置项，加密前写入的明文原样返回
+func (s *SettingService) decryptSetting(key string, value string) (string, error) {
+	if !model.IsSecretSetting(key) {
+		return value, nil
+	}
+	return seal.Decrypt(value)
+}
+
 func (s *SettingService) saveSetting(key string, value string) error {
-	setting, err := s.getSetting(key)
-	db := database.GetDB()
+	return s.saveSettingTx(database.GetDB(), key, value)
+}
+
+func (s *SettingService) saveSettingTx(tx *gorm.DB, key string, value string) error {
+	if model.IsSecretSetting(key) {
+		var err error
+		value, err = seal.Encrypt(value)
+		if err != nil {
+			return err
+		}
+	}
+	setting := &model.Setting{}
+	err := tx.Model(model.Setting{}).Where("key = ?", key).First(setting).Error
 	if database.IsNotFound(err) {
-		return db.Create(&model.Setting{
+		return tx.Create(&model.Setting{
 			Key:   key,
 			Value: value,
 		}).Error
@@ -141,25 +129,122 @@ func (s *SettingService) saveSetting(key string, value string) error {
 	}
 	setting.Key = key
 	setting.Value = value
-	return db.Save(setting).Error
+	return tx.Save(setting).Error
+}
+
+// saveChanges 在同一事务中保存修改的设置并记录为一个历史版本，没有修改时返回 nil
+func (s *SettingService) saveChanges(version *model.SettingVersion, changes []*model.SettingChange) (*model.SettingVersion, error) {
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	db := database.GetDB()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return s.saveChangesTx(tx, version, changes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// saveChangesTx 在调用方的事务中保存修改并记录版本
+func (s *SettingService) saveChangesTx(tx *gorm.DB, version *model.SettingVersion, changes []*model.SettingChange) error {
+	for _, change := range changes {
+		err := s.saveSettingTx(tx, change.Key, change.NewValue)
+		if err != nil {
+			return err
+		}
+	}
+	return s.addVersion(tx, version, changes)
+}
+
+func (s *SettingService) addVersion(tx *gorm.DB, version *model.SettingVersion, changes []*model.SettingChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	if version.Username == "" && version.UserId > 0 {
+		user := &model.User{}
+		err := tx.Model(model.User{}).Where("id = ?", version.UserId).First(user).Error
+		if err == nil {
+			version.Username = user.Username
+		}
+	}
+	version.CreatedAt = time.Now().Unix()
+	err := tx.Create(version).Error
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		change.VersionId = version.Id
+	}
+	err = tx.Create(changes).Error
+	if err != nil {
+		return err
+	}
+	version.Changes = changes
+	return nil
 }
 
 func (s *SettingService) getString(key string) (string, error) {
+	def, err := getSettingDef(key)
+	if err != nil {
+		return "", err
+	}
 	setting, err := s.getSetting(key)
 	if database.IsNotFound(err) {
-		value, ok := defaultValueMap[key]
-		if !ok {
-			return "", common.NewErrorf("key <%v> not in defaultValueMap", key)
+		if def.generate == nil {
+			return def.Default, nil
 		}
-		return value, nil
+		return s.generateSetting(def)
 	} else if err != nil {
 		return "", err
 	}
-	return setting.Value, nil
+	return s.decryptSetting(key, setting.Value)
+}
+
+// generateSetting 生成并保存设置的默认值，否则每次启动都会不同。
+// 加锁后重新读取，避免并发的首次读取保存不同的值
+func (s *SettingService) generateSetting(def *SettingDef) (string, error) {
+	generateSettingLock.Lock()
+	defer generateSettingLock.Unlock()
+	setting, err := s.getSetting(def.Key)
+	if err == nil {
+		return s.decryptSetting(def.Key, setting.Value)
+	} else if !database.IsNotFound(err) {
+		return "", err
+	}
+	value, err := def.generate()
+	if err != nil {
+		return "", err
+	}
+	err = s.saveSetting(def.Key, value)
+	if err != nil {
+		return "", err
+	}
+	return value, nil
 }
 
 func (s *SettingService) setString(key string, value string) error {
-	return s.saveSetting(key, value)
+	def, err := getSettingDef(key)
+	if err != nil {
+		return err
+	}
+	_, err = def.Parse(value)
+	if err != nil {
+		return err
+	}
+	// setString 只用于命令行修改设置
+	oldValue, err := s.getString(key)
+	if err != nil {
+		return err
+	}
+	if oldValue == value {
+		return nil
+	}
+	_, err = s.saveChanges(&model.SettingVersion{Source: model.SettingSourceCli}, []*model.SettingChange{
+		{Key: key, OldValue: oldValue, NewValue: value},
+	})
+	return err
 }
 
 func (s *SettingService) getBool(key string) (bool, error) {
@@ -218,6 +303,90 @@ func (s *SettingService) GetTgbotenabled() (bool, error) {
 	return s.getBool("tgBotEnable")
 }
 
+// GetTgBotAdminChatIds 返回允许向机器人发送管理命令的 chat id，始终包含通知使用的 chat id
+func (s *SettingService) GetTgBotAdminChatIds() ([]int64, error) {
+	chatId, err := s.GetTgBotChatId()
+	if err != nil {
+		return nil, err
+	}
+	str, err := s.getString("tgBotAdminChatIds")
+	if err != nil {
+		return nil, err
+	}
+	chatIds, err := common.ParseChatIds(str)
+	if err != nil {
+		return nil, err
+	}
+	if chatId != 0 {
+		chatIds = append(chatIds, int64(chatId))
+	}
+	return chatIds, nil
+}
+
+// GetTgBindWarnPercents 返回向绑定用户发送流量提醒的百分比，从小到大排列
+func (s *SettingService) GetTgBindWarnPercents() ([]int, error) {
+	str, err := s.getString("tgBindWarnPercents")
+	if err != nil {
+		return nil, err
+	}
+	percents, err := common.ParseInts(str)
+	if err != nil {
+		return nil, err
+	}
+	sort.Ints(percents)
+	return percents, nil
+}
+
+func (s *SettingService) GetTgBindWarnDays() (int, error) {
+	return s.getInt("tgBindWarnDays")
+}
+
+// GetNotifyLanguage 返回通知消息使用的语言，如 zh-Hans、zh-Hant、en-US
+func (s *SettingService) GetNotifyLanguage() (string, error) {
+	return s.getString("notifyLanguage")
+}
+
+func (s *SettingService) GetBackupEnable() (bool, error) {
+	return s.getBool("backupEnable")
+}
+
+func (s *SettingService) GetBackupCron() (string, error) {
+	return s.getString("backupCron")
+}
+
+// GetBackupDir 返回定时备份目录，未设置时使用数据库所在目录下的 backup 目录
+func (s *SettingService) GetBackupDir() (string, error) {
+	dir, err := s.getString("backupDir")
+	if err != nil {
+		return "", err
+	}
+	if dir == "" {
+		dir = filepath.Join(filepath.Dir(config.GetDBPath()), "backup")
+	}
+	return dir, nil
+}
+
+// LoadPathSettings 将数据库中设置的路径加载到 config，命令行参数和环境变量优先
+func (s *SettingService) LoadPathSettings() error {
+	for name, key := range config.GetPathSettingKeys() {
+		value, err := s.getString(key)
+		if err != nil {
+			return err
+		}
+		config.SetPathDBValue(name, value)
+	}
+	return nil
+}
+
+// GetBackupKeep 返回定时备份保留的份数
+func (s *SettingService) GetBackupKeep() (int, error) {
+	return s.getInt("backupKeep")
+}
+
+func (s *SettingService) GetBackupTelegram() (bool, error) {
+	return s.getBool("backupTelegram")
+}
+
 func (s *SettingService) SetTgbotRuntime(time string) error {
 	return s.setString("tgRunTime", time)
 }
@@ -226,6 +395,22 @@ func (s *SettingService) GetTgbotRuntime() (string, error) {
 	return s.getString("tgRunTime")
 }
 
+func (s *SettingService) GetForwardProbeTarget() (string, error) {
+	return s.getString("forwardProbeTarget")
+}
+
+func (s *SettingService) GetMetricsEnable() (bool, error) {
+	return s.getBool("metricsEnable")
+}
+
+func (s *SettingService) GetMetricsListen() (string, error) {
+	return s.getString("metricsListen")
+}
+
+func (s *SettingService) GetMetricsToken() (string, error) {
+	return s.getString("metricsToken")
+}
+
 func (s *SettingService) GetPort() (int, error) {
 	return s.getInt("webPort")
 }
@@ -244,12 +429,6 @@ func (s *SettingService) GetKeyFile() (string, error) {
 
 func (s *SettingService) GetSecret() ([]byte, error) {
 	secret, err := s.getString("secret")
-	if secret == defaultValueMap["secret"] {
-		err := s.saveSetting("secret", secret)
-		if err != nil {
-			logger.Warning("save secret failed:", err)
-		}
-	}
 	return []byte(secret), err
 }
 
@@ -274,30 +453,49 @@ func (s *SettingService) GetTimeLocation() (*time.Location, error) {
 	}
 	location, err := time.LoadLocation(l)
 	if err != nil {
-		defaultLocation := defaultValueMap["timeLocation"]
+		defaultLocation := settingDefMap["timeLocation"].Default
 		logger.Errorf("location <%v> not exist, using default location: %v", l, defaultLocation)
 		return time.LoadLocation(defaultLocation)
 	}
 	return location, nil
 }
 
-func (s *SettingService) UpdateAllSetting(allSetting *entity.AllSetting) error {
-	if err := allSetting.CheckValid(); err != nil {
-		return err
+// UpdateAllSetting 校验并保存所有设置，敏感设置提交掩码时保持原值。
+// 有修改时记录为一个历史版本并返回，version 填写修改者和来源
+func (s *SettingService) UpdateAllSetting(allSetting entity.AllSetting, version *model.SettingVersion) (*model.SettingVersion, error) {
+	changes, err := s.getSettingChanges(allSetting)
+	if err != nil {
+		return nil, err
 	}
+	return s.saveChanges(version, changes)
+}
 
-	v := reflect.ValueOf(allSetting).Elem()
-	t := reflect.TypeOf(allSetting).Elem()
-	fields := reflect_util.GetFields(t)
-	errs := make([]error, 0)
-	for _, field := range fields {
-		key := field.Tag.Get("json")
-		fieldV := v.FieldByName(field.Name)
-		value := fmt.Sprint(fieldV.Interface())
-		err := s.saveSetting(key, value)
-		if err != nil {
-			errs = append(errs, err)
+// getSettingChanges 校验提交的所有设置，返回与当前设置不同的设置项
+func (s *SettingService) getSettingChanges(allSetting entity.AllSetting) ([]*model.SettingChange, error) {
+	for _, def := range settingDefs {
+		if def.Sensitive && allSetting[def.Key] == model.SecretMask {
+			value, err := s.getString(def.Key)
+			if err != nil {
+				return nil, err
+			}
+			allSetting[def.Key] = value
+		}
+	}
+	if err := CheckAllSetting(allSetting); err != nil {
+		return nil, err
+	}
+
+	current, err := s.GetAllSetting()
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]*model.SettingChange, 0)
+	for _, def := range GetSettingDefs() {
+		oldValue := def.Format(current[def.Key])
+		newValue := def.Format(allSetting[def.Key])
+		if oldValue != newValue {
+			changes = append(changes, &model.SettingChange{Key: def.Key, OldValue: oldValue, NewValue: newValue})
 		}
 	}
-	return common.Combine(errs...)
+	return changes, nil
 }
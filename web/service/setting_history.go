@@ -0,0 +1,140 @@
+package service
+
+import (
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/json_util"
+)
+
+// 设置历史接口每次返回的最大版本数
+const settingHistoryLimit = 100
+
+func (s *SettingService) getChanges(versionIds []int) (map[int][]*model.SettingChange, error) {
+	db := database.GetDB()
+	changes := make([]*model.SettingChange, 0)
+	err := db.Model(model.SettingChange{}).Where("version_id in ?", versionIds).Order("id").Find(&changes).Error
+	if err != nil {
+		return nil, err
+	}
+	changeMap := map[int][]*model.SettingChange{}
+	for _, change := range changes {
+		changeMap[change.VersionId] = append(changeMap[change.VersionId], change)
+	}
+	return changeMap, nil
+}
+
+// GetSettingHistory 返回最近的设置历史，新版本在前。敏感设置使用掩码，
+// xray 配置模板只返回按 JSON 结构比较的差异
+func (s *SettingService) GetSettingHistory() ([]*model.SettingVersion, error) {
+	db := database.GetDB()
+	versions := make([]*model.SettingVersion, 0)
+	err := db.Model(model.SettingVersion{}).Order("id desc").Limit(settingHistoryLimit).Find(&versions).Error
+	if err != nil {
+		return nil, err
+	}
+	versionIds := make([]int, 0, len(versions))
+	for _, version := range versions {
+		versionIds = append(versionIds, version.Id)
+	}
+	changeMap, err := s.getChanges(versionIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range versions {
+		version.Changes = changeMap[version.Id]
+		for _, change := range version.Changes {
+			maskSettingChange(change)
+		}
+	}
+	return versions, nil
+}
+
+func maskSettingChange(change *model.SettingChange) {
+	if model.IsSecretSetting(change.Key) {
+		if change.OldValue != "" {
+			change.OldValue = model.SecretMask
+		}
+		if change.NewValue != "" {
+			change.NewValue = model.SecretMask
+		}
+		return
+	}
+	if change.Key != "xrayTemplateConfig" {
+		return
+	}
+	diff, err := json_util.Diff([]byte(change.OldValue), []byte(change.NewValue))
+	if err != nil {
+		// 无法解析时原样返回完整内容
+		return
+	}
+	change.Diff = diff
+	change.OldValue = ""
+	change.NewValue = ""
+}
+
+// getSettingsAt 返回某个版本保存后的所有可修改设置：
+// 从当前设置开始，按从新到旧的顺序撤销该版本之后的所有修改
+func (s *SettingService) getSettingsAt(versionId int) (map[string]interface{}, error) {
+	current, err := s.GetAllSetting()
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	for _, def := range GetSettingDefs() {
+		values[def.Key] = def.Format(current[def.Key])
+	}
+
+	db := database.GetDB()
+	changes := make([]*model.SettingChange, 0)
+	err = db.Model(model.SettingChange{}).Where("version_id > ?", versionId).Order("id desc").Find(&changes).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		// 已经不再使用的设置项和内部设置不回滚
+		if _, ok := values[change.Key]; ok {
+			values[change.Key] = change.OldValue
+		}
+	}
+	return values, nil
+}
+
+// RevertSettings 将设置回滚到某个版本保存后的状态，与修改设置一样经过校验，
+// 并记录为新的版本。返回需要重启面板才能生效的设置项
+func (s *SettingService) RevertSettings(versionId int, userId int) ([]string, error) {
+	db := database.GetDB()
+	target := &model.SettingVersion{}
+	err := db.Model(model.SettingVersion{}).Where("id = ?", versionId).First(target).Error
+	if database.IsNotFound(err) {
+		return nil, common.NewError("设置版本不存在:", versionId)
+	} else if err != nil {
+		return nil, err
+	}
+	values, err := s.getSettingsAt(versionId)
+	if err != nil {
+		return nil, err
+	}
+	allSetting, err := ParseAllSetting(values)
+	if err != nil {
+		return nil, err
+	}
+	version, err := s.UpdateAllSetting(allSetting, &model.SettingVersion{
+		UserId:   userId,
+		Source:   model.SettingSourceRevert,
+		RevertTo: versionId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	restartKeys := make([]string, 0)
+	if version == nil {
+		return restartKeys, nil
+	}
+	for _, change := range version.Changes {
+		if settingDefMap[change.Key].RequiresRestart {
+			restartKeys = append(restartKeys, change.Key)
+		}
+	}
+	return restartKeys, nil
+}
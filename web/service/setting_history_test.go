@@ -0,0 +1,128 @@
+package service
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"x-ui/database/model"
+)
+
+func updateTestSettings(t *testing.T, service *SettingService, values map[string]interface{}) *model.SettingVersion {
+	t.Helper()
+	allSetting, err := service.GetAllSetting()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range values {
+		allSetting[key] = value
+	}
+	version, err := service.UpdateAllSetting(allSetting, &model.SettingVersion{UserId: 1, Source: model.SettingSourceWeb})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version == nil {
+		t.Fatalf("update %v saved no version", values)
+	}
+	return version
+}
+
+func TestGetSettingsAt(t *testing.T) {
+	initTestDB(t)
+	service := &SettingService{}
+	v1 := updateTestSettings(t, service, map[string]interface{}{"webPort": 12345, "backupKeep": 10})
+	v2 := updateTestSettings(t, service, map[string]interface{}{"backupKeep": 20, "tgBindWarnDays": 5})
+	v3 := updateTestSettings(t, service, map[string]interface{}{"webPort": 23456})
+
+	for _, c := range []struct {
+		version *model.SettingVersion
+		want    map[string]string
+	}{
+		{v1, map[string]string{"webPort": "12345", "backupKeep": "10", "tgBindWarnDays": "3"}},
+		{v2, map[string]string{"webPort": "12345", "backupKeep": "20", "tgBindWarnDays": "5"}},
+		{v3, map[string]string{"webPort": "23456", "backupKeep": "20", "tgBindWarnDays": "5"}},
+	} {
+		values, err := service.getSettingsAt(c.version.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, want := range c.want {
+			if values[key] != want {
+				t.Errorf("version %v %v = %v, want %v", c.version.Id, key, values[key], want)
+			}
+		}
+		// 内部设置不参与回滚
+		if _, ok := values["secret"]; ok {
+			t.Errorf("version %v contains internal setting secret", c.version.Id)
+		}
+	}
+}
+
+func TestRevertSettings(t *testing.T) {
+	initTestDB(t)
+	service := &SettingService{}
+	v1 := updateTestSettings(t, service, map[string]interface{}{"webPort": 12345})
+	updateTestSettings(t, service, map[string]interface{}{"backupKeep": 20, "metricsToken": "token"})
+	v3 := updateTestSettings(t, service, map[string]interface{}{"webPort": 23456, "tgBindWarnDays": 5})
+
+	restartKeys, err := service.RevertSettings(v1.Id, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// backupKeep 和 tgBindWarnDays 立即生效，端口和指标令牌需要重启
+	sort.Strings(restartKeys)
+	if want := []string{"metricsToken", "webPort"}; !reflect.DeepEqual(restartKeys, want) {
+		t.Errorf("restart keys = %v, want %v", restartKeys, want)
+	}
+	allSetting, err := service.GetAllSetting()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]interface{}{"webPort": 12345, "backupKeep": 7, "tgBindWarnDays": 3, "metricsToken": ""} {
+		if allSetting[key] != want {
+			t.Errorf("%v after revert = %v, want %v", key, allSetting[key], want)
+		}
+	}
+
+	// 回滚记录为新的版本，可以再回滚到回滚之前的状态
+	history, err := service.GetSettingHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history[0].Source != model.SettingSourceRevert || history[0].RevertTo != v1.Id {
+		t.Errorf("latest version = %+v, want revert to %v", history[0], v1.Id)
+	}
+	for _, change := range history[0].Changes {
+		if change.Key == "metricsToken" && change.OldValue != model.SecretMask {
+			t.Errorf("metricsToken change is not masked: %+v", change)
+		}
+	}
+	restartKeys, err = service.RevertSettings(v3.Id, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(restartKeys)
+	if want := []string{"metricsToken", "webPort"}; !reflect.DeepEqual(restartKeys, want) {
+		t.Errorf("restart keys = %v, want %v", restartKeys, want)
+	}
+	token, err := service.GetMetricsToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "token" {
+		t.Errorf("metricsToken after reverting back = %q, want %q", token, "token")
+	}
+
+	// 回滚到当前状态时没有修改
+	restartKeys, err = service.RevertSettings(v3.Id, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restartKeys) != 0 {
+		t.Errorf("restart keys without changes = %v, want none", restartKeys)
+	}
+
+	_, err = service.RevertSettings(10000, 1)
+	if err == nil {
+		t.Error("revert to an unknown version succeeded")
+	}
+}
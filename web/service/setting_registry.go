@@ -0,0 +1,434 @@
+package service
+
+import (
+	"crypto/tls"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/random"
+	"x-ui/web/entity"
+	"x-ui/xray"
+
+	"github.com/robfig/cron/v3"
+	"golang.org/x/text/language"
+)
+
+// 设置项的值类型
+type SettingType string
+
+const (
+	SettingTypeString SettingType = "string"
+	SettingTypeInt    SettingType = "int"
+	SettingTypeBool   SettingType = "bool"
+)
+
+// SettingDef 设置项定义，决定默认值、校验、接口序列化和前端展示
+type SettingDef struct {
+	Key  string      `json:"key"`
+	Type SettingType `json:"type"`
+	// Default 默认值，以数据库中保存的字符串形式表示
+	Default string `json:"default"`
+	// Sensitive 接口返回时使用掩码代替，需与 model 中加密保存的设置项一致
+	Sensitive bool `json:"sensitive"`
+	// RequiresRestart 修改后需要重启面板才能生效
+	RequiresRestart bool `json:"requiresRestart"`
+	// Internal 内部使用的设置，不通过设置接口读写
+	Internal bool `json:"-"`
+
+	// generate 没有保存过时生成默认值，生成后立即保存，保证多次启动使用同一个值
+	generate func() (string, error)
+	validate func(value interface{}) error
+}
+
+// Parse 将数据库或表单中的字符串解析为对应类型的值
+func (d *SettingDef) Parse(str string) (interface{}, error) {
+	switch d.Type {
+	case SettingTypeInt:
+		n, err := strconv.Atoi(strings.TrimSpace(str))
+		if err != nil {
+			return nil, common.NewErrorf("设置项 %v 不是整数: %v", d.Key, str)
+		}
+		return n, nil
+	case SettingTypeBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(str))
+		if err != nil {
+			return nil, common.NewErrorf("设置项 %v 不是布尔值: %v", d.Key, str)
+		}
+		return b, nil
+	default:
+		return str, nil
+	}
+}
+
+// Format 将值转换为数据库中保存的字符串
+func (d *SettingDef) Format(value interface{}) string {
+	return fmt.Sprint(value)
+}
+
+// check 检查值的类型并执行设置项自身的校验
+func (d *SettingDef) check(value interface{}) error {
+	var ok bool
+	switch d.Type {
+	case SettingTypeInt:
+		_, ok = value.(int)
+	case SettingTypeBool:
+		_, ok = value.(bool)
+	default:
+		_, ok = value.(string)
+	}
+	if !ok {
+		return common.NewErrorf("设置项 %v 的类型应为 %v", d.Key, d.Type)
+	}
+	if d.validate == nil {
+		return nil
+	}
+	return d.validate(value)
+}
+
+func validateString(f func(string) error) func(interface{}) error {
+	return func(value interface{}) error {
+		return f(value.(string))
+	}
+}
+
+func validateInt(f func(int) error) func(interface{}) error {
+	return func(value interface{}) error {
+		return f(value.(int))
+	}
+}
+
+//go:embed config.json
+var xrayTemplateConfig string
+
+var settingDefs = []*SettingDef{
+	{
+		Key: "xrayTemplateConfig", Type: SettingTypeString, Default: xrayTemplateConfig, RequiresRestart: true,
+		validate: validateString(func(v string) error {
+			xrayConfig := &xray.Config{}
+			err := json.Unmarshal([]byte(v), xrayConfig)
+			if err != nil {
+				return common.NewError("xray template config invalid:", err)
+			}
+			return nil
+		}),
+	},
+	{
+		Key: "webListen", Type: SettingTypeString, RequiresRestart: true,
+		validate: validateString(func(v string) error {
+			if v != "" && net.ParseIP(v) == nil {
+				return common.NewError("web listen is not valid ip:", v)
+			}
+			return nil
+		}),
+	},
+	{
+		Key: "webPort", Type: SettingTypeInt, Default: "54321", RequiresRestart: true,
+		validate: validateInt(func(v int) error {
+			if v <= 0 || v > 65535 {
+				return common.NewError("web port is not a valid port:", v)
+			}
+			return nil
+		}),
+	},
+	{Key: "webCertFile", Type: SettingTypeString, RequiresRestart: true},
+	{Key: "webKeyFile", Type: SettingTypeString, RequiresRestart: true},
+	{Key: "secret", Type: SettingTypeString, Sensitive: true, Internal: true, generate: func() (string, error) { return random.SecureSeq(64) }},
+	{Key: "webBasePath", Type: SettingTypeString, Default: "/", RequiresRestart: true},
+	{
+		Key: "timeLocation", Type: SettingTypeString, Default: "Asia/Shanghai", RequiresRestart: true,
+		validate: validateString(func(v string) error {
+			_, err := time.LoadLocation(v)
+			if err != nil {
+				return common.NewError("time location not exist:", v)
+			}
+			return nil
+		}),
+	},
+	{Key: "tgBotEnable", Type: SettingTypeBool, Default: "false", RequiresRestart: true},
+	{Key: "tgBotToken", Type: SettingTypeString, Sensitive: true, RequiresRestart: true},
+	{Key: "tgBotChatId", Type: SettingTypeInt, Default: "0", RequiresRestart: true},
+	{Key: "tgRunTime", Type: SettingTypeString, RequiresRestart: true},
+	{
+		Key: "tgBotAdminChatIds", Type: SettingTypeString, RequiresRestart: true,
+		validate: validateString(func(v string) error {
+			_, err := common.ParseChatIds(v)
+			if err != nil {
+				return common.NewError("tg bot admin chat ids invalid:", err)
+			}
+			return nil
+		}),
+	},
+	{
+		Key: "tgBindWarnPercents", Type: SettingTypeString, Default: "80,95",
+		validate: validateString(func(v string) error {
+			percents, err := common.ParseInts(v)
+			if err != nil {
+				return common.NewError("tg bind warn percents invalid:", err)
+			}
+			for _, percent := range percents {
+				if percent <= 0 || percent > 100 {
+					return common.NewError("tg bind warn percent must be in (0, 100]:", percent)
+				}
+			}
+			return nil
+		}),
+	},
+	{
+		Key: "tgBindWarnDays", Type: SettingTypeInt, Default: "3",
+		validate: validateInt(func(v int) error {
+			if v < 0 {
+				return common.NewError("tg bind warn days can not be negative:", v)
+			}
+			return nil
+		}),
+	},
+	{
+		Key: "notifyLanguage", Type: SettingTypeString, Default: "zh-Hans",
+		validate: validateString(func(v string) error {
+			_, err := language.Parse(v)
+			if err != nil {
+				return common.NewError("notify language invalid:", v)
+			}
+			return nil
+		}),
+	},
+	{Key: "backupEnable", Type: SettingTypeBool, Default: "false", RequiresRestart: true},
+	{Key: "backupCron", Type: SettingTypeString, Default: "0 0 4 * * *", RequiresRestart: true},
+	{Key: "backupDir", Type: SettingTypeString},
+	{Key: "backupKeep", Type: SettingTypeInt, Default: "7"},
+	{Key: "backupTelegram", Type: SettingTypeBool, Default: "false"},
+	{
+		Key: "forwardProbeTarget", Type: SettingTypeString, Default: "http://api.ipify.org",
+		validate: validateString(func(v string) error {
+			if v == "" {
+				return nil
+			}
+			u, err := url.Parse(v)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return common.NewError("forward probe target is not a valid http url:", v)
+			}
+			return nil
+		}),
+	},
+	{Key: "metricsEnable", Type: SettingTypeBool, Default: "false", RequiresRestart: true},
+	{
+		Key: "metricsListen", Type: SettingTypeString, RequiresRestart: true,
+		validate: validateString(func(v string) error {
+			if v == "" {
+				return nil
+			}
+			_, _, err := net.SplitHostPort(v)
+			if err != nil {
+				return common.NewError("metrics listen is not a valid address:", v)
+			}
+			return nil
+		}),
+	},
+	{Key: "metricsToken", Type: SettingTypeString, Sensitive: true, RequiresRestart: true},
+	{Key: "acmeEnable", Type: SettingTypeBool, Default: "false", RequiresRestart: true},
+	{Key: "acmeDomains", Type: SettingTypeString, RequiresRestart: true},
+	{Key: "acmeEmail", Type: SettingTypeString, RequiresRestart: true},
+	{
+		Key: "acmeDirectory", Type: SettingTypeString, Default: "https://acme-v02.api.letsencrypt.org/directory", RequiresRestart: true,
+		validate: validateString(func(v string) error {
+			u, err := url.Parse(v)
+			if err != nil || u.Scheme != "https" || u.Host == "" {
+				return common.NewError("acme directory is not a valid https url:", v)
+			}
+			return nil
+		}),
+	},
+	{
+		Key: "acmeChallenge", Type: SettingTypeString, Default: AcmeChallengeHttp01, RequiresRestart: true,
+		validate: validateString(func(v string) error {
+			if v != AcmeChallengeHttp01 && v != AcmeChallengeTlsAlpn01 {
+				return common.NewError("unsupported acme challenge:", v)
+			}
+			return nil
+		}),
+	},
+	{
+		Key: "acmeHttpListen", Type: SettingTypeString, Default: ":80", RequiresRestart: true,
+		validate: validateString(func(v string) error {
+			_, _, err := net.SplitHostPort(v)
+			if err != nil {
+				return common.NewError("acme http listen is not a valid address:", v)
+			}
+			return nil
+		}),
+	},
+	{Key: "acmeCaFile", Type: SettingTypeString, RequiresRestart: true},
+	{Key: "binDir", Type: SettingTypeString, RequiresRestart: true},
+	{Key: "xrayConfigPath", Type: SettingTypeString, RequiresRestart: true},
+	{Key: "logDir", Type: SettingTypeString, RequiresRestart: true},
+}
+
+var settingDefMap = map[string]*SettingDef{}
+
+func init() {
+	for _, def := range settingDefs {
+		if _, ok := settingDefMap[def.Key]; ok {
+			panic("duplicate setting key: " + def.Key)
+		}
+		// 敏感设置必须加密保存，否则数据库备份会泄露明文
+		if def.Sensitive != model.IsSecretSetting(def.Key) {
+			panic("setting sensitivity does not match secret setting keys: " + def.Key)
+		}
+		if def.generate == nil {
+			_, err := def.Parse(def.Default)
+			if err != nil {
+				panic(err)
+			}
+		}
+		settingDefMap[def.Key] = def
+	}
+}
+
+func getSettingDef(key string) (*SettingDef, error) {
+	def, ok := settingDefMap[key]
+	if !ok {
+		return nil, common.NewErrorf("未知的设置项 <%v>", key)
+	}
+	return def, nil
+}
+
+// GetSettingDefs 返回可以通过设置接口修改的设置项定义
+func GetSettingDefs() []*SettingDef {
+	defs := make([]*SettingDef, 0, len(settingDefs))
+	for _, def := range settingDefs {
+		if !def.Internal {
+			defs = append(defs, def)
+		}
+	}
+	return defs
+}
+
+// ParseAllSetting 按设置项定义解析提交的设置，所有设置项都必须提交，不允许未知的设置项。
+// 值可以是表单中的字符串，也可以是 JSON 解码得到的数字和布尔值
+func ParseAllSetting(values map[string]interface{}) (entity.AllSetting, error) {
+	for key := range values {
+		def, err := getSettingDef(key)
+		if err != nil {
+			return nil, err
+		}
+		if def.Internal {
+			return nil, common.NewErrorf("设置项 <%v> 不能修改", key)
+		}
+	}
+	allSetting := entity.AllSetting{}
+	for _, def := range GetSettingDefs() {
+		raw, ok := values[def.Key]
+		if !ok {
+			return nil, common.NewErrorf("缺少设置项 <%v>", def.Key)
+		}
+		value, err := parseSettingValue(def, raw)
+		if err != nil {
+			return nil, err
+		}
+		allSetting[def.Key] = value
+	}
+	return allSetting, nil
+}
+
+func parseSettingValue(def *SettingDef, raw interface{}) (interface{}, error) {
+	if str, ok := raw.(string); ok {
+		return def.Parse(str)
+	}
+	if f, ok := raw.(float64); ok && def.Type == SettingTypeInt {
+		if f != float64(int(f)) {
+			return nil, common.NewErrorf("设置项 %v 不是整数: %v", def.Key, f)
+		}
+		return int(f), nil
+	}
+	return def.Parse(fmt.Sprint(raw))
+}
+
+// MaskSecretSettings 将敏感设置替换为掩码
+func MaskSecretSettings(allSetting entity.AllSetting) {
+	for _, def := range settingDefs {
+		if def.Sensitive && allSetting.GetString(def.Key) != "" {
+			allSetting[def.Key] = model.SecretMask
+		}
+	}
+}
+
+// CheckAllSetting 校验每个设置项以及设置项之间的约束，会规范化面板根路径
+func CheckAllSetting(allSetting entity.AllSetting) error {
+	for _, def := range GetSettingDefs() {
+		value, ok := allSetting[def.Key]
+		if !ok {
+			return common.NewErrorf("缺少设置项 <%v>", def.Key)
+		}
+		err := def.check(value)
+		if err != nil {
+			return err
+		}
+	}
+
+	certFile := allSetting.GetString("webCertFile")
+	keyFile := allSetting.GetString("webKeyFile")
+	if certFile != "" || keyFile != "" {
+		_, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return common.NewErrorf("cert file <%v> or key file <%v> invalid: %v", certFile, keyFile, err)
+		}
+	}
+
+	basePath := allSetting.GetString("webBasePath")
+	if !strings.HasPrefix(basePath, "/") {
+		basePath = "/" + basePath
+	}
+	if !strings.HasSuffix(basePath, "/") {
+		basePath += "/"
+	}
+	allSetting["webBasePath"] = basePath
+
+	if allSetting.GetBool("acmeEnable") {
+		if certFile != "" || keyFile != "" {
+			return common.NewError("acme can not be used together with cert file and key file")
+		}
+		domains := common.SplitTrim(allSetting.GetString("acmeDomains"))
+		if len(domains) == 0 {
+			return common.NewError("acme domains are required when acme is enabled")
+		}
+		for _, domain := range domains {
+			if !isValidDomain(domain) {
+				return common.NewError("acme domain is not a valid domain name:", domain)
+			}
+		}
+		// ACME 服务器只会连接 443 端口进行 TLS-ALPN-01 验证
+		if allSetting.GetString("acmeChallenge") == AcmeChallengeTlsAlpn01 && allSetting.GetInt("webPort") != 443 {
+			return common.NewError("acme tls-alpn-01 challenge requires the panel port to be 443")
+		}
+		caFile := allSetting.GetString("acmeCaFile")
+		if caFile != "" {
+			_, err := LoadCertPool(caFile)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if allSetting.GetBool("backupEnable") {
+		backupKeep := allSetting.GetInt("backupKeep")
+		if backupKeep <= 0 {
+			return common.NewError("backup keep must be greater than 0:", backupKeep)
+		}
+		_, err := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor).Parse(allSetting.GetString("backupCron"))
+		if err != nil {
+			return common.NewError("backup cron invalid:", err)
+		}
+	}
+
+	if allSetting.GetString("metricsListen") == "" && allSetting.GetBool("metricsEnable") && allSetting.GetString("metricsToken") == "" {
+		return common.NewError("metrics token is required when metrics is served on the panel port")
+	}
+	return nil
+}
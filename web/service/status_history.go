@@ -0,0 +1,181 @@
+package service
+
+import (
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+
+	"gorm.io/gorm"
+)
+
+// 各精度采样的保留时间
+const (
+	statusMinuteRetention  = 24 * time.Hour
+	statusQuarterRetention = 30 * 24 * time.Hour
+)
+
+// StatusSeries 按列组织的历史状态，时间为 unix 秒
+type StatusSeries struct {
+	Resolution int       `json:"resolution"`
+	Time       []int64   `json:"time"`
+	Cpu        []float64 `json:"cpu"`
+	Mem        []uint64  `json:"mem"`
+	MemTotal   []uint64  `json:"memTotal"`
+	NetUp      []uint64  `json:"netUp"`
+	NetDown    []uint64  `json:"netDown"`
+	TcpCount   []int     `json:"tcpCount"`
+	UdpCount   []int     `json:"udpCount"`
+}
+
+type StatusHistoryService struct {
+}
+
+// RecordStatus 保存一个分钟精度的采样
+func (s *StatusHistoryService) RecordStatus(status *Status) error {
+	sample := &model.StatusSample{
+		Resolution: model.StatusResolutionMinute,
+		Time:       status.T.Unix() / model.StatusResolutionMinute * model.StatusResolutionMinute,
+		Cpu:        status.Cpu,
+		Mem:        status.Mem.Current,
+		MemTotal:   status.Mem.Total,
+		NetUp:      status.NetIO.Up,
+		NetDown:    status.NetIO.Down,
+		TcpCount:   status.TcpCount,
+		UdpCount:   status.UdpCount,
+	}
+	db := database.GetDB()
+	return db.Create(sample).Error
+}
+
+// Rollup 将已经结束的 15 分钟区间内的分钟采样取平均，合并为一个 15 分钟精度的采样。
+// 从最近一个 15 分钟采样之后开始处理，面板停止期间遗漏的区间会在下次运行时补齐
+func (s *StatusHistoryService) Rollup(now time.Time) error {
+	db := database.GetDB()
+	var start int64
+	latest := &model.StatusSample{}
+	err := db.Model(model.StatusSample{}).
+		Where("resolution = ?", model.StatusResolutionQuarter).
+		Order("time desc").
+		First(latest).Error
+	if err == nil {
+		start = latest.Time + model.StatusResolutionQuarter
+	} else if err != gorm.ErrRecordNotFound {
+		return err
+	}
+	end := now.Unix() / model.StatusResolutionQuarter * model.StatusResolutionQuarter
+	if start >= end {
+		return nil
+	}
+
+	samples := make([]*model.StatusSample, 0)
+	err = db.Model(model.StatusSample{}).
+		Where("resolution = ? and time >= ? and time < ?", model.StatusResolutionMinute, start, end).
+		Order("time asc").
+		Find(&samples).Error
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+
+	rollups := make([]*model.StatusSample, 0)
+	for i := 0; i < len(samples); {
+		bucket := samples[i].Time / model.StatusResolutionQuarter * model.StatusResolutionQuarter
+		j := i
+		for j < len(samples) && samples[j].Time < bucket+model.StatusResolutionQuarter {
+			j++
+		}
+		rollups = append(rollups, averageSamples(bucket, samples[i:j]))
+		i = j
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, rollup := range rollups {
+			err := tx.Create(rollup).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func averageSamples(bucket int64, samples []*model.StatusSample) *model.StatusSample {
+	result := &model.StatusSample{
+		Resolution: model.StatusResolutionQuarter,
+		Time:       bucket,
+	}
+	n := len(samples)
+	var cpu float64
+	var mem, memTotal, netUp, netDown uint64
+	var tcpCount, udpCount int
+	for _, sample := range samples {
+		cpu += sample.Cpu
+		mem += sample.Mem
+		memTotal += sample.MemTotal
+		netUp += sample.NetUp
+		netDown += sample.NetDown
+		tcpCount += sample.TcpCount
+		udpCount += sample.UdpCount
+	}
+	result.Cpu = cpu / float64(n)
+	result.Mem = mem / uint64(n)
+	result.MemTotal = memTotal / uint64(n)
+	result.NetUp = netUp / uint64(n)
+	result.NetDown = netDown / uint64(n)
+	result.TcpCount = tcpCount / n
+	result.UdpCount = udpCount / n
+	return result
+}
+
+// Prune 删除超过保留时间的采样
+func (s *StatusHistoryService) Prune(now time.Time) error {
+	db := database.GetDB()
+	err := db.Where("resolution = ? and time < ?", model.StatusResolutionMinute, now.Add(-statusMinuteRetention).Unix()).
+		Delete(model.StatusSample{}).Error
+	if err != nil {
+		return err
+	}
+	return db.Where("resolution = ? and time < ?", model.StatusResolutionQuarter, now.Add(-statusQuarterRetention).Unix()).
+		Delete(model.StatusSample{}).Error
+}
+
+// GetSeries 返回 [from, to] 区间内的历史状态，起点在一天以内时使用分钟精度，否则使用 15 分钟精度
+func (s *StatusHistoryService) GetSeries(from time.Time, to time.Time) (*StatusSeries, error) {
+	resolution := model.StatusResolutionQuarter
+	if time.Since(from) <= statusMinuteRetention {
+		resolution = model.StatusResolutionMinute
+	}
+	samples := make([]*model.StatusSample, 0)
+	db := database.GetDB()
+	err := db.Model(model.StatusSample{}).
+		Where("resolution = ? and time >= ? and time <= ?", resolution, from.Unix(), to.Unix()).
+		Order("time asc").
+		Find(&samples).Error
+	if err != nil {
+		return nil, err
+	}
+	n := len(samples)
+	series := &StatusSeries{
+		Resolution: resolution,
+		Time:       make([]int64, 0, n),
+		Cpu:        make([]float64, 0, n),
+		Mem:        make([]uint64, 0, n),
+		MemTotal:   make([]uint64, 0, n),
+		NetUp:      make([]uint64, 0, n),
+		NetDown:    make([]uint64, 0, n),
+		TcpCount:   make([]int, 0, n),
+		UdpCount:   make([]int, 0, n),
+	}
+	for _, sample := range samples {
+		series.Time = append(series.Time, sample.Time)
+		series.Cpu = append(series.Cpu, sample.Cpu)
+		series.Mem = append(series.Mem, sample.Mem)
+		series.MemTotal = append(series.MemTotal, sample.MemTotal)
+		series.NetUp = append(series.NetUp, sample.NetUp)
+		series.NetDown = append(series.NetDown, sample.NetDown)
+		series.TcpCount = append(series.TcpCount, sample.TcpCount)
+		series.UdpCount = append(series.UdpCount, sample.UdpCount)
+	}
+	return series, nil
+}
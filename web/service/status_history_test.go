@@ -0,0 +1,157 @@
+package service
+
+import (
+	"testing"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+
+	"github.com/shirou/gopsutil/cpu"
+)
+
+func addTestStatusSample(t *testing.T, resolution int, at int64, cpu float64, tcpCount int) {
+	sample := &model.StatusSample{
+		Resolution: resolution,
+		Time:       at,
+		Cpu:        cpu,
+		Mem:        uint64(cpu),
+		TcpCount:   tcpCount,
+	}
+	err := database.GetDB().Create(sample).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getTestStatusSamples(t *testing.T, resolution int) []*model.StatusSample {
+	samples := make([]*model.StatusSample, 0)
+	err := database.GetDB().Model(model.StatusSample{}).
+		Where("resolution = ?", resolution).
+		Order("time asc").
+		Find(&samples).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return samples
+}
+
+func TestStatusHistoryRollup(t *testing.T) {
+	initTestDB(t)
+	service := StatusHistoryService{}
+	const quarter = model.StatusResolutionQuarter
+	const minute = model.StatusResolutionMinute
+	base := int64(1700000100) / quarter * quarter
+
+	// 第一个区间两个采样，第二个区间一个采样，第三个区间还没有结束
+	addTestStatusSample(t, minute, base, 10, 1)
+	addTestStatusSample(t, minute, base+minute, 30, 3)
+	addTestStatusSample(t, minute, base+quarter, 50, 5)
+	addTestStatusSample(t, minute, base+2*quarter, 90, 9)
+
+	now := time.Unix(base+2*quarter+minute, 0)
+	err := service.Rollup(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rollups := getTestStatusSamples(t, quarter)
+	if len(rollups) != 2 {
+		t.Fatalf("rollups = %v, want 2", len(rollups))
+	}
+	for i, want := range []struct {
+		time     int64
+		cpu      float64
+		mem      uint64
+		tcpCount int
+	}{
+		{base, 20, 20, 2},
+		{base + quarter, 50, 50, 5},
+	} {
+		got := rollups[i]
+		if got.Time != want.time || got.Cpu != want.cpu || got.Mem != want.mem || got.TcpCount != want.tcpCount {
+			t.Errorf("rollup %v = %+v, want %+v", i, got, want)
+		}
+	}
+
+	// 再次运行不会重复合并已经处理过的区间
+	err = service.Rollup(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(getTestStatusSamples(t, quarter)); n != 2 {
+		t.Errorf("rollups after second run = %v, want 2", n)
+	}
+
+	// 区间结束后继续从上一个 15 分钟采样之后开始合并
+	err = service.Rollup(time.Unix(base+3*quarter, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rollups = getTestStatusSamples(t, quarter)
+	if len(rollups) != 3 || rollups[2].Time != base+2*quarter || rollups[2].Cpu != 90 {
+		t.Errorf("rollups after the third quarter = %+v", rollups)
+	}
+}
+
+func TestStatusHistoryPrune(t *testing.T) {
+	initTestDB(t)
+	service := StatusHistoryService{}
+	now := time.Unix(1700000000, 0)
+	minuteCutoff := now.Add(-statusMinuteRetention).Unix()
+	quarterCutoff := now.Add(-statusQuarterRetention).Unix()
+
+	addTestStatusSample(t, model.StatusResolutionMinute, minuteCutoff-60, 1, 0)
+	addTestStatusSample(t, model.StatusResolutionMinute, minuteCutoff, 2, 0)
+	addTestStatusSample(t, model.StatusResolutionQuarter, minuteCutoff-60, 3, 0)
+	addTestStatusSample(t, model.StatusResolutionQuarter, quarterCutoff-60, 4, 0)
+	addTestStatusSample(t, model.StatusResolutionQuarter, quarterCutoff, 5, 0)
+
+	err := service.Prune(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		resolution int
+		cpu        []float64
+	}{
+		// 分钟采样只保留一天，15 分钟采样保留 30 天
+		{model.StatusResolutionMinute, []float64{2}},
+		{model.StatusResolutionQuarter, []float64{5, 3}},
+	} {
+		samples := getTestStatusSamples(t, c.resolution)
+		cpus := make([]float64, 0, len(samples))
+		for _, sample := range samples {
+			cpus = append(cpus, sample.Cpu)
+		}
+		if len(cpus) != len(c.cpu) {
+			t.Errorf("resolution %v samples = %v, want %v", c.resolution, cpus, c.cpu)
+			continue
+		}
+		for i := range cpus {
+			if cpus[i] != c.cpu[i] {
+				t.Errorf("resolution %v samples = %v, want %v", c.resolution, cpus, c.cpu)
+				break
+			}
+		}
+	}
+}
+
+func TestCpuPercentBetween(t *testing.T) {
+	last := &cpu.TimesStat{User: 100, System: 50, Idle: 850}
+	for _, c := range []struct {
+		current cpu.TimesStat
+		want    float64
+	}{
+		{cpu.TimesStat{User: 130, System: 70, Idle: 900}, 50},
+		{cpu.TimesStat{User: 100, System: 50, Idle: 950}, 0},
+		{cpu.TimesStat{User: 200, System: 50, Idle: 850}, 100},
+		// 计数器回绕或没有变化时不计算
+		{cpu.TimesStat{User: 100, System: 50, Idle: 850}, 0},
+		{cpu.TimesStat{User: 10, System: 5, Idle: 85}, 0},
+	} {
+		current := c.current
+		got := cpuPercentBetween(last, &current)
+		if got != c.want {
+			t.Errorf("cpu percent %+v = %v, want %v", c.current, got, c.want)
+		}
+	}
+}
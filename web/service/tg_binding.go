@@ -0,0 +1,243 @@
+package service
+
+import (
+	"fmt"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/random"
+
+	"gorm.io/gorm"
+)
+
+// 绑定码的有效时间
+const tgBindCodeTTL = 10 * time.Minute
+
+// 绑定失败的原因，电报机器人回复时按通知语言翻译
+var (
+	ErrTgBindCodeInvalid = common.NewError("绑定码无效")
+	ErrTgBindCodeExpired = common.NewError("绑定码已过期，请联系管理员重新生成")
+)
+
+// TgBindingWarning 需要发送给绑定用户的提醒，State 为提醒发送成功后需要保存的绑定状态，
+// Text 为空时只需要保存状态
+type TgBindingWarning struct {
+	BindingId int
+	ChatId    int64
+	Text      string
+	State     map[string]interface{}
+}
+
+type TgBindingService struct {
+	inboundService InboundService
+	settingService SettingService
+}
+
+// GenerateBindCode 为入站生成一次性绑定码，link 为面板生成的分享链接，绑定后用户可以查看。
+// 流量、到期时间和流量统计都只在入站上，客户端没有单独的额度，所以只支持绑定到入站
+func (s *TgBindingService) GenerateBindCode(inboundId int, link string) (*model.TgBinding, error) {
+	_, err := s.inboundService.GetInbound(inboundId)
+	if err != nil {
+		return nil, err
+	}
+	// 绑定码可以换取分享链接，必须不可猜测
+	code, err := random.SecureSeq(16)
+	if err != nil {
+		return nil, err
+	}
+	db := database.GetDB()
+	now := time.Now()
+	err = db.Where("chat_id = 0 and code_expiry < ?", now.Unix()).Delete(model.TgBinding{}).Error
+	if err != nil {
+		return nil, err
+	}
+	binding := &model.TgBinding{
+		InboundId:  inboundId,
+		Code:       code,
+		CodeExpiry: now.Add(tgBindCodeTTL).Unix(),
+		Link:       link,
+	}
+	err = db.Create(binding).Error
+	if err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+// Bind 使用绑定码将 chat 绑定到入站，绑定码只能使用一次
+func (s *TgBindingService) Bind(code string, chatId int64) (*model.Inbound, error) {
+	if code == "" {
+		return nil, ErrTgBindCodeInvalid
+	}
+	db := database.GetDB()
+	binding := &model.TgBinding{}
+	err := db.Model(model.TgBinding{}).Where("code = ? and chat_id = 0", code).First(binding).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrTgBindCodeInvalid
+	} else if err != nil {
+		return nil, err
+	}
+	if binding.CodeExpiry < time.Now().Unix() {
+		db.Delete(binding)
+		return nil, ErrTgBindCodeExpired
+	}
+	inbound, err := s.inboundService.GetInbound(binding.InboundId)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("chat_id = ? and inbound_id = ?", chatId, binding.InboundId).Delete(model.TgBinding{}).Error
+		if err != nil {
+			return err
+		}
+		// 只有绑定码仍未使用时才能绑定，避免同一个绑定码被并发使用两次
+		result := tx.Model(&model.TgBinding{}).
+			Where("id = ? and code = ? and chat_id = 0", binding.Id, code).
+			Updates(map[string]interface{}{"chat_id": chatId, "code": "", "code_expiry": 0, "bound_at": time.Now().Unix()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTgBindCodeInvalid
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inbound, nil
+}
+
+// Unbind 解除 chat 的所有绑定
+func (s *TgBindingService) Unbind(chatId int64) (int64, error) {
+	db := database.GetDB()
+	result := db.Where("chat_id = ?", chatId).Delete(model.TgBinding{})
+	return result.RowsAffected, result.Error
+}
+
+func (s *TgBindingService) GetBindingsByChat(chatId int64) ([]*model.TgBinding, error) {
+	db := database.GetDB()
+	var bindings []*model.TgBinding
+	err := db.Model(model.TgBinding{}).Where("chat_id = ?", chatId).Order("id asc").Find(&bindings).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return bindings, nil
+}
+
+func (s *TgBindingService) GetBindingsByInbound(inboundId int) ([]*model.TgBinding, error) {
+	db := database.GetDB()
+	var bindings []*model.TgBinding
+	err := db.Model(model.TgBinding{}).Where("inbound_id = ? and chat_id != 0", inboundId).Order("id asc").Find(&bindings).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return bindings, nil
+}
+
+func (s *TgBindingService) GetBinding(id int) (*model.TgBinding, error) {
+	db := database.GetDB()
+	binding := &model.TgBinding{}
+	err := db.Model(model.TgBinding{}).First(binding, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+func (s *TgBindingService) DelBinding(id int) error {
+	db := database.GetDB()
+	return db.Delete(model.TgBinding{}, id).Error
+}
+
+// CheckWarnings 检查所有绑定的入站，流量用量新达到提醒百分比或即将到期时生成提醒。
+// 同一档位只提醒一次，流量重置或到期时间延后后会重新提醒。这里不保存提醒状态，
+// 由调用者在提醒发送成功后调用 SaveWarningState
+func (s *TgBindingService) CheckWarnings(now time.Time) ([]*TgBindingWarning, error) {
+	percents, err := s.settingService.GetTgBindWarnPercents()
+	if err != nil {
+		return nil, err
+	}
+	warnDays, err := s.settingService.GetTgBindWarnDays()
+	if err != nil {
+		return nil, err
+	}
+	localizer, err := getNotifyLocalizer(&s.settingService)
+	if err != nil {
+		return nil, err
+	}
+	db := database.GetDB()
+	var bindings []*model.TgBinding
+	err = db.Model(model.TgBinding{}).Where("chat_id != 0").Find(&bindings).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	inboundMap := make(map[int]*model.Inbound, len(inbounds))
+	for _, inbound := range inbounds {
+		inboundMap[inbound.Id] = inbound
+	}
+
+	warnings := make([]*TgBindingWarning, 0)
+	for _, binding := range bindings {
+		inbound, ok := inboundMap[binding.InboundId]
+		if !ok {
+			continue
+		}
+
+		reached := 0
+		usage := 0.0
+		if inbound.Total > 0 {
+			usage = float64(inbound.Up+inbound.Down) / float64(inbound.Total) * 100
+			for _, percent := range percents {
+				if usage >= float64(percent) {
+					reached = percent
+				}
+			}
+		}
+		if reached != binding.WarnPercent {
+			warning := &TgBindingWarning{
+				BindingId: binding.Id,
+				ChatId:    binding.ChatId,
+				State:     map[string]interface{}{"warn_percent": reached},
+			}
+			if reached > binding.WarnPercent {
+				warning.Text = localize(localizer, "tgBotTrafficWarning", map[string]interface{}{
+					"Remark": inbound.Remark,
+					"Usage":  fmt.Sprintf("%.1f", usage),
+				}) + "\n\n" + formatInboundUsage(localizer, inbound)
+			}
+			warnings = append(warnings, warning)
+		}
+
+		expiring := false
+		if warnDays > 0 && inbound.ExpiryTime > 0 {
+			expiring = inbound.ExpiryTime-now.Unix()*1000 <= int64(warnDays)*int64(24*time.Hour/time.Millisecond)
+		}
+		if expiring != binding.ExpiryWarned {
+			warning := &TgBindingWarning{
+				BindingId: binding.Id,
+				ChatId:    binding.ChatId,
+				State:     map[string]interface{}{"expiry_warned": expiring},
+			}
+			if expiring {
+				warning.Text = localize(localizer, "tgBotExpiryWarning", map[string]interface{}{
+					"Remark": inbound.Remark,
+					"Time":   time.Unix(inbound.ExpiryTime/1000, 0).Format("2006-01-02 15:04:05"),
+				}) + "\n\n" + formatInboundUsage(localizer, inbound)
+			}
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings, nil
+}
+
+// SaveWarningState 保存提醒对应的绑定状态，应在提醒发送成功后调用，发送失败时下次检查会重新提醒
+func (s *TgBindingService) SaveWarningState(warning *TgBindingWarning) error {
+	db := database.GetDB()
+	return db.Model(&model.TgBinding{}).Where("id = ?", warning.BindingId).Updates(warning.State).Error
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+)
+
+func TestTgBindCode(t *testing.T) {
+	initTestDB(t)
+	inbound := newTestInbound(20000, `{"auth": "noauth"}`)
+	addTestInbound(t, inbound)
+	service := TgBindingService{}
+
+	_, err := service.Bind("unknown", 1)
+	if err != ErrTgBindCodeInvalid {
+		t.Errorf("err = %v, want %v", err, ErrTgBindCodeInvalid)
+	}
+	binding, err := service.GenerateBindCode(inbound.Id, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = service.Bind(binding.Code, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 绑定码只能使用一次
+	_, err = service.Bind(binding.Code, 2)
+	if err != ErrTgBindCodeInvalid {
+		t.Errorf("err = %v, want %v", err, ErrTgBindCodeInvalid)
+	}
+}
+
+func TestTgBindingWarningLanguage(t *testing.T) {
+	initTestDB(t)
+	inbound := newTestInbound(20000, `{"auth": "noauth"}`)
+	inbound.Remark = "node"
+	addTestInbound(t, inbound)
+	db := database.GetDB()
+	err := db.Model(&model.Inbound{}).Where("id = ?", inbound.Id).
+		Updates(map[string]interface{}{"up": 90, "down": 0, "total": 100}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&model.TgBinding{InboundId: inbound.Id, ChatId: 1}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := TgBindingService{}
+	err = service.settingService.setString("notifyLanguage", "en-US")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	warnings, err := service.CheckWarnings(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("warnings = %v, want 1", len(warnings))
+	}
+	text := warnings[0].Text
+	for _, want := range []string{"Traffic warning: node has used 90.0%", "State:Enabled", "Expiry:Never"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("warning %q does not contain %q", text, want)
+		}
+	}
+}
+
+func TestTgBindingWarningState(t *testing.T) {
+	initTestDB(t)
+	now := time.Now()
+	inbound := newTestInbound(20000, `{"auth": "noauth"}`)
+	addTestInbound(t, inbound)
+	db := database.GetDB()
+	err := db.Model(&model.Inbound{}).Where("id = ?", inbound.Id).
+		Updates(map[string]interface{}{"up": 90, "down": 0, "total": 100, "expiry_time": now.Add(time.Hour).Unix() * 1000}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&model.TgBinding{InboundId: inbound.Id, ChatId: 1}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := TgBindingService{}
+
+	check := func(wantTexts int, wantStates int) []*TgBindingWarning {
+		t.Helper()
+		warnings, err := service.CheckWarnings(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		texts := 0
+		for _, warning := range warnings {
+			if warning.Text != "" {
+				texts++
+			}
+		}
+		if texts != wantTexts || len(warnings) != wantStates {
+			t.Fatalf("warnings = %v with %v texts, want %v with %v texts", len(warnings), texts, wantStates, wantTexts)
+		}
+		return warnings
+	}
+
+	// 提醒发送成功前不保存状态，下次检查会重新提醒
+	check(2, 2)
+	warnings := check(2, 2)
+	for _, warning := range warnings {
+		err = service.SaveWarningState(warning)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(0, 0)
+
+	// 流量重置后只需要保存状态，不再发送提醒
+	err = db.Model(&model.Inbound{}).Where("id = ?", inbound.Id).Update("up", 0).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	warnings = check(0, 1)
+	err = service.SaveWarningState(warnings[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(0, 0)
+}
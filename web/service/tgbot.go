@@ -0,0 +1,629 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/web/notify"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// 入站列表每页显示的数量
+const tgBotPageSize = 8
+
+// 内联键盘回调数据的动作
+const (
+	tgBotActionUsage   = "usage"
+	tgBotActionEnable  = "enable"
+	tgBotActionDisable = "disable"
+)
+
+// 命令的说明为翻译 key，按通知语言设置翻译
+var tgBotCommands = []tgbotapi.BotCommand{
+	{Command: "status", Description: "tgBotCmdStatus"},
+	{Command: "usage", Description: "tgBotCmdUsage"},
+	{Command: "enable", Description: "tgBotCmdEnable"},
+	{Command: "disable", Description: "tgBotCmdDisable"},
+	{Command: "restart", Description: "tgBotCmdRestart"},
+	{Command: "backup", Description: "tgBotCmdBackup"},
+}
+
+// 终端用户可以使用的命令，不需要在管理员白名单中
+var tgBotUserCommands = []tgbotapi.BotCommand{
+	{Command: "bind", Description: "tgBotCmdBind"},
+	{Command: "quota", Description: "tgBotCmdQuota"},
+	{Command: "link", Description: "tgBotCmdLink"},
+	{Command: "unbind", Description: "tgBotCmdUnbind"},
+}
+
+// tgBotUsageTemplate 入站流量的回复模板，数据为 NotifyInbound
+const tgBotUsageTemplate = `{{i18n "notifyInboundRemark"}}:{{.Remark}}
+{{i18n "notifyPort"}}:{{.Port}}
+{{i18n "tgBotState"}}:{{if .Enable}}{{i18n "tgBotStateEnabled"}}{{else}}{{i18n "tgBotStateDisabled"}}{{end}}
+{{i18n "notifyUp"}}:{{traffic .Up}}
+{{i18n "notifyDown"}}:{{traffic .Down}}
+{{i18n "notifyTotal"}}:{{traffic (.Up | add .Down)}} / {{if .Total}}{{traffic .Total}}{{else}}{{i18n "tgBotUnlimited"}}{{end}}
+{{i18n "notifyExpiry"}}:{{if .ExpiryTime}}{{time .ExpiryTime}}{{else}}{{i18n "notifyNoExpiry"}}{{end}}`
+
+// TgBotService 电报机器人，接收白名单中的 chat 发送的管理命令，以及终端用户的自助查询命令
+type TgBotService struct {
+	settingService   SettingService
+	inboundService   InboundService
+	xrayService      XrayService
+	serverService    ServerService
+	tgBindingService TgBindingService
+}
+
+// 正在运行的轮询，同一个机器人同时只能有一个 getUpdates 请求，否则 Telegram 返回 409 Conflict
+var tgBotPollLock sync.Mutex
+var tgBotPollCancel context.CancelFunc
+var tgBotPollDone chan struct{}
+
+// 已处理的更新位置，重启轮询后继续使用，避免已处理的消息被再次处理
+var tgBotPollToken string
+var tgBotPollOffset int
+
+// tgBotContextClient 为请求附加 ctx，停止时可以中断正在进行的长轮询
+type tgBotContextClient struct {
+	ctx    context.Context
+	client tgbotapi.HTTPClient
+}
+
+func (c *tgBotContextClient) Do(req *http.Request) (*http.Response, error) {
+	return c.client.Do(req.WithContext(c.ctx))
+}
+
+// Start 启用电报机器人时开始轮询消息，之前的轮询会先停止。ctx 结束或调用 Stop 后停止
+func (s *TgBotService) Start(ctx context.Context) error {
+	tgBotPollLock.Lock()
+	defer tgBotPollLock.Unlock()
+	stopTgBotPoll()
+
+	enabled, err := s.settingService.GetTgbotenabled()
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return nil
+	}
+	token, err := s.settingService.GetTgBotToken()
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return common.NewError("telegram bot token is empty")
+	}
+	bot, err := notify.GetBot(token)
+	if err != nil {
+		return err
+	}
+	localizer, err := getNotifyLocalizer(&s.settingService)
+	if err != nil {
+		return err
+	}
+	s.setCommands(bot, localizer)
+	logger.Info("telegram bot started:", bot.Self.UserName)
+	s.startPoll(ctx, bot)
+	return nil
+}
+
+// setCommands 默认只显示终端用户命令，管理员的 chat 单独设置，同时显示管理命令和终端用户命令
+func (s *TgBotService) setCommands(bot *tgbotapi.BotAPI, localizer *i18n.Localizer) {
+	userCommands := localizeCommands(localizer, tgBotUserCommands)
+	_, err := bot.Request(tgbotapi.NewSetMyCommands(userCommands...))
+	if err != nil {
+		logger.Warning("set telegram bot commands failed:", err)
+	}
+	chatIds, err := s.settingService.GetTgBotAdminChatIds()
+	if err != nil {
+		logger.Warning("get telegram admin chat ids failed:", err)
+		return
+	}
+	adminCommands := append(localizeCommands(localizer, tgBotCommands), userCommands...)
+	for _, chatId := range chatIds {
+		_, err = bot.Request(tgbotapi.NewSetMyCommandsWithScope(tgbotapi.NewBotCommandScopeChat(chatId), adminCommands...))
+		if err != nil {
+			logger.Warningf("set telegram bot commands for chat %v failed: %v", chatId, err)
+		}
+	}
+}
+
+// Stop 停止轮询，并等待正在进行的 getUpdates 请求结束
+func (s *TgBotService) Stop() {
+	tgBotPollLock.Lock()
+	defer tgBotPollLock.Unlock()
+	stopTgBotPoll()
+}
+
+// startPoll 在后台开始轮询，调用时需要持有 tgBotPollLock 并且之前的轮询已经停止
+func (s *TgBotService) startPoll(ctx context.Context, bot *tgbotapi.BotAPI) {
+	if bot.Token != tgBotPollToken {
+		tgBotPollToken = bot.Token
+		tgBotPollOffset = 0
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	tgBotPollCancel = cancel
+	tgBotPollDone = done
+	offset := tgBotPollOffset
+	go func() {
+		defer close(done)
+		tgBotPollOffset = s.poll(ctx, bot, offset)
+	}()
+}
+
+// stopTgBotPoll 停止轮询并等待退出，调用时需要持有 tgBotPollLock
+func stopTgBotPoll() {
+	if tgBotPollCancel == nil {
+		return
+	}
+	tgBotPollCancel()
+	<-tgBotPollDone
+	tgBotPollCancel = nil
+	tgBotPollDone = nil
+}
+
+// poll 长轮询获取消息，返回下次轮询的 offset。不使用 GetUpdatesChan，因为 bot 是共享的，停止后无法再次启动
+func (s *TgBotService) poll(ctx context.Context, bot *tgbotapi.BotAPI, offset int) int {
+	// 只有轮询使用附加了 ctx 的客户端，回复消息仍使用共享的 bot
+	pollBot := *bot
+	pollBot.Client = &tgBotContextClient{ctx: ctx, client: bot.Client}
+	updateConfig := tgbotapi.NewUpdate(offset)
+	updateConfig.Timeout = 30
+	for {
+		select {
+		case <-ctx.Done():
+			return updateConfig.Offset
+		default:
+		}
+		updates, err := pollBot.GetUpdates(updateConfig)
+		if ctx.Err() != nil {
+			return updateConfig.Offset
+		}
+		if err != nil {
+			logger.Warning("get telegram updates failed:", err)
+			select {
+			case <-ctx.Done():
+				return updateConfig.Offset
+			case <-time.After(time.Second * 3):
+			}
+			continue
+		}
+		for _, update := range updates {
+			if update.UpdateID >= updateConfig.Offset {
+				updateConfig.Offset = update.UpdateID + 1
+			}
+			s.handleUpdate(bot, update)
+		}
+	}
+}
+
+func (s *TgBotService) isAdmin(chatId int64) bool {
+	chatIds, err := s.settingService.GetTgBotAdminChatIds()
+	if err != nil {
+		logger.Warning("get telegram admin chat ids failed:", err)
+		return false
+	}
+	for _, id := range chatIds {
+		if id == chatId {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *TgBotService) handleUpdate(bot *tgbotapi.BotAPI, update tgbotapi.Update) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Error("handle telegram update panic:", err)
+		}
+	}()
+	if update.CallbackQuery != nil {
+		s.handleCallback(bot, update.CallbackQuery)
+		return
+	}
+	msg := update.Message
+	if msg == nil || !msg.IsCommand() {
+		return
+	}
+	localizer, err := getNotifyLocalizer(&s.settingService)
+	if err != nil {
+		logger.Warning("get telegram bot localizer failed:", err)
+		return
+	}
+	chatId := msg.Chat.ID
+	command := msg.Command()
+	args := strings.TrimSpace(msg.CommandArguments())
+	if s.handleUserCommand(bot, localizer, chatId, command, args) {
+		return
+	}
+	if !s.isAdmin(chatId) {
+		logger.Warningf("telegram chat %v is not allowed to run command %v", chatId, command)
+		s.reply(bot, chatId, userHelp(localizer))
+		return
+	}
+	s.handleCommand(bot, localizer, chatId, command, args)
+}
+
+// localizeCommands 翻译命令说明
+func localizeCommands(localizer *i18n.Localizer, commands []tgbotapi.BotCommand) []tgbotapi.BotCommand {
+	result := make([]tgbotapi.BotCommand, 0, len(commands))
+	for _, c := range commands {
+		result = append(result, tgbotapi.BotCommand{Command: c.Command, Description: localize(localizer, c.Description, nil)})
+	}
+	return result
+}
+
+func formatCommands(localizer *i18n.Localizer, titleKey string, commands []tgbotapi.BotCommand) string {
+	text := localize(localizer, titleKey, nil) + ":\n"
+	for _, c := range localizeCommands(localizer, commands) {
+		text += fmt.Sprintf("/%s - %s\n", c.Command, c.Description)
+	}
+	return text
+}
+
+func userHelp(localizer *i18n.Localizer) string {
+	return formatCommands(localizer, "tgBotUserHelp", tgBotUserCommands)
+}
+
+// bindErrorText 翻译绑定失败的原因，其他错误原样显示
+func bindErrorText(localizer *i18n.Localizer, err error) string {
+	switch err {
+	case ErrTgBindCodeInvalid:
+		return localize(localizer, "tgBotBindCodeInvalid", nil)
+	case ErrTgBindCodeExpired:
+		return localize(localizer, "tgBotBindCodeExpired", nil)
+	}
+	return err.Error()
+}
+
+// handleUserCommand 处理终端用户命令，返回 false 表示不是用户命令。
+// /start 携带参数时视为绑定码，便于通过 https://t.me/<bot>?start=<绑定码> 直接绑定
+func (s *TgBotService) handleUserCommand(bot *tgbotapi.BotAPI, localizer *i18n.Localizer, chatId int64, command string, args string) bool {
+	switch command {
+	case "start", "bind":
+		if args == "" {
+			if command == "start" && !s.isAdmin(chatId) {
+				s.reply(bot, chatId, userHelp(localizer))
+				return true
+			}
+			if command == "bind" {
+				s.reply(bot, chatId, localize(localizer, "tgBotBindUsage", nil))
+				return true
+			}
+			return false
+		}
+		inbound, err := s.tgBindingService.Bind(args, chatId)
+		if err != nil {
+			s.reply(bot, chatId, localize(localizer, "tgBotBindFailed", map[string]interface{}{"Error": bindErrorText(localizer, err)}))
+			return true
+		}
+		s.reply(bot, chatId, localize(localizer, "tgBotBound", map[string]interface{}{"Remark": inbound.Remark}))
+	case "quota", "link":
+		bindings, err := s.tgBindingService.GetBindingsByChat(chatId)
+		if err != nil {
+			s.reply(bot, chatId, localize(localizer, "tgBotQueryBindingFailed", map[string]interface{}{"Error": err.Error()}))
+			return true
+		}
+		if len(bindings) == 0 {
+			s.reply(bot, chatId, localize(localizer, "tgBotNotBound", nil))
+			return true
+		}
+		for _, binding := range bindings {
+			inbound, err := s.inboundService.GetInbound(binding.InboundId)
+			if err != nil {
+				continue
+			}
+			if command == "quota" {
+				s.reply(bot, chatId, formatInboundUsage(localizer, inbound))
+			} else if binding.Link != "" {
+				s.reply(bot, chatId, fmt.Sprintf("%s:\n%s", inbound.Remark, binding.Link))
+			} else {
+				s.reply(bot, chatId, localize(localizer, "tgBotNoLink", map[string]interface{}{"Remark": inbound.Remark}))
+			}
+		}
+	case "unbind":
+		count, err := s.tgBindingService.Unbind(chatId)
+		if err != nil {
+			s.reply(bot, chatId, localize(localizer, "tgBotUnbindFailed", map[string]interface{}{"Error": err.Error()}))
+			return true
+		}
+		s.reply(bot, chatId, localize(localizer, "tgBotUnbound", map[string]interface{}{"Count": count}))
+	default:
+		return false
+	}
+	return true
+}
+
+func (s *TgBotService) handleCommand(bot *tgbotapi.BotAPI, localizer *i18n.Localizer, chatId int64, command string, args string) {
+	switch command {
+	case "status":
+		s.reply(bot, chatId, s.formatStatus(localizer))
+	case tgBotActionUsage, tgBotActionEnable, tgBotActionDisable:
+		if args == "" {
+			s.sendInboundList(bot, localizer, chatId, 0, command, 0)
+			return
+		}
+		inbounds, err := s.findInbounds(args)
+		if err != nil {
+			s.reply(bot, chatId, localize(localizer, "tgBotQueryInboundFailed", map[string]interface{}{"Error": err.Error()}))
+			return
+		}
+		if len(inbounds) == 0 {
+			s.reply(bot, chatId, localize(localizer, "tgBotInboundNotFound", map[string]interface{}{"Key": args}))
+			return
+		}
+		for _, inbound := range inbounds {
+			s.reply(bot, chatId, s.runInboundAction(localizer, command, inbound))
+		}
+	case "restart":
+		err := s.xrayService.RestartXray(true)
+		if err != nil {
+			s.reply(bot, chatId, localize(localizer, "tgBotRestartFailed", map[string]interface{}{"Error": err.Error()}))
+			return
+		}
+		s.reply(bot, chatId, localize(localizer, "tgBotRestarted", nil))
+	case "backup":
+		s.sendBackup(bot, localizer, chatId)
+	default:
+		text := formatCommands(localizer, "tgBotAdminHelp", tgBotCommands)
+		s.reply(bot, chatId, text+"\n"+userHelp(localizer))
+	}
+}
+
+// handleCallback 处理内联键盘，数据格式为 "page:<动作>:<页码>" 或 "<动作>:<入站 id>"
+func (s *TgBotService) handleCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery) {
+	if query.Message == nil {
+		return
+	}
+	localizer, err := getNotifyLocalizer(&s.settingService)
+	if err != nil {
+		logger.Warning("get telegram bot localizer failed:", err)
+		return
+	}
+	chatId := query.Message.Chat.ID
+	if !s.isAdmin(chatId) {
+		bot.Request(tgbotapi.NewCallback(query.ID, localize(localizer, "tgBotNoPermission", nil)))
+		return
+	}
+	bot.Request(tgbotapi.NewCallback(query.ID, ""))
+
+	parts := strings.Split(query.Data, ":")
+	if len(parts) == 3 && parts[0] == "page" {
+		page, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return
+		}
+		s.sendInboundList(bot, localizer, chatId, query.Message.MessageID, parts[1], page)
+		return
+	}
+	if len(parts) != 2 {
+		return
+	}
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return
+	}
+	inbound, err := s.inboundService.GetInbound(id)
+	if err != nil {
+		s.reply(bot, chatId, localize(localizer, "tgBotInboundNotExist", nil))
+		return
+	}
+	s.reply(bot, chatId, s.runInboundAction(localizer, parts[0], inbound))
+}
+
+// sendInboundList 以分页的内联键盘列出入站，messageId 不为 0 时编辑原消息实现翻页
+func (s *TgBotService) sendInboundList(bot *tgbotapi.BotAPI, localizer *i18n.Localizer, chatId int64, messageId int, action string, page int) {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		s.reply(bot, chatId, localize(localizer, "tgBotQueryInboundFailed", map[string]interface{}{"Error": err.Error()}))
+		return
+	}
+	if len(inbounds) == 0 {
+		s.reply(bot, chatId, localize(localizer, "tgBotNoInbounds", nil))
+		return
+	}
+	pageCount := (len(inbounds) + tgBotPageSize - 1) / tgBotPageSize
+	if page < 0 {
+		page = 0
+	}
+	if page >= pageCount {
+		page = pageCount - 1
+	}
+	start := page * tgBotPageSize
+	end := start + tgBotPageSize
+	if end > len(inbounds) {
+		end = len(inbounds)
+	}
+
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, tgBotPageSize+1)
+	for _, inbound := range inbounds[start:end] {
+		state := "✅"
+		if !inbound.Enable {
+			state = "⛔"
+		}
+		text := fmt.Sprintf("%s %d %s", state, inbound.Port, inbound.Remark)
+		data := fmt.Sprintf("%s:%d", action, inbound.Id)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(text, data)))
+	}
+	nav := make([]tgbotapi.InlineKeyboardButton, 0, 2)
+	if page > 0 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData(localize(localizer, "tgBotPrevPage", nil), fmt.Sprintf("page:%s:%d", action, page-1)))
+	}
+	if page < pageCount-1 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData(localize(localizer, "tgBotNextPage", nil), fmt.Sprintf("page:%s:%d", action, page+1)))
+	}
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	text := localize(localizer, "tgBotSelectInbound", map[string]interface{}{"Action": action, "Page": page + 1, "PageCount": pageCount})
+
+	if messageId != 0 {
+		_, err = bot.Send(tgbotapi.NewEditMessageTextAndMarkup(chatId, messageId, text, markup))
+	} else {
+		msg := tgbotapi.NewMessage(chatId, text)
+		msg.ReplyMarkup = markup
+		_, err = bot.Send(msg)
+	}
+	if err != nil {
+		logger.Warning("send telegram inbound list failed:", err)
+	}
+}
+
+// findInbounds 按端口或备注查找入站，备注不区分大小写
+func (s *TgBotService) findInbounds(key string) ([]*model.Inbound, error) {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	port, portErr := strconv.Atoi(key)
+	result := make([]*model.Inbound, 0)
+	for _, inbound := range inbounds {
+		if (portErr == nil && inbound.Port == port) || strings.EqualFold(inbound.Remark, key) {
+			result = append(result, inbound)
+		}
+	}
+	return result, nil
+}
+
+func (s *TgBotService) runInboundAction(localizer *i18n.Localizer, action string, inbound *model.Inbound) string {
+	switch action {
+	case tgBotActionUsage:
+		return formatInboundUsage(localizer, inbound)
+	case tgBotActionEnable, tgBotActionDisable:
+		enable := action == tgBotActionEnable
+		err := s.inboundService.SetInboundEnable(inbound.Id, enable)
+		if err != nil {
+			return localize(localizer, "tgBotUpdateInboundFailed", map[string]interface{}{"Error": err.Error()})
+		}
+		s.xrayService.SetToNeedRestart()
+		data := map[string]interface{}{"Remark": inbound.Remark, "Port": inbound.Port}
+		if enable {
+			return localize(localizer, "tgBotInboundEnabled", data)
+		}
+		return localize(localizer, "tgBotInboundDisabled", data)
+	}
+	return localize(localizer, "tgBotUnknownAction", nil)
+}
+
+// formatInboundUsage 使用 tgBotUsageTemplate 生成入站流量信息
+func formatInboundUsage(localizer *i18n.Localizer, inbound *model.Inbound) string {
+	text, err := notify.Render(tgBotUsageTemplate, localizer, NewNotifyInbound(inbound))
+	if err != nil {
+		logger.Warning("render telegram usage failed:", err)
+		return inbound.Remark
+	}
+	return text
+}
+
+func (s *TgBotService) formatStatus(localizer *i18n.Localizer) string {
+	label := func(key string) string {
+		return localize(localizer, key, nil)
+	}
+	status := s.serverService.GetStatus(nil)
+	hostname, _ := os.Hostname()
+	text := fmt.Sprintf("%s:%s\n", label("notifyHostname"), hostname)
+	text += fmt.Sprintf("xray:%s %s\n", status.Xray.State, status.Xray.Version)
+	if status.Xray.ErrorMsg != "" {
+		text += fmt.Sprintf("%s:%s\n", label("tgBotXrayError"), status.Xray.ErrorMsg)
+	}
+	text += fmt.Sprintf("CPU:%.1f%%\n", status.Cpu)
+	text += fmt.Sprintf("%s:%s / %s\n", label("tgBotMem"), common.FormatTraffic(int64(status.Mem.Current)), common.FormatTraffic(int64(status.Mem.Total)))
+	text += fmt.Sprintf("%s:%s / %s\n", label("tgBotDisk"), common.FormatTraffic(int64(status.Disk.Current)), common.FormatTraffic(int64(status.Disk.Total)))
+	if len(status.Loads) == 3 {
+		text += fmt.Sprintf("%s:%.2f %.2f %.2f\n", label("tgBotLoad"), status.Loads[0], status.Loads[1], status.Loads[2])
+	}
+	text += fmt.Sprintf("%s:%s\n", label("tgBotUptime"), time.Duration(status.Uptime)*time.Second)
+	text += fmt.Sprintf("%s:%d / %d\n", label("tgBotConnections"), status.TcpCount, status.UdpCount)
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err == nil {
+		enabled := 0
+		for _, inbound := range inbounds {
+			if inbound.Enable {
+				enabled++
+			}
+		}
+		text += localize(localizer, "tgBotInboundCount", map[string]interface{}{"Count": len(inbounds), "Enabled": enabled}) + "\n"
+	}
+	return text
+}
+
+func (s *TgBotService) sendBackup(bot *tgbotapi.BotAPI, localizer *i18n.Localizer, chatId int64) {
+	data, err := database.BackupBytes()
+	if err != nil {
+		s.reply(bot, chatId, localize(localizer, "tgBotBackupFailed", map[string]interface{}{"Error": err.Error()}))
+		return
+	}
+	name := GetBackupFileName(time.Now())
+	_, err = bot.Send(tgbotapi.NewDocument(chatId, tgbotapi.FileBytes{Name: name, Bytes: data}))
+	if err != nil {
+		logger.Warning("send telegram backup failed:", err)
+		s.reply(bot, chatId, localize(localizer, "tgBotSendBackupFailed", map[string]interface{}{"Error": err.Error()}))
+	}
+}
+
+// GetBotUserName 返回当前机器人的用户名，未启用时返回空字符串
+func (s *TgBotService) GetBotUserName() string {
+	bot, err := s.getBot()
+	if err != nil || bot == nil {
+		return ""
+	}
+	return bot.Self.UserName
+}
+
+func (s *TgBotService) getBot() (*tgbotapi.BotAPI, error) {
+	enabled, err := s.settingService.GetTgbotenabled()
+	if err != nil || !enabled {
+		return nil, err
+	}
+	token, err := s.settingService.GetTgBotToken()
+	if err != nil {
+		return nil, err
+	}
+	return notify.GetBot(token)
+}
+
+// SendMessage 通过与管理通知共用的机器人向指定 chat 发送消息
+func (s *TgBotService) SendMessage(chatId int64, text string) error {
+	bot, err := s.getBot()
+	if err != nil {
+		return err
+	}
+	if bot == nil {
+		return common.NewError("telegram bot is not enabled")
+	}
+	_, err = bot.Send(tgbotapi.NewMessage(chatId, text))
+	return err
+}
+
+// SendDocument 通过机器人向指定 chat 发送文件
+func (s *TgBotService) SendDocument(chatId int64, name string, data []byte) error {
+	bot, err := s.getBot()
+	if err != nil {
+		return err
+	}
+	if bot == nil {
+		return common.NewError("telegram bot is not enabled")
+	}
+	_, err = bot.Send(tgbotapi.NewDocument(chatId, tgbotapi.FileBytes{Name: name, Bytes: data}))
+	return err
+}
+
+func (s *TgBotService) reply(bot *tgbotapi.BotAPI, chatId int64, text string) {
+	_, err := bot.Send(tgbotapi.NewMessage(chatId, text))
+	if err != nil {
+		logger.Warning("send telegram message failed:", err)
+	}
+}
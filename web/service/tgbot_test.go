@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// countingClient 记录正在进行和同时进行的最大请求数
+type countingClient struct {
+	client   *http.Client
+	lock     sync.Mutex
+	inflight int
+	max      int
+}
+
+func (c *countingClient) Do(req *http.Request) (*http.Response, error) {
+	c.lock.Lock()
+	c.inflight++
+	if c.inflight > c.max {
+		c.max = c.inflight
+	}
+	c.lock.Unlock()
+	defer func() {
+		c.lock.Lock()
+		c.inflight--
+		c.lock.Unlock()
+	}()
+	return c.client.Do(req)
+}
+
+func (c *countingClient) get() (int, int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.inflight, c.max
+}
+
+// newFakeTelegramBot getUpdates 像长轮询一样一直等待，直到请求被取消
+func newFakeTelegramBot(t *testing.T) (*tgbotapi.BotAPI, *countingClient) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/getMe"):
+			io.WriteString(w, `{"ok": true, "result": {"id": 1, "is_bot": true, "username": "test_bot"}}`)
+		case strings.HasSuffix(r.URL.Path, "/getUpdates"):
+			// 读完请求体后服务端才能发现客户端断开连接
+			io.ReadAll(r.Body)
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second * 30):
+			}
+			io.WriteString(w, `{"ok": true, "result": []}`)
+		default:
+			io.WriteString(w, `{"ok": true, "result": true}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := &countingClient{client: server.Client()}
+	bot, err := tgbotapi.NewBotAPIWithClient("token", server.URL+"/bot%s/%s", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bot, client
+}
+
+func waitInflight(t *testing.T, client *countingClient, want int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second * 5)
+	for time.Now().Before(deadline) {
+		if inflight, _ := client.get(); inflight == want {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	inflight, _ := client.get()
+	t.Fatalf("inflight requests = %v, want %v", inflight, want)
+}
+
+func TestTgBotPollRestart(t *testing.T) {
+	bot, client := newFakeTelegramBot(t)
+	service := TgBotService{}
+	start := func() {
+		tgBotPollLock.Lock()
+		defer tgBotPollLock.Unlock()
+		stopTgBotPoll()
+		service.startPoll(context.Background(), bot)
+	}
+
+	start()
+	waitInflight(t, client, 1)
+	// 重启时先中断并等待旧的长轮询，新旧 getUpdates 不能同时进行
+	start()
+	waitInflight(t, client, 1)
+
+	begin := time.Now()
+	service.Stop()
+	if time.Since(begin) > time.Second*5 {
+		t.Errorf("stop waited %v for the long poll", time.Since(begin))
+	}
+	inflight, max := client.get()
+	if inflight != 0 {
+		t.Errorf("inflight requests after stop = %v, want 0", inflight)
+	}
+	if max != 1 {
+		t.Errorf("max concurrent getUpdates = %v, want 1", max)
+	}
+}
+
+func TestTgBotSetCommands(t *testing.T) {
+	initTestDB(t)
+	service := TgBotService{}
+	err := service.settingService.setString("tgBotAdminChatIds", "100,200")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lock sync.Mutex
+	requests := make([]map[string]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/setMyCommands") {
+			r.ParseForm()
+			lock.Lock()
+			requests = append(requests, map[string]string{"scope": r.PostForm.Get("scope"), "commands": r.PostForm.Get("commands")})
+			lock.Unlock()
+		}
+		if strings.HasSuffix(r.URL.Path, "/getMe") {
+			io.WriteString(w, `{"ok": true, "result": {"id": 1, "is_bot": true, "username": "test_bot"}}`)
+			return
+		}
+		io.WriteString(w, `{"ok": true, "result": true}`)
+	}))
+	defer server.Close()
+	bot, err := tgbotapi.NewBotAPIWithClient("token", server.URL+"/bot%s/%s", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	localizer, err := getNotifyLocalizer(&service.settingService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.setCommands(bot, localizer)
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(requests) != 3 {
+		t.Fatalf("setMyCommands requests = %v, want 3", len(requests))
+	}
+	commandNames := func(data string) []string {
+		var commands []tgbotapi.BotCommand
+		err := json.Unmarshal([]byte(data), &commands)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := make([]string, 0, len(commands))
+		for _, command := range commands {
+			if command.Description == "" {
+				t.Errorf("command %v has no description", command.Command)
+			}
+			names = append(names, command.Command)
+		}
+		return names
+	}
+	// 默认范围只有终端用户命令
+	if requests[0]["scope"] != "" {
+		t.Errorf("default commands scope = %v, want empty", requests[0]["scope"])
+	}
+	if names := commandNames(requests[0]["commands"]); strings.Join(names, ",") != "bind,quota,link,unbind" {
+		t.Errorf("default commands = %v", names)
+	}
+	for i, chatId := range []int64{100, 200} {
+		request := requests[i+1]
+		var scope tgbotapi.BotCommandScope
+		err := json.Unmarshal([]byte(request["scope"]), &scope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if scope.Type != "chat" || scope.ChatID != chatId {
+			t.Errorf("admin commands scope = %+v, want chat %v", scope, chatId)
+		}
+		names := commandNames(request["commands"])
+		if strings.Join(names, ",") != "status,usage,enable,disable,restart,backup,bind,quota,link,unbind" {
+			t.Errorf("admin commands for chat %v = %v", chatId, names)
+		}
+	}
+}
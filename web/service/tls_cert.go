@@ -0,0 +1,638 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"x-ui/config"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/util/json_util"
+
+	"golang.org/x/crypto/acme"
+	"gorm.io/gorm"
+)
+
+// 证书剩余有效期少于该天数时自动续期
+const tlsCertRenewDays = 30
+
+// 自签证书的有效期
+const selfSignedCertDays = 365
+
+// ACME 签发证书的超时时间
+const acmeIssueTimeout = 5 * time.Minute
+
+// streamCertRef 入站 tlsSettings 或 xtlsSettings 的 certificates 中对证书库的引用，
+// UseFile 为 true 时渲染为证书文件路径，否则渲染为证书内容
+type streamCertRef struct {
+	CertId  int  `json:"certId"`
+	UseFile bool `json:"useFile"`
+}
+
+type TlsCertService struct {
+	settingService SettingService
+}
+
+func (s *TlsCertService) GetTlsCerts() ([]*model.TlsCert, error) {
+	db := database.GetDB()
+	var certs []*model.TlsCert
+	err := db.Model(model.TlsCert{}).Order("id asc").Find(&certs).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return certs, nil
+}
+
+func (s *TlsCertService) GetTlsCert(id int) (*model.TlsCert, error) {
+	db := database.GetDB()
+	cert := &model.TlsCert{}
+	err := db.Model(model.TlsCert{}).First(cert, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// checkDomains 检查签发证书的域名，自签证书可以使用 IP
+func checkDomains(domains []string, allowIp bool) error {
+	if len(domains) == 0 {
+		return common.NewError("域名不能为空")
+	}
+	for _, domain := range domains {
+		if allowIp && net.ParseIP(domain) != nil {
+			continue
+		}
+		if !isValidDomain(domain) {
+			return common.NewError("域名格式不正确:", domain)
+		}
+	}
+	return nil
+}
+
+// fillCertInfo 检查证书和私钥是否匹配，并从证书中读取有效期，上传的证书同时读取域名
+func fillCertInfo(cert *model.TlsCert) error {
+	pair, err := tls.X509KeyPair([]byte(cert.Cert), []byte(cert.Key))
+	if err != nil {
+		return common.NewError("证书或私钥无效:", err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return common.NewError("解析证书失败:", err)
+	}
+	cert.NotBefore = leaf.NotBefore.Unix()
+	cert.NotAfter = leaf.NotAfter.Unix()
+	if cert.Source == model.TlsCertSourceUpload {
+		domains := append([]string{}, leaf.DNSNames...)
+		for _, ip := range leaf.IPAddresses {
+			domains = append(domains, ip.String())
+		}
+		if len(domains) == 0 && leaf.Subject.CommonName != "" {
+			domains = append(domains, leaf.Subject.CommonName)
+		}
+		cert.Domains = strings.Join(domains, ",")
+	}
+	return nil
+}
+
+// issueTlsCert 按证书来源签发证书，上传的证书只做检查
+func (s *TlsCertService) issueTlsCert(cert *model.TlsCert) error {
+	domains := common.SplitTrim(cert.Domains)
+	var certPEM, keyPEM []byte
+	var err error
+	switch cert.Source {
+	case model.TlsCertSourceUpload:
+		if cert.Cert == "" || cert.Key == "" {
+			return common.NewError("证书和私钥不能为空")
+		}
+		return fillCertInfo(cert)
+	case model.TlsCertSourceSelfSigned:
+		err = checkDomains(domains, true)
+		if err != nil {
+			return err
+		}
+		certPEM, keyPEM, err = generateSelfSignedCert(domains, selfSignedCertDays)
+	case model.TlsCertSourceAcme:
+		err = checkDomains(domains, false)
+		if err != nil {
+			return err
+		}
+		certPEM, keyPEM, err = s.issueAcmeCert(domains)
+	default:
+		return common.NewError("不支持的证书来源:", cert.Source)
+	}
+	if err != nil {
+		return err
+	}
+	cert.Domains = strings.Join(domains, ",")
+	cert.Cert = string(certPEM)
+	cert.Key = string(keyPEM)
+	return fillCertInfo(cert)
+}
+
+// AddTlsCert 添加证书，自签和 ACME 证书按 Domains 签发，上传的证书使用提交的 Cert 和 Key
+func (s *TlsCertService) AddTlsCert(cert *model.TlsCert) error {
+	if cert.Name == "" {
+		return common.NewError("证书名称不能为空")
+	}
+	cert.Id = 0
+	cert.LastError = ""
+	err := s.issueTlsCert(cert)
+	if err != nil {
+		return err
+	}
+	cert.UpdatedAt = time.Now().Unix()
+	db := database.GetDB()
+	return db.Create(cert).Error
+}
+
+// UpdateTlsCert 修改证书名称，上传的证书可以替换证书内容，自签和 ACME 证书修改域名后重新签发。
+// 返回证书内容是否变化，变化时需要重新生成 xray 配置
+func (s *TlsCertService) UpdateTlsCert(cert *model.TlsCert) (bool, error) {
+	if cert.Name == "" {
+		return false, common.NewError("证书名称不能为空")
+	}
+	oldCert, err := s.GetTlsCert(cert.Id)
+	if err != nil {
+		return false, err
+	}
+	changed := false
+	if oldCert.Source == model.TlsCertSourceUpload {
+		// 前端提交掩码表示未修改私钥
+		if cert.Key == model.SecretMask {
+			cert.Key = oldCert.Key
+		}
+		if cert.Cert != oldCert.Cert || cert.Key != oldCert.Key {
+			oldCert.Cert = cert.Cert
+			oldCert.Key = cert.Key
+			changed = true
+		}
+	} else if strings.Join(common.SplitTrim(cert.Domains), ",") != oldCert.Domains {
+		oldCert.Domains = cert.Domains
+		changed = true
+	}
+	oldCert.Name = cert.Name
+	if changed {
+		err = s.issueTlsCert(oldCert)
+		if err != nil {
+			return false, err
+		}
+		oldCert.LastError = ""
+		oldCert.UpdatedAt = time.Now().Unix()
+	}
+	db := database.GetDB()
+	err = db.Save(oldCert).Error
+	if err != nil {
+		return false, err
+	}
+	if changed {
+		removeCertFiles(oldCert.Id, getCertFileName(oldCert))
+	}
+	return changed, nil
+}
+
+// RenewTlsCert 立即重新签发自签或 ACME 证书，失败时记录失败原因
+func (s *TlsCertService) RenewTlsCert(id int) error {
+	cert, err := s.GetTlsCert(id)
+	if err != nil {
+		return err
+	}
+	if cert.Source == model.TlsCertSourceUpload {
+		return common.NewError("上传的证书不能续期，请替换证书内容")
+	}
+	return s.renewTlsCert(cert)
+}
+
+func (s *TlsCertService) renewTlsCert(cert *model.TlsCert) error {
+	db := database.GetDB()
+	renewed := *cert
+	err := s.issueTlsCert(&renewed)
+	if err != nil {
+		cert.LastError = err.Error()
+		db.Model(&model.TlsCert{}).Where("id = ?", cert.Id).Update("last_error", cert.LastError)
+		return err
+	}
+	renewed.LastError = ""
+	renewed.UpdatedAt = time.Now().Unix()
+	err = db.Save(&renewed).Error
+	if err != nil {
+		return err
+	}
+	removeCertFiles(renewed.Id, getCertFileName(&renewed))
+	*cert = renewed
+	return nil
+}
+
+// RenewExpiringTlsCerts 续期即将到期的自签和 ACME 证书，返回续期成功的数量
+func (s *TlsCertService) RenewExpiringTlsCerts() (int, error) {
+	certs, err := s.GetTlsCerts()
+	if err != nil {
+		return 0, err
+	}
+	renewBefore := time.Now().Add(tlsCertRenewDays * 24 * time.Hour).Unix()
+	count := 0
+	var errs []error
+	for _, cert := range certs {
+		if cert.Source == model.TlsCertSourceUpload || cert.NotAfter > renewBefore {
+			continue
+		}
+		err = s.renewTlsCert(cert)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %v", cert.Name, err))
+			continue
+		}
+		logger.Infof("tls certificate %v renewed, valid until %v", cert.Name, time.Unix(cert.NotAfter, 0).Format("2006-01-02 15:04:05"))
+		count++
+	}
+	return count, common.Combine(errs...)
+}
+
+// DelTlsCert 删除没有被入站引用的证书
+func (s *TlsCertService) DelTlsCert(id int) error {
+	inbounds, err := s.getReferencingInbounds(id)
+	if err != nil {
+		return err
+	}
+	if len(inbounds) > 0 {
+		return common.NewError("证书正在被入站使用:", strings.Join(inbounds, ", "))
+	}
+	db := database.GetDB()
+	err = db.Delete(model.TlsCert{}, id).Error
+	if err != nil {
+		return err
+	}
+	removeCertFiles(id, "")
+	return nil
+}
+
+// getReferencingInbounds 返回引用了证书的入站备注
+func (s *TlsCertService) getReferencingInbounds(id int) ([]string, error) {
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	err := db.Model(model.Inbound{}).Find(&inbounds).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	remarks := make([]string, 0)
+	for _, inbound := range inbounds {
+		for _, ref := range getStreamCertRefs(inbound.StreamSettings) {
+			if ref.CertId == id {
+				remarks = append(remarks, fmt.Sprintf("%v(%v)", inbound.Remark, inbound.Port))
+				break
+			}
+		}
+	}
+	return remarks, nil
+}
+
+// CheckStreamCerts 检查入站引用的证书都存在
+func (s *TlsCertService) CheckStreamCerts(streamSettings string) error {
+	db := database.GetDB()
+	for _, ref := range getStreamCertRefs(streamSettings) {
+		var count int64
+		err := db.Model(model.TlsCert{}).Where("id = ?", ref.CertId).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return common.NewError("证书不存在:", ref.CertId)
+		}
+	}
+	return nil
+}
+
+// GetTlsCertMap 返回所有证书，key 为证书 id
+func (s *TlsCertService) GetTlsCertMap() (map[int]*model.TlsCert, error) {
+	certs, err := s.GetTlsCerts()
+	if err != nil {
+		return nil, err
+	}
+	certMap := make(map[int]*model.TlsCert, len(certs))
+	for _, cert := range certs {
+		certMap[cert.Id] = cert
+	}
+	return certMap, nil
+}
+
+// getStreamCertRefs 返回 streamSettings 中对证书库的所有引用
+func getStreamCertRefs(streamSettings string) []*streamCertRef {
+	stream := map[string]json_util.RawMessage{}
+	if json.Unmarshal([]byte(streamSettings), &stream) != nil {
+		return nil
+	}
+	refs := make([]*streamCertRef, 0)
+	for _, key := range []string{"tlsSettings", "xtlsSettings"} {
+		tlsSettings := &struct {
+			Certificates []*streamCertRef `json:"certificates"`
+		}{}
+		if json.Unmarshal(stream[key], tlsSettings) != nil {
+			continue
+		}
+		for _, ref := range tlsSettings.Certificates {
+			if ref != nil && ref.CertId > 0 {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	return refs
+}
+
+// RenderStreamCerts 将 streamSettings 中对证书库的引用替换为 xray 的证书配置，
+// 证书文件写入证书目录。没有引用时原样返回
+func RenderStreamCerts(streamSettings json_util.RawMessage, certs map[int]*model.TlsCert) (json_util.RawMessage, error) {
+	if len(getStreamCertRefs(string(streamSettings))) == 0 {
+		return streamSettings, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(streamSettings))
+	decoder.UseNumber()
+	stream := map[string]interface{}{}
+	err := decoder.Decode(&stream)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range []string{"tlsSettings", "xtlsSettings"} {
+		tlsSettings, ok := stream[key].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		certificates, ok := tlsSettings["certificates"].([]interface{})
+		if !ok {
+			continue
+		}
+		for i, item := range certificates {
+			certificate, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			certId, _ := certificate["certId"].(json.Number).Int64()
+			if certId <= 0 {
+				continue
+			}
+			cert, ok := certs[int(certId)]
+			if !ok {
+				return nil, common.NewError("证书不存在:", certId)
+			}
+			useFile, _ := certificate["useFile"].(bool)
+			delete(certificate, "certId")
+			delete(certificate, "useFile")
+			if useFile {
+				certFile, keyFile, err := writeCertFiles(cert)
+				if err != nil {
+					return nil, err
+				}
+				certificate["certificateFile"] = certFile
+				certificate["keyFile"] = keyFile
+			} else {
+				certificate["certificate"] = strings.Split(strings.TrimSpace(cert.Cert), "\n")
+				certificate["key"] = strings.Split(strings.TrimSpace(cert.Key), "\n")
+			}
+			certificates[i] = certificate
+		}
+	}
+	data, err := json.Marshal(stream)
+	if err != nil {
+		return nil, err
+	}
+	return json_util.RawMessage(data), nil
+}
+
+// getCertFileName 证书文件名带有内容的摘要，证书续期后 xray 配置随之变化，从而触发 xray 重启
+func getCertFileName(cert *model.TlsCert) string {
+	sum := sha256.Sum256([]byte(cert.Cert + cert.Key))
+	return fmt.Sprintf("%d-%s", cert.Id, hex.EncodeToString(sum[:4]))
+}
+
+// writeCertFiles 将证书和私钥写入证书目录，文件已存在时不再写入
+func writeCertFiles(cert *model.TlsCert) (string, string, error) {
+	dir := config.GetCertDir()
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", "", err
+	}
+	name := getCertFileName(cert)
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	for _, file := range []struct {
+		path    string
+		content string
+		perm    os.FileMode
+	}{
+		{certFile, cert.Cert, 0644},
+		{keyFile, cert.Key, 0600},
+	} {
+		if _, err := os.Stat(file.path); err == nil {
+			continue
+		}
+		err = os.WriteFile(file.path, []byte(file.content), file.perm)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return certFile, keyFile, nil
+}
+
+// removeCertFiles 删除证书的旧文件，keep 为需要保留的文件名
+func removeCertFiles(id int, keep string) {
+	files, _ := filepath.Glob(filepath.Join(config.GetCertDir(), fmt.Sprintf("%d-*", id)))
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		if name == keep {
+			continue
+		}
+		err := os.Remove(file)
+		if err != nil {
+			logger.Warning("remove certificate file failed:", err)
+		}
+	}
+}
+
+func encodeECKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// generateSelfSignedCert 生成 ECDSA P-256 的自签证书，第一个域名作为证书的 CN
+func generateSelfSignedCert(domains []string, days int) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: domains[0]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Duration(days) * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, domain := range domains {
+		if ip := net.ParseIP(domain); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, domain)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := encodeECKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), keyPEM, nil
+}
+
+// issueAcmeCert 使用面板的 ACME 设置和账号签发证书。入站证书只使用 HTTP-01 验证，
+// 面板的 HTTP-01 验证服务在运行时由它响应，否则在 acmeHttpListen 上临时监听
+func (s *TlsCertService) issueAcmeCert(domains []string) ([]byte, []byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), acmeIssueTimeout)
+	defer cancel()
+
+	client, err := s.settingService.NewAcmeClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	client.Key, err = getAcmeAccountKey(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	email, err := s.settingService.GetAcmeEmail()
+	if err != nil {
+		return nil, nil, err
+	}
+	account := &acme.Account{}
+	if email != "" {
+		account.Contact = []string{"mailto:" + email}
+	}
+	_, err = client.Register(ctx, account, acme.AcceptTOS)
+	if err != nil && err != acme.ErrAccountAlreadyExists {
+		return nil, nil, common.NewError("acme register failed:", err)
+	}
+
+	if !acmeHttpServing.Load() {
+		stop, err := s.startAcmeHttpResponder()
+		if err != nil {
+			return nil, nil, err
+		}
+		defer stop()
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(domains...))
+	if err != nil {
+		return nil, nil, common.NewError("acme create order failed:", err)
+	}
+	for _, authzURL := range order.AuthzURLs {
+		authz, err := client.GetAuthorization(ctx, authzURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		if authz.Status == acme.StatusValid {
+			continue
+		}
+		var challenge *acme.Challenge
+		for _, c := range authz.Challenges {
+			if c.Type == AcmeChallengeHttp01 {
+				challenge = c
+				break
+			}
+		}
+		if challenge == nil {
+			return nil, nil, common.NewError("acme server does not offer http-01 challenge for", authz.Identifier.Value)
+		}
+		response, err := client.HTTP01ChallengeResponse(challenge.Token)
+		if err != nil {
+			return nil, nil, err
+		}
+		path := client.HTTP01ChallengePath(challenge.Token)
+		acmeHttpTokens.Store(path, response)
+		defer acmeHttpTokens.Delete(path)
+		_, err = client.Accept(ctx, challenge)
+		if err != nil {
+			return nil, nil, err
+		}
+		_, err = client.WaitAuthorization(ctx, authz.URI)
+		if err != nil {
+			return nil, nil, common.NewError("acme authorization for", authz.Identifier.Value, "failed:", err)
+		}
+	}
+	order, err = client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domains[0]},
+		DNSNames: domains,
+	}, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, nil, common.NewError("acme finalize order failed:", err)
+	}
+	certPEM := make([]byte, 0)
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyPEM, err := encodeECKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return certPEM, keyPEM, nil
+}
+
+// startAcmeHttpResponder 在 acmeHttpListen 上临时响应 HTTP-01 验证请求，返回停止函数
+func (s *TlsCertService) startAcmeHttpResponder() (func(), error) {
+	httpListen, err := s.settingService.GetAcmeHttpListen()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", httpListen)
+	if err != nil {
+		return nil, common.NewError("listen acme http-01 address failed:", err)
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !HandleAcmeHttpChallenge(w, r) {
+				http.NotFound(w, r)
+			}
+		}),
+	}
+	go server.Serve(listener)
+	return func() {
+		server.Close()
+	}, nil
+}
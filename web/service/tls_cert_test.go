@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+	"x-ui/database/model"
+)
+
+func TestRenewTlsCertRecordsError(t *testing.T) {
+	initTestDB(t)
+	service := TlsCertService{}
+	cert := &model.TlsCert{Name: "self", Source: model.TlsCertSourceSelfSigned, Domains: "example.com"}
+	err := service.AddTlsCert(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 域名为空时无法签发，续期失败的原因需要保存下来
+	broken := *cert
+	broken.Domains = ""
+	err = service.renewTlsCert(&broken)
+	if err == nil {
+		t.Fatal("renew certificate without domains should fail")
+	}
+	saved, err := service.GetTlsCert(cert.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.LastError == "" || saved.LastError != broken.LastError {
+		t.Errorf("last error = %q, want %q", saved.LastError, broken.LastError)
+	}
+	if saved.Cert != cert.Cert {
+		t.Error("failed renewal replaced the certificate")
+	}
+}
@@ -0,0 +1,382 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"x-ui/config"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/web/entity"
+
+	"gorm.io/gorm"
+)
+
+// ExportVersion 导出文件的格式版本，格式有不兼容的变化时递增
+const ExportVersion = 1
+
+// 导入冲突（端口或 tag 已存在）的处理方式
+const (
+	ConflictSkip      = "skip"
+	ConflictRenumber  = "renumber"
+	ConflictOverwrite = "overwrite"
+)
+
+// 导入报告中入站的处理结果
+const (
+	ImportActionAdd       = "add"
+	ImportActionSkip      = "skip"
+	ImportActionRenumber  = "renumber"
+	ImportActionOverwrite = "overwrite"
+	ImportActionError     = "error"
+)
+
+// 与面板所在机器相关或敏感的设置，不导出也不导入
+var nonPortableSettings = map[string]bool{
+	"webListen":          true,
+	"webPort":            true,
+	"webCertFile":        true,
+	"webKeyFile":         true,
+	"webBasePath":        true,
+	"tgBotToken":         true,
+	"metricsToken":       true,
+	"backupDir":          true,
+	"binDir":             true,
+	"xrayConfigPath":     true,
+	"logDir":             true,
+	"acmeEnable":         true,
+	"acmeDomains":        true,
+	"acmeHttpListen":     true,
+	"acmeCaFile":         true,
+	"xrayTemplateConfig": true,
+}
+
+// ExportData 导出文件的内容
+type ExportData struct {
+	Version            int                    `json:"version"`
+	XuiVersion         string                 `json:"xuiVersion"`
+	ExportedAt         int64                  `json:"exportedAt"`
+	Inbounds           []*model.Inbound       `json:"inbounds"`
+	Settings           map[string]interface{} `json:"settings,omitempty"`
+	XrayTemplateConfig string                 `json:"xrayTemplateConfig,omitempty"`
+}
+
+type ExportOptions struct {
+	// 为空时导出所有入站
+	InboundIds      []int
+	IncludeSettings bool
+	IncludeTemplate bool
+}
+
+type ImportOptions struct {
+	// 导入的入站所属的用户
+	UserId         int
+	Conflict       string
+	DryRun         bool
+	ImportSettings bool
+	ImportTemplate bool
+}
+
+// ImportInboundResult 单个入站的导入结果，NewPort 为实际使用的端口
+type ImportInboundResult struct {
+	Remark  string `json:"remark"`
+	Port    int    `json:"port"`
+	NewPort int    `json:"newPort"`
+	Action  string `json:"action"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// ImportReport 导入报告，DryRun 时只报告将要进行的修改
+type ImportReport struct {
+	DryRun          bool                   `json:"dryRun"`
+	Inbounds        []*ImportInboundResult `json:"inbounds"`
+	Settings        []string               `json:"settings"`
+	TemplateChanged bool                   `json:"templateChanged"`
+}
+
+type TransferService struct {
+	inboundService InboundService
+	settingService SettingService
+}
+
+// Export 导出选中的入站，以及可选的通用设置和 xray 模板
+func (s *TransferService) Export(options *ExportOptions) (*ExportData, error) {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	selected := map[int]bool{}
+	for _, id := range options.InboundIds {
+		selected[id] = true
+	}
+	data := &ExportData{
+		Version:    ExportVersion,
+		XuiVersion: config.GetVersion(),
+		ExportedAt: time.Now().Unix(),
+		Inbounds:   make([]*model.Inbound, 0, len(inbounds)),
+	}
+	for _, inbound := range inbounds {
+		if len(selected) > 0 && !selected[inbound.Id] {
+			continue
+		}
+		inbound.Id = 0
+		inbound.Tag = ""
+		data.Inbounds = append(data.Inbounds, inbound)
+	}
+	if !options.IncludeSettings && !options.IncludeTemplate {
+		return data, nil
+	}
+	allSetting, err := s.settingService.GetAllSetting()
+	if err != nil {
+		return nil, err
+	}
+	if options.IncludeTemplate {
+		data.XrayTemplateConfig = allSetting.GetString("xrayTemplateConfig")
+	}
+	if options.IncludeSettings {
+		data.Settings = map[string]interface{}{}
+		for key, value := range allSetting {
+			if !nonPortableSettings[key] {
+				data.Settings[key] = value
+			}
+		}
+	}
+	return data, nil
+}
+
+// checkImportMasked 导出时没有包含凭据的入站中是掩码，导入后无法使用。
+// 覆盖已有入站时也不能用被覆盖入站的凭据代替
+func checkImportMasked(inbound *model.Inbound) error {
+	if inbound.SecondaryForwardPassword == model.SecretMask {
+		return common.NewError("二次转发密码是掩码，请导出时选择包含客户端 id 和密码")
+	}
+	_, err := model.RestoreInboundSettings(inbound.Protocol, inbound.Settings, "")
+	if err != nil {
+		return common.NewError("入站凭据是掩码，请导出时选择包含客户端 id 和密码:", err)
+	}
+	return nil
+}
+
+// checkImportInbound 与新增入站相同的校验，失败的入站在报告中标记为错误
+func (s *TransferService) checkImportInbound(inbound *model.Inbound) error {
+	err := checkImportMasked(inbound)
+	if err != nil {
+		return err
+	}
+	err = ValidateInboundConfig(inbound)
+	if err != nil {
+		return err
+	}
+	err = s.inboundService.validateSecondaryForward(inbound)
+	if err != nil {
+		return err
+	}
+	return s.inboundService.tlsCertService.CheckStreamCerts(inbound.StreamSettings)
+}
+
+// planInbounds 按冲突处理方式决定每个入站的导入方式，返回需要新增和覆盖的入站
+func (s *TransferService) planInbounds(data *ExportData, options *ImportOptions, report *ImportReport) ([]*model.Inbound, []*model.Inbound, error) {
+	existing, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, nil, err
+	}
+	existingPorts := map[int]*model.Inbound{}
+	for _, inbound := range existing {
+		existingPorts[inbound.Port] = inbound
+	}
+	// 已被导入的入站占用的端口，避免导入文件内部的冲突
+	usedPorts := map[int]bool{}
+	isFree := func(port int) bool {
+		_, exist := existingPorts[port]
+		return !exist && !usedPorts[port]
+	}
+
+	adds := make([]*model.Inbound, 0)
+	overwrites := make([]*model.Inbound, 0)
+	conflict := options.Conflict
+	for _, inbound := range data.Inbounds {
+		result := &ImportInboundResult{
+			Remark:  inbound.Remark,
+			Port:    inbound.Port,
+			NewPort: inbound.Port,
+			Action:  ImportActionAdd,
+		}
+		report.Inbounds = append(report.Inbounds, result)
+		if inbound.Port <= 0 || inbound.Port > 65535 {
+			result.Action = ImportActionError
+			result.Reason = fmt.Sprint("端口无效: ", inbound.Port)
+			continue
+		}
+
+		old, conflicted := existingPorts[inbound.Port]
+		if usedPorts[inbound.Port] {
+			// 导入文件中重复的端口只能重新编号或跳过
+			conflicted = true
+			old = nil
+		}
+		if conflicted {
+			switch {
+			case conflict == ConflictOverwrite && old != nil:
+				result.Action = ImportActionOverwrite
+			case conflict == ConflictRenumber || conflict == ConflictOverwrite:
+				port := inbound.Port
+				for port <= 65535 && !isFree(port) {
+					port++
+				}
+				if port > 65535 {
+					result.Action = ImportActionError
+					result.Reason = "没有可用的端口"
+					continue
+				}
+				result.Action = ImportActionRenumber
+				result.NewPort = port
+			default:
+				result.Action = ImportActionSkip
+				result.Reason = fmt.Sprint("端口已存在: ", inbound.Port)
+				continue
+			}
+		}
+
+		imported := *inbound
+		imported.Id = 0
+		imported.UserId = options.UserId
+		imported.Port = result.NewPort
+		imported.Tag = fmt.Sprintf("inbound-%v", imported.Port)
+		err := s.checkImportInbound(&imported)
+		if err != nil {
+			result.Action = ImportActionError
+			result.Reason = err.Error()
+			continue
+		}
+		usedPorts[imported.Port] = true
+		if result.Action == ImportActionOverwrite {
+			imported.Id = old.Id
+			imported.UserId = old.UserId
+			overwrites = append(overwrites, &imported)
+		} else {
+			adds = append(adds, &imported)
+		}
+	}
+	return adds, overwrites, nil
+}
+
+// planSettings 将导入的设置合并到当前设置，返回合并后的设置和有变化的设置项
+func (s *TransferService) planSettings(data *ExportData, options *ImportOptions, report *ImportReport) (entity.AllSetting, error) {
+	current, err := s.settingService.GetAllSetting()
+	if err != nil {
+		return nil, err
+	}
+	merged := entity.AllSetting{}
+	for key, value := range current {
+		merged[key] = value
+	}
+	if options.ImportSettings {
+		for key, raw := range data.Settings {
+			if nonPortableSettings[key] {
+				continue
+			}
+			oldValue, ok := current[key]
+			if !ok {
+				continue
+			}
+			value, err := parseSettingValue(settingDefMap[key], raw)
+			if err != nil {
+				return nil, common.NewError("导入的设置无效:", err)
+			}
+			if oldValue != value {
+				report.Settings = append(report.Settings, key)
+				merged[key] = value
+			}
+		}
+		sort.Strings(report.Settings)
+	}
+	if options.ImportTemplate && data.XrayTemplateConfig != "" && data.XrayTemplateConfig != current.GetString("xrayTemplateConfig") {
+		report.TemplateChanged = true
+		merged["xrayTemplateConfig"] = data.XrayTemplateConfig
+	}
+	if len(report.Settings) == 0 && !report.TemplateChanged {
+		return nil, nil
+	}
+	err = CheckAllSetting(merged)
+	if err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// Import 导入导出文件。新增、覆盖的入站和设置在同一事务中保存，
+// 有任何入站无法导入时不做任何修改；DryRun 时只返回报告
+func (s *TransferService) Import(data *ExportData, options *ImportOptions) (*ImportReport, error) {
+	if data.Version <= 0 || data.Version > ExportVersion {
+		return nil, common.NewErrorf("不支持的导出文件版本 %v，当前支持 %v", data.Version, ExportVersion)
+	}
+	switch options.Conflict {
+	case "":
+		options.Conflict = ConflictSkip
+	case ConflictSkip, ConflictRenumber, ConflictOverwrite:
+	default:
+		return nil, common.NewError("不支持的冲突处理方式:", options.Conflict)
+	}
+	report := &ImportReport{
+		DryRun:   options.DryRun,
+		Inbounds: make([]*ImportInboundResult, 0, len(data.Inbounds)),
+		Settings: make([]string, 0),
+	}
+	adds, overwrites, err := s.planInbounds(data, options, report)
+	if err != nil {
+		return nil, err
+	}
+	newSetting, err := s.planSettings(data, options, report)
+	if err != nil {
+		return nil, err
+	}
+	if options.DryRun {
+		return report, nil
+	}
+	for _, result := range report.Inbounds {
+		if result.Action == ImportActionError {
+			return report, common.NewErrorf("入站 %v (端口 %v) 无法导入: %v", result.Remark, result.Port, result.Reason)
+		}
+	}
+
+	err = s.inboundService.prepareInbounds(adds)
+	if err != nil {
+		return report, err
+	}
+	updates := make([]*model.Inbound, 0, len(overwrites))
+	for _, inbound := range overwrites {
+		updated, err := s.inboundService.prepareUpdateInbound(inbound)
+		if err != nil {
+			return report, err
+		}
+		updates = append(updates, updated)
+	}
+	var changes []*model.SettingChange
+	if newSetting != nil {
+		changes, err = s.settingService.getSettingChanges(newSetting)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	db := database.GetDB()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := s.inboundService.saveInbounds(tx, adds)
+		if err != nil {
+			return err
+		}
+		err = s.inboundService.saveInbounds(tx, updates)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+		return s.settingService.saveChangesTx(tx, &model.SettingVersion{UserId: options.UserId, Source: model.SettingSourceImport}, changes)
+	})
+	if err != nil {
+		return report, err
+	}
+	return report, nil
+}
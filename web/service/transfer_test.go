@@ -0,0 +1,145 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"x-ui/database/model"
+)
+
+func newTestInbound(port int, settings string) *model.Inbound {
+	return &model.Inbound{
+		UserId:   1,
+		Enable:   true,
+		Port:     port,
+		Protocol: model.Socks,
+		Settings: settings,
+	}
+}
+
+func addTestInbound(t *testing.T, inbound *model.Inbound) {
+	t.Helper()
+	err := (&InboundService{}).AddInbound(inbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportIsAtomic(t *testing.T) {
+	initTestDB(t)
+	addTestInbound(t, newTestInbound(20000, `{"auth": "noauth"}`))
+
+	// 第一个入站可以新增，第二个覆盖的入站配置无效，整个导入都不能生效
+	data := &ExportData{
+		Version: ExportVersion,
+		Inbounds: []*model.Inbound{
+			newTestInbound(20001, `{"auth": "noauth"}`),
+			newTestInbound(20000, `{"auth": "password"}`),
+		},
+		Settings: map[string]interface{}{"tgBindWarnDays": 5},
+	}
+	service := TransferService{}
+	_, err := service.Import(data, &ImportOptions{UserId: 1, Conflict: ConflictOverwrite, ImportSettings: true})
+	if err == nil {
+		t.Fatal("import with an invalid inbound should fail")
+	}
+
+	inbounds, err := service.inboundService.GetAllInbounds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inbounds) != 1 || inbounds[0].Settings != `{"auth": "noauth"}` {
+		t.Errorf("inbounds changed by failed import: %+v", inbounds)
+	}
+	days, err := service.settingService.getInt("tgBindWarnDays")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if days != 3 {
+		t.Errorf("tgBindWarnDays = %v, want unchanged 3", days)
+	}
+}
+
+func TestImportAddOverwriteAndSettings(t *testing.T) {
+	initTestDB(t)
+	existing := newTestInbound(20000, `{"auth": "noauth"}`)
+	addTestInbound(t, existing)
+
+	data := &ExportData{
+		Version: ExportVersion,
+		Inbounds: []*model.Inbound{
+			newTestInbound(20001, `{"auth": "noauth"}`),
+			newTestInbound(20000, `{"auth": "noauth", "udp": true}`),
+		},
+		Settings: map[string]interface{}{"tgBindWarnDays": 5},
+	}
+	service := TransferService{}
+	report, err := service.Import(data, &ImportOptions{UserId: 1, Conflict: ConflictOverwrite, ImportSettings: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Inbounds[0].Action != ImportActionAdd || report.Inbounds[1].Action != ImportActionOverwrite {
+		t.Errorf("report = %+v %+v", report.Inbounds[0], report.Inbounds[1])
+	}
+
+	inbounds, err := service.inboundService.GetAllInbounds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inbounds) != 2 {
+		t.Fatalf("inbounds count = %v, want 2", len(inbounds))
+	}
+	overwritten, err := service.inboundService.GetInbound(existing.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(overwritten.Settings, `"udp": true`) {
+		t.Errorf("overwritten settings = %v", overwritten.Settings)
+	}
+	days, err := service.settingService.getInt("tgBindWarnDays")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if days != 5 {
+		t.Errorf("tgBindWarnDays = %v, want 5", days)
+	}
+}
+
+func TestImportRejectsMaskedCredentials(t *testing.T) {
+	initTestDB(t)
+	existing := newTestInbound(20000, `{"auth": "password", "accounts": [{"user": "u", "pass": "secret"}]}`)
+	addTestInbound(t, existing)
+
+	// 未包含凭据导出的文件覆盖已有入站时，不能沿用被覆盖入站的密码
+	masked := newTestInbound(20000, `{"auth": "password", "accounts": [{"user": "u", "pass": "`+model.SecretMask+`"}]}`)
+	data := &ExportData{Version: ExportVersion, Inbounds: []*model.Inbound{masked}}
+	service := TransferService{}
+	report, err := service.Import(data, &ImportOptions{UserId: 1, Conflict: ConflictOverwrite})
+	if err == nil {
+		t.Fatal("import masked credentials should fail")
+	}
+	if report.Inbounds[0].Action != ImportActionError || !strings.Contains(report.Inbounds[0].Reason, "掩码") {
+		t.Errorf("report = %+v", report.Inbounds[0])
+	}
+}
+
+func TestImportReportsInvalidConfig(t *testing.T) {
+	initTestDB(t)
+	data := &ExportData{
+		Version: ExportVersion,
+		Inbounds: []*model.Inbound{
+			newTestInbound(20001, `{"auth": "noauth"}`),
+			newTestInbound(20002, `{"auth": "password"}`),
+		},
+	}
+	service := TransferService{}
+	report, err := service.Import(data, &ImportOptions{UserId: 1, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Inbounds[0].Action != ImportActionAdd {
+		t.Errorf("valid inbound action = %v, want %v", report.Inbounds[0].Action, ImportActionAdd)
+	}
+	if report.Inbounds[1].Action != ImportActionError || !strings.Contains(report.Inbounds[1].Reason, "accounts") {
+		t.Errorf("invalid inbound result = %+v, want error on accounts", report.Inbounds[1])
+	}
+}
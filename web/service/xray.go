@@ -3,7 +3,9 @@ package service
 import (
 	"encoding/json"
 	"errors"
+	"os"
 	"sync"
+	"time"
 	"x-ui/logger"
 	"x-ui/xray"
 
@@ -16,8 +18,11 @@ var isNeedXrayRestart atomic.Bool
 var result string
 
 type XrayService struct {
-	inboundService InboundService
-	settingService SettingService
+	inboundService     InboundService
+	settingService     SettingService
+	routingService     RoutingService
+	forwardPoolService ForwardPoolService
+	tlsCertService     TlsCertService
 }
 
 func (s *XrayService) IsXrayRunning() bool {
@@ -68,13 +73,39 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	certs, err := s.tlsCertService.GetTlsCertMap()
+	if err != nil {
+		return nil, err
+	}
 	for _, inbound := range inbounds {
 		if !inbound.Enable {
 			continue
 		}
 		inboundConfig := inbound.GenXrayInboundConfig()
+		inboundConfig.StreamSettings, err = RenderStreamCerts(inboundConfig.StreamSettings, certs)
+		if err != nil {
+			// 证书有问题时跳过这个入站，不影响其他入站
+			logger.Warningf("render certificates of inbound %v failed: %v", inbound.Tag, err)
+			continue
+		}
 		xrayConfig.InboundConfigs = append(xrayConfig.InboundConfigs, *inboundConfig)
 	}
+
+	rules, err := s.routingService.GetEnabledRoutingRules()
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		xrayConfig.RuleConfigs = append(xrayConfig.RuleConfigs, *rule.GenXrayRuleConfig())
+	}
+
+	pools, err := s.forwardPoolService.GetForwardPools()
+	if err != nil {
+		return nil, err
+	}
+	for _, pool := range pools {
+		xrayConfig.ForwardPools = append(xrayConfig.ForwardPools, *pool)
+	}
 	return xrayConfig, nil
 }
 
@@ -105,6 +136,7 @@ func (s *XrayService) RestartXray(isForce bool) error {
 
 	p = xray.NewProcess(xrayConfig)
 	result = ""
+	RecordXrayRestart()
 	return p.Start()
 }
 
@@ -125,3 +157,43 @@ func (s *XrayService) SetToNeedRestart() {
 func (s *XrayService) IsNeedRestartAndSetFalse() bool {
 	return isNeedXrayRestart.CAS(true, false)
 }
+
+// RotateLogs 将 xray 配置中的访问日志和错误日志改名保存，然后重启 xray 重新创建日志文件，返回改名后的文件
+func (s *XrayService) RotateLogs() ([]string, error) {
+	xrayConfig, err := s.GetXrayConfig()
+	if err != nil {
+		return nil, err
+	}
+	logConfig := struct {
+		Access string `json:"access"`
+		Error  string `json:"error"`
+	}{}
+	if len(xrayConfig.LogConfig) > 0 {
+		err = json.Unmarshal(xrayConfig.LogConfig, &logConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+	suffix := time.Now().Format("20060102-150405")
+	rotated := make([]string, 0)
+	for _, path := range []string{logConfig.Access, logConfig.Error} {
+		if path == "" || path == "none" {
+			continue
+		}
+		_, err = os.Stat(path)
+		if err != nil {
+			// 访问日志和错误日志可能是同一个文件，已经被改名
+			continue
+		}
+		newPath := path + "." + suffix
+		err = os.Rename(path, newPath)
+		if err != nil {
+			return rotated, err
+		}
+		rotated = append(rotated, newPath)
+	}
+	if len(rotated) == 0 {
+		return rotated, nil
+	}
+	return rotated, s.RestartXray(true)
+}
@@ -0,0 +1,37 @@
+package translation
+
+import (
+	"embed"
+	"io/fs"
+
+	"github.com/BurntSushi/toml"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+//go:embed *.toml
+var translationFS embed.FS
+
+// NewBundle 加载所有翻译文件，默认语言为简体中文
+func NewBundle() (*i18n.Bundle, error) {
+	bundle := i18n.NewBundle(language.SimplifiedChinese)
+	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
+	err := fs.WalkDir(translationFS, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		data, err := translationFS.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		_, err = bundle.ParseMessageFileBytes(data, path)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
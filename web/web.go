@@ -20,14 +20,13 @@ import (
 	"x-ui/web/job"
 	"x-ui/web/network"
 	"x-ui/web/service"
+	"x-ui/web/translation"
 
-	"github.com/BurntSushi/toml"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"github.com/robfig/cron/v3"
-	"golang.org/x/text/language"
 )
 
 //go:embed assets/*
@@ -36,9 +35,6 @@ var assetsFS embed.FS
 //go:embed html/*
 var htmlFS embed.FS
 
-//go:embed translation/*
-var i18nFS embed.FS
-
 var startTime = time.Now()
 
 type wrapAssetsFS struct {
@@ -81,6 +77,13 @@ type Server struct {
 	httpServer *http.Server
 	listener   net.Listener
 
+	metricsServer   *http.Server
+	metricsListener net.Listener
+
+	// ACME HTTP-01 验证服务
+	acmeServer   *http.Server
+	acmeListener net.Listener
+
 	index  *controller.IndexController
 	server *controller.ServerController
 	xui    *controller.XUIController
@@ -88,6 +91,7 @@ type Server struct {
 	xrayService    service.XrayService
 	settingService service.SettingService
 	inboundService service.InboundService
+	tgBotService   service.TgBotService
 
 	cron *cron.Cron
 
@@ -207,26 +211,31 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 	s.server = controller.NewServerController(g)
 	s.xui = controller.NewXUIController(g)
 
+	metricsEnable, err := s.settingService.GetMetricsEnable()
+	if err != nil {
+		return nil, err
+	}
+	metricsListen, err := s.settingService.GetMetricsListen()
+	if err != nil {
+		return nil, err
+	}
+	// 未单独设置监听地址时，指标接口挂在面板的根路径下
+	if metricsEnable && metricsListen == "" {
+		metricsToken, err := s.settingService.GetMetricsToken()
+		if err != nil {
+			return nil, err
+		}
+		if metricsToken == "" {
+			logger.Warning("metrics token is empty, /metrics on the panel listener will refuse all requests")
+		}
+		controller.NewMetricsController(g, true)
+	}
+
 	return engine, nil
 }
 
 func (s *Server) initI18n(engine *gin.Engine) error {
-	bundle := i18n.NewBundle(language.SimplifiedChinese)
-	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
-	err := fs.WalkDir(i18nFS, "translation", func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
-		data, err := i18nFS.ReadFile(path)
-		if err != nil {
-			return err
-		}
-		_, err = bundle.ParseMessageFileBytes(data, path)
-		return err
-	})
+	bundle, err := translation.NewBundle()
 	if err != nil {
 		return err
 	}
@@ -285,34 +294,82 @@ func (s *Server) startTask() {
 		logger.Warning("start xray failed:", err)
 	}
 	// 每 30 秒检查一次 xray 是否在运行
-	s.cron.AddJob("@every 30s", job.NewCheckXrayRunningJob())
+	s.cron.AddJob("@every 30s", job.NewTimedJob("check_xray_running", job.NewCheckXrayRunningJob()))
 
 	go func() {
 		time.Sleep(time.Second * 5)
 		// 每 10 秒统计一次流量，首次启动延迟 5 秒，与重启 xray 的时间错开
-		s.cron.AddJob("@every 10s", job.NewXrayTrafficJob())
+		s.cron.AddJob("@every 10s", job.NewTimedJob("xray_traffic", job.NewXrayTrafficJob()))
 	}()
 
 	// 每 30 秒检查一次 inbound 流量超出和到期的情况
-	s.cron.AddJob("@every 30s", job.NewCheckInboundJob())
-	// 每一天提示一次流量情况,上海时间8点30
-	var entry cron.EntryID
-	isTgbotenabled, err := s.settingService.GetTgbotenabled()
-	if (err == nil) && (isTgbotenabled) {
-		runtime, err := s.settingService.GetTgbotRuntime()
-		if err != nil || runtime == "" {
-			logger.Errorf("Add NewStatsNotifyJob error[%s],Runtime[%s] invalid,wil run default", err, runtime)
-			runtime = "@daily"
+	s.cron.AddJob("@every 30s", job.NewTimedJob("check_inbound", job.NewCheckInboundJob()))
+	// 每 30 秒探测一次二次转发上游的连通性
+	s.cron.AddJob("@every 30s", job.NewTimedJob("check_forward_health", job.NewCheckForwardHealthJob()))
+	// 每 30 秒检查一次告警规则
+	s.cron.AddJob("@every 30s", job.NewTimedJob("alert", job.NewAlertJob()))
+	// 每 6 小时检查一次证书库中需要续期的证书
+	s.cron.AddJob("@every 6h", job.NewTimedJob("tls_cert_renew", job.NewTlsCertRenewJob()))
+	// 每分钟检查一次绑定电报的用户是否需要流量或到期提醒
+	s.cron.AddJob("@every 1m", job.NewTimedJob("tg_binding_warn", job.NewTgBindingWarnJob()))
+	// 每分钟记录一次系统状态，并合并、清理历史采样
+	s.cron.AddJob("0 * * * * *", job.NewTimedJob("status_history", job.NewStatusHistoryJob()))
+	// 按设置的时间定时备份数据库
+	backupEnable, err := s.settingService.GetBackupEnable()
+	if err == nil && backupEnable {
+		backupCron, err := s.settingService.GetBackupCron()
+		if err == nil {
+			_, err = s.cron.AddJob(backupCron, job.NewTimedJob("backup", job.NewBackupJob()))
 		}
-		logger.Infof("Tg notify enabled,run at %s", runtime)
-		entry, err = s.cron.AddJob(runtime, job.NewStatsNotifyJob())
 		if err != nil {
-			logger.Warning("Add NewStatsNotifyJob error", err)
-			return
+			logger.Warning("add backup job failed:", err)
 		}
-	} else {
-		s.cron.Remove(entry)
 	}
+	// 每一天提示一次流量情况,上海时间8点30
+	// 通知渠道可以在面板运行时启用，任务始终调度，运行时没有启用的渠道则跳过
+	runtime, err := s.settingService.GetTgbotRuntime()
+	if err != nil || runtime == "" {
+		logger.Errorf("Add NewStatsNotifyJob error[%s],Runtime[%s] invalid,wil run default", err, runtime)
+		runtime = "@daily"
+	}
+	logger.Infof("Stats notify run at %s", runtime)
+	_, err = s.cron.AddJob(runtime, job.NewTimedJob("stats_notify", job.NewStatsNotifyJob()))
+	if err != nil {
+		logger.Warning("Add NewStatsNotifyJob error", err)
+		return
+	}
+}
+
+// startMetricsServer 在单独的地址上提供 /metrics，便于只对监控系统开放
+func (s *Server) startMetricsServer() error {
+	metricsEnable, err := s.settingService.GetMetricsEnable()
+	if err != nil {
+		return err
+	}
+	metricsListen, err := s.settingService.GetMetricsListen()
+	if err != nil {
+		return err
+	}
+	if !metricsEnable || metricsListen == "" {
+		return nil
+	}
+	engine := gin.New()
+	engine.Use(gin.Recovery())
+	controller.NewMetricsController(engine.Group("/"), false)
+
+	listener, err := net.Listen("tcp", metricsListen)
+	if err != nil {
+		return err
+	}
+	logger.Info("metrics server run http on", listener.Addr())
+	s.metricsListener = listener
+	s.metricsServer = &http.Server{
+		Handler: engine,
+	}
+	go func() {
+		s.metricsServer.Serve(listener)
+	}()
+	return nil
 }
 
 func (s *Server) Start() (err error) {
@@ -351,12 +408,19 @@ func (s *Server) Start() (err error) {
 	if err != nil {
 		return err
 	}
+	acmeManager, err := s.newAcmeManager()
+	if err != nil {
+		return err
+	}
 	listenAddr := net.JoinHostPort(listen, strconv.Itoa(port))
 	listener, err := net.Listen("tcp", listenAddr)
 	if err != nil {
 		return err
 	}
-	if certFile != "" || keyFile != "" {
+	if acmeManager != nil {
+		listener = network.NewAutoHttpsListener(listener)
+		listener = tls.NewListener(listener, acmeManager.TLSConfig())
+	} else if certFile != "" || keyFile != "" {
 		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
 		if err != nil {
 			listener.Close()
@@ -369,15 +433,35 @@ func (s *Server) Start() (err error) {
 		listener = tls.NewListener(listener, c)
 	}
 
-	if certFile != "" || keyFile != "" {
+	if acmeManager != nil || certFile != "" || keyFile != "" {
 		logger.Info("web server run https on", listener.Addr())
 	} else {
 		logger.Info("web server run http on", listener.Addr())
 	}
 	s.listener = listener
 
+	// 指标端口在启动定时任务和电报机器人之前监听，启动失败时不会留下已经运行的任务
+	err = s.startMetricsServer()
+	if err != nil {
+		return err
+	}
+
 	s.startTask()
 
+	err = s.tgBotService.Start(s.ctx)
+	if err != nil {
+		logger.Warning("start telegram bot failed:", err)
+	}
+
+	if acmeManager != nil {
+		// 验证端口被占用等情况不影响面板启动，仍可以使用 TLS-ALPN-01 验证和已缓存的证书
+		err = s.startAcmeHttpServer(acmeManager, port)
+		if err != nil {
+			logger.Warning("start acme http-01 server failed, only tls-alpn-01 challenge is available:", err)
+		}
+		go s.prefetchAcmeCerts(acmeManager)
+	}
+
 	s.httpServer = &http.Server{
 		Handler: engine,
 	}
@@ -391,19 +475,38 @@ func (s *Server) Start() (err error) {
 
 func (s *Server) Stop() error {
 	s.cancel()
+	// 等待电报机器人的长轮询退出，重启后新的轮询才不会与它冲突
+	s.tgBotService.Stop()
 	s.xrayService.StopXray()
 	if s.cron != nil {
 		s.cron.Stop()
 	}
 	var err1 error
 	var err2 error
+	var err3 error
+	var err4 error
+	var err5 error
+	var err6 error
 	if s.httpServer != nil {
 		err1 = s.httpServer.Shutdown(s.ctx)
 	}
 	if s.listener != nil {
 		err2 = s.listener.Close()
 	}
-	return common.Combine(err1, err2)
+	if s.metricsServer != nil {
+		err3 = s.metricsServer.Shutdown(s.ctx)
+	}
+	if s.metricsListener != nil {
+		err4 = s.metricsListener.Close()
+	}
+	if s.acmeServer != nil {
+		service.SetAcmeHttpServing(false)
+		err5 = s.acmeServer.Shutdown(s.ctx)
+	}
+	if s.acmeListener != nil {
+		err6 = s.acmeListener.Close()
+	}
+	return common.Combine(err1, err2, err3, err4, err5, err6)
 }
 
 func (s *Server) GetCtx() context.Context {
@@ -416,6 +416,7 @@ ssl_cert_issue() {
     LOGI "2.知晓Cloudflare Global API Key"
     LOGI "3.域名已通过Cloudflare进行解析到当前服务器"
     LOGI "4.该脚本申请证书默认安装路径为/root/cert目录"
+    LOGI "如果域名可以直接解析到本机，也可以在面板设置中启用自动申请证书（ACME），无需本脚本"
     confirm "我已确认以上内容[y/n]" "y"
     if [ $? -eq 0 ]; then
         cd ~
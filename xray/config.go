@@ -19,6 +19,11 @@ type Config struct {
 	Stats           json_util.RawMessage `json:"stats"`
 	Reverse         json_util.RawMessage `json:"reverse"`
 	FakeDNS         json_util.RawMessage `json:"fakeDns"`
+
+	// 数据库中的路由规则，生成配置时追加在模板规则之后
+	RuleConfigs []model.RuleConfig `json:"-"`
+	// 二次转发上游池，只有被入站引用的才会生成出站
+	ForwardPools []model.ForwardPool `json:"-"`
 }
 
 func (c *Config) Equals(other *Config) bool {
@@ -60,6 +65,19 @@ func (c *Config) Equals(other *Config) bool {
 	if !bytes.Equal(c.FakeDNS, other.FakeDNS) {
 		return false
 	}
+	if len(c.RuleConfigs) != len(other.RuleConfigs) {
+		return false
+	}
+	for i := range c.RuleConfigs {
+		if !RuleConfigEquals(&c.RuleConfigs[i], &other.RuleConfigs[i]) {
+			return false
+		}
+	}
+	pools1, err1 := json.Marshal(c.ForwardPools)
+	pools2, err2 := json.Marshal(other.ForwardPools)
+	if err1 != nil || err2 != nil || !bytes.Equal(pools1, pools2) {
+		return false
+	}
 	return true
 }
 
@@ -90,25 +108,47 @@ func (c *Config) BuildConfig() map[string]interface{} {
 	var inbounds []interface{}
 	var secondaryForwardOutbounds []interface{}
 	var routingRules []interface{}
+	var poolIds []int
+	poolUsed := map[int]bool{}
+	
+	// 数据库路由规则排在二次转发规则之前
+	for i := range c.RuleConfigs {
+		routingRules = append(routingRules, c.RuleConfigs[i])
+	}
 	
 	for i := range c.InboundConfigs {
 		inbound := &c.InboundConfigs[i]
 		
-		// 应用二次转发设置到inbound配置
-		ApplySecondaryForward(inbound)
-		
 		// 添加入站配置
 		inboundMap := map[string]interface{}{
-			"listen":         json.RawMessage(inbound.Listen),
+			"listen":         inbound.Listen,
 			"port":           inbound.Port,
 			"protocol":       inbound.Protocol,
-			"settings":       json.RawMessage(inbound.Settings),
-			"streamSettings": json.RawMessage(inbound.StreamSettings),
+			"settings":       inbound.Settings,
+			"streamSettings": inbound.StreamSettings,
 			"tag":            inbound.Tag,
-			"sniffing":       json.RawMessage(inbound.Sniffing),
+			"sniffing":       inbound.Sniffing,
 		}
 		inbounds = append(inbounds, inboundMap)
 		
+		// 引用上游池时添加指向 balancer 的路由规则，池内出站在后面统一生成
+		if HasSecondaryForward(inbound) && inbound.SecondaryForwardProtocol == model.SecondaryForwardPool {
+			if !c.hasForwardPool(inbound.SecondaryForwardPoolId) {
+				continue
+			}
+			if !poolUsed[inbound.SecondaryForwardPoolId] {
+				poolUsed[inbound.SecondaryForwardPoolId] = true
+				poolIds = append(poolIds, inbound.SecondaryForwardPoolId)
+			}
+			rule := map[string]interface{}{
+				"type":        "field",
+				"inboundTag":  []string{inbound.Tag},
+				"balancerTag": GetSecondaryForwardTag(inbound),
+			}
+			routingRules = append(routingRules, rule)
+			continue
+		}
+		
 		// 如果有二次转发，添加出站配置
 		if inbound.SecondaryForwardEnable && inbound.SecondaryForwardProtocol != "" && inbound.SecondaryForwardProtocol != "none" {
 			outboundJSON, outboundTag := GetSecondaryForwardOutbound(inbound)
@@ -146,13 +186,20 @@ func (c *Config) BuildConfig() map[string]interface{} {
 		outbounds = append(outbounds, secondaryForwardOutbounds...)
 	}
 	
+	// 添加上游池出站配置
+	poolOutbounds, balancers, observatory := c.genForwardPools(poolIds)
+	outbounds = append(outbounds, poolOutbounds...)
+	if observatory != nil {
+		config["observatory"] = observatory
+	}
+	
 	if len(outbounds) > 0 {
 		config["outbounds"] = outbounds
 	}
 	
 	// 添加路由规则
-	if len(routingRules) > 0 {
-		c.updateRoutingConfig(config, routingRules)
+	if len(routingRules) > 0 || len(balancers) > 0 {
+		c.updateRoutingConfig(config, routingRules, balancers)
 	}
 	
 	// 添加其他配置
@@ -196,7 +243,7 @@ func (c *Config) BuildConfig() map[string]interface{} {
 }
 
 // updateRoutingConfig 更新路由配置，添加二次转发规则
-func (c *Config) updateRoutingConfig(config map[string]interface{}, newRules []interface{}) {
+func (c *Config) updateRoutingConfig(config map[string]interface{}, newRules []interface{}, newBalancers []interface{}) {
 	// 获取现有的路由配置
 	var routing map[string]interface{}
 	if len(c.RouterConfig) > 0 {
@@ -217,6 +264,15 @@ func (c *Config) updateRoutingConfig(config map[string]interface{}, newRules []i
 	rules = append(rules, newRules...)
 	routing["rules"] = rules
 	
+	// 添加上游池的负载均衡器
+	if len(newBalancers) > 0 {
+		var balancers []interface{}
+		if existingBalancers, ok := routing["balancers"].([]interface{}); ok {
+			balancers = existingBalancers
+		}
+		routing["balancers"] = append(balancers, newBalancers...)
+	}
+	
 	// 更新路由配置
 	routingJSON, err := json.Marshal(routing)
 	if err == nil {
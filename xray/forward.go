@@ -0,0 +1,541 @@
+package xray
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"x-ui/database/model"
+	"x-ui/util/common"
+)
+
+var uuidRegex = regexp.MustCompile("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$")
+
+// ForwardUpstream 二次转发上游服务器，地址、端口和认证信息保存在 inbound 的独立字段中，
+// 其余协议和传输参数以 JSON 形式保存在 SecondaryForwardSettings 中
+type ForwardUpstream struct {
+	Protocol string `json:"-"`
+	Address  string `json:"-"`
+	Port     int    `json:"-"`
+	Username string `json:"-"`
+	Password string `json:"-"`
+
+	// vmess / vless
+	Id         string `json:"id,omitempty"`
+	AlterId    int    `json:"alterId,omitempty"`
+	Security   string `json:"security,omitempty"`
+	Encryption string `json:"encryption,omitempty"`
+	Flow       string `json:"flow,omitempty"`
+	// shadowsocks
+	Method string `json:"method,omitempty"`
+
+	// 传输层
+	Network        string   `json:"network,omitempty"`
+	StreamSecurity string   `json:"streamSecurity,omitempty"`
+	ServerName     string   `json:"serverName,omitempty"`
+	Fingerprint    string   `json:"fingerprint,omitempty"`
+	Alpn           []string `json:"alpn,omitempty"`
+	AllowInsecure  bool     `json:"allowInsecure,omitempty"`
+	PublicKey      string   `json:"publicKey,omitempty"`
+	ShortId        string   `json:"shortId,omitempty"`
+	SpiderX        string   `json:"spiderX,omitempty"`
+	Path           string   `json:"path,omitempty"`
+	Host           string   `json:"host,omitempty"`
+	ServiceName    string   `json:"serviceName,omitempty"`
+	HeaderType     string   `json:"headerType,omitempty"`
+}
+
+// NewForwardUpstream 由独立字段和扩展参数 JSON 组装上游
+func NewForwardUpstream(protocol string, address string, port int, username string, password string, settings string) (*ForwardUpstream, error) {
+	u := &ForwardUpstream{}
+	if settings != "" {
+		err := json.Unmarshal([]byte(settings), u)
+		if err != nil {
+			return nil, common.NewError("secondary forward settings invalid:", err)
+		}
+	}
+	u.Protocol = protocol
+	u.Address = address
+	u.Port = port
+	u.Username = username
+	u.Password = password
+	return u, nil
+}
+
+// GetForwardUpstream 从 inbound 配置中读取二次转发上游
+func GetForwardUpstream(c *model.InboundConfig) (*ForwardUpstream, error) {
+	return NewForwardUpstream(c.SecondaryForwardProtocol, c.SecondaryForwardAddress, c.SecondaryForwardPort,
+		c.SecondaryForwardUsername, c.SecondaryForwardPassword, c.SecondaryForwardSettings)
+}
+
+// GetPoolMemberUpstream 从上游池成员中读取上游
+func GetPoolMemberUpstream(m *model.ForwardPoolMember) (*ForwardUpstream, error) {
+	return NewForwardUpstream(m.Protocol, m.Address, m.Port, m.Username, m.Password, m.Settings)
+}
+
+// SettingsJSON 返回需要保存到 SecondaryForwardSettings 的扩展参数
+func (u *ForwardUpstream) SettingsJSON() string {
+	data, err := json.Marshal(u)
+	if err != nil || string(data) == "{}" {
+		return ""
+	}
+	return string(data)
+}
+
+func (u *ForwardUpstream) Validate() error {
+	if u.Address == "" {
+		return common.NewError("二次转发服务器地址不能为空")
+	}
+	if u.Port <= 0 || u.Port > 65535 {
+		return common.NewError("二次转发端口必须在1-65535之间")
+	}
+	switch u.Protocol {
+	case model.SecondaryForwardSOCKS, model.SecondaryForwardHTTP, model.SecondaryForwardHTTPS:
+	case model.SecondaryForwardVMess, model.SecondaryForwardVLESS:
+		if !uuidRegex.MatchString(u.Id) {
+			return common.NewError("二次转发用户 id 不是有效的 UUID:", u.Id)
+		}
+	case model.SecondaryForwardTrojan:
+		if u.Password == "" {
+			return common.NewError("trojan 二次转发密码不能为空")
+		}
+	case model.SecondaryForwardShadowsocks:
+		if u.Method == "" || u.Password == "" {
+			return common.NewError("shadowsocks 二次转发加密方式和密码不能为空")
+		}
+	default:
+		return common.NewError("不支持的二次转发协议:", u.Protocol)
+	}
+	switch u.StreamSecurity {
+	case "", "none", "tls":
+	case "reality":
+		if u.PublicKey == "" || u.ServerName == "" {
+			return common.NewError("reality 二次转发需要填写 publicKey 和 serverName")
+		}
+	default:
+		return common.NewError("不支持的传输层安全类型:", u.StreamSecurity)
+	}
+	switch u.Network {
+	case "", "tcp", "ws", "grpc", "h2", "http", "kcp", "quic", "httpupgrade":
+	default:
+		return common.NewError("不支持的传输方式:", u.Network)
+	}
+	return nil
+}
+
+func (u *ForwardUpstream) getUsers() []map[string]interface{} {
+	if u.Username == "" || u.Password == "" {
+		return nil
+	}
+	return []map[string]interface{}{
+		{
+			"user": u.Username,
+			"pass": u.Password,
+		},
+	}
+}
+
+// GenOutbound 生成对应协议的 xray 出站配置
+func (u *ForwardUpstream) GenOutbound(tag string) map[string]interface{} {
+	var protocol string
+	var settings map[string]interface{}
+	server := map[string]interface{}{
+		"address": u.Address,
+		"port":    u.Port,
+	}
+
+	switch u.Protocol {
+	case model.SecondaryForwardSOCKS:
+		protocol = "socks"
+		if users := u.getUsers(); users != nil {
+			server["users"] = users
+		}
+		settings = map[string]interface{}{"servers": []interface{}{server}}
+	case model.SecondaryForwardHTTP, model.SecondaryForwardHTTPS:
+		protocol = "http"
+		if users := u.getUsers(); users != nil {
+			server["users"] = users
+		}
+		settings = map[string]interface{}{"servers": []interface{}{server}}
+	case model.SecondaryForwardVMess:
+		protocol = "vmess"
+		security := u.Security
+		if security == "" {
+			security = "auto"
+		}
+		server["users"] = []interface{}{
+			map[string]interface{}{
+				"id":       u.Id,
+				"alterId":  u.AlterId,
+				"security": security,
+			},
+		}
+		settings = map[string]interface{}{"vnext": []interface{}{server}}
+	case model.SecondaryForwardVLESS:
+		protocol = "vless"
+		encryption := u.Encryption
+		if encryption == "" {
+			encryption = "none"
+		}
+		user := map[string]interface{}{
+			"id":         u.Id,
+			"encryption": encryption,
+		}
+		if u.Flow != "" {
+			user["flow"] = u.Flow
+		}
+		server["users"] = []interface{}{user}
+		settings = map[string]interface{}{"vnext": []interface{}{server}}
+	case model.SecondaryForwardTrojan:
+		protocol = "trojan"
+		server["password"] = u.Password
+		if u.Flow != "" {
+			server["flow"] = u.Flow
+		}
+		settings = map[string]interface{}{"servers": []interface{}{server}}
+	case model.SecondaryForwardShadowsocks:
+		protocol = "shadowsocks"
+		server["method"] = u.Method
+		server["password"] = u.Password
+		settings = map[string]interface{}{"servers": []interface{}{server}}
+	default:
+		return nil
+	}
+
+	outbound := map[string]interface{}{
+		"protocol": protocol,
+		"settings": settings,
+		"tag":      tag,
+	}
+	if streamSettings := u.genStreamSettings(); streamSettings != nil {
+		outbound["streamSettings"] = streamSettings
+	}
+	return outbound
+}
+
+func (u *ForwardUpstream) genStreamSettings() map[string]interface{} {
+	security := u.StreamSecurity
+	if u.Protocol == model.SecondaryForwardHTTPS || (u.Protocol == model.SecondaryForwardTrojan && security == "") {
+		security = "tls"
+	}
+	if security == "none" {
+		security = ""
+	}
+	network := u.Network
+	if network == "http" {
+		network = "h2"
+	}
+	if network == "" && security == "" {
+		return nil
+	}
+	if network == "" {
+		network = "tcp"
+	}
+
+	stream := map[string]interface{}{
+		"network": network,
+	}
+	switch network {
+	case "tcp":
+		if u.HeaderType == "http" {
+			request := map[string]interface{}{}
+			if u.Path != "" {
+				request["path"] = []string{u.Path}
+			}
+			if u.Host != "" {
+				request["headers"] = map[string]interface{}{"Host": strings.Split(u.Host, ",")}
+			}
+			stream["tcpSettings"] = map[string]interface{}{
+				"header": map[string]interface{}{
+					"type":    "http",
+					"request": request,
+				},
+			}
+		}
+	case "ws":
+		ws := map[string]interface{}{"path": u.Path}
+		if u.Host != "" {
+			ws["headers"] = map[string]interface{}{"Host": u.Host}
+		}
+		stream["wsSettings"] = ws
+	case "httpupgrade":
+		stream["httpupgradeSettings"] = map[string]interface{}{
+			"path": u.Path,
+			"host": u.Host,
+		}
+	case "grpc":
+		stream["grpcSettings"] = map[string]interface{}{"serviceName": u.ServiceName}
+	case "h2":
+		h2 := map[string]interface{}{"path": u.Path}
+		if u.Host != "" {
+			h2["host"] = strings.Split(u.Host, ",")
+		}
+		stream["httpSettings"] = h2
+	case "kcp":
+		if u.HeaderType != "" {
+			stream["kcpSettings"] = map[string]interface{}{
+				"header": map[string]interface{}{"type": u.HeaderType},
+			}
+		}
+	case "quic":
+		if u.HeaderType != "" {
+			stream["quicSettings"] = map[string]interface{}{
+				"header": map[string]interface{}{"type": u.HeaderType},
+			}
+		}
+	}
+
+	serverName := u.ServerName
+	if serverName == "" && net.ParseIP(u.Address) == nil {
+		serverName = u.Address
+	}
+	switch security {
+	case "tls":
+		tlsSettings := map[string]interface{}{
+			"serverName":    serverName,
+			"allowInsecure": u.AllowInsecure,
+		}
+		if len(u.Alpn) > 0 {
+			tlsSettings["alpn"] = u.Alpn
+		}
+		if u.Fingerprint != "" {
+			tlsSettings["fingerprint"] = u.Fingerprint
+		}
+		stream["security"] = "tls"
+		stream["tlsSettings"] = tlsSettings
+	case "reality":
+		fingerprint := u.Fingerprint
+		if fingerprint == "" {
+			fingerprint = "chrome"
+		}
+		stream["security"] = "reality"
+		stream["realitySettings"] = map[string]interface{}{
+			"serverName":  serverName,
+			"fingerprint": fingerprint,
+			"publicKey":   u.PublicKey,
+			"shortId":     u.ShortId,
+			"spiderX":     u.SpiderX,
+		}
+	}
+	return stream
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	encodings := []*base64.Encoding{
+		base64.StdEncoding,
+		base64.RawStdEncoding,
+		base64.URLEncoding,
+		base64.RawURLEncoding,
+	}
+	var err error
+	for _, encoding := range encodings {
+		var data []byte
+		data, err = encoding.DecodeString(s)
+		if err == nil {
+			return data, nil
+		}
+	}
+	return nil, err
+}
+
+// ParseShareLink 解析 vmess/vless/trojan/ss/socks/http(s) 分享链接
+func ParseShareLink(link string) (*ForwardUpstream, error) {
+	link = strings.TrimSpace(link)
+	i := strings.Index(link, "://")
+	if i < 0 {
+		return nil, common.NewError("invalid share link:", link)
+	}
+	scheme := strings.ToLower(link[:i])
+	switch scheme {
+	case "vmess":
+		return parseVMessLink(link[i+3:])
+	case "ss":
+		return parseShadowsocksLink(link)
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return nil, common.NewError("invalid share link port:", u.Port())
+	}
+	upstream := &ForwardUpstream{
+		Address: u.Hostname(),
+		Port:    port,
+	}
+	query := u.Query()
+	switch scheme {
+	case "vless":
+		upstream.Protocol = model.SecondaryForwardVLESS
+		upstream.Id = u.User.Username()
+		upstream.Encryption = query.Get("encryption")
+		upstream.Flow = query.Get("flow")
+		upstream.applyQuery(query)
+	case "trojan":
+		upstream.Protocol = model.SecondaryForwardTrojan
+		upstream.Password = u.User.Username()
+		upstream.Flow = query.Get("flow")
+		upstream.applyQuery(query)
+	case "socks", "socks5", "http", "https":
+		switch scheme {
+		case "http":
+			upstream.Protocol = model.SecondaryForwardHTTP
+		case "https":
+			upstream.Protocol = model.SecondaryForwardHTTPS
+			upstream.ServerName = query.Get("sni")
+		default:
+			upstream.Protocol = model.SecondaryForwardSOCKS
+		}
+		if u.User != nil {
+			upstream.Username = u.User.Username()
+			upstream.Password, _ = u.User.Password()
+			if _, ok := u.User.Password(); !ok && upstream.Protocol == model.SecondaryForwardSOCKS {
+				// 部分客户端将 user:pass 整体 base64 编码
+				if data, err := decodeBase64(upstream.Username); err == nil {
+					parts := strings.SplitN(string(data), ":", 2)
+					if len(parts) == 2 {
+						upstream.Username = parts[0]
+						upstream.Password = parts[1]
+					}
+				}
+			}
+		}
+	default:
+		return nil, common.NewError("unsupported share link scheme:", scheme)
+	}
+	return upstream, nil
+}
+
+func (u *ForwardUpstream) applyQuery(query url.Values) {
+	u.Network = query.Get("type")
+	u.StreamSecurity = query.Get("security")
+	u.ServerName = query.Get("sni")
+	u.Fingerprint = query.Get("fp")
+	u.PublicKey = query.Get("pbk")
+	u.ShortId = query.Get("sid")
+	u.SpiderX = query.Get("spx")
+	u.Path = query.Get("path")
+	u.Host = query.Get("host")
+	u.ServiceName = query.Get("serviceName")
+	u.HeaderType = query.Get("headerType")
+	if alpn := query.Get("alpn"); alpn != "" {
+		u.Alpn = strings.Split(alpn, ",")
+	}
+	allowInsecure := query.Get("allowInsecure")
+	u.AllowInsecure = allowInsecure == "1" || allowInsecure == "true"
+}
+
+func parseVMessLink(encoded string) (*ForwardUpstream, error) {
+	if i := strings.Index(encoded, "#"); i >= 0 {
+		encoded = encoded[:i]
+	}
+	data, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, common.NewError("vmess link decode failed:", err)
+	}
+	// 不同客户端导出的 port/aid 可能是字符串也可能是数字
+	link := map[string]interface{}{}
+	err = json.Unmarshal(data, &link)
+	if err != nil {
+		return nil, common.NewError("vmess link invalid:", err)
+	}
+	get := func(key string) string {
+		switch v := link[key].(type) {
+		case string:
+			return v
+		case float64:
+			return strconv.Itoa(int(v))
+		}
+		return ""
+	}
+	port, err := strconv.Atoi(get("port"))
+	if err != nil {
+		return nil, common.NewError("vmess link port invalid:", get("port"))
+	}
+	alterId, _ := strconv.Atoi(get("aid"))
+	upstream := &ForwardUpstream{
+		Protocol:       model.SecondaryForwardVMess,
+		Address:        get("add"),
+		Port:           port,
+		Id:             get("id"),
+		AlterId:        alterId,
+		Security:       get("scy"),
+		Network:        get("net"),
+		StreamSecurity: get("tls"),
+		ServerName:     get("sni"),
+		Fingerprint:    get("fp"),
+		Host:           get("host"),
+		Path:           get("path"),
+		HeaderType:     get("type"),
+	}
+	if upstream.Network == "grpc" {
+		upstream.ServiceName = upstream.Path
+		upstream.Path = ""
+	}
+	if alpn := get("alpn"); alpn != "" {
+		upstream.Alpn = strings.Split(alpn, ",")
+	}
+	return upstream, nil
+}
+
+func parseShadowsocksLink(link string) (*ForwardUpstream, error) {
+	body := strings.TrimPrefix(link[strings.Index(link, "://")+3:], "//")
+	if i := strings.Index(body, "#"); i >= 0 {
+		body = body[:i]
+	}
+	if i := strings.Index(body, "?"); i >= 0 {
+		body = body[:i]
+	}
+	body = strings.TrimSuffix(body, "/")
+
+	var userInfo, hostPort string
+	if i := strings.LastIndex(body, "@"); i >= 0 {
+		// SIP002: ss://base64(method:password)@host:port
+		userInfo = body[:i]
+		hostPort = body[i+1:]
+		if data, err := decodeBase64(userInfo); err == nil && strings.Contains(string(data), ":") {
+			userInfo = string(data)
+		} else if unescaped, err := url.PathUnescape(userInfo); err == nil {
+			userInfo = unescaped
+		}
+	} else {
+		// 旧格式: ss://base64(method:password@host:port)
+		data, err := decodeBase64(body)
+		if err != nil {
+			return nil, common.NewError("shadowsocks link decode failed:", err)
+		}
+		decoded := string(data)
+		i := strings.LastIndex(decoded, "@")
+		if i < 0 {
+			return nil, common.NewError("shadowsocks link invalid:", link)
+		}
+		userInfo = decoded[:i]
+		hostPort = decoded[i+1:]
+	}
+
+	parts := strings.SplitN(userInfo, ":", 2)
+	if len(parts) != 2 {
+		return nil, common.NewError("shadowsocks link invalid:", link)
+	}
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, common.NewError("shadowsocks link port invalid:", portStr)
+	}
+	return &ForwardUpstream{
+		Protocol: model.SecondaryForwardShadowsocks,
+		Address:  host,
+		Port:     port,
+		Method:   parts[0],
+		Password: parts[1],
+	}, nil
+}
@@ -51,77 +51,22 @@ func InboundConfigEquals(c, other *model.InboundConfig) bool {
 	if c.SecondaryForwardPassword != other.SecondaryForwardPassword {
 		return false
 	}
-	
-	return true
-}
-
-// ApplySecondaryForward 应用二次转发配置到settings
-func ApplySecondaryForward(c *model.InboundConfig) {
-	if !c.SecondaryForwardEnable || c.SecondaryForwardProtocol == "" {
-		return
-	}
-	
-	// 根据协议类型应用二次转发配置
-	switch c.SecondaryForwardProtocol {
-	case "socks":
-		applySocksForward(c)
-	case "http":
-		applyHTTPForward(c)
-	}
-}
-
-// applySocksForward 应用SOCKS二次转发
-func applySocksForward(c *model.InboundConfig) {
-	// 解析现有的settings
-	var settings map[string]interface{}
-	if len(c.Settings) > 0 {
-		json.Unmarshal(c.Settings, &settings)
-	} else {
-		settings = make(map[string]interface{})
-	}
-	
-	// 添加SOCKS代理设置 - Xray的proxySettings格式
-	proxySettings := map[string]interface{}{
-		"proxySettings": map[string]interface{}{
-			"tag": fmt.Sprintf("socks-forward-%d", c.Port),
-		},
+	if c.SecondaryForwardSettings != other.SecondaryForwardSettings {
+		return false
 	}
-	
-	// 合并设置
-	for k, v := range proxySettings {
-		settings[k] = v
+	if c.SecondaryForwardPoolId != other.SecondaryForwardPoolId {
+		return false
 	}
 	
-	// 更新settings
-	updatedSettings, _ := json.Marshal(settings)
-	c.Settings = updatedSettings
+	return true
 }
 
-// applyHTTPForward 应用HTTP二次转发
-func applyHTTPForward(c *model.InboundConfig) {
-	// 解析现有的settings
-	var settings map[string]interface{}
-	if len(c.Settings) > 0 {
-		json.Unmarshal(c.Settings, &settings)
-	} else {
-		settings = make(map[string]interface{})
-	}
-	
-	// 添加HTTP代理设置
-	proxySettings := map[string]interface{}{
-		"proxySettings": map[string]interface{}{
-			"tag": fmt.Sprintf("http-forward-%d", c.Port),
-		},
+// GetSecondaryForwardTag 获取二次转发出站的tag
+func GetSecondaryForwardTag(c *model.InboundConfig) string {
+	if c.SecondaryForwardProtocol == model.SecondaryForwardPool {
+		return GetPoolBalancerTag(c.SecondaryForwardPoolId)
 	}
-	
-	// 合并设置
-	for k, v := range proxySettings {
-		settings[k] = v
-	}
-	
-	// 更新settings
-	updatedSettings, _ := json.Marshal(settings)
-	c.Settings = updatedSettings
+	return fmt.Sprintf("%s-forward-%d", c.SecondaryForwardProtocol, c.Port)
 }
 
 // GetSecondaryForwardOutbound 获取二次转发出站配置
@@ -129,72 +74,18 @@ func GetSecondaryForwardOutbound(c *model.InboundConfig) (json_util.RawMessage,
 	if !c.SecondaryForwardEnable || c.SecondaryForwardProtocol == "" {
 		return nil, ""
 	}
+	// 上游池的出站由 Config 统一生成
+	if c.SecondaryForwardProtocol == model.SecondaryForwardPool {
+		return nil, ""
+	}
 	
-	var outbound map[string]interface{}
-	var tag string
-	
-	switch c.SecondaryForwardProtocol {
-	case "socks":
-		tag = fmt.Sprintf("socks-forward-%d", c.Port)
-		
-		// 构建用户数组
-		var users []map[string]interface{}
-		if c.SecondaryForwardUsername != "" && c.SecondaryForwardPassword != "" {
-			users = append(users, map[string]interface{}{
-				"user": c.SecondaryForwardUsername,
-				"pass": c.SecondaryForwardPassword,
-			})
-		}
-		
-		outbound = map[string]interface{}{
-			"protocol": "socks",
-			"settings": map[string]interface{}{
-				"servers": []map[string]interface{}{
-					{
-						"address": c.SecondaryForwardAddress,
-						"port":    c.SecondaryForwardPort,
-					},
-				},
-			},
-			"tag": tag,
-		}
-		
-		// 如果有认证信息，添加到服务器配置
-		if len(users) > 0 {
-			outbound["settings"].(map[string]interface{})["servers"].([]map[string]interface{})[0]["users"] = users
-		}
-		
-	case "http":
-		tag = fmt.Sprintf("http-forward-%d", c.Port)
-		
-		// 构建用户数组
-		var users []map[string]interface{}
-		if c.SecondaryForwardUsername != "" && c.SecondaryForwardPassword != "" {
-			users = append(users, map[string]interface{}{
-				"user": c.SecondaryForwardUsername,
-				"pass": c.SecondaryForwardPassword,
-			})
-		}
-		
-		outbound = map[string]interface{}{
-			"protocol": "http",
-			"settings": map[string]interface{}{
-				"servers": []map[string]interface{}{
-					{
-						"address": c.SecondaryForwardAddress,
-						"port":    c.SecondaryForwardPort,
-					},
-				},
-			},
-			"tag": tag,
-		}
-		
-		// 如果有认证信息，添加到服务器配置
-		if len(users) > 0 {
-			outbound["settings"].(map[string]interface{})["servers"].([]map[string]interface{})[0]["users"] = users
-		}
-		
-	default:
+	upstream, err := GetForwardUpstream(c)
+	if err != nil {
+		return nil, ""
+	}
+	tag := GetSecondaryForwardTag(c)
+	outbound := upstream.GenOutbound(tag)
+	if outbound == nil {
 		return nil, ""
 	}
 	
@@ -208,13 +99,17 @@ func GetSecondaryForwardRoutingRule(c *model.InboundConfig) (json_util.RawMessag
 		return nil, ""
 	}
 	
-	tag := fmt.Sprintf("%s-forward-%d", c.SecondaryForwardProtocol, c.Port)
+	tag := GetSecondaryForwardTag(c)
 	
 	// 创建路由规则：将此入站的所有流量转发到对应的代理出站
 	routingRule := map[string]interface{}{
 		"type": "field",
 		"inboundTag": []string{c.Tag},
-		"outboundTag": tag,
+	}
+	if c.SecondaryForwardProtocol == model.SecondaryForwardPool {
+		routingRule["balancerTag"] = tag
+	} else {
+		routingRule["outboundTag"] = tag
 	}
 	
 	routingRuleJSON, _ := json.Marshal(routingRule)
@@ -223,6 +118,9 @@ func GetSecondaryForwardRoutingRule(c *model.InboundConfig) (json_util.RawMessag
 
 // HasSecondaryForward 检查是否有二次转发配置
 func HasSecondaryForward(c *model.InboundConfig) bool {
+	if c.SecondaryForwardEnable && c.SecondaryForwardProtocol == model.SecondaryForwardPool {
+		return c.SecondaryForwardPoolId > 0
+	}
 	return c.SecondaryForwardEnable && c.SecondaryForwardProtocol != "" && 
 	       c.SecondaryForwardAddress != "" && c.SecondaryForwardPort > 0
 }
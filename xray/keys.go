@@ -0,0 +1,127 @@
+package xray
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"x-ui/util/common"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// Shadowsocks 2022 加密方式及其密钥长度
+var ss2022KeySizes = map[string]int{
+	"2022-blake3-aes-128-gcm":       16,
+	"2022-blake3-aes-256-gcm":       32,
+	"2022-blake3-chacha20-poly1305": 32,
+}
+
+// REALITY shortId 的最大长度，以十六进制字符计
+const maxShortIdLength = 16
+
+// X25519KeyPair REALITY 使用的密钥对，私钥写入入站配置，公钥写入分享链接
+type X25519KeyPair struct {
+	PrivateKey string `json:"privateKey"`
+	PublicKey  string `json:"publicKey"`
+}
+
+// GenerateX25519 生成 x25519 密钥对，与 xray x25519 命令一样使用不带填充的 URL 安全 base64 编码。
+// privateKey 不为空时由它计算公钥
+func GenerateX25519(privateKey string) (*X25519KeyPair, error) {
+	var priv []byte
+	if privateKey != "" {
+		var err error
+		priv, err = base64.RawURLEncoding.DecodeString(privateKey)
+		if err != nil || len(priv) != curve25519.ScalarSize {
+			return nil, common.NewError("invalid x25519 private key:", privateKey)
+		}
+	} else {
+		priv = make([]byte, curve25519.ScalarSize)
+		_, err := rand.Read(priv)
+		if err != nil {
+			return nil, err
+		}
+	}
+	priv[0] &= 248
+	priv[31] &= 127
+	priv[31] |= 64
+	pub, err := curve25519.X25519(priv, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return &X25519KeyPair{
+		PrivateKey: base64.RawURLEncoding.EncodeToString(priv),
+		PublicKey:  base64.RawURLEncoding.EncodeToString(pub),
+	}, nil
+}
+
+// GenerateShortIds 生成 count 个 REALITY shortId，length 为十六进制字符数，必须是不超过 16 的偶数
+func GenerateShortIds(count int, length int) ([]string, error) {
+	if count <= 0 || count > 16 {
+		return nil, common.NewError("short id count must be between 1 and 16:", count)
+	}
+	if length <= 0 || length > maxShortIdLength || length%2 != 0 {
+		return nil, common.NewError("short id length must be an even number between 2 and 16:", length)
+	}
+	shortIds := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		buf := make([]byte, length/2)
+		_, err := rand.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		shortIds = append(shortIds, hex.EncodeToString(buf))
+	}
+	return shortIds, nil
+}
+
+// GenerateUUID 生成随机的 v4 UUID
+func GenerateUUID() (string, error) {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	buf[6] = buf[6]&0x0f | 0x40
+	buf[8] = buf[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:16]), nil
+}
+
+// IsSS2022Method 是否是 Shadowsocks 2022 加密方式，这类方式的密码必须是对应长度的 base64 密钥
+func IsSS2022Method(method string) bool {
+	_, ok := ss2022KeySizes[method]
+	return ok
+}
+
+// GenerateSS2022Key 按 Shadowsocks 2022 加密方式生成对应长度的 base64 密钥
+func GenerateSS2022Key(method string) (string, error) {
+	size, ok := ss2022KeySizes[method]
+	if !ok {
+		return "", common.NewError("not a shadowsocks 2022 method:", method)
+	}
+	buf := make([]byte, size)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf), nil
+}
+
+// IsValidUUID 是否是标准格式的 UUID
+func IsValidUUID(id string) bool {
+	return uuidRegex.MatchString(id)
+}
+
+// CheckSS2022Key 检查 Shadowsocks 2022 密钥是否是对应加密方式长度的 base64 密钥
+func CheckSS2022Key(method string, key string) error {
+	size, ok := ss2022KeySizes[method]
+	if !ok {
+		return common.NewError("not a shadowsocks 2022 method:", method)
+	}
+	data, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(data) != size {
+		return fmt.Errorf("%v 的密钥必须是 %d 字节的 base64", method, size)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package xray
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+)
+
+func TestGenerateX25519(t *testing.T) {
+	pair, err := GenerateX25519("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{pair.PrivateKey, pair.PublicKey} {
+		data, err := base64.RawURLEncoding.DecodeString(key)
+		if err != nil || len(data) != 32 {
+			t.Errorf("key %q is not 32 bytes of unpadded url base64", key)
+		}
+	}
+	// 由私钥重新计算的公钥不变
+	again, err := GenerateX25519(pair.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *again != *pair {
+		t.Errorf("GenerateX25519(%q) = %+v, want %+v", pair.PrivateKey, again, pair)
+	}
+	other, err := GenerateX25519("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.PrivateKey == pair.PrivateKey {
+		t.Error("GenerateX25519 returned the same private key twice")
+	}
+
+	// RFC 7748 6.1 的测试向量
+	priv, _ := hex.DecodeString("77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a")
+	pub, _ := hex.DecodeString("8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a")
+	pair, err = GenerateX25519(base64.RawURLEncoding.EncodeToString(priv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.PublicKey != base64.RawURLEncoding.EncodeToString(pub) {
+		t.Errorf("public key = %v, want %v", pair.PublicKey, base64.RawURLEncoding.EncodeToString(pub))
+	}
+
+	for _, key := range []string{"not base64!", base64.RawURLEncoding.EncodeToString(make([]byte, 31)), base64.StdEncoding.EncodeToString(priv)} {
+		if _, err := GenerateX25519(key); err == nil {
+			t.Errorf("GenerateX25519(%q) succeeded", key)
+		}
+	}
+}
+
+func TestGenerateShortIds(t *testing.T) {
+	for _, c := range []struct {
+		count  int
+		length int
+	}{
+		{1, 2},
+		{4, 8},
+		{16, 16},
+	} {
+		shortIds, err := GenerateShortIds(c.count, c.length)
+		if err != nil {
+			t.Fatalf("GenerateShortIds(%v, %v): %v", c.count, c.length, err)
+		}
+		if len(shortIds) != c.count {
+			t.Errorf("GenerateShortIds(%v, %v) returned %v ids", c.count, c.length, len(shortIds))
+		}
+		for _, shortId := range shortIds {
+			if _, err := hex.DecodeString(shortId); err != nil || len(shortId) != c.length {
+				t.Errorf("short id %q is not %v hex characters", shortId, c.length)
+			}
+		}
+	}
+	shortIds, _ := GenerateShortIds(16, 16)
+	seen := map[string]bool{}
+	for _, shortId := range shortIds {
+		if seen[shortId] {
+			t.Errorf("duplicate short id %v", shortId)
+		}
+		seen[shortId] = true
+	}
+
+	for _, c := range []struct {
+		count  int
+		length int
+	}{
+		{0, 8},
+		{17, 8},
+		{1, 0},
+		{1, 3},
+		{1, 18},
+	} {
+		if _, err := GenerateShortIds(c.count, c.length); err == nil {
+			t.Errorf("GenerateShortIds(%v, %v) succeeded", c.count, c.length)
+		}
+	}
+}
+
+func TestGenerateSS2022Key(t *testing.T) {
+	for method, size := range ss2022KeySizes {
+		if !IsSS2022Method(method) {
+			t.Errorf("IsSS2022Method(%v) = false", method)
+		}
+		key, err := GenerateSS2022Key(method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := base64.StdEncoding.DecodeString(key)
+		if err != nil || len(data) != size {
+			t.Errorf("%v key %q is not %v bytes of base64", method, key, size)
+		}
+		if err := CheckSS2022Key(method, key); err != nil {
+			t.Errorf("CheckSS2022Key(%v, %v): %v", method, key, err)
+		}
+	}
+
+	// 长度与加密方式不符的密钥
+	key16 := base64.StdEncoding.EncodeToString(make([]byte, 16))
+	key32 := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	for _, c := range [][2]string{
+		{"2022-blake3-aes-128-gcm", key32},
+		{"2022-blake3-aes-256-gcm", key16},
+		{"2022-blake3-chacha20-poly1305", "password"},
+		{"aes-256-gcm", key32},
+	} {
+		if err := CheckSS2022Key(c[0], c[1]); err == nil {
+			t.Errorf("CheckSS2022Key(%v, %v) succeeded", c[0], c[1])
+		}
+	}
+	if IsSS2022Method("aes-256-gcm") {
+		t.Error("IsSS2022Method(aes-256-gcm) = true")
+	}
+	if _, err := GenerateSS2022Key("aes-256-gcm"); err == nil {
+		t.Error("GenerateSS2022Key(aes-256-gcm) succeeded")
+	}
+}
@@ -0,0 +1,108 @@
+package xray
+
+import (
+	"fmt"
+	"x-ui/database/model"
+)
+
+const defaultProbeURL = "https://www.google.com/generate_204"
+
+func GetPoolBalancerTag(poolId int) string {
+	return fmt.Sprintf("pool-%d", poolId)
+}
+
+func GetPoolMemberTag(poolId int, memberId int) string {
+	return fmt.Sprintf("pool-%d-%d", poolId, memberId)
+}
+
+// getPoolSelector balancer 按前缀选择出站，末尾的 "-" 避免 pool-1 匹配到 pool-10
+func getPoolSelector(poolId int) string {
+	return GetPoolBalancerTag(poolId) + "-"
+}
+
+func (c *Config) getForwardPool(poolId int) *model.ForwardPool {
+	for i := range c.ForwardPools {
+		if c.ForwardPools[i].Id == poolId {
+			return &c.ForwardPools[i]
+		}
+	}
+	return nil
+}
+
+// genForwardPools 为被入站引用的上游池生成出站、balancer 以及 observatory 配置。
+// 所有上游池都加入 observatory，random 和 leastPing 都只在探测可用的上游中选择，
+// 全部不可用时使用第一个上游。observatory 在 xray 中是全局的，探测地址和间隔取第一个填写了该值的上游池
+func (c *Config) genForwardPools(poolIds []int) ([]interface{}, []interface{}, map[string]interface{}) {
+	outbounds := make([]interface{}, 0)
+	balancers := make([]interface{}, 0)
+	selectors := make([]string, 0)
+	probeURL := ""
+	probeInterval := ""
+
+	for _, poolId := range poolIds {
+		pool := c.getForwardPool(poolId)
+		if pool == nil {
+			continue
+		}
+		fallbackTag := ""
+		for i := range pool.Members {
+			member := &pool.Members[i]
+			upstream, err := GetPoolMemberUpstream(member)
+			if err != nil {
+				continue
+			}
+			tag := GetPoolMemberTag(pool.Id, member.Id)
+			outbound := upstream.GenOutbound(tag)
+			if outbound == nil {
+				continue
+			}
+			outbounds = append(outbounds, outbound)
+			if fallbackTag == "" {
+				fallbackTag = tag
+			}
+		}
+		if fallbackTag == "" {
+			continue
+		}
+		strategy := pool.Strategy
+		if strategy == "" {
+			strategy = model.BalancerRandom
+		}
+		// xray 只在设置了 fallbackTag 时才让 random 策略读取 observatory 的探测结果
+		balancers = append(balancers, map[string]interface{}{
+			"tag":         GetPoolBalancerTag(pool.Id),
+			"selector":    []string{getPoolSelector(pool.Id)},
+			"strategy":    map[string]interface{}{"type": strategy},
+			"fallbackTag": fallbackTag,
+		})
+		selectors = append(selectors, getPoolSelector(pool.Id))
+		if probeURL == "" {
+			probeURL = pool.ProbeURL
+		}
+		if probeInterval == "" {
+			probeInterval = pool.ProbeInterval
+		}
+	}
+
+	if len(selectors) == 0 {
+		return outbounds, balancers, nil
+	}
+	if probeURL == "" {
+		probeURL = defaultProbeURL
+	}
+	if probeInterval == "" {
+		probeInterval = "1m"
+	}
+	observatory := map[string]interface{}{
+		"subjectSelector": selectors,
+		"probeURL":        probeURL,
+		"probeInterval":   probeInterval,
+	}
+	return outbounds, balancers, observatory
+}
+
+// hasForwardPool 判断上游池是否存在并且至少有一个上游
+func (c *Config) hasForwardPool(poolId int) bool {
+	pool := c.getForwardPool(poolId)
+	return pool != nil && len(pool.Members) > 0
+}
@@ -0,0 +1,82 @@
+package xray
+
+import (
+	"reflect"
+	"testing"
+	"x-ui/database/model"
+)
+
+func newTestPool(id int, strategy string, probeURL string, memberIds ...int) model.ForwardPool {
+	pool := model.ForwardPool{Id: id, Strategy: strategy, ProbeURL: probeURL}
+	for _, memberId := range memberIds {
+		pool.Members = append(pool.Members, model.ForwardPoolMember{
+			Id:       memberId,
+			PoolId:   id,
+			Protocol: model.SecondaryForwardSOCKS,
+			Address:  "198.51.100.1",
+			Port:     1080,
+		})
+	}
+	return pool
+}
+
+func TestGenForwardPools(t *testing.T) {
+	c := &Config{ForwardPools: []model.ForwardPool{
+		newTestPool(1, model.BalancerRandom, "", 11, 12),
+		newTestPool(2, model.BalancerLeastPing, "https://example.com/204", 21),
+		newTestPool(3, "", "", 31),
+		// 没有上游的池不生成 balancer
+		newTestPool(4, model.BalancerRandom, ""),
+	}}
+	outbounds, balancers, observatory := c.genForwardPools([]int{1, 2, 3, 4, 5})
+
+	if len(outbounds) != 4 {
+		t.Errorf("outbounds = %v, want 4", len(outbounds))
+	}
+	want := []map[string]interface{}{
+		{
+			"tag":         "pool-1",
+			"selector":    []string{"pool-1-"},
+			"strategy":    map[string]interface{}{"type": model.BalancerRandom},
+			"fallbackTag": "pool-1-11",
+		},
+		{
+			"tag":         "pool-2",
+			"selector":    []string{"pool-2-"},
+			"strategy":    map[string]interface{}{"type": model.BalancerLeastPing},
+			"fallbackTag": "pool-2-21",
+		},
+		{
+			"tag":         "pool-3",
+			"selector":    []string{"pool-3-"},
+			"strategy":    map[string]interface{}{"type": model.BalancerRandom},
+			"fallbackTag": "pool-3-31",
+		},
+	}
+	if len(balancers) != len(want) {
+		t.Fatalf("balancers = %v, want %v", balancers, want)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(balancers[i], want[i]) {
+			t.Errorf("balancer %v = %v, want %v", i, balancers[i], want[i])
+		}
+	}
+
+	// random 上游池也需要加入 observatory，才能跳过不可用的上游
+	wantObservatory := map[string]interface{}{
+		"subjectSelector": []string{"pool-1-", "pool-2-", "pool-3-"},
+		"probeURL":        "https://example.com/204",
+		"probeInterval":   "1m",
+	}
+	if !reflect.DeepEqual(observatory, wantObservatory) {
+		t.Errorf("observatory = %v, want %v", observatory, wantObservatory)
+	}
+}
+
+func TestGenForwardPoolsEmpty(t *testing.T) {
+	c := &Config{ForwardPools: []model.ForwardPool{newTestPool(1, model.BalancerRandom, "")}}
+	outbounds, balancers, observatory := c.genForwardPools([]int{1})
+	if len(outbounds) != 0 || len(balancers) != 0 || observatory != nil {
+		t.Errorf("empty pool generated %v, %v, %v", outbounds, balancers, observatory)
+	}
+}
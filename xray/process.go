@@ -10,10 +10,12 @@ import (
 	"io/fs"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
 	"time"
+	"x-ui/config"
 	"x-ui/util/common"
 
 	"github.com/Workiva/go-datastructures/queue"
@@ -28,19 +30,23 @@ func GetBinaryName() string {
 }
 
 func GetBinaryPath() string {
-	return "bin/" + GetBinaryName()
+	return GetBinFilePath(GetBinaryName())
 }
 
 func GetConfigPath() string {
-	return "bin/config.json"
+	return config.GetXrayConfigPath()
 }
 
 func GetGeositePath() string {
-	return "bin/geosite.dat"
+	return GetBinFilePath("geosite.dat")
 }
 
 func GetGeoipPath() string {
-	return "bin/geoip.dat"
+	return GetBinFilePath("geoip.dat")
+}
+
+func GetBinFilePath(name string) string {
+	return filepath.Join(config.GetBinDir(), name)
 }
 
 func stopProcess(p *Process) {
@@ -151,7 +157,7 @@ func (p *process) Start() (err error) {
 		}
 	}()
 
-	data, err := json.MarshalIndent(p.config, "", "  ")
+	data, err := json.MarshalIndent(p.config.BuildConfig(), "", "  ")
 	if err != nil {
 		return common.NewErrorf("生成 xray 配置文件失败: %v", err)
 	}
@@ -259,13 +265,15 @@ func (p *process) GetTraffic(reset bool) ([]*Traffic, error) {
 		if tag == "api" {
 			continue
 		}
-		traffic, ok := tagTrafficMap[tag]
+		// 入站和出站可能使用相同的 tag，需要分开统计
+		key := matchs[1] + ">>>" + tag
+		traffic, ok := tagTrafficMap[key]
 		if !ok {
 			traffic = &Traffic{
 				IsInbound: isInbound,
 				Tag:       tag,
 			}
-			tagTrafficMap[tag] = traffic
+			tagTrafficMap[key] = traffic
 			traffics = append(traffics, traffic)
 		}
 		if isDown {
@@ -277,3 +285,26 @@ func (p *process) GetTraffic(reset bool) ([]*Traffic, error) {
 
 	return traffics, nil
 }
+
+// TestConfig 使用 xray -test 检查配置，返回 xray 的输出
+func TestConfig(config *Config) (string, error) {
+	data, err := json.MarshalIndent(config.BuildConfig(), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp("", "xray-test-*.json")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	closeErr := file.Close()
+	if err != nil {
+		return "", err
+	}
+	if closeErr != nil {
+		return "", closeErr
+	}
+	output, err := exec.Command(GetBinaryPath(), "-test", "-c", file.Name()).CombinedOutput()
+	return string(output), err
+}
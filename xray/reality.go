@@ -0,0 +1,97 @@
+package xray
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"x-ui/util/common"
+)
+
+// REALITY 目标检测的超时时间
+const realityCheckTimeout = 5 * time.Second
+
+// 校验 REALITY 目标证书使用的根证书，为空时使用系统根证书
+var realityRootCAs *x509.CertPool
+
+// RealityCheckResult 使用一个 serverName 连接 REALITY 目标的结果，Latency 单位为毫秒
+type RealityCheckResult struct {
+	ServerName string `json:"serverName"`
+	Ok         bool   `json:"ok"`
+	Alpn       string `json:"alpn"`
+	Latency    int64  `json:"latency"`
+	Error      string `json:"error,omitempty"`
+}
+
+// getRealityDestAddr 将 REALITY 的 dest 转换为连接地址，只有端口时连接本机
+func getRealityDestAddr(dest string) (string, error) {
+	dest = strings.TrimSpace(dest)
+	if dest == "" {
+		return "", common.NewError("reality dest can not be empty")
+	}
+	if strings.HasPrefix(dest, "/") || strings.HasPrefix(dest, "@") {
+		return "", common.NewError("checking unix socket dest is not supported:", dest)
+	}
+	if port, err := strconv.Atoi(dest); err == nil {
+		return net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), nil
+	}
+	host, port, err := net.SplitHostPort(dest)
+	if err != nil || host == "" {
+		return "", common.NewError("reality dest must be host:port:", dest)
+	}
+	if _, err := strconv.Atoi(port); err != nil {
+		return "", common.NewError("reality dest port invalid:", dest)
+	}
+	return dest, nil
+}
+
+// CheckRealityDest 对每个 serverName 与 dest 进行 TLS 握手，REALITY 要求目标支持 TLS 1.3 和 X25519，
+// 并且证书对 serverName 有效
+func CheckRealityDest(dest string, serverNames []string) ([]*RealityCheckResult, error) {
+	addr, err := getRealityDestAddr(dest)
+	if err != nil {
+		return nil, err
+	}
+	if len(serverNames) == 0 {
+		return nil, common.NewError("reality serverNames can not be empty")
+	}
+	results := make([]*RealityCheckResult, 0, len(serverNames))
+	for _, serverName := range serverNames {
+		result := &RealityCheckResult{ServerName: serverName}
+		start := time.Now()
+		alpn, err := realityHandshake(addr, serverName)
+		result.Latency = time.Since(start).Milliseconds()
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Ok = true
+			result.Alpn = alpn
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func realityHandshake(addr string, serverName string) (string, error) {
+	conn, err := net.DialTimeout("tcp", addr, realityCheckTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(realityCheckTimeout))
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:       serverName,
+		RootCAs:          realityRootCAs,
+		MinVersion:       tls.VersionTLS13,
+		MaxVersion:       tls.VersionTLS13,
+		CurvePreferences: []tls.CurveID{tls.X25519},
+		NextProtos:       []string{"h2", "http/1.1"},
+	})
+	err = tlsConn.Handshake()
+	if err != nil {
+		return "", err
+	}
+	return tlsConn.ConnectionState().NegotiatedProtocol, nil
+}
@@ -0,0 +1,133 @@
+package xray
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGetRealityDestAddr(t *testing.T) {
+	for _, c := range []struct {
+		dest string
+		want string
+	}{
+		{"8443", "127.0.0.1:8443"},
+		{" www.example.com:443 ", "www.example.com:443"},
+		{"1.1.1.1:443", "1.1.1.1:443"},
+		{"[2001:db8::1]:443", "[2001:db8::1]:443"},
+		{"", ""},
+		{"/dev/shm/dest.sock", ""},
+		{"@abstract", ""},
+		{"www.example.com", ""},
+		{":443", ""},
+		{"www.example.com:https", ""},
+		{"2001:db8::1:443", ""},
+	} {
+		got, err := getRealityDestAddr(c.dest)
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("getRealityDestAddr(%q) = %q, want error", c.dest, got)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("getRealityDestAddr(%q) = %q, %v, want %q", c.dest, got, err, c.want)
+		}
+	}
+}
+
+// startTestTLSServer 使用 serverName 的自签名证书监听本地端口，返回端口和证书
+func startTestTLSServer(t *testing.T, serverName string, maxVersion uint16) (int, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: serverName},
+		DNSNames:              []string{serverName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		MaxVersion:   maxVersion,
+		NextProtos:   []string{"h2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, cert
+}
+
+func TestCheckRealityDest(t *testing.T) {
+	port, cert := startTestTLSServer(t, "www.example.com", tls.VersionTLS13)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	realityRootCAs = pool
+	defer func() { realityRootCAs = nil }()
+
+	// 只有端口时连接本机
+	results, err := CheckRealityDest(strconv.Itoa(port), []string{"www.example.com", "other.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("results = %v, want 2", len(results))
+	}
+	if !results[0].Ok || results[0].Alpn != "h2" || results[0].Error != "" {
+		t.Errorf("result for a valid serverName = %+v", results[0])
+	}
+	// 证书对 serverName 无效
+	if results[1].Ok || results[1].Error == "" {
+		t.Errorf("result for a mismatched serverName = %+v", results[1])
+	}
+
+	// 不支持 TLS 1.3 的目标
+	port12, cert12 := startTestTLSServer(t, "www.example.com", tls.VersionTLS12)
+	pool.AddCert(cert12)
+	results, err = CheckRealityDest("127.0.0.1:"+strconv.Itoa(port12), []string{"www.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Ok {
+		t.Errorf("result for a tls 1.2 dest = %+v", results[0])
+	}
+
+	if _, err := CheckRealityDest(strconv.Itoa(port), nil); err == nil {
+		t.Error("CheckRealityDest without serverNames succeeded")
+	}
+}
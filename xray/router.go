@@ -0,0 +1,567 @@
+package xray
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/database/model"
+	"x-ui/util/common"
+
+	"github.com/xtls/xray-core/app/router"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	RuleSourceTemplate = "template"
+	RuleSourceDatabase = "database"
+	RuleSourceForward  = "forward"
+)
+
+// RuleConfigEquals 比较两个RuleConfig是否相等
+func RuleConfigEquals(c, other *model.RuleConfig) bool {
+	if c.Id != other.Id {
+		return false
+	}
+	data1, err1 := json.Marshal(c)
+	data2, err2 := json.Marshal(other)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return bytes.Equal(data1, data2)
+}
+
+// RouteTarget 路由试算的目标连接
+type RouteTarget struct {
+	Domain     string `json:"domain" form:"domain"`
+	IP         string `json:"ip" form:"ip"`
+	Port       int    `json:"port" form:"port"`
+	Network    string `json:"network" form:"network"`
+	Protocol   string `json:"protocol" form:"protocol"`
+	InboundTag string `json:"inboundTag" form:"inboundTag"`
+	User       string `json:"user" form:"user"`
+}
+
+// RouteResult 路由试算结果
+type RouteResult struct {
+	Matched     bool              `json:"matched"`
+	Index       int               `json:"index"`
+	Source      string            `json:"source"`
+	RuleId      int               `json:"ruleId"`
+	Rule        *model.RuleConfig `json:"rule"`
+	OutboundTag string            `json:"outboundTag"`
+	BalancerTag string            `json:"balancerTag"`
+}
+
+type sourceRule struct {
+	source string
+	rule   model.RuleConfig
+}
+
+// getSourceRules 按 BuildConfig 生成的顺序返回全部路由规则
+func (c *Config) getSourceRules() ([]sourceRule, error) {
+	rules := make([]sourceRule, 0)
+	if len(c.RouterConfig) > 0 {
+		routing := struct {
+			Rules []model.RuleConfig `json:"rules"`
+		}{}
+		err := json.Unmarshal(c.RouterConfig, &routing)
+		if err != nil {
+			return nil, common.NewError("parse template routing failed:", err)
+		}
+		for _, rule := range routing.Rules {
+			rules = append(rules, sourceRule{source: RuleSourceTemplate, rule: rule})
+		}
+	}
+	for _, rule := range c.RuleConfigs {
+		rules = append(rules, sourceRule{source: RuleSourceDatabase, rule: rule})
+	}
+	for i := range c.InboundConfigs {
+		inbound := &c.InboundConfigs[i]
+		if !HasSecondaryForward(inbound) {
+			continue
+		}
+		if inbound.SecondaryForwardProtocol == model.SecondaryForwardPool && !c.hasForwardPool(inbound.SecondaryForwardPoolId) {
+			continue
+		}
+		ruleJSON, _ := GetSecondaryForwardRoutingRule(inbound)
+		if ruleJSON == nil {
+			continue
+		}
+		rule := model.RuleConfig{}
+		if json.Unmarshal(ruleJSON, &rule) == nil {
+			rules = append(rules, sourceRule{source: RuleSourceForward, rule: rule})
+		}
+	}
+	return rules, nil
+}
+
+// getDefaultOutboundTag 未命中任何规则时 xray 使用第一个出站
+func (c *Config) getDefaultOutboundTag() string {
+	outbounds := make([]struct {
+		Tag string `json:"tag"`
+	}, 0)
+	json.Unmarshal(c.OutboundConfigs, &outbounds)
+	if len(outbounds) == 0 {
+		return ""
+	}
+	return outbounds[0].Tag
+}
+
+// MatchRoute 模拟 xray 的路由匹配，返回第一个命中的规则
+func (c *Config) MatchRoute(target *RouteTarget) (*RouteResult, error) {
+	rules, err := c.getSourceRules()
+	if err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		matched, err := MatchRule(&rules[i].rule, target)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+		rule := rules[i].rule
+		return &RouteResult{
+			Matched:     true,
+			Index:       i,
+			Source:      rules[i].source,
+			RuleId:      rule.Id,
+			Rule:        &rule,
+			OutboundTag: rule.OutboundTag,
+			BalancerTag: rule.BalancerTag,
+		}, nil
+	}
+	return &RouteResult{
+		Matched:     false,
+		Index:       -1,
+		OutboundTag: c.getDefaultOutboundTag(),
+	}, nil
+}
+
+// MatchRule 判断目标是否命中规则，规则中的各个条件之间为“与”关系
+func MatchRule(rule *model.RuleConfig, target *RouteTarget) (bool, error) {
+	hasCondition := false
+	if len(rule.Domain) > 0 {
+		hasCondition = true
+		matched, err := matchDomains(rule.Domain, target.Domain)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	if len(rule.IP) > 0 {
+		hasCondition = true
+		matched, err := matchIPs(rule.IP, target.IP)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	if port := parseRawPort(rule.Port); port != "" {
+		hasCondition = true
+		matched, err := MatchPortList(port, target.Port)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	if rule.Network != "" {
+		hasCondition = true
+		if !containsFold(strings.Split(rule.Network, ","), target.Network) {
+			return false, nil
+		}
+	}
+	if len(rule.Protocol) > 0 {
+		hasCondition = true
+		if !containsFold(rule.Protocol, target.Protocol) {
+			return false, nil
+		}
+	}
+	if len(rule.InboundTag) > 0 {
+		hasCondition = true
+		if !contains(rule.InboundTag, target.InboundTag) {
+			return false, nil
+		}
+	}
+	if len(rule.User) > 0 {
+		hasCondition = true
+		if !contains(rule.User, target.User) {
+			return false, nil
+		}
+	}
+	return hasCondition, nil
+}
+
+func contains(list []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), value) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseRawPort(raw []byte) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var n int
+	if json.Unmarshal(raw, &n) == nil {
+		return strconv.Itoa(n)
+	}
+	return string(raw)
+}
+
+// MatchPortList 支持 "53"、"1000-2000" 以及逗号分隔的组合
+func MatchPortList(portList string, port int) (bool, error) {
+	for _, item := range strings.Split(portList, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		from, to, err := parsePortRange(item)
+		if err != nil {
+			return false, err
+		}
+		if port >= from && port <= to {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ValidatePortList 校验端口列表格式
+func ValidatePortList(portList string) error {
+	_, err := MatchPortList(portList, 0)
+	return err
+}
+
+func parsePortRange(item string) (int, int, error) {
+	parts := strings.SplitN(item, "-", 2)
+	from, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || from < 0 || from > 65535 {
+		return 0, 0, common.NewError("invalid port:", item)
+	}
+	to := from
+	if len(parts) == 2 {
+		to, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || to < from || to > 65535 {
+			return 0, 0, common.NewError("invalid port range:", item)
+		}
+	}
+	return from, to, nil
+}
+
+func matchDomains(patterns []string, domain string) (bool, error) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if domain == "" {
+		return false, nil
+	}
+	for _, pattern := range patterns {
+		var matched bool
+		var err error
+		switch {
+		case strings.HasPrefix(pattern, "geosite:"):
+			matched, err = matchGeoSite(GetGeositePath(), strings.TrimPrefix(pattern, "geosite:"), domain)
+		case strings.HasPrefix(pattern, "ext:"):
+			file, category, ok := parseExtPattern(pattern)
+			if !ok {
+				return false, common.NewError("invalid ext domain pattern:", pattern)
+			}
+			matched, err = matchGeoSite(file, category, domain)
+		default:
+			matched, err = matchDomainPattern(pattern, domain)
+		}
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchDomainPattern 匹配 regexp:/domain:/full:/keyword: 以及纯字符串规则
+func matchDomainPattern(pattern string, domain string) (bool, error) {
+	switch {
+	case strings.HasPrefix(pattern, "regexp:"):
+		re, err := regexp.Compile(strings.TrimPrefix(pattern, "regexp:"))
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(domain), nil
+	case strings.HasPrefix(pattern, "domain:"):
+		return matchSubDomain(strings.ToLower(strings.TrimPrefix(pattern, "domain:")), domain), nil
+	case strings.HasPrefix(pattern, "full:"):
+		return strings.ToLower(strings.TrimPrefix(pattern, "full:")) == domain, nil
+	case strings.HasPrefix(pattern, "keyword:"):
+		return strings.Contains(domain, strings.ToLower(strings.TrimPrefix(pattern, "keyword:"))), nil
+	case strings.HasPrefix(pattern, "dotless:"):
+		return !strings.Contains(domain, ".") && strings.Contains(domain, strings.TrimPrefix(pattern, "dotless:")), nil
+	default:
+		return strings.Contains(domain, strings.ToLower(pattern)), nil
+	}
+}
+
+func matchSubDomain(pattern string, domain string) bool {
+	return domain == pattern || strings.HasSuffix(domain, "."+pattern)
+}
+
+// parseExtPattern 解析 ext:file.dat:category，文件相对于 bin 目录
+func parseExtPattern(pattern string) (string, string, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(pattern, "ext:"), ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return GetBinFilePath(parts[0]), parts[1], true
+}
+
+func matchGeoSite(file string, category string, domain string) (bool, error) {
+	attr := ""
+	if i := strings.Index(category, "@"); i >= 0 {
+		attr = category[i+1:]
+		category = category[:i]
+	}
+	site, err := LoadGeoSite(file, category)
+	if err != nil {
+		return false, err
+	}
+	for _, d := range site.Domain {
+		if attr != "" && !hasDomainAttr(d, attr) {
+			continue
+		}
+		value := strings.ToLower(d.Value)
+		switch d.Type {
+		case router.Domain_Plain:
+			if strings.Contains(domain, value) {
+				return true, nil
+			}
+		case router.Domain_Regex:
+			re, err := regexp.Compile(d.Value)
+			if err == nil && re.MatchString(domain) {
+				return true, nil
+			}
+		case router.Domain_Domain:
+			if matchSubDomain(value, domain) {
+				return true, nil
+			}
+		case router.Domain_Full:
+			if value == domain {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func hasDomainAttr(d *router.Domain, attr string) bool {
+	for _, a := range d.Attribute {
+		if strings.EqualFold(a.Key, attr) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchIPs(patterns []string, ipStr string) (bool, error) {
+	if ipStr == "" {
+		return false, nil
+	}
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return false, common.NewError("invalid ip:", ipStr)
+	}
+	for _, pattern := range patterns {
+		var matched bool
+		var err error
+		switch {
+		case strings.HasPrefix(pattern, "geoip:"):
+			category := strings.TrimPrefix(pattern, "geoip:")
+			reverse := strings.HasPrefix(category, "!")
+			matched, err = matchGeoIP(GetGeoipPath(), strings.TrimPrefix(category, "!"), ip)
+			matched = matched != reverse
+		case strings.HasPrefix(pattern, "ext:"):
+			file, category, ok := parseExtPattern(pattern)
+			if !ok {
+				return false, common.NewError("invalid ext ip pattern:", pattern)
+			}
+			reverse := strings.HasPrefix(category, "!")
+			matched, err = matchGeoIP(file, strings.TrimPrefix(category, "!"), ip)
+			matched = matched != reverse
+		default:
+			matched, err = matchCIDR(pattern, ip)
+		}
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchCIDR(pattern string, ip net.IP) (bool, error) {
+	if !strings.Contains(pattern, "/") {
+		other := net.ParseIP(pattern)
+		if other == nil {
+			return false, common.NewError("invalid ip:", pattern)
+		}
+		return other.Equal(ip), nil
+	}
+	_, ipNet, err := net.ParseCIDR(pattern)
+	if err != nil {
+		return false, err
+	}
+	return ipNet.Contains(ip), nil
+}
+
+func matchGeoIP(file string, category string, ip net.IP) (bool, error) {
+	geoip, err := LoadGeoIP(file, category)
+	if err != nil {
+		return false, err
+	}
+	for _, cidr := range geoip.Cidr {
+		ipNet := &net.IPNet{
+			IP:   net.IP(cidr.Ip),
+			Mask: net.CIDRMask(int(cidr.Prefix), len(cidr.Ip)*8),
+		}
+		if ipNet.Contains(ip) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type geoFileCache struct {
+	modTime time.Time
+	sites   map[string]*router.GeoSite
+	ips     map[string]*router.GeoIP
+}
+
+var geoCacheLock sync.Mutex
+var geoCache = map[string]*geoFileCache{}
+
+// loadGeoFile 读取 geosite/geoip 文件，文件未修改时使用缓存
+func loadGeoFile(file string, isSite bool) (*geoFileCache, error) {
+	geoCacheLock.Lock()
+	defer geoCacheLock.Unlock()
+
+	stat, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	cache, ok := geoCache[file]
+	if ok && cache.modTime.Equal(stat.ModTime()) {
+		if (isSite && cache.sites != nil) || (!isSite && cache.ips != nil) {
+			return cache, nil
+		}
+	} else {
+		cache = &geoFileCache{modTime: stat.ModTime()}
+		geoCache[file] = cache
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if isSite {
+		list := &router.GeoSiteList{}
+		err = proto.Unmarshal(data, list)
+		if err != nil {
+			return nil, common.NewErrorf("parse geosite file <%v> failed: %v", file, err)
+		}
+		cache.sites = make(map[string]*router.GeoSite, len(list.Entry))
+		for _, entry := range list.Entry {
+			cache.sites[strings.ToLower(entry.CountryCode)] = entry
+		}
+	} else {
+		list := &router.GeoIPList{}
+		err = proto.Unmarshal(data, list)
+		if err != nil {
+			return nil, common.NewErrorf("parse geoip file <%v> failed: %v", file, err)
+		}
+		cache.ips = make(map[string]*router.GeoIP, len(list.Entry))
+		for _, entry := range list.Entry {
+			cache.ips[strings.ToLower(entry.CountryCode)] = entry
+		}
+	}
+	return cache, nil
+}
+
+func LoadGeoSite(file string, category string) (*router.GeoSite, error) {
+	cache, err := loadGeoFile(file, true)
+	if err != nil {
+		return nil, err
+	}
+	site, ok := cache.sites[strings.ToLower(category)]
+	if !ok {
+		return nil, common.NewErrorf("geosite category <%v> not found in %v", category, file)
+	}
+	return site, nil
+}
+
+func LoadGeoIP(file string, category string) (*router.GeoIP, error) {
+	cache, err := loadGeoFile(file, false)
+	if err != nil {
+		return nil, err
+	}
+	geoip, ok := cache.ips[strings.ToLower(category)]
+	if !ok {
+		return nil, common.NewErrorf("geoip category <%v> not found in %v", category, file)
+	}
+	return geoip, nil
+}
+
+// GetGeoSiteCategories 返回 geosite 文件中的全部分类
+func GetGeoSiteCategories() ([]string, error) {
+	cache, err := loadGeoFile(GetGeositePath(), true)
+	if err != nil {
+		return nil, err
+	}
+	categories := make([]string, 0, len(cache.sites))
+	for category := range cache.sites {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	return categories, nil
+}
+
+// GetGeoIPCategories 返回 geoip 文件中的全部分类
+func GetGeoIPCategories() ([]string, error) {
+	cache, err := loadGeoFile(GetGeoipPath(), false)
+	if err != nil {
+		return nil, err
+	}
+	categories := make([]string, 0, len(cache.ips))
+	for category := range cache.ips {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	return categories, nil
+}
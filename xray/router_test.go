@@ -0,0 +1,283 @@
+package xray
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"x-ui/config"
+	"x-ui/database/model"
+
+	"github.com/xtls/xray-core/app/router"
+	"google.golang.org/protobuf/proto"
+)
+
+// writeGeoIP 在 bin 目录写入只包含一个分类的 geoip 文件
+func writeGeoIP(t *testing.T, name string, category string, cidr string) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix, _ := ipNet.Mask.Size()
+	list := &router.GeoIPList{
+		Entry: []*router.GeoIP{{
+			CountryCode: category,
+			Cidr:        []*router.CIDR{{Ip: ipNet.IP, Prefix: uint32(prefix)}},
+		}},
+	}
+	data, err := proto.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(config.GetBinDir(), name), data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeGeoSite 在 bin 目录写入只包含一个分类的 geosite 文件，带 @ 的域名设置同名属性
+func writeGeoSite(t *testing.T, name string, category string, domains map[string]router.Domain_Type, attrs map[string]string) {
+	site := &router.GeoSite{CountryCode: category}
+	for value, domainType := range domains {
+		domain := &router.Domain{Type: domainType, Value: value}
+		if attr, ok := attrs[value]; ok {
+			domain.Attribute = []*router.Domain_Attribute{{Key: attr, TypedValue: &router.Domain_Attribute_BoolValue{BoolValue: true}}}
+		}
+		site.Domain = append(site.Domain, domain)
+	}
+	data, err := proto.Marshal(&router.GeoSiteList{Entry: []*router.GeoSite{site}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(config.GetBinDir(), name), data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatchRuleDomain(t *testing.T) {
+	config.SetPathFlag(config.PathBinDir, t.TempDir())
+	writeGeoSite(t, "geosite.dat", "TEST", map[string]router.Domain_Type{
+		"example.com": router.Domain_Domain,
+		"full.test":   router.Domain_Full,
+		"ads":         router.Domain_Plain,
+		`^cdn\d+\.`:   router.Domain_Regex,
+	}, map[string]string{"full.test": "cn"})
+	writeGeoSite(t, "ext.dat", "EXT", map[string]router.Domain_Type{
+		"ext.example": router.Domain_Domain,
+	}, nil)
+
+	for _, c := range []struct {
+		pattern string
+		domain  string
+		matched bool
+	}{
+		{"example", "www.example.com", true},
+		{"example", "www.other.com", false},
+		{"domain:example.com", "example.com", true},
+		{"domain:example.com", "a.b.example.com", true},
+		{"domain:example.com", "badexample.com", false},
+		{"domain:Example.com", "WWW.EXAMPLE.COM.", true},
+		{"full:example.com", "example.com", true},
+		{"full:example.com", "www.example.com", false},
+		{"keyword:tube", "www.youtube.com", true},
+		{"keyword:tube", "www.example.com", false},
+		{`regexp:^ads\.`, "ads.example.com", true},
+		{`regexp:^ads\.`, "www.ads.example.com", false},
+		{"dotless:intra", "intranet", true},
+		{"dotless:intra", "intranet.example.com", false},
+		{"geosite:test", "www.example.com", true},
+		{"geosite:test", "full.test", true},
+		{"geosite:test", "www.full.test", false},
+		{"geosite:test", "ads.example.net", true},
+		{"geosite:test", "cdn12.example.net", true},
+		{"geosite:test", "other.net", false},
+		{"geosite:test@cn", "full.test", true},
+		{"geosite:test@cn", "www.example.com", false},
+		{"ext:ext.dat:ext", "www.ext.example", true},
+		{"ext:ext.dat:ext", "www.example.com", false},
+		// 没有域名时域名条件不会命中
+		{"example", "", false},
+	} {
+		rule := &model.RuleConfig{Domain: []string{c.pattern}}
+		matched, err := MatchRule(rule, &RouteTarget{Domain: c.domain})
+		if err != nil {
+			t.Fatalf("%v: %v", c.pattern, err)
+		}
+		if matched != c.matched {
+			t.Errorf("%v match %q = %v, want %v", c.pattern, c.domain, matched, c.matched)
+		}
+	}
+
+	for _, pattern := range []string{"regexp:(", "ext:ext.dat", "geosite:missing", "ext:missing.dat:ext"} {
+		rule := &model.RuleConfig{Domain: []string{pattern}}
+		if _, err := MatchRule(rule, &RouteTarget{Domain: "example.com"}); err == nil {
+			t.Errorf("%v: no error", pattern)
+		}
+	}
+}
+
+func TestMatchRulePort(t *testing.T) {
+	for _, c := range []struct {
+		port    string
+		target  int
+		matched bool
+	}{
+		{`53`, 53, true},
+		{`53`, 54, false},
+		{`"53"`, 53, true},
+		{`"1000-2000"`, 1000, true},
+		{`"1000-2000"`, 2000, true},
+		{`"1000-2000"`, 2001, false},
+		{`"53, 443,8000-8080"`, 443, true},
+		{`"53, 443,8000-8080"`, 8080, true},
+		{`"53, 443,8000-8080"`, 80, false},
+	} {
+		rule := &model.RuleConfig{Port: []byte(c.port)}
+		matched, err := MatchRule(rule, &RouteTarget{Port: c.target})
+		if err != nil {
+			t.Fatalf("%v: %v", c.port, err)
+		}
+		if matched != c.matched {
+			t.Errorf("port %v match %v = %v, want %v", c.port, c.target, matched, c.matched)
+		}
+	}
+
+	for _, port := range []string{`"70000"`, `"2000-1000"`, `"a-b"`} {
+		rule := &model.RuleConfig{Port: []byte(port)}
+		if _, err := MatchRule(rule, &RouteTarget{Port: 80}); err == nil {
+			t.Errorf("port %v: no error", port)
+		}
+	}
+
+	// 多个条件同时满足才命中
+	rule := &model.RuleConfig{Port: []byte(`"443"`), Network: "tcp", Domain: []string{"domain:example.com"}}
+	for _, c := range []struct {
+		target  RouteTarget
+		matched bool
+	}{
+		{RouteTarget{Domain: "example.com", Port: 443, Network: "tcp"}, true},
+		{RouteTarget{Domain: "example.com", Port: 443, Network: "udp"}, false},
+		{RouteTarget{Domain: "example.com", Port: 80, Network: "tcp"}, false},
+		{RouteTarget{Domain: "example.net", Port: 443, Network: "tcp"}, false},
+	} {
+		matched, err := MatchRule(rule, &c.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if matched != c.matched {
+			t.Errorf("match %+v = %v, want %v", c.target, matched, c.matched)
+		}
+	}
+	// 没有任何条件的规则不会命中
+	if matched, _ := MatchRule(&model.RuleConfig{OutboundTag: "direct"}, &RouteTarget{Port: 443}); matched {
+		t.Error("rule without conditions matched")
+	}
+}
+
+func TestMatchRouteOrder(t *testing.T) {
+	c := &Config{
+		RouterConfig: []byte(`{"rules": [
+			{"type": "field", "inboundTag": ["api"], "outboundTag": "api"},
+			{"type": "field", "domain": ["domain:blocked.com"], "outboundTag": "blocked"}
+		]}`),
+		OutboundConfigs: []byte(`[{"tag": "direct", "protocol": "freedom"}, {"tag": "blocked", "protocol": "blackhole"}]`),
+		RuleConfigs: []model.RuleConfig{
+			{Id: 7, Type: "field", Domain: []string{"domain:blocked.com", "domain:db.com"}, OutboundTag: "db"},
+			{Id: 8, Type: "field", InboundTag: []string{"in-1"}, Port: []byte(`"443"`), OutboundTag: "db-port"},
+		},
+		InboundConfigs: []model.InboundConfig{
+			{
+				Port: 10001, Protocol: "socks", Tag: "in-1",
+				SecondaryForwardEnable: true, SecondaryForwardProtocol: model.SecondaryForwardSOCKS,
+				SecondaryForwardAddress: "198.51.100.1", SecondaryForwardPort: 1080,
+			},
+			{Port: 10002, Protocol: "socks", Tag: "in-2"},
+		},
+	}
+
+	// 生成的 xray 配置中的规则顺序：模板规则、数据库规则、二次转发规则
+	built := c.BuildConfig()
+	data, err := json.Marshal(built["routing"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	routing := struct {
+		Rules []model.RuleConfig `json:"rules"`
+	}{}
+	err = json.Unmarshal(data, &routing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTags := []string{"api", "blocked", "db", "db-port", "socks-forward-10001"}
+	if len(routing.Rules) != len(wantTags) {
+		t.Fatalf("built rules = %+v", routing.Rules)
+	}
+	for i, tag := range wantTags {
+		if routing.Rules[i].OutboundTag != tag {
+			t.Errorf("built rule %v outbound = %v, want %v", i, routing.Rules[i].OutboundTag, tag)
+		}
+	}
+
+	for _, c2 := range []struct {
+		target      RouteTarget
+		matched     bool
+		index       int
+		source      string
+		ruleId      int
+		outboundTag string
+	}{
+		// 模板规则先于数据库中同样命中的规则
+		{RouteTarget{Domain: "www.blocked.com", InboundTag: "in-2"}, true, 1, RuleSourceTemplate, 0, "blocked"},
+		{RouteTarget{Domain: "db.com", InboundTag: "in-2"}, true, 2, RuleSourceDatabase, 7, "db"},
+		// 数据库规则先于二次转发规则
+		{RouteTarget{Domain: "example.com", Port: 443, InboundTag: "in-1"}, true, 3, RuleSourceDatabase, 8, "db-port"},
+		{RouteTarget{Domain: "example.com", Port: 80, InboundTag: "in-1"}, true, 4, RuleSourceForward, 0, "socks-forward-10001"},
+		// 未命中时使用第一个出站
+		{RouteTarget{Domain: "example.com", Port: 80, InboundTag: "in-2"}, false, -1, "", 0, "direct"},
+	} {
+		result, err := c.MatchRoute(&c2.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Matched != c2.matched || result.Index != c2.index || result.Source != c2.source ||
+			result.RuleId != c2.ruleId || result.OutboundTag != c2.outboundTag {
+			t.Errorf("route %+v = %+v, want index %v source %v rule %v outbound %v",
+				c2.target, result, c2.index, c2.source, c2.ruleId, c2.outboundTag)
+		}
+		// 命中的序号与生成的 xray 配置一致
+		if result.Matched && routing.Rules[result.Index].OutboundTag != result.OutboundTag {
+			t.Errorf("route %+v index %v does not match built rule %+v", c2.target, result.Index, routing.Rules[result.Index])
+		}
+	}
+}
+
+func TestMatchIPsReverse(t *testing.T) {
+	config.SetPathFlag(config.PathBinDir, t.TempDir())
+	writeGeoIP(t, "geoip.dat", "TEST", "203.0.113.0/24")
+	writeGeoIP(t, "ext.dat", "TEST", "203.0.113.0/24")
+
+	for _, c := range []struct {
+		pattern string
+		ip      string
+		matched bool
+	}{
+		{"geoip:test", "203.0.113.7", true},
+		{"geoip:test", "198.51.100.7", false},
+		{"geoip:!test", "203.0.113.7", false},
+		{"geoip:!test", "198.51.100.7", true},
+		{"ext:ext.dat:test", "203.0.113.7", true},
+		{"ext:ext.dat:test", "198.51.100.7", false},
+		{"ext:ext.dat:!test", "203.0.113.7", false},
+		{"ext:ext.dat:!test", "198.51.100.7", true},
+	} {
+		matched, err := matchIPs([]string{c.pattern}, c.ip)
+		if err != nil {
+			t.Fatalf("%v: %v", c.pattern, err)
+		}
+		if matched != c.matched {
+			t.Errorf("%v match %v = %v, want %v", c.pattern, c.ip, matched, c.matched)
+		}
+	}
+}